@@ -0,0 +1,127 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+)
+
+// Silence suppresses alerts for paths matching a glob until it expires
+type Silence struct {
+	Pattern   string    `json:"pattern"`
+	Until     time.Time `json:"until"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Silences is the persistent set of active silences
+type Silences struct {
+	Items []*Silence `json:"silences"`
+	path  string
+	mu    sync.RWMutex
+}
+
+// GetDefaultSilencesPath returns the default path of the silences file
+func GetDefaultSilencesPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "fim-silences.json"
+	}
+	return filepath.Join(homeDir, ".fim", "silences.json")
+}
+
+// LoadSilences loads silences from a JSON file. A missing file yields an
+// empty set.
+func LoadSilences(path string) (*Silences, error) {
+	s := &Silences{path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read silences: %v", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse silences: %v", err)
+	}
+	return s, nil
+}
+
+// Add adds a silence for the pattern lasting the given duration
+func (s *Silences) Add(pattern string, duration time.Duration, reason string) *Silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	silence := &Silence{
+		Pattern:   pattern,
+		Until:     now.Add(duration),
+		Reason:    reason,
+		CreatedAt: now,
+	}
+	s.Items = append(s.Items, silence)
+	return silence
+}
+
+// Remove removes all silences with the given pattern and returns how many
+// were removed
+func (s *Silences) Remove(pattern string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.Items[:0]
+	for _, silence := range s.Items {
+		if silence.Pattern != pattern {
+			kept = append(kept, silence)
+		}
+	}
+	removed := len(s.Items) - len(kept)
+	s.Items = kept
+	return removed
+}
+
+// Active returns the silences that have not yet expired
+func (s *Silences) Active() []*Silence {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	active := make([]*Silence, 0, len(s.Items))
+	for _, silence := range s.Items {
+		if now.Before(silence.Until) {
+			active = append(active, silence)
+		}
+	}
+	return active
+}
+
+// Match returns the active silence covering path, if any
+func (s *Silences) Match(path string) *Silence {
+	for _, silence := range s.Active() {
+		if config.MatchPath(silence.Pattern, path) {
+			return silence
+		}
+	}
+	return nil
+}
+
+// Save writes the active silences back to disk, dropping expired ones
+func (s *Silences) Save() error {
+	active := s.Active()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Items = active
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0644)
+}
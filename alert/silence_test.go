@@ -0,0 +1,55 @@
+package alert
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSilenceExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "silences.json")
+	silences, err := LoadSilences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	silences.Add("/etc/ssl/*", time.Hour, "rotation")
+	silences.Add("/etc/hosts", time.Hour, "")
+	silences.Add("/var/lib/*", -time.Second, "expired")
+
+	tests := []struct {
+		path    string
+		pattern string
+	}{
+		{"/etc/ssl/cert.pem", "/etc/ssl/*"},
+		{"/etc/hosts", "/etc/hosts"},
+		{"/etc/passwd", ""},
+		{"/var/lib/dpkg", ""},
+	}
+	for _, tt := range tests {
+		pattern := ""
+		if silence := silences.Match(tt.path); silence != nil {
+			pattern = silence.Pattern
+		}
+		if pattern != tt.pattern {
+			t.Errorf("Match(%s) = %q, want %q", tt.path, pattern, tt.pattern)
+		}
+	}
+	if n := len(silences.Active()); n != 2 {
+		t.Errorf("%d active silences, want 2", n)
+	}
+
+	// Expired silences are dropped when saved
+	if err := silences.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := LoadSilences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Items) != 2 {
+		t.Errorf("loaded %d silences, want 2", len(loaded.Items))
+	}
+	if n := loaded.Remove("/etc/hosts"); n != 1 || loaded.Match("/etc/hosts") != nil {
+		t.Errorf("Remove removed %d silences", n)
+	}
+}
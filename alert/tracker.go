@@ -0,0 +1,223 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// Status is the alert state of a path
+type Status string
+
+const (
+	StatusNew      Status = "new"
+	StatusPresent  Status = "present"
+	StatusResolved Status = "resolved"
+)
+
+// Entry records the drift of one path from the baseline
+type Entry struct {
+	Path        string             `json:"path"`
+	Type        monitor.ChangeType `json:"type"`
+	Fingerprint string             `json:"fingerprint"`
+	FirstSeen   time.Time          `json:"first_seen"`
+	LastSeen    time.Time          `json:"last_seen"`
+	NotifiedAt  time.Time          `json:"notified_at,omitempty"`
+	Container   *monitor.Container `json:"container,omitempty"` // container holding the path; nil for the host
+}
+
+// Result is the outcome of feeding one scan's changes to the tracker
+type Result struct {
+	Alerts    []*monitor.Change // changes to notify about
+	Resolved  []*Entry          // paths whose drift has disappeared
+	Silenced  []*monitor.Change // changes held back by a silence
+	Throttled int               // changes held back by the throttle
+}
+
+// Tracker remembers which changes have already been alerted on so that
+// the daemon only notifies on transitions: a path drifting from the
+// baseline, drifting differently, or returning to its baseline state.
+type Tracker struct {
+	Entries map[string]*Entry `json:"entries"`
+
+	path   string
+	limit  int
+	window time.Duration
+	sent   []time.Time
+	mu     sync.Mutex
+}
+
+// GetDefaultStatePath returns the default path of the alert state file
+func GetDefaultStatePath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "fim-alerts.json"
+	}
+	return filepath.Join(homeDir, ".fim", "alerts.json")
+}
+
+// LoadTracker loads the alert state from path. At most limit alerts are
+// released per window; a limit of 0 disables throttling.
+func LoadTracker(path string, limit int, window time.Duration) (*Tracker, error) {
+	t := &Tracker{
+		Entries: make(map[string]*Entry),
+		path:    path,
+		limit:   limit,
+		window:  window,
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alert state: %v", err)
+	}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("failed to parse alert state: %v", err)
+	}
+	if t.Entries == nil {
+		t.Entries = make(map[string]*Entry)
+	}
+	return t, nil
+}
+
+// Fingerprint identifies the state a path has drifted to, so that a path
+// that changes again is alerted on again
+func Fingerprint(change *monitor.Change) string {
+	info := change.NewInfo
+	if info == nil {
+		return change.Type.String()
+	}
+	return fmt.Sprintf("%s:%s:%d:%o:%d:%d", change.Type, info.Hash, info.Size, info.Mode, info.UID, info.GID)
+}
+
+// Key identifies the path of a change in the alert state. Paths in
+// containers are kept apart from the host's and from each other.
+func Key(change *monitor.Change) string {
+	if change.Container != nil {
+		return change.Container.ID + ":" + change.Path
+	}
+	return change.Path
+}
+
+// Update feeds the changes of one scan to the tracker and returns which of
+// them should be notified. silences may be nil.
+func (t *Tracker) Update(changes []*monitor.Change, silences *Silences) *Result {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	result := &Result{}
+	seen := make(map[string]bool, len(changes))
+
+	for _, change := range changes {
+		key := Key(change)
+		seen[key] = true
+		fingerprint := Fingerprint(change)
+
+		entry, exists := t.Entries[key]
+		if !exists || entry.Fingerprint != fingerprint {
+			// New drift, or the path drifted to a different state
+			entry = &Entry{
+				Path:        change.Path,
+				Type:        change.Type,
+				Fingerprint: fingerprint,
+				FirstSeen:   now,
+				Container:   change.Container,
+			}
+			t.Entries[key] = entry
+		}
+		entry.LastSeen = now
+
+		// Already notified about this state
+		if !entry.NotifiedAt.IsZero() {
+			continue
+		}
+
+		if silences != nil && silences.Match(change.Path) != nil {
+			result.Silenced = append(result.Silenced, change)
+			continue
+		}
+		if !t.allow(now) {
+			result.Throttled++
+			continue
+		}
+
+		entry.NotifiedAt = now
+		result.Alerts = append(result.Alerts, change)
+	}
+
+	// Paths that no longer differ from the baseline are resolved
+	for key, entry := range t.Entries {
+		if !seen[key] {
+			if !entry.NotifiedAt.IsZero() {
+				result.Resolved = append(result.Resolved, entry)
+			}
+			delete(t.Entries, key)
+		}
+	}
+	sort.Slice(result.Resolved, func(i, j int) bool {
+		return result.Resolved[i].Path < result.Resolved[j].Path
+	})
+
+	return result
+}
+
+// allow reports whether another alert fits into the throttle window and
+// records it if so
+func (t *Tracker) allow(now time.Time) bool {
+	if t.limit <= 0 {
+		return true
+	}
+
+	// Forget alerts that have left the window
+	cutoff := now.Add(-t.window)
+	kept := t.sent[:0]
+	for _, sent := range t.sent {
+		if sent.After(cutoff) {
+			kept = append(kept, sent)
+		}
+	}
+	t.sent = kept
+
+	if len(t.sent) >= t.limit {
+		return false
+	}
+	t.sent = append(t.sent, now)
+	return true
+}
+
+// Status returns the alert status of a path
+func (t *Tracker) Status(path string) Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, exists := t.Entries[path]
+	switch {
+	case !exists:
+		return StatusResolved
+	case entry.NotifiedAt.IsZero():
+		return StatusNew
+	default:
+		return StatusPresent
+	}
+}
+
+// Save writes the alert state to disk
+func (t *Tracker) Save() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.path, data, 0644)
+}
@@ -0,0 +1,181 @@
+package alert
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// modified returns a modification of path to content with the given hash
+func modified(path, hash string) *monitor.Change {
+	info := &monitor.FileInfo{Path: path, Size: 10, Mode: 0644, Hash: hash, ModTime: 1}
+	return &monitor.Change{Path: path, Type: monitor.ModifiedFile, NewInfo: info}
+}
+
+// paths returns the paths of changes, space separated
+func paths(changes []*monitor.Change) string {
+	var names []string
+	for _, change := range changes {
+		names = append(names, change.Path)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestFingerprint(t *testing.T) {
+	base := modified("/etc/hosts", "a")
+	tests := []struct {
+		name   string
+		edit   func(info *monitor.FileInfo, change *monitor.Change)
+		differ bool
+	}{
+		{"modification time", func(info *monitor.FileInfo, _ *monitor.Change) { info.ModTime = 2 }, false},
+		{"path", func(info *monitor.FileInfo, change *monitor.Change) { change.Path = "/etc/passwd" }, false},
+		{"hash", func(info *monitor.FileInfo, _ *monitor.Change) { info.Hash = "b" }, true},
+		{"size", func(info *monitor.FileInfo, _ *monitor.Change) { info.Size = 11 }, true},
+		{"mode", func(info *monitor.FileInfo, _ *monitor.Change) { info.Mode = 0600 }, true},
+		{"owner", func(info *monitor.FileInfo, _ *monitor.Change) { info.UID = 1000 }, true},
+		{"group", func(info *monitor.FileInfo, _ *monitor.Change) { info.GID = 1000 }, true},
+		{"type", func(_ *monitor.FileInfo, change *monitor.Change) { change.Type = monitor.PermissionChange }, true},
+		{"deletion", func(_ *monitor.FileInfo, change *monitor.Change) { change.NewInfo = nil }, true},
+	}
+	for _, tt := range tests {
+		change := modified("/etc/hosts", "a")
+		tt.edit(change.NewInfo, change)
+		if differ := Fingerprint(change) != Fingerprint(base); differ != tt.differ {
+			t.Errorf("%s: fingerprints differ %v, want %v", tt.name, differ, tt.differ)
+		}
+	}
+}
+
+func TestUpdateAlertsOnTransitions(t *testing.T) {
+	tracker, err := LoadTracker(filepath.Join(t.TempDir(), "alerts.json"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := &monitor.Container{ID: "web"}
+	inWeb := func(change *monitor.Change) *monitor.Change {
+		change.Container = web
+		return change
+	}
+	touched := modified("/etc/passwd", "a")
+	touched.NewInfo.ModTime = 2
+
+	scans := []struct {
+		name     string
+		changes  []*monitor.Change
+		alerts   string
+		resolved int
+	}{
+		{"new drift", []*monitor.Change{modified("/etc/hosts", "a"), modified("/etc/passwd", "a")}, "/etc/hosts /etc/passwd", 0},
+		{"unchanged drift", []*monitor.Change{modified("/etc/hosts", "a"), modified("/etc/passwd", "a")}, "", 0},
+		{"touched only", []*monitor.Change{modified("/etc/hosts", "a"), touched}, "", 0},
+		{"drifted again", []*monitor.Change{modified("/etc/hosts", "b"), modified("/etc/passwd", "a")}, "/etc/hosts", 0},
+		{"same path in a container", []*monitor.Change{modified("/etc/hosts", "b"), modified("/etc/passwd", "a"),
+			inWeb(modified("/etc/hosts", "b"))}, "/etc/hosts", 0},
+		{"restored", []*monitor.Change{inWeb(modified("/etc/hosts", "b"))}, "", 2},
+	}
+	for _, scan := range scans {
+		result := tracker.Update(scan.changes, nil)
+		if got := paths(result.Alerts); got != scan.alerts {
+			t.Errorf("%s: alerts %q, want %q", scan.name, got, scan.alerts)
+		}
+		if len(result.Resolved) != scan.resolved {
+			t.Errorf("%s: %d resolved, want %d", scan.name, len(result.Resolved), scan.resolved)
+		}
+	}
+	if status := tracker.Status("/etc/hosts"); status != StatusResolved {
+		t.Errorf("status of a restored path %s, want resolved", status)
+	}
+	if status := tracker.Status("web:/etc/hosts"); status != StatusPresent {
+		t.Errorf("status of the container's path %s, want present", status)
+	}
+}
+
+func TestThrottledChangesCarryOver(t *testing.T) {
+	tracker, err := LoadTracker(filepath.Join(t.TempDir(), "alerts.json"), 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	burst := []*monitor.Change{modified("/etc/a", "a"), modified("/etc/b", "a"), modified("/etc/c", "a")}
+
+	scans := []struct {
+		name      string
+		elapsed   time.Duration // moves the alerts sent so far into the past
+		alerts    string
+		throttled int
+		status    Status // of the throttled /etc/c
+	}{
+		{"burst", 0, "/etc/a /etc/b", 1, StatusNew},
+		{"within the window", 0, "", 1, StatusNew},
+		{"after the window", 2 * time.Hour, "/etc/c", 0, StatusPresent},
+		{"nothing left", 2 * time.Hour, "", 0, StatusPresent},
+	}
+	for _, scan := range scans {
+		for i := range tracker.sent {
+			tracker.sent[i] = tracker.sent[i].Add(-scan.elapsed)
+		}
+		result := tracker.Update(burst, nil)
+		if got := paths(result.Alerts); got != scan.alerts || result.Throttled != scan.throttled {
+			t.Errorf("%s: alerts %q with %d throttled, want %q with %d",
+				scan.name, got, result.Throttled, scan.alerts, scan.throttled)
+		}
+		if status := tracker.Status("/etc/c"); status != scan.status {
+			t.Errorf("%s: status of /etc/c %s, want %s", scan.name, status, scan.status)
+		}
+	}
+}
+
+func TestSilencedChangesCarryOver(t *testing.T) {
+	dir := t.TempDir()
+	tracker, err := LoadTracker(filepath.Join(dir, "alerts.json"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	silences, err := LoadSilences(filepath.Join(dir, "silences.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	silence := silences.Add("/etc/ssl/*", time.Hour, "certificate rotation")
+	changes := []*monitor.Change{modified("/etc/hosts", "a"), modified("/etc/ssl/cert.pem", "a")}
+
+	result := tracker.Update(changes, silences)
+	if paths(result.Alerts) != "/etc/hosts" || paths(result.Silenced) != "/etc/ssl/cert.pem" {
+		t.Fatalf("alerts %q, silenced %q", paths(result.Alerts), paths(result.Silenced))
+	}
+	result = tracker.Update(changes, silences)
+	if len(result.Alerts) != 0 || paths(result.Silenced) != "/etc/ssl/cert.pem" {
+		t.Fatalf("while silenced: alerts %q, silenced %q", paths(result.Alerts), paths(result.Silenced))
+	}
+
+	// The drift is alerted on once the silence expires
+	silence.Until = time.Now().Add(-time.Second)
+	result = tracker.Update(changes, silences)
+	if paths(result.Alerts) != "/etc/ssl/cert.pem" || len(result.Silenced) != 0 {
+		t.Errorf("after expiry: alerts %q, silenced %q", paths(result.Alerts), paths(result.Silenced))
+	}
+}
+
+func TestTrackerSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	tracker, err := LoadTracker(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := []*monitor.Change{modified("/etc/hosts", "a")}
+	tracker.Update(changes, nil)
+	if err := tracker.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// A restarted daemon does not alert on the same drift again
+	loaded, err := LoadTracker(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := loaded.Update(changes, nil); len(result.Alerts) != 0 {
+		t.Errorf("alerted again after a restart: %q", paths(result.Alerts))
+	}
+}
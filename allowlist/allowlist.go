@@ -0,0 +1,340 @@
+package allowlist
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/ioc"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+)
+
+// Kind is added to the kinds of a new file found on an allowlist
+const Kind = "known_good"
+
+// indexExt is the extension of index files, which are named
+// <list>.<algorithm>.idx
+const indexExt = ".idx"
+
+// algorithmSizes maps the supported algorithms to their digest sizes
+var algorithmSizes = map[string]int{"sha256": 32, "sha1": 20, "md5": 16}
+
+// validName matches names of imported lists
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// listIndex is an open index and the list it belongs to
+type listIndex struct {
+	list      string
+	algorithm string
+	index     *Index
+}
+
+// Allowlist matches new files against imported known-good hash sets
+type Allowlist struct {
+	indexes  []*listIndex
+	severity monitor.Severity
+	report   bool
+}
+
+// GetDefaultDir returns the default directory of allowlist indexes
+func GetDefaultDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "fim-allowlist"
+	}
+	return filepath.Join(homeDir, ".fim", "allowlist")
+}
+
+// Open opens the indexes imported with 'fim allowlist import'. The
+// allowlist must be closed after use.
+func Open(cfg *config.Config) (*Allowlist, error) {
+	severity, err := monitor.ParseSeverity(cfg.Allowlist.Severity)
+	if err != nil {
+		return nil, fmt.Errorf("invalid [allowlist] severity: %v", err)
+	}
+	a := &Allowlist{severity: severity, report: cfg.Allowlist.Report}
+
+	paths, err := Indexes(cfg.Allowlist.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		list, algorithm, _ := parseIndexName(path)
+		index, err := OpenIndex(path)
+		if err != nil {
+			a.Close()
+			return nil, err
+		}
+		if index.Size() != algorithmSizes[algorithm] {
+			index.Close()
+			a.Close()
+			return nil, fmt.Errorf("allowlist index %s does not hold %s digests", path, algorithm)
+		}
+		a.indexes = append(a.indexes, &listIndex{list: list, algorithm: algorithm, index: index})
+	}
+
+	// Check the digest the scan already computed first
+	sort.SliceStable(a.indexes, func(i, j int) bool {
+		return a.indexes[i].algorithm == "sha256" && a.indexes[j].algorithm != "sha256"
+	})
+	return a, nil
+}
+
+// Enabled reports whether any list is loaded
+func (a *Allowlist) Enabled() bool {
+	return len(a.indexes) > 0
+}
+
+// Close closes the indexes
+func (a *Allowlist) Close() error {
+	for _, ix := range a.indexes {
+		ix.index.Close()
+	}
+	a.indexes = nil
+	return nil
+}
+
+// Lookup returns the name of the list holding the digest of a scanned
+// file. The file is only read again if a list holds md5 or sha1 digests.
+func (a *Allowlist) Lookup(info *monitor.FileInfo) (string, bool, error) {
+	if info == nil || info.IsDir || info.IsSymlink || info.Hash == "" {
+		return "", false, nil
+	}
+
+	sums := map[string][]byte{}
+	if sum, err := hex.DecodeString(info.Hash); err == nil {
+		sums["sha256"] = sum
+	}
+	for _, ix := range a.indexes {
+		sum, ok := sums[ix.algorithm]
+		if !ok {
+			var err error
+			if sum, err = digest(info.SourcePath(), ix.algorithm); err != nil {
+				// The file is gone or unreadable; it cannot be vouched for
+				return "", false, nil
+			}
+			sums[ix.algorithm] = sum
+		}
+		found, err := ix.index.Contains(sum)
+		if err != nil {
+			return "", false, err
+		}
+		if found {
+			return ix.list, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// Apply lowers the severity of new files found on an allowlist, or drops
+// them if [allowlist] report is off. Files matching a known-bad hash are
+// left alone. It returns the remaining changes and the number of
+// allowlisted files.
+func (a *Allowlist) Apply(changes *storage.Changes) (*storage.Changes, int, error) {
+	if !a.Enabled() {
+		return changes, 0, nil
+	}
+
+	allowed := make(map[*monitor.Change]bool)
+	for _, change := range changes.Details {
+		if change.Type != monitor.NewFile || change.IOC != nil {
+			continue
+		}
+		_, found, err := a.Lookup(change.NewInfo)
+		if err != nil {
+			return nil, 0, err
+		}
+		if found {
+			allowed[change] = true
+			change.Severity = a.severity
+			change.Kinds = append(change.Kinds, Kind)
+		}
+	}
+
+	if !a.report && len(allowed) > 0 {
+		changes = changes.Filter(func(change *monitor.Change) bool {
+			return !allowed[change]
+		})
+	}
+	return changes, len(allowed), nil
+}
+
+// Indexes returns the index files in the allowlist directory, or the
+// default directory if dir is empty
+func Indexes(dir string) ([]string, error) {
+	if dir == "" {
+		dir = GetDefaultDir()
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allowlist directory: %v", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if _, _, ok := parseIndexName(path); ok && entry.Type().IsRegular() {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// parseIndexName splits the file name of an index into list and algorithm
+func parseIndexName(path string) (string, string, bool) {
+	base := strings.TrimSuffix(filepath.Base(path), indexExt)
+	if base == filepath.Base(path) {
+		return "", "", false
+	}
+	ext := filepath.Ext(base)
+	algorithm := strings.TrimPrefix(ext, ".")
+	if _, ok := algorithmSizes[algorithm]; !ok {
+		return "", "", false
+	}
+	list := strings.TrimSuffix(base, ext)
+	return list, algorithm, validName.MatchString(list)
+}
+
+// indexPath returns the path of the index of a list for one algorithm
+func indexPath(dir, list, algorithm string) string {
+	return filepath.Join(dir, list+"."+algorithm+indexExt)
+}
+
+// Import reads a known-good hash list in the given format (see ioc.Read)
+// and writes one index per algorithm under name, replacing an earlier
+// import of the same name. It returns the number of unique digests per
+// algorithm, with a *ioc.SkippedError if malformed lines were skipped.
+func Import(dir, name string, r io.Reader, format string) (map[string]int, error) {
+	if dir == "" {
+		dir = GetDefaultDir()
+	}
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("invalid list name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+
+	// Collect the digests of each algorithm in one flat buffer
+	buffers := make(map[string][]byte)
+	err := ioc.Read(r, format, func(indicator *monitor.Indicator) error {
+		sum, err := hex.DecodeString(indicator.Hash)
+		if err != nil {
+			return nil
+		}
+		buffers[indicator.Algorithm] = append(buffers[indicator.Algorithm], sum...)
+		return nil
+	})
+	skipped, _ := err.(*ioc.SkippedError)
+	if err != nil && skipped == nil {
+		return nil, err
+	}
+	if len(buffers) == 0 {
+		return nil, fmt.Errorf("no hashes found")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create allowlist directory: %v", err)
+	}
+	counts := make(map[string]int)
+	for algorithm, size := range algorithmSizes {
+		path := indexPath(dir, name, algorithm)
+		data, ok := buffers[algorithm]
+		if !ok {
+			// Drop the index of an earlier import of the same name
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to remove allowlist index: %v", err)
+			}
+			continue
+		}
+
+		tmp := filepath.Join(dir, "."+filepath.Base(path)+".tmp")
+		count, err := WriteIndex(tmp, size, data)
+		if err != nil {
+			os.Remove(tmp)
+			return nil, err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return nil, fmt.Errorf("failed to store allowlist index: %v", err)
+		}
+		counts[algorithm] = count
+	}
+	if skipped != nil {
+		return counts, skipped
+	}
+	return counts, nil
+}
+
+// Remove deletes the indexes of an imported list
+func Remove(dir, name string) error {
+	if dir == "" {
+		dir = GetDefaultDir()
+	}
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid list name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+
+	removed := 0
+	for algorithm := range algorithmSizes {
+		err := os.Remove(indexPath(dir, name, algorithm))
+		if err == nil {
+			removed++
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove allowlist index: %v", err)
+		}
+	}
+	if removed == 0 {
+		return fmt.Errorf("no imported allowlist named %s", name)
+	}
+	return nil
+}
+
+// Describe returns the list name, algorithm and digest count of an index
+func Describe(path string) (string, string, int, error) {
+	list, algorithm, ok := parseIndexName(path)
+	if !ok {
+		return "", "", 0, fmt.Errorf("%s is not an allowlist index", path)
+	}
+	index, err := OpenIndex(path)
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer index.Close()
+	return list, algorithm, index.Len(), nil
+}
+
+// digest returns the binary md5 or sha1 digest of a file
+func digest(path, algorithm string) ([]byte, error) {
+	var h hash.Hash
+	switch algorithm {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm: %s", algorithm)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,117 @@
+package allowlist
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/ioc"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+)
+
+// setup writes files holding their names and imports a list for each
+// algorithm: sha256 of a, sha1 of b and md5 of c. It returns the
+// configuration and the scanned files.
+func setup(t *testing.T) (*config.Config, map[string]*monitor.FileInfo) {
+	t.Helper()
+	dir := t.TempDir()
+	files := make(map[string]*monitor.FileInfo)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(name))
+		files[name] = &monitor.FileInfo{Path: path, Size: 1, Mode: 0755, Hash: hex.EncodeToString(sum[:])}
+	}
+
+	sha1Sum, md5Sum := sha1.Sum([]byte("b")), md5.Sum([]byte("c"))
+	lists := map[string]string{
+		"distro":  files["a"].Hash + "  a\n",
+		"vendor":  hex.EncodeToString(sha1Sum[:]) + "  b\n",
+		"archive": hex.EncodeToString(md5Sum[:]) + "  c\n",
+	}
+	cfg := config.DefaultConfig()
+	cfg.Allowlist.Dir = filepath.Join(dir, "allowlist")
+	for name, list := range lists {
+		if _, err := Import(cfg.Allowlist.Dir, name, strings.NewReader(list), ioc.FormatText); err != nil {
+			t.Fatalf("Import %s: %v", name, err)
+		}
+	}
+	return cfg, files
+}
+
+func TestLookupAlgorithms(t *testing.T) {
+	cfg, files := setup(t)
+	a, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer a.Close()
+
+	tests := []struct {
+		name  string
+		info  *monitor.FileInfo
+		list  string
+		found bool
+	}{
+		{"sha256", files["a"], "distro", true},
+		{"sha1", files["b"], "vendor", true},
+		{"md5", files["c"], "archive", true},
+		{"unlisted", files["d"], "", false},
+		{"directory", &monitor.FileInfo{Path: "/", IsDir: true, Hash: files["a"].Hash}, "", false},
+		{"gone", &monitor.FileInfo{Path: files["b"].Path + ".gone", Hash: files["d"].Hash}, "", false},
+	}
+	for _, tt := range tests {
+		list, found, err := a.Lookup(tt.info)
+		if err != nil || list != tt.list || found != tt.found {
+			t.Errorf("%s: Lookup = %q, %v, %v; want %q, %v", tt.name, list, found, err, tt.list, tt.found)
+		}
+	}
+}
+
+func TestApplySeverityAndReport(t *testing.T) {
+	cfg, files := setup(t)
+	newFiles := func() *storage.Changes {
+		changes := &storage.Changes{}
+		for _, name := range []string{"a", "d"} {
+			changes.Add(&monitor.Change{Path: files[name].Path, Type: monitor.NewFile, NewInfo: files[name], Severity: monitor.SeverityHigh})
+		}
+		// A known-bad file is never vouched for
+		changes.Add(&monitor.Change{Path: files["b"].Path, Type: monitor.NewFile, NewInfo: files["b"],
+			Severity: monitor.SeverityCritical, IOC: &monitor.Indicator{Hash: files["b"].Hash}})
+		return changes
+	}
+
+	for _, report := range []bool{true, false} {
+		cfg.Allowlist.Report = report
+		a, err := Open(cfg)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		changes, allowed, err := a.Apply(newFiles())
+		a.Close()
+		if err != nil || allowed != 1 {
+			t.Fatalf("report %v: Apply allowed %d, %v; want 1", report, allowed, err)
+		}
+
+		var got []string
+		for _, change := range changes.Details {
+			got = append(got, filepath.Base(change.Path)+" "+change.Severity.String()+" "+strings.Join(change.Kinds, ","))
+		}
+		want := "a low known_good\nd high \nb critical "
+		if !report {
+			want = "d high \nb critical "
+		}
+		if strings.Join(got, "\n") != want {
+			t.Errorf("report %v: changes\n%s\nwant\n%s", report, strings.Join(got, "\n"), want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package allowlist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// An index file holds the digests of one algorithm in sorted order after a
+// fixed header. A fan-out table of cumulative counts per first byte narrows
+// a lookup to a small range, which is then binary searched with positioned
+// reads, so lists of millions of hashes are neither loaded nor parsed.
+//
+//	magic   [8]byte     "FIMALW\x00\x01"
+//	size    uint32      digest size in bytes (16, 20 or 32)
+//	count   uint32      number of digests
+//	fanout  [256]uint32 digests whose first byte is at most the index
+//	digests [count][size]byte, sorted and unique
+var indexMagic = [8]byte{'F', 'I', 'M', 'A', 'L', 'W', 0, 1}
+
+// indexHeaderSize is the size of the index header in bytes
+const indexHeaderSize = 8 + 4 + 4 + 256*4
+
+// Index is an open on-disk digest index
+type Index struct {
+	file   *os.File
+	size   int
+	count  uint32
+	fanout [256]uint32
+}
+
+// OpenIndex opens an index file and reads its header
+func OpenIndex(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open allowlist index: %v", err)
+	}
+
+	header := make([]byte, indexHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read allowlist index %s: %v", path, err)
+	}
+	if !bytes.Equal(header[:8], indexMagic[:]) {
+		file.Close()
+		return nil, fmt.Errorf("%s is not an allowlist index", path)
+	}
+
+	ix := &Index{
+		file:  file,
+		size:  int(binary.BigEndian.Uint32(header[8:])),
+		count: binary.BigEndian.Uint32(header[12:]),
+	}
+	for i := range ix.fanout {
+		ix.fanout[i] = binary.BigEndian.Uint32(header[16+4*i:])
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read allowlist index %s: %v", path, err)
+	}
+	if ix.size == 0 || ix.size > 64 || ix.fanout[255] != ix.count || !ix.monotonic() ||
+		info.Size() != indexHeaderSize+int64(ix.count)*int64(ix.size) {
+		file.Close()
+		return nil, fmt.Errorf("allowlist index %s is corrupt", path)
+	}
+	return ix, nil
+}
+
+// monotonic reports whether the counts of the fan-out table never
+// decrease, so that every lookup range lies within the digests
+func (ix *Index) monotonic() bool {
+	for i := 1; i < len(ix.fanout); i++ {
+		if ix.fanout[i] < ix.fanout[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// Size returns the size of the digests in the index
+func (ix *Index) Size() int {
+	return ix.size
+}
+
+// Len returns the number of digests in the index
+func (ix *Index) Len() int {
+	return int(ix.count)
+}
+
+// Contains reports whether the index holds a digest
+func (ix *Index) Contains(digest []byte) (bool, error) {
+	if len(digest) != ix.size {
+		return false, nil
+	}
+
+	lo := uint32(0)
+	if digest[0] > 0 {
+		lo = ix.fanout[digest[0]-1]
+	}
+	hi := ix.fanout[digest[0]]
+
+	buf := make([]byte, ix.size)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if _, err := ix.file.ReadAt(buf, indexHeaderSize+int64(mid)*int64(ix.size)); err != nil {
+			return false, fmt.Errorf("failed to read allowlist index: %v", err)
+		}
+		switch c := bytes.Compare(buf, digest); {
+		case c == 0:
+			return true, nil
+		case c < 0:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return false, nil
+}
+
+// Close closes the index file
+func (ix *Index) Close() error {
+	return ix.file.Close()
+}
+
+// digests is a flat buffer of fixed-size digests that sorts in place
+type digests struct {
+	data []byte
+	size int
+	tmp  []byte
+}
+
+// Len implements sort.Interface
+func (d *digests) Len() int {
+	return len(d.data) / d.size
+}
+
+// Less implements sort.Interface
+func (d *digests) Less(i, j int) bool {
+	return bytes.Compare(d.at(i), d.at(j)) < 0
+}
+
+// Swap implements sort.Interface
+func (d *digests) Swap(i, j int) {
+	copy(d.tmp, d.at(i))
+	copy(d.at(i), d.at(j))
+	copy(d.at(j), d.tmp)
+}
+
+// at returns the i-th digest
+func (d *digests) at(i int) []byte {
+	return d.data[i*d.size : (i+1)*d.size]
+}
+
+// WriteIndex sorts a flat buffer of digests of the given size, drops
+// duplicates and writes them as an index file. It returns the number of
+// unique digests written.
+func WriteIndex(path string, size int, data []byte) (int, error) {
+	d := &digests{data: data, size: size, tmp: make([]byte, size)}
+	sort.Sort(d)
+
+	// Drop duplicates in place
+	unique := 0
+	for i := 0; i < d.Len(); i++ {
+		if unique > 0 && bytes.Equal(d.at(i), d.at(unique-1)) {
+			continue
+		}
+		copy(d.at(unique), d.at(i))
+		unique++
+	}
+	d.data = d.data[:unique*size]
+	if uint64(unique) > uint64(^uint32(0)) {
+		return 0, fmt.Errorf("too many digests for one index: %d", unique)
+	}
+
+	header := make([]byte, indexHeaderSize)
+	copy(header, indexMagic[:])
+	binary.BigEndian.PutUint32(header[8:], uint32(size))
+	binary.BigEndian.PutUint32(header[12:], uint32(unique))
+	var fanout [256]uint32
+	for i := 0; i < unique; i++ {
+		fanout[d.at(i)[0]]++
+	}
+	total := uint32(0)
+	for i, n := range fanout {
+		total += n
+		binary.BigEndian.PutUint32(header[16+4*i:], total)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create allowlist index: %v", err)
+	}
+	if _, err := file.Write(header); err != nil {
+		file.Close()
+		return 0, fmt.Errorf("failed to write allowlist index: %v", err)
+	}
+	if _, err := file.Write(d.data); err != nil {
+		file.Close()
+		return 0, fmt.Errorf("failed to write allowlist index: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write allowlist index: %v", err)
+	}
+	return unique, nil
+}
@@ -0,0 +1,119 @@
+package allowlist
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sums returns the sha256 digests of n strings with a prefix
+func sums(prefix string, n int) [][]byte {
+	var digests [][]byte
+	for i := 0; i < n; i++ {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s%d", prefix, i)))
+		digests = append(digests, sum[:])
+	}
+	return digests
+}
+
+// writeTestIndex writes the digests, each twice, as an index
+func writeTestIndex(t *testing.T, digests [][]byte) string {
+	t.Helper()
+	var data []byte
+	for _, d := range digests {
+		data = append(data, d...)
+	}
+	data = append(data, data...)
+	path := filepath.Join(t.TempDir(), "list.sha256.idx")
+	count, err := WriteIndex(path, 32, data)
+	if err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	if count != len(digests) {
+		t.Errorf("WriteIndex wrote %d digests, want %d unique ones", count, len(digests))
+	}
+	return path
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	// The first and last fan-out buckets bound the lookup ranges
+	digests := append(sums("in", 1000), bytes.Repeat([]byte{0x00}, 32), bytes.Repeat([]byte{0xff}, 32))
+	path := writeTestIndex(t, digests)
+
+	ix, err := OpenIndex(path)
+	if err != nil {
+		t.Fatalf("OpenIndex: %v", err)
+	}
+	defer ix.Close()
+	if ix.Size() != 32 || ix.Len() != len(digests) {
+		t.Errorf("index of %d %d-byte digests, want %d of 32", ix.Len(), ix.Size(), len(digests))
+	}
+
+	var want [256]uint32
+	for _, d := range digests {
+		for b := int(d[0]); b < 256; b++ {
+			want[b]++
+		}
+	}
+	if ix.fanout != want {
+		t.Errorf("fan-out table %v, want %v", ix.fanout, want)
+	}
+
+	for _, d := range digests {
+		if found, err := ix.Contains(d); err != nil || !found {
+			t.Fatalf("Contains(%x) = %v, %v; want true", d, found, err)
+		}
+	}
+	for _, d := range sums("out", 1000) {
+		if found, err := ix.Contains(d); err != nil || found {
+			t.Fatalf("Contains(%x) = %v, %v; want false", d, found, err)
+		}
+	}
+	if found, _ := ix.Contains(digests[0][:20]); found {
+		t.Error("a digest of another size was found")
+	}
+}
+
+func TestOpenIndexRejectsCorruption(t *testing.T) {
+	valid, err := os.ReadFile(writeTestIndex(t, sums("in", 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(edit func([]byte) []byte) []byte {
+		return edit(append([]byte(nil), valid...))
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated header", valid[:indexHeaderSize-1]},
+		{"truncated digests", valid[:len(valid)-1]},
+		{"extra data", append(append([]byte(nil), valid...), 0)},
+		{"bad magic", corrupt(func(b []byte) []byte { b[0] = 'X'; return b })},
+		{"zero digest size", corrupt(func(b []byte) []byte {
+			binary.BigEndian.PutUint32(b[8:], 0)
+			return b
+		})},
+		{"non-monotonic fan-out", corrupt(func(b []byte) []byte {
+			// The total still matches the count
+			binary.BigEndian.PutUint32(b[16+4*0x80:], 1000)
+			return b
+		})},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "list.sha256.idx")
+		if err := os.WriteFile(path, tt.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if ix, err := OpenIndex(path); err == nil {
+			ix.Close()
+			t.Errorf("%s: index opened", tt.name)
+		}
+	}
+}
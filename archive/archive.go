@@ -0,0 +1,365 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+)
+
+// Whiteout prefixes of the OCI image layer format. A ".wh.<name>" entry
+// removes <name> of the lower layers; an opaque whiteout in a directory
+// removes everything the lower layers put in it.
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// maxLinks bounds the symlinks followed when resolving a path in an image
+const maxLinks = 40
+
+// Load reads the monitored paths of a tar archive, optionally gzip
+// compressed, or of an OCI image layout directory into a baseline. The
+// files are recorded as if the archive were extracted at /, so the
+// baseline can be compared with scans of a container running the image.
+func Load(cfg *config.Config, source string) (*storage.Baseline, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %v", err)
+	}
+
+	fs := newFilesystem()
+	if info.IsDir() {
+		layers, err := Layers(source)
+		if err != nil {
+			return nil, err
+		}
+		for i, layer := range layers {
+			if err := fs.applyBlob(source, layer); err != nil {
+				return nil, fmt.Errorf("layer %d (%s): %v", i+1, layer.Digest, err)
+			}
+		}
+	} else {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open image: %v", err)
+		}
+		defer file.Close()
+		if err := fs.apply(file); err != nil {
+			return nil, fmt.Errorf("%s: %v", source, err)
+		}
+	}
+	return fs.baseline(cfg), nil
+}
+
+// filesystem is the merged content of the layers applied so far
+type filesystem struct {
+	files    map[string]*monitor.FileInfo
+	targets  map[string]string          // link targets of symlinks
+	children map[string]map[string]bool // entries of each directory
+}
+
+// newFilesystem creates an empty filesystem
+func newFilesystem() *filesystem {
+	return &filesystem{
+		files:    make(map[string]*monitor.FileInfo),
+		targets:  make(map[string]string),
+		children: make(map[string]map[string]bool),
+	}
+}
+
+// layer is the content of one layer before it is merged
+type layer struct {
+	files     []*monitor.FileInfo
+	targets   map[string]string
+	whiteouts []string // paths removed from the lower layers
+	opaque    []string // directories emptied of the lower layers' entries
+}
+
+// apply reads a layer, optionally gzip compressed, and merges it
+func (fs *filesystem) apply(r io.Reader) error {
+	tr, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	l, err := fs.readLayer(tr)
+	if err != nil {
+		return err
+	}
+
+	// Whiteouts only hide what lower layers added
+	for _, dir := range l.opaque {
+		fs.remove(dir, false)
+	}
+	for _, name := range l.whiteouts {
+		fs.remove(name, true)
+	}
+	for _, info := range l.files {
+		if existing, ok := fs.files[info.Path]; ok && existing.IsDir && !info.IsDir {
+			// A file replacing a directory replaces its content too
+			fs.remove(info.Path, true)
+		}
+		fs.add(info)
+		delete(fs.targets, info.Path)
+		if target, ok := l.targets[info.Path]; ok {
+			fs.targets[info.Path] = target
+		}
+	}
+	return nil
+}
+
+// add records an entry, replacing any earlier one of the same path. The
+// entry is listed in its directory, and so are parents without an entry
+// of their own, so that removing a directory finds everything below it.
+func (fs *filesystem) add(info *monitor.FileInfo) {
+	fs.files[info.Path] = info
+	for name := info.Path; name != "/"; name = path.Dir(name) {
+		dir := path.Dir(name)
+		if fs.children[dir][name] {
+			break
+		}
+		if fs.children[dir] == nil {
+			fs.children[dir] = make(map[string]bool)
+		}
+		fs.children[dir][name] = true
+	}
+}
+
+// remove deletes everything below dir, and dir itself if self is set
+func (fs *filesystem) remove(dir string, self bool) {
+	for name := range fs.children[dir] {
+		fs.remove(name, true)
+	}
+	delete(fs.children, dir)
+	if self {
+		delete(fs.files, dir)
+		delete(fs.targets, dir)
+		delete(fs.children[path.Dir(dir)], dir)
+	}
+}
+
+// decompress returns a tar reader of an uncompressed or gzip compressed
+// stream
+func decompress(r io.Reader) (*tar.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip stream: %v", err)
+		}
+		return tar.NewReader(gz), nil
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return nil, fmt.Errorf("zstd compressed layers are not supported")
+	}
+	return tar.NewReader(br), nil
+}
+
+// readLayer reads the entries of a layer, hashing regular files
+func (fs *filesystem) readLayer(tr *tar.Reader) (*layer, error) {
+	l := &layer{targets: make(map[string]string)}
+	byPath := make(map[string]*monitor.FileInfo)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid tar archive: %v", err)
+		}
+
+		name := clean(hdr.Name)
+		dir, base := path.Split(name)
+		switch {
+		case base == opaqueWhiteout:
+			l.opaque = append(l.opaque, path.Clean(dir))
+			continue
+		case strings.HasPrefix(base, whiteoutPrefix):
+			l.whiteouts = append(l.whiteouts, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+			continue
+		}
+
+		info := &monitor.FileInfo{
+			Path:     name,
+			Size:     hdr.Size,
+			Mode:     uint32(hdr.FileInfo().Mode()),
+			ModTime:  hdr.ModTime.Unix(),
+			UID:      hdr.Uid,
+			GID:      hdr.Gid,
+			Archived: true,
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			info.IsDir = true
+		case tar.TypeSymlink:
+			info.IsSymlink = true
+			info.Size = int64(len(hdr.Linkname))
+			l.targets[name] = hdr.Linkname
+		case tar.TypeLink:
+			// Hard links share the content of an earlier entry
+			target, ok := byPath[clean(hdr.Linkname)]
+			if !ok {
+				target, ok = fs.files[clean(hdr.Linkname)]
+			}
+			if ok {
+				info.Mode, info.Size, info.Hash = target.Mode, target.Size, target.Hash
+			}
+		case tar.TypeReg:
+			h := sha256.New()
+			if _, err := io.Copy(h, tr); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %v", name, err)
+			}
+			info.Hash = hex.EncodeToString(h.Sum(nil))
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		default:
+			// Extended headers and the like are not files
+			continue
+		}
+		byPath[name] = info
+		l.files = append(l.files, info)
+	}
+	return l, nil
+}
+
+// clean turns the name of an archive entry, such as "./etc/passwd" or
+// "etc/", into an absolute path
+func clean(name string) string {
+	return path.Clean("/" + name)
+}
+
+// resolve returns a path with all symlinks resolved, as seen from inside
+// the image
+func (fs *filesystem) resolve(name string) (string, error) {
+	resolved := "/"
+	pending := strings.Split(name, "/")
+	for links := 0; len(pending) > 0; {
+		elem := pending[0]
+		pending = pending[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, elem)
+		info, ok := fs.files[next]
+		if !ok && next != "/" {
+			return "", fmt.Errorf("%s: no such file or directory", next)
+		}
+		if info == nil || !info.IsSymlink {
+			resolved = next
+			continue
+		}
+
+		if links++; links > maxLinks {
+			return "", fmt.Errorf("too many levels of symbolic links: %s", name)
+		}
+		target := fs.targets[next]
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+		pending = append(strings.Split(target, "/"), pending...)
+	}
+	return resolved, nil
+}
+
+// baseline returns the monitored files, selected and recorded as a scan of
+// an extracted copy would
+func (fs *filesystem) baseline(cfg *config.Config) *storage.Baseline {
+	baseline := storage.NewBaseline()
+
+	// A monitored path that is a symlink is followed, as by the scanner
+	tops := make([]string, 0, len(cfg.Monitor.Paths))
+	for _, top := range cfg.Monitor.Paths {
+		top = clean(top)
+		if info, ok := fs.files[top]; ok && info.IsSymlink {
+			if resolved, err := fs.resolve(top); err == nil {
+				top = resolved
+			}
+		}
+		fs.addParents(top)
+		tops = append(tops, top)
+	}
+
+	names := make([]string, 0, len(fs.files))
+	for name := range fs.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, top := range tops {
+		prefix := strings.TrimSuffix(top, "/") + "/"
+		for _, name := range names {
+			if name != top && !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			if fs.excluded(cfg, name, top) {
+				continue
+			}
+
+			info := *fs.files[name]
+			if info.IsSymlink {
+				// Symlinks are recorded with their target, as for live scans
+				if target, err := fs.resolve(name); err == nil {
+					info.Path = fmt.Sprintf("%s -> %s", name, target)
+				}
+			}
+			baseline.AddFile(&info)
+		}
+	}
+	return baseline
+}
+
+// addParents records directories that layers create implicitly, by
+// adding files below them without an entry of their own. Their attributes
+// are made up, so they are marked as implicit and compared by existence
+// only.
+func (fs *filesystem) addParents(top string) {
+	prefix := strings.TrimSuffix(top, "/") + "/"
+	for name := range fs.files {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		for dir := path.Dir(name); len(dir) >= len(top) && dir != "/"; dir = path.Dir(dir) {
+			if _, ok := fs.files[dir]; ok {
+				break
+			}
+			fs.add(&monitor.FileInfo{
+				Path:     dir,
+				Mode:     uint32(os.ModeDir | 0755),
+				IsDir:    true,
+				Implicit: true,
+				Archived: true,
+			})
+		}
+	}
+}
+
+// excluded reports whether a path or one of its parents below the
+// monitored path is excluded, as the scanner skips excluded directories
+func (fs *filesystem) excluded(cfg *config.Config, name, top string) bool {
+	for {
+		if cfg.IsExcluded(name) {
+			return true
+		}
+		if len(name) <= len(top) || name == "/" {
+			return false
+		}
+		name = path.Dir(name)
+	}
+}
@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// entry is a tar entry of a test layer; content of "->x" makes a symlink
+// to x, and a name ending in "/" a directory
+type entry struct {
+	name    string
+	content string
+}
+
+// buildLayer writes entries as an uncompressed layer
+func buildLayer(t *testing.T, entries ...entry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, ModTime: time.Unix(1700000000, 0), Typeflag: tar.TypeReg, Size: int64(len(e.content))}
+		switch {
+		case e.name[len(e.name)-1] == '/':
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0755, 0
+		case len(e.content) > 2 && e.content[:2] == "->":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.content[2:], 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			tw.Write([]byte(e.content))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestApplyWhiteouts(t *testing.T) {
+	fs := newFilesystem()
+	layers := [][]entry{
+		{{"etc/", ""}, {"etc/app/", ""}, {"etc/app/a.conf", "a"}, {"etc/app/sub/b.conf", "b"}, {"etc/hosts", "h"}, {"etc/old", "o"}},
+		{{"etc/app/.wh..wh..opq", ""}, {"etc/app/c.conf", "c"}, {"etc/.wh.old", ""}},
+		{{"etc/hosts/", ""}, {"etc/link", "->app/c.conf"}},
+	}
+	for i, l := range layers {
+		if err := fs.apply(buildLayer(t, l...)); err != nil {
+			t.Fatalf("layer %d: %v", i+1, err)
+		}
+	}
+
+	for _, name := range []string{"/etc/app/a.conf", "/etc/app/sub", "/etc/app/sub/b.conf", "/etc/old"} {
+		if _, ok := fs.files[name]; ok {
+			t.Errorf("%s was not removed", name)
+		}
+	}
+	for _, name := range []string{"/etc", "/etc/app", "/etc/app/c.conf", "/etc/hosts", "/etc/link"} {
+		if _, ok := fs.files[name]; !ok {
+			t.Errorf("%s is missing", name)
+		}
+	}
+	if !fs.files["/etc/hosts"].IsDir {
+		t.Error("directory did not replace the file")
+	}
+	if len(fs.children["/etc/app"]) != 1 {
+		t.Errorf("/etc/app lists %v", fs.children["/etc/app"])
+	}
+	if target, err := fs.resolve("/etc/link"); err != nil || target != "/etc/app/c.conf" {
+		t.Errorf("resolve(/etc/link) = %s, %v", target, err)
+	}
+}
+
+func TestImplicitDirectoriesMatchAnyAttributes(t *testing.T) {
+	fs := newFilesystem()
+	if err := fs.apply(buildLayer(t, entry{"srv/", ""}, entry{"srv/www/site/index.html", "x"})); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Monitor.Paths = []string{"/srv"}
+	cfg.Monitor.Exclude = nil
+	baseline := fs.baseline(cfg)
+
+	implicit, ok := baseline.GetFile("/srv/www")
+	if !ok || !implicit.Implicit {
+		t.Fatalf("/srv/www = %+v, want an implicit directory", implicit)
+	}
+	if srv, _ := baseline.GetFile("/srv"); srv.Implicit {
+		t.Error("directory with an entry marked as implicit")
+	}
+
+	// A live directory of other attributes is the same directory
+	live := &monitor.FileInfo{Path: "/srv/www", Mode: uint32(os.ModeDir | 0750), ModTime: 1700000100, UID: 33, GID: 33, IsDir: true, Size: 4096}
+	if !implicit.Equals(live) || !live.Equals(implicit) {
+		t.Error("implicit directory differs from a live one")
+	}
+	if implicit.Equals(&monitor.FileInfo{Path: "/srv/www", Mode: 0644}) {
+		t.Error("implicit directory equals a file")
+	}
+}
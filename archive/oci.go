@@ -0,0 +1,214 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Media types of manifests and indexes, in their OCI and Docker variants
+const (
+	mediaTypeIndex          = "application/vnd.oci.image.index.v1+json"
+	mediaTypeManifest       = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// maxDocument bounds the size of index and manifest blobs
+const maxDocument = 4 * 1024 * 1024
+
+// Descriptor references a blob of an OCI image layout
+type Descriptor struct {
+	MediaType string    `json:"mediaType"`
+	Digest    string    `json:"digest"`
+	Size      int64     `json:"size"`
+	Platform  *Platform `json:"platform,omitempty"`
+}
+
+// Platform is the platform an image of an index was built for
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// index is an image index or Docker manifest list
+type index struct {
+	MediaType string        `json:"mediaType"`
+	Manifests []*Descriptor `json:"manifests"`
+}
+
+// manifest is an image manifest
+type manifest struct {
+	MediaType string        `json:"mediaType"`
+	Layers    []*Descriptor `json:"layers"`
+}
+
+// IsLayout reports whether dir is an OCI image layout
+func IsLayout(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "oci-layout"))
+	return err == nil
+}
+
+// Layers returns the layers of the image in an OCI image layout, bottom
+// first. Where the layout holds images for several platforms, the one
+// for this system is chosen.
+func Layers(dir string) ([]*Descriptor, error) {
+	if !IsLayout(dir) {
+		return nil, fmt.Errorf("%s is not an OCI image layout: no oci-layout file", dir)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image index: %v", err)
+	}
+	var top index
+	if err := json.Unmarshal(data, &top); err != nil {
+		return nil, fmt.Errorf("invalid image index: %v", err)
+	}
+
+	// Indexes may nest; follow them down to a manifest
+	manifests := top.Manifests
+	for depth := 0; depth < 8; depth++ {
+		desc, err := selectManifest(manifests)
+		if err != nil {
+			return nil, err
+		}
+		data, err := readDocument(dir, desc)
+		if err != nil {
+			return nil, err
+		}
+
+		switch desc.MediaType {
+		case mediaTypeIndex, mediaTypeDockerList:
+			var nested index
+			if err := json.Unmarshal(data, &nested); err != nil {
+				return nil, fmt.Errorf("invalid image index %s: %v", desc.Digest, err)
+			}
+			manifests = nested.Manifests
+		case mediaTypeManifest, mediaTypeDockerManifest, "":
+			var m manifest
+			if err := json.Unmarshal(data, &m); err != nil {
+				return nil, fmt.Errorf("invalid image manifest %s: %v", desc.Digest, err)
+			}
+			return m.Layers, nil
+		default:
+			return nil, fmt.Errorf("unsupported manifest type %s", desc.MediaType)
+		}
+	}
+	return nil, fmt.Errorf("image indexes are nested too deeply")
+}
+
+// selectManifest picks the manifest for this platform, or the only one
+func selectManifest(manifests []*Descriptor) (*Descriptor, error) {
+	switch len(manifests) {
+	case 0:
+		return nil, fmt.Errorf("image index lists no manifests")
+	case 1:
+		return manifests[0], nil
+	}
+	for _, desc := range manifests {
+		if p := desc.Platform; p != nil && p.OS == runtime.GOOS && p.Architecture == runtime.GOARCH {
+			return desc, nil
+		}
+	}
+	// Fall back to the first image, as runtimes pulling by tag do
+	return manifests[0], nil
+}
+
+// readDocument reads an index or manifest blob
+func readDocument(dir string, desc *Descriptor) ([]byte, error) {
+	if desc.Size > maxDocument {
+		return nil, fmt.Errorf("blob %s is too large: %d bytes", desc.Digest, desc.Size)
+	}
+	blob, err := openBlob(dir, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	return io.ReadAll(blob)
+}
+
+// applyBlob reads a layer blob and merges it into the filesystem
+func (fs *filesystem) applyBlob(dir string, desc *Descriptor) error {
+	blob, err := openBlob(dir, desc)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	if err := fs.apply(blob); err != nil {
+		return err
+	}
+	// Read to the end so that the digest is checked
+	_, err = io.Copy(io.Discard, blob)
+	return err
+}
+
+// blob reads the content of a blob and fails at its end if the content
+// does not match its digest
+type blob struct {
+	file   *os.File
+	hash   hash.Hash
+	digest string
+	read   int64
+	size   int64
+}
+
+// openBlob opens the blob of a descriptor
+func openBlob(dir string, desc *Descriptor) (*blob, error) {
+	algorithm, encoded, ok := strings.Cut(desc.Digest, ":")
+	if !ok || !isHex(encoded) {
+		return nil, fmt.Errorf("invalid digest %q", desc.Digest)
+	}
+	var h hash.Hash
+	switch algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm: %s", algorithm)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "blobs", algorithm, encoded))
+	if err != nil {
+		return nil, fmt.Errorf("missing blob %s: %v", desc.Digest, err)
+	}
+	return &blob{file: file, hash: h, digest: strings.ToLower(encoded), size: desc.Size}, nil
+}
+
+// Read implements io.Reader
+func (b *blob) Read(p []byte) (int, error) {
+	n, err := b.file.Read(p)
+	b.hash.Write(p[:n])
+	b.read += int64(n)
+	if err == io.EOF {
+		if hex.EncodeToString(b.hash.Sum(nil)) != b.digest {
+			return n, fmt.Errorf("blob does not match its digest")
+		}
+		if b.size > 0 && b.read != b.size {
+			return n, fmt.Errorf("blob has %d bytes, expected %d", b.read, b.size)
+		}
+	}
+	return n, err
+}
+
+// Close closes the blob file
+func (b *blob) Close() error {
+	return b.file.Close()
+}
+
+// isHex reports whether s is a non-empty hex string
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,295 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"golang.org/x/sys/unix"
+)
+
+// maxLogTail is how much of the end of the audit log is read when it is
+// first opened
+const maxLogTail = 8 * 1024 * 1024
+
+// Log follows the auditd log and attributes changes to the processes that
+// made them. Watches must be set up in auditd, e.g. with
+// 'auditctl -w /etc -p wa -k fim'.
+type Log struct {
+	path   string
+	window time.Duration
+	key    string
+
+	info   os.FileInfo // identity of the file read so far, to detect rotation
+	offset int64
+	asm    *assembler
+	events map[string][]*Event // successful events by path, oldest first
+
+	// relative holds successful events with names relative to a directory
+	// fd by base name, oldest first
+	relative map[string][]*Event
+
+	since time.Time // time of the previous update; later changes happened after it
+	last  time.Time // time of the latest update
+}
+
+// NewLog creates a follower for the [audit] log. Nothing is read before
+// the first Update.
+func NewLog(cfg *config.Config) *Log {
+	return &Log{
+		path:   cfg.Audit.Log,
+		window: cfg.Audit.Window,
+		key:    cfg.Audit.Key,
+		asm:    newAssembler(),
+		events: make(map[string][]*Event),
+
+		relative: make(map[string][]*Event),
+	}
+}
+
+// Update reads the records appended to the log since the previous update.
+// The first update reads the end of the log, and a rotated log is read
+// from the start.
+func (l *Log) Update() error {
+	now := time.Now()
+	file, err := os.Open(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %v", err)
+	}
+
+	skipPartial := false
+	switch {
+	case l.info == nil:
+		if l.offset = info.Size() - maxLogTail; l.offset > 0 {
+			skipPartial = true
+		} else {
+			l.offset = 0
+		}
+	case !os.SameFile(info, l.info) || info.Size() < l.offset:
+		// Records at the end of the rotated log that were not read yet
+		// are lost
+		l.offset = 0
+		l.asm = newAssembler()
+	}
+	l.info = info
+	l.since, l.last = l.last, now
+	l.prune()
+
+	data, err := io.ReadAll(io.NewSectionReader(file, l.offset, info.Size()-l.offset))
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %v", err)
+	}
+	if skipPartial {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return nil
+		}
+		l.offset += int64(i + 1)
+		data = data[i+1:]
+	}
+
+	// A trailing partial line is read again by the next update
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return nil
+	}
+	l.offset += int64(end + 1)
+	for _, line := range bytes.Split(data[:end], []byte{'\n'}) {
+		for _, e := range l.asm.add(string(line)) {
+			l.record(e)
+		}
+	}
+	return nil
+}
+
+// record indexes a completed event by the paths it touched
+func (l *Log) record(e *Event) {
+	if !e.Success || (l.key != "" && e.Key != l.key) {
+		return
+	}
+	for _, path := range e.Paths {
+		l.events[path] = append(l.events[path], e)
+	}
+	for i, rel := range e.relative {
+		base := filepath.Base(rel.name)
+		if i == 0 || base != filepath.Base(e.relative[i-1].name) {
+			l.relative[base] = append(l.relative[base], e)
+		}
+	}
+}
+
+// prune drops events too old to explain changes found from now on
+func (l *Log) prune() {
+	if l.since.IsZero() {
+		return
+	}
+	cutoff := l.since.Add(-l.window)
+	for _, index := range []map[string][]*Event{l.events, l.relative} {
+		for key, events := range index {
+			i := 0
+			for i < len(events) && events[i].Time.Before(cutoff) {
+				i++
+			}
+			if i == len(events) {
+				delete(index, key)
+			} else if i > 0 {
+				index[key] = events[i:]
+			}
+		}
+	}
+}
+
+// Lookup returns the event that most likely made a change to a file: the
+// event closest to the file's modification time within the window, or else
+// the latest event since the previous update. A zero mtime, as for deleted
+// files, skips the first test.
+func (l *Log) Lookup(path string, mtime time.Time) *Event {
+	events := l.events[path]
+	if candidates := l.relative[filepath.Base(path)]; len(candidates) > 0 {
+		events = append(append([]*Event(nil), events...), resolveRelative(path, candidates)...)
+		sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	if !mtime.IsZero() {
+		var best *Event
+		var bestDistance time.Duration
+		for _, e := range events {
+			distance := e.Time.Sub(mtime)
+			if distance < 0 {
+				distance = -distance
+			}
+			// mtime has a resolution of one second
+			if distance > l.window+time.Second {
+				continue
+			}
+			if best == nil || distance <= bestDistance {
+				best, bestDistance = e, distance
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+
+	// The mtime may have been set back, e.g. by cp -p or touch
+	latest := events[len(events)-1]
+	if !l.since.IsZero() && latest.Time.Before(l.since.Add(-l.window)) {
+		return nil
+	}
+	return latest
+}
+
+// resolveRelative returns the events whose names relative to a directory
+// fd refer to path
+func resolveRelative(path string, candidates []*Event) []*Event {
+	file, _ := os.Lstat(path)
+	dir, _ := os.Stat(filepath.Dir(path))
+
+	var events []*Event
+	for _, e := range candidates {
+		if e.touchesRelative(path, file, dir) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Touches reports whether the event touched a file, resolving names
+// relative to a directory fd against the file on disk
+func (e *Event) Touches(path string) bool {
+	for _, p := range e.Paths {
+		if p == path {
+			return true
+		}
+	}
+	if len(e.relative) == 0 {
+		return false
+	}
+	file, _ := os.Lstat(path)
+	dir, _ := os.Stat(filepath.Dir(path))
+	return e.touchesRelative(path, file, dir)
+}
+
+// touchesRelative reports whether a name relative to a directory fd refers
+// to path: the name is a suffix of the path, and the logged inode of the
+// file, or of its parent for deleted entries, is the one on disk
+func (e *Event) touchesRelative(path string, file, dir os.FileInfo) bool {
+	for _, rel := range e.relative {
+		if path != rel.name && !strings.HasSuffix(path, "/"+rel.name) {
+			continue
+		}
+		if sameFile(file, rel.file) || sameFile(dir, rel.parent) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameFile reports whether a file on disk is the one a PATH record logged
+func sameFile(info os.FileInfo, item pathItem) bool {
+	if info == nil || item.inode == 0 {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	dev := fmt.Sprintf("%02x:%02x", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)))
+	return uint64(st.Ino) == item.inode && dev == item.dev
+}
+
+// Annotate attaches the process that made each change, where the audit
+// log records one. It returns the number of attributed changes.
+func (l *Log) Annotate(changes []*monitor.Change) int {
+	count := 0
+	for _, change := range changes {
+		var mtime time.Time
+		if (change.Type == monitor.NewFile || change.Type == monitor.ModifiedFile) && change.NewInfo != nil {
+			mtime = time.Unix(change.NewInfo.ModTime, 0)
+		}
+		if e := l.Lookup(change.Path, mtime); e != nil {
+			change.Actor = e.Actor()
+			count++
+		}
+	}
+	return count
+}
+
+// ReadEvents reads the syscall events recorded in an audit log file,
+// oldest first
+func ReadEvents(path string) ([]*Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+	defer file.Close()
+
+	asm := newAssembler()
+	var events []*Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		events = append(events, asm.add(scanner.Text())...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+	return append(events, asm.flush()...), nil
+}
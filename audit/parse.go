@@ -0,0 +1,358 @@
+package audit
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// Event is a syscall recorded by auditd with the paths it touched
+type Event struct {
+	Serial  string // e.g. "1700000000.123:456"
+	Time    time.Time
+	Syscall string
+	Success bool
+	Key     string
+	AUID    uint32
+	UID     uint32
+	PID     int
+	Exe     string
+	Comm    string
+	Paths   []string // absolute paths of the files the syscall touched
+
+	cwd      string
+	atFD     bool           // relative names are resolved against a directory fd, not cwd
+	items    []pathItem     // PATH records, resolved when the event ends
+	relative []relativeName // names relative to a directory fd, see Log.Lookup
+}
+
+// pathItem is a PATH record of an event
+type pathItem struct {
+	name   string
+	parent bool // nametype=PARENT: the directory holding a created or deleted entry
+	inode  uint64
+	dev    string // major:minor in hex, as logged
+}
+
+// relativeName is a name passed to an *at syscall relative to a directory
+// fd. The directory of the fd is not logged, so the name is resolved later
+// by comparing the inodes of the file and of its parent, as logged, with
+// those of a changed file.
+type relativeName struct {
+	name   string
+	file   pathItem
+	parent pathItem // zero if there was no PARENT record
+}
+
+// Actor returns the process of the event for attaching to a change
+func (e *Event) Actor() *monitor.Actor {
+	return &monitor.Actor{
+		AUID:    e.AUID,
+		UID:     e.UID,
+		PID:     e.PID,
+		Exe:     e.Exe,
+		Comm:    e.Comm,
+		Syscall: e.Syscall,
+		Time:    e.Time,
+		Event:   e.Serial,
+	}
+}
+
+// record is one line of the audit log
+type record struct {
+	typ    string
+	serial string
+	time   time.Time
+	fields map[string]string
+}
+
+// parseRecord parses a line such as
+//
+//	type=PATH msg=audit(1700000000.123:456): item=0 name="/etc/passwd" ...
+//
+// It returns false for lines that are not audit records.
+func parseRecord(line string) (*record, bool) {
+	// Enriched logs append interpreted fields after a group separator
+	if i := strings.IndexByte(line, 0x1d); i >= 0 {
+		line = line[:i]
+	}
+	if !strings.HasPrefix(line, "type=") {
+		return nil, false
+	}
+	typ, rest, _ := strings.Cut(line[len("type="):], " ")
+	if !strings.HasPrefix(rest, "msg=audit(") {
+		return nil, false
+	}
+	stamp, rest, ok := strings.Cut(rest[len("msg=audit("):], "):")
+	if !ok {
+		return nil, false
+	}
+	seconds, _, ok := strings.Cut(stamp, ":")
+	if !ok {
+		return nil, false
+	}
+	t, err := parseTime(seconds)
+	if err != nil {
+		return nil, false
+	}
+	return &record{typ: typ, serial: stamp, time: t, fields: parseFields(rest)}, true
+}
+
+// parseTime parses the seconds.milliseconds of an audit timestamp
+func parseTime(s string) (time.Time, error) {
+	secs, frac, _ := strings.Cut(s, ".")
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid audit timestamp %q", s)
+	}
+	var nsec int64
+	if frac != "" {
+		n, err := strconv.ParseInt(frac, 10, 64)
+		if err != nil || len(frac) > 9 {
+			return time.Time{}, fmt.Errorf("invalid audit timestamp %q", s)
+		}
+		for i := len(frac); i < 9; i++ {
+			n *= 10
+		}
+		nsec = n
+	}
+	return time.Unix(sec, nsec), nil
+}
+
+// parseFields splits key=value pairs. Values are bare, double-quoted or,
+// for strings holding spaces or other special characters, hex encoded.
+func parseFields(s string) map[string]string {
+	fields := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return fields
+		}
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return fields
+		}
+
+		var value string
+		switch {
+		case strings.HasPrefix(rest, `"`):
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, s = rest[1:], ""
+			} else {
+				value, s = rest[1:end+1], rest[end+2:]
+			}
+		case strings.HasPrefix(rest, "'"):
+			// msg='...' of user space records
+			end := strings.IndexByte(rest[1:], '\'')
+			if end < 0 {
+				value, s = rest[1:], ""
+			} else {
+				value, s = rest[1:end+1], rest[end+2:]
+			}
+		default:
+			value, s, _ = strings.Cut(rest, " ")
+			if hexFields[key] {
+				value = decodeHex(value)
+			}
+		}
+		fields[key] = value
+	}
+}
+
+// hexFields are the fields auditd hex encodes when they hold special
+// characters
+var hexFields = map[string]bool{"name": true, "cwd": true, "exe": true, "comm": true, "key": true}
+
+// decodeHex decodes an unquoted, hex encoded field. "(null)" and other
+// values that are not hex are returned unchanged.
+func decodeHex(value string) string {
+	if value == "(null)" || len(value)%2 != 0 {
+		return value
+	}
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		return value
+	}
+	return string(decoded)
+}
+
+// assembler groups the records of an event, which share a serial and end
+// with an EOE record
+type assembler struct {
+	pending map[string]*Event
+	order   []string // serials of pending events, oldest first
+}
+
+// newAssembler creates an empty assembler
+func newAssembler() *assembler {
+	return &assembler{pending: make(map[string]*Event)}
+}
+
+// maxPending bounds the events waiting for their EOE record; the records of
+// an event are written together, so older events are complete
+const maxPending = 64
+
+// add adds a line of the audit log and returns the events it completed
+func (a *assembler) add(line string) []*Event {
+	rec, ok := parseRecord(line)
+	if !ok {
+		return nil
+	}
+
+	var done []*Event
+	if rec.typ == "EOE" {
+		if e := a.take(rec.serial); e != nil {
+			done = append(done, e)
+		}
+		return done
+	}
+
+	e := a.pending[rec.serial]
+	switch rec.typ {
+	case "SYSCALL":
+		if e == nil {
+			e = a.start(rec)
+		}
+		f := rec.fields
+		e.Syscall = f["syscall"]
+		e.Success = f["success"] == "yes"
+		e.Key = f["key"]
+		if e.Key == "(null)" {
+			e.Key = ""
+		}
+		e.AUID = parseID(f["auid"])
+		e.UID = parseID(f["uid"])
+		e.PID, _ = strconv.Atoi(f["pid"])
+		e.Exe = nullable(f["exe"])
+		e.Comm = nullable(f["comm"])
+		e.atFD = relativeToFD(f)
+	case "CWD":
+		if e == nil {
+			e = a.start(rec)
+		}
+		e.cwd = rec.fields["cwd"]
+	case "PATH":
+		if e == nil {
+			e = a.start(rec)
+		}
+		item := pathItem{
+			name:   nullable(rec.fields["name"]),
+			parent: rec.fields["nametype"] == "PARENT",
+			dev:    strings.ToLower(rec.fields["dev"]),
+		}
+		item.inode, _ = strconv.ParseUint(rec.fields["inode"], 10, 64)
+		e.items = append(e.items, item)
+	default:
+		return nil
+	}
+
+	for len(a.order) > maxPending {
+		if e := a.take(a.order[0]); e != nil {
+			done = append(done, e)
+		}
+	}
+	return done
+}
+
+// start begins a pending event
+func (a *assembler) start(rec *record) *Event {
+	e := &Event{Serial: rec.serial, Time: rec.time}
+	a.pending[rec.serial] = e
+	a.order = append(a.order, rec.serial)
+	return e
+}
+
+// take completes a pending event. Events without a SYSCALL record are
+// dropped.
+func (a *assembler) take(serial string) *Event {
+	e, ok := a.pending[serial]
+	if !ok {
+		return nil
+	}
+	delete(a.pending, serial)
+	for i, s := range a.order {
+		if s == serial {
+			a.order = append(a.order[:i], a.order[i+1:]...)
+			break
+		}
+	}
+	if e.Syscall == "" {
+		return nil
+	}
+	e.resolve()
+	return e
+}
+
+// resolve sets the paths of an event from its PATH records. The directory
+// holding a created or deleted entry is not what changed, so PARENT records
+// only serve to resolve the names of the other records: the n-th entry of
+// a rename belongs to the n-th parent.
+func (e *Event) resolve() {
+	var parents []pathItem
+	for _, item := range e.items {
+		if item.parent {
+			parents = append(parents, item)
+		}
+	}
+
+	n := 0
+	for _, item := range e.items {
+		if item.parent || item.name == "" {
+			continue
+		}
+		var parent pathItem
+		if len(parents) > 0 {
+			parent = parents[min(n, len(parents)-1)]
+		}
+		n++
+
+		name := item.name
+		switch {
+		case filepath.IsAbs(name):
+		case e.atFD:
+			// The PARENT record names the working directory here, as
+			// the kernel assumes relative names are relative to it
+			e.relative = append(e.relative, relativeName{name: filepath.Clean(name), file: item, parent: parent})
+			continue
+		case e.cwd == "":
+			continue
+		default:
+			name = filepath.Join(e.cwd, name)
+		}
+		e.Paths = append(e.Paths, filepath.Clean(name))
+	}
+}
+
+// flush completes all pending events
+func (a *assembler) flush() []*Event {
+	var done []*Event
+	for len(a.order) > 0 {
+		if e := a.take(a.order[0]); e != nil {
+			done = append(done, e)
+		}
+	}
+	return done
+}
+
+// parseID parses a uid, returning AUIDUnset if it is missing
+func parseID(s string) uint32 {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return monitor.AUIDUnset
+	}
+	return uint32(id)
+}
+
+// nullable returns "" for the "(null)" auditd writes for missing strings
+func nullable(s string) string {
+	if s == "(null)" {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,61 @@
+package audit
+
+import "strconv"
+
+// atFDCWD is the directory fd telling *at syscalls to resolve relative
+// names against the working directory
+const atFDCWD = -100
+
+// Audit architectures of the SYSCALL record's arch field
+const (
+	archX86_64  = "c000003e"
+	archAArch64 = "c00000b7"
+)
+
+// dirfdArgs lists, by architecture and syscall number, the arguments of
+// the *at syscalls that change files and hold directory fds
+var dirfdArgs = map[string]map[string][]string{
+	archX86_64: {
+		"257": {"a0"},       // openat
+		"258": {"a0"},       // mkdirat
+		"259": {"a0"},       // mknodat
+		"260": {"a0"},       // fchownat
+		"261": {"a0"},       // futimesat
+		"263": {"a0"},       // unlinkat
+		"264": {"a0", "a2"}, // renameat
+		"265": {"a0", "a2"}, // linkat
+		"266": {"a1"},       // symlinkat
+		"268": {"a0"},       // fchmodat
+		"280": {"a0"},       // utimensat
+		"316": {"a0", "a2"}, // renameat2
+		"437": {"a0"},       // openat2
+		"452": {"a0"},       // fchmodat2
+	},
+	archAArch64: {
+		"33":  {"a0"},       // mknodat
+		"34":  {"a0"},       // mkdirat
+		"35":  {"a0"},       // unlinkat
+		"36":  {"a1"},       // symlinkat
+		"37":  {"a0", "a2"}, // linkat
+		"38":  {"a0", "a2"}, // renameat
+		"53":  {"a0"},       // fchmodat
+		"54":  {"a0"},       // fchownat
+		"56":  {"a0"},       // openat
+		"88":  {"a0"},       // utimensat
+		"276": {"a0", "a2"}, // renameat2
+		"437": {"a0"},       // openat2
+		"452": {"a0"},       // fchmodat2
+	},
+}
+
+// relativeToFD reports whether a SYSCALL record is of an *at syscall given
+// a directory fd other than AT_FDCWD. Arguments are logged in hex.
+func relativeToFD(fields map[string]string) bool {
+	for _, arg := range dirfdArgs[fields["arch"]][fields["syscall"]] {
+		fd, err := strconv.ParseUint(fields[arg], 16, 64)
+		if err == nil && int32(uint32(fd)) != atFDCWD {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/allowlist"
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/ioc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	allowlistName   string
+	allowlistFormat string
+)
+
+var allowlistCmd = &cobra.Command{
+	Use:   "allowlist",
+	Short: "Manage known-good hash sets",
+	Long: `Manage sets of known-good file hashes, such as the NSRL reference data
+set or hash manifests supplied by a vendor.
+
+New files whose md5, sha1 or sha256 digest is in an imported set are
+reported with the [allowlist] severity (low by default), or not at all if
+[allowlist] report is off. Files matching a known-bad hash are always
+reported as critical.`,
+}
+
+var allowlistImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import a known-good hash set",
+	Long: `Import a known-good hash set in plain text (one hash per line, as written
+by sha256sum), CSV (hash columns found by header, as in NSRLFile.txt) or
+STIX 2 JSON. The format is detected from the file unless --format is given.
+
+The hashes are stored in a compact sorted index per algorithm under
+~/.fim/allowlist, so sets of millions of hashes are looked up without being
+loaded. Importing a set with the same name again replaces it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+
+		source := args[0]
+		file, err := os.Open(source)
+		if err != nil {
+			return fmt.Errorf("failed to open hash set: %v", err)
+		}
+		defer file.Close()
+
+		// Detect the format from the start of the file
+		r := bufio.NewReaderSize(file, 64*1024)
+		format := allowlistFormat
+		if format == "" {
+			head, _ := r.Peek(512)
+			format = ioc.DetectFormat(source, head)
+		}
+
+		name := allowlistName
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+		}
+		counts, err := allowlist.Import(cfg.Allowlist.Dir, name, r, format)
+		if _, skipped := err.(*ioc.SkippedError); skipped {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", source, err)
+		} else if err != nil {
+			return fmt.Errorf("%s: %v", source, err)
+		}
+
+		var parts []string
+		for _, algorithm := range []string{"sha256", "sha1", "md5"} {
+			if n, ok := counts[algorithm]; ok {
+				parts = append(parts, fmt.Sprintf("%d %s", n, algorithm))
+			}
+		}
+		fmt.Printf("Imported %s as allowlist %s\n", strings.Join(parts, ", "), name)
+		return nil
+	},
+}
+
+var allowlistListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List imported known-good hash sets",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+		paths, err := allowlist.Indexes(cfg.Allowlist.Dir)
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			fmt.Println("No allowlists imported.")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tALGORITHM\tHASHES\tSIZE")
+		for _, path := range paths {
+			list, algorithm, count, err := allowlist.Describe(path)
+			if err != nil {
+				return err
+			}
+			size := int64(0)
+			if info, err := os.Stat(path); err == nil {
+				size = info.Size()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", list, algorithm, count, formatBytes(size))
+		}
+		return w.Flush()
+	},
+}
+
+var allowlistRemoveCmd = &cobra.Command{
+	Use:   "remove <name>...",
+	Short: "Remove imported known-good hash sets",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+		for _, name := range args {
+			if err := allowlist.Remove(cfg.Allowlist.Dir, name); err != nil {
+				return err
+			}
+			fmt.Printf("Removed allowlist %s\n", name)
+		}
+		return nil
+	},
+}
+
+// formatBytes formats a size in bytes for people, e.g. "12.5 MiB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func init() {
+	rootCmd.AddCommand(allowlistCmd)
+	allowlistCmd.AddCommand(allowlistImportCmd, allowlistListCmd, allowlistRemoveCmd)
+	allowlistImportCmd.Flags().StringVar(&allowlistName, "name", "", "Name of the imported set (default: the file name)")
+	allowlistImportCmd.Flags().StringVar(&allowlistFormat, "format", "", "Format of the file (text, csv or stix; default: detected)")
+}
@@ -7,7 +7,7 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/prashantpokhriyal/fim-tool/daemon"
+	"github.com/rhinocodelab/IntegrityWatchdog/daemon"
 	"github.com/spf13/cobra"
 )
 
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/archive"
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/container"
+	"github.com/rhinocodelab/IntegrityWatchdog/report"
+	"github.com/rhinocodelab/IntegrityWatchdog/severity"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+	"github.com/spf13/cobra"
+)
+
+var containersCmd = &cobra.Command{
+	Use:   "containers",
+	Short: "Check running containers against their images",
+	Long: `Check the root filesystems of running containers against baselines of
+the images they were started from.
+
+Containers are found in the state directory of the [containers] runtime
+(docker or containerd). A container's files are read through
+/proc/<pid>/root, or the bundle's rootfs for containerd, or else its
+overlayfs upper directory is applied to the image baseline.
+
+Image baselines are created with 'fim containers baseline' from a tar
+archive or OCI image layout and kept in ~/.fim/images. With [containers]
+enabled, the daemon checks every running container on each scan and logs
+drift with the container's ID and name.`,
+}
+
+var containersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List running containers",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := config.LoadOfflineConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+		containers, err := container.Discover(cfg)
+		if err != nil {
+			return err
+		}
+		if len(containers) == 0 {
+			fmt.Println("No running containers found.")
+			return nil
+		}
+
+		images := container.OpenImages(cfg)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tIMAGE\tPID\tBASELINE\tFILES")
+		for _, c := range containers {
+			baseline := "no"
+			if _, err := os.Stat(images.Path(c.Image)); err == nil {
+				baseline = "yes"
+			}
+			files := "unreachable"
+			switch {
+			case c.Root != "":
+				files = c.Root
+			case c.UpperDir != "":
+				files = "upper " + c.UpperDir
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", c.Info().ShortID(), c.Name, c.Image, c.PID, baseline, files)
+		}
+		return w.Flush()
+	},
+}
+
+var containersBaselineCmd = &cobra.Command{
+	Use:   "baseline <image> <archive>",
+	Short: "Create the baseline of an image",
+	Long: `Create the baseline of an image from a tar archive, optionally gzip
+compressed, or an OCI image layout directory. The baseline is used for
+containers created from the image reference, e.g. nginx:1.25.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := config.LoadOfflineConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+		baseline, err := archive.Load(cfg, args[1])
+		if err != nil {
+			return fmt.Errorf("failed to read image: %v", err)
+		}
+		images := container.OpenImages(cfg)
+		if err := images.Save(args[0], baseline); err != nil {
+			return err
+		}
+		fmt.Printf("Baseline of %s (%d files) created at %s\n",
+			container.NormalizeImage(args[0]), len(baseline.Files), images.Path(args[0]))
+		return nil
+	},
+}
+
+var containersScanCmd = &cobra.Command{
+	Use:   "scan [container]...",
+	Short: "Compare running containers with their image baselines",
+	Long: `Compare running containers, or those named by name or ID, with the
+baselines of their images. Exits with status 1 if any container has
+drifted, or 2 if a container cannot be checked.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := config.LoadOfflineConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+		containers, err := container.Discover(cfg)
+		if err != nil {
+			return err
+		}
+		if len(args) > 0 {
+			if containers, err = container.Find(containers, args); err != nil {
+				return err
+			}
+		}
+		classifier, err := severity.NewClassifier(cfg)
+		if err != nil {
+			return err
+		}
+
+		images := container.OpenImages(cfg)
+		reporter := report.TextReporter{}
+		drifted, failed := 0, 0
+		for i, c := range containers {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("Container %s from %s\n", c, c.Image)
+			image, err := images.Baseline(c.Image)
+			if err == nil && image == nil {
+				err = fmt.Errorf("no baseline of image %q", c.Image)
+			}
+			var changes int
+			if err == nil {
+				changes, err = scanContainer(cfg, classifier, reporter, c, image)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				failed++
+				continue
+			}
+			if changes > 0 {
+				drifted++
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d containers could not be checked", failed, len(containers))
+		}
+		if drifted > 0 {
+			return &exitError{code: ExitChanges}
+		}
+		return nil
+	},
+}
+
+// scanContainer compares a container with its image baseline and prints
+// the changes. It returns the number of changes.
+func scanContainer(cfg *config.Config, classifier *severity.Classifier, reporter report.Reporter, c *container.Container, image *storage.Baseline) (int, error) {
+	current, err := container.Scan(cfg, c, image)
+	if err != nil {
+		return 0, err
+	}
+	changes := image.Compare(current)
+	classifier.Classify(changes.Details)
+	container.Annotate(changes.Details, c)
+
+	r := report.New(image, container.NormalizeImage(c.Image), current, "container "+c.String(), changes)
+	if err := reporter.Write(os.Stdout, r); err != nil {
+		return 0, err
+	}
+	return changes.Count(), nil
+}
+
+func init() {
+	rootCmd.AddCommand(containersCmd)
+	containersCmd.AddCommand(containersListCmd, containersBaselineCmd, containersScanCmd)
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/ima"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	imaList string
+	imaAll  bool
+	imaJSON bool
+)
+
+var imaCmd = &cobra.Command{
+	Use:   "ima",
+	Short: "Check IMA measurements against the baseline",
+	Long: `Check the Linux IMA runtime measurement list against the baseline. IMA
+measures files as the kernel executes, maps or opens them, depending on
+the IMA policy, so a measured hash that differs from the baseline means a
+binary ran with content that was not baselined, even if the file was put
+back since.
+
+The list is read from securityfs, or from --list, in the ASCII or the
+binary format. Files that differ from the baseline are listed, and the
+command exits with status 1 if there are any. Measurements of files
+outside the baseline, measurements that cannot be compared and
+violations are only listed with --all.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+		baseline, err := storage.Load(storage.GetDefaultBaselinePath())
+		if err != nil {
+			return &exitError{code: ExitBaselineMissing, err: fmt.Errorf("failed to load baseline: %v", err)}
+		}
+
+		path := imaList
+		if path == "" {
+			path = cfg.IMA.Log
+		}
+		if path == "" {
+			if path, err = ima.FindLog(); err != nil {
+				return err
+			}
+		}
+		measurements, err := ima.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		// Count the results and keep the ones to show
+		verifier := ima.NewVerifier(baseline)
+		counts := make(map[ima.Status]int)
+		shown := make([]*ima.Result, 0)
+		for _, m := range measurements {
+			result := verifier.Verify(m)
+			counts[result.Status]++
+			if result.Status == ima.StatusDiffers || (imaAll && result.Status != ima.StatusMatches) {
+				shown = append(shown, result)
+			}
+		}
+
+		if imaJSON {
+			data, err := json.MarshalIndent(shown, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal results to JSON: %v", err)
+			}
+			fmt.Println(string(data))
+		} else {
+			if len(shown) > 0 {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "STATUS\tPATH\tMEASURED\tBASELINE\tCONTENT")
+				for _, result := range shown {
+					fmt.Fprintf(w, "%s\t%s\t%s:%s\t%s\t%s\n", result.Status, result.Path,
+						result.Algorithm, result.Hash, result.Baseline, result.Content)
+				}
+				w.Flush()
+				fmt.Println()
+			}
+			fmt.Printf("Checked %d measurements: %d match, %d differ, %d not in baseline, %d unverified, %d violations\n",
+				len(measurements), counts[ima.StatusMatches], counts[ima.StatusDiffers],
+				counts[ima.StatusUnmonitored], counts[ima.StatusUnverified], counts[ima.StatusViolation])
+		}
+
+		if counts[ima.StatusDiffers] > 0 {
+			return &exitError{code: ExitChanges}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(imaCmd)
+	imaCmd.Flags().StringVar(&imaList, "list", "", "Measurement list to read (default: [ima] log or securityfs)")
+	imaCmd.Flags().BoolVar(&imaAll, "all", false, "Also list unmonitored and unverified files and violations")
+	imaCmd.Flags().BoolVar(&imaJSON, "json", false, "Output results in JSON format")
+}
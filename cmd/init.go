@@ -4,12 +4,19 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/rhinocodelab/IntegrityWatchdog/config"
-	"github.com/rhinocodelab/IntegrityWatchdog/scanner"
+	"github.com/rhinocodelab/IntegrityWatchdog/content"
+	"github.com/rhinocodelab/IntegrityWatchdog/ioc"
 	"github.com/spf13/cobra"
 )
 
+var (
+	initRoot  string
+	initImage string
+)
+
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize a new baseline",
@@ -19,8 +26,16 @@ This command will:
 2. Create a configuration file if it doesn't exist
 3. Scan configured directories
 4. Store file metadata and hashes
-5. Create a baseline file at ~/.fim/baseline.json`,
+5. Create a baseline file at ~/.fim/baseline.json
+
+With --root, the configured paths are read below another directory, such
+as a mounted disk image or a chroot, and recorded as if it were /, so the
+baseline can be compared with scans of live hosts. With --image, they are
+read from a tar archive (optionally gzip compressed) or an OCI image
+layout directory instead, applying the whiteouts of each layer.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
 		// Get home directory
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
@@ -46,20 +61,38 @@ This command will:
 			return nil
 		}
 
-		// Load configuration
-		cfg, err := config.LoadConfig()
+		// Load configuration; the monitored paths of an image need not
+		// exist on this host
+		load := config.LoadConfig
+		if initRoot != "" || initImage != "" {
+			load = config.LoadOfflineConfig
+		}
+		cfg, err := load()
 		if err != nil {
 			return fmt.Errorf("failed to load configuration: %v", err)
 		}
 
-		// Create scanner
-		s := scanner.NewScanner(cfg)
+		// Scan all configured paths, or read them from an image
+		baseline, _, err := scanCurrent(cfg, initRoot, initImage, true)
+		if err != nil {
+			return err
+		}
 
-		// Scan all configured paths
-		fmt.Println("Scanning configured paths...")
-		baseline, err := s.ScanPaths()
+		// Leave known-bad files out of the baseline so that they are
+		// reported by every scan
+		known, err := ioc.LoadSet(cfg)
 		if err != nil {
-			return fmt.Errorf("failed to scan paths: %v", err)
+			return fmt.Errorf("failed to load hash lists: %v", err)
+		}
+		hits := known.Check(baseline)
+		paths := make([]string, 0, len(hits))
+		for path := range hits {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Printf("[!] %s (critical) matches known-bad hash: %s\n", path, hits[path])
+			baseline.RemoveFile(path)
 		}
 
 		// Save baseline
@@ -68,7 +101,21 @@ This command will:
 			return fmt.Errorf("failed to save baseline: %v", err)
 		}
 
+		// Keep the content of files selected for diffing and restores;
+		// the content of images is not on disk
+		if snapshots := content.NewSnapshotter(cfg); snapshots.Enabled() && initImage == "" {
+			stored, err := snapshots.Capture(baseline)
+			if err != nil {
+				return fmt.Errorf("failed to store file contents: %v", err)
+			}
+			fmt.Printf("Stored the content of %d file(s)\n", stored)
+		}
+
 		fmt.Printf("Baseline created successfully at %s\n", baselinePath)
+		fmt.Printf("Root digest: %s\n", baseline.RootDigest())
+		if len(hits) > 0 {
+			return &exitError{code: ExitChanges, err: fmt.Errorf("%d file(s) match known-bad hashes and were left out of the baseline", len(hits))}
+		}
 		return nil
 	},
 }
@@ -87,9 +134,129 @@ exclude = /tmp, /var/log, /proc
 # Optional: Log file path
 logfile = /var/log/fim.log
 
+# Optional: Daemon event log format (text, json, cef or leef)
+format = text
+
+# Optional: Minimum level to log (debug, info, warning, error, critical)
+level = info
+
+# Optional: Also send events to syslog (local, udp://host:514 or tcp://host:601)
+# syslog = local
+
+# Optional: Rotate the daemon log at this size in megabytes (0 disables)
+max_size = 10
+
+# Optional: Rotate the daemon log once it is this old (e.g. 24h, 0 disables)
+# max_age = 24h
+
+# Optional: Number of rotated log segments to keep (0 keeps all)
+max_backups = 5
+
+# Optional: Compress rotated log segments with gzip
+compress = true
+
 [output]
 # Optional: Enable verbose output
 verbose = true
+
+[content]
+# Optional: Keep the content of text files matching these globs so that
+# scans and alerts can show a unified diff when they change
+# capture = /etc/ssh/sshd_config, /etc/*.conf
+
+# Optional: Largest file captured, in bytes
+max_size = 65536
+
+# Optional: Keep the content of files matching these globs so that
+# 'fim restore' can put them back
+# restore = /etc/**, /usr/local/bin/*
+
+# Optional: Largest file kept for restores, in bytes
+restore_max_size = 10485760
+
+[quarantine]
+# Optional: Move new executables matching these globs into quarantine
+# paths = /usr/bin/*, /usr/local/sbin/*
+
+# Optional: Change types quarantined (added, modified)
+changes = added
+
+# Optional: Only quarantine files with an exec bit
+executables = true
+
+[packages]
+# Optional: Check changed files against package databases (auto, off, dpkg or rpm)
+verify = auto
+
+# Optional: Locations of the dpkg and rpm databases
+dpkg_dir = /var/lib/dpkg
+rpm_dir = /var/lib/rpm
+
+# Optional: Let the daemon fold changes made by the package manager into the
+# baseline when they match the packaged files
+auto_accept = false
+
+# Optional: Package manager logs and lock files used to detect transactions
+# logs = /var/log/apt/history.log, /var/log/dpkg.log, /var/log/dnf.rpm.log, /var/log/yum.log
+# locks = /var/lib/dpkg/lock-frontend, /var/lib/dpkg/lock, /var/lib/rpm/.rpm.lock
+
+[ioc]
+# Optional: Lists of known-bad file hashes (plain text, CSV or STIX JSON).
+# Matching files are reported as critical and left out of the baseline.
+# Lists added with 'fim ioc import' are always used.
+# lists = /etc/fim/malware-hashes.txt
+
+[allowlist]
+# Known-good hash sets are added with 'fim allowlist import'.
+# Optional: Severity of new files whose hash is on an allowlist
+severity = low
+
+# Optional: Still report new files whose hash is on an allowlist
+report = true
+
+[rules]
+# Content rules in YARA-like syntax are read from *.yar files in
+# ~/.fim/rules and run against added and modified files.
+# Optional: Directory of rule files
+# dir = /etc/fim/rules
+
+# Optional: Files larger than this many bytes are not scanned
+max_size = 4194304
+
+# Optional: Severity of matches of rules without a severity meta
+severity = high
+
+[audit]
+# Optional: Attribute changes found by the daemon to the processes that
+# made them, using auditd watches such as 'auditctl -w /etc -p wa -k fim'
+enabled = false
+
+# Optional: Audit log read by the daemon
+log = /var/log/audit/audit.log
+
+# Optional: Largest distance between an audit event and a file's mtime
+window = 2m
+
+# Optional: Only use events of audit rules with this key
+# key = fim
+
+[ima]
+# Optional: Check new IMA measurements against the baseline in the daemon
+verify = false
+
+# Optional: Measurement list, ASCII or binary (default: from securityfs)
+# log = /sys/kernel/security/ima/ascii_runtime_measurements
+
+[containers]
+# Optional: Check running containers against baselines of their images,
+# created with 'fim containers baseline', in the daemon
+enabled = false
+
+# Optional: Container runtime (docker or containerd)
+runtime = docker
+
+# Optional: Runtime state directory (default: from the runtime)
+# state_dir = /var/lib/docker
 `
 
 	// Write config file
@@ -102,4 +269,6 @@ verbose = true
 
 func init() {
 	rootCmd.AddCommand(initCmd)
+	initCmd.Flags().StringVar(&initImage, "image", "", "Read the configured paths from a tar archive or OCI image layout")
+	initCmd.Flags().StringVar(&initRoot, "root", "", "Scan the configured paths below this directory, e.g. a mounted image, as if it were /")
 }
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/ioc"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	iocName   string
+	iocFormat string
+)
+
+var iocCmd = &cobra.Command{
+	Use:   "ioc",
+	Short: "Manage known-bad hash lists",
+	Long: `Manage lists of known-bad file hashes (indicators of compromise).
+
+Files whose md5, sha1 or sha256 digest is on a list are reported as
+critical by 'fim scan' and the daemon, and left out of the baseline by
+'fim init'. Lists are read from the [ioc] lists setting and from the
+lists added with 'fim ioc import'.`,
+}
+
+var iocImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import a hash list",
+	Long: `Import a hash list in plain text (one hash per line, optionally followed
+by a name), CSV (hash columns found by header) or STIX 2 JSON (file hash
+indicators). The format is detected from the file unless --format is given.
+
+The hashes are stored under ~/.fim/ioc and used by every later scan.
+Importing a list with the same name again replaces it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+
+		source := args[0]
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return fmt.Errorf("failed to read hash list: %v", err)
+		}
+		format := iocFormat
+		if format == "" {
+			format = ioc.DetectFormat(source, data)
+		}
+
+		name := iocName
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+		}
+		indicators, err := ioc.Parse(bytes.NewReader(data), format, name)
+		if _, skipped := err.(*ioc.SkippedError); skipped {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", source, err)
+		} else if err != nil {
+			return fmt.Errorf("%s: %v", source, err)
+		}
+		if len(indicators) == 0 {
+			return fmt.Errorf("no hashes found in %s", source)
+		}
+
+		path, err := ioc.Import(cfg.IOC.Dir, name, source, indicators)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d hash(es) (%s) from %s to %s\n", len(indicators), countAlgorithms(indicators), source, path)
+		return nil
+	},
+}
+
+var iocListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List hash lists in use",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+		imported, err := ioc.ImportedLists(cfg.IOC.Dir)
+		if err != nil {
+			return err
+		}
+		if len(cfg.IOC.Lists)+len(imported) == 0 {
+			fmt.Println("No hash lists configured or imported.")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ORIGIN\tHASHES\tPATH")
+		for _, paths := range []struct {
+			origin string
+			paths  []string
+		}{{"config", cfg.IOC.Lists}, {"imported", imported}} {
+			for _, path := range paths.paths {
+				indicators, err := ioc.LoadFile(path)
+				if _, skipped := err.(*ioc.SkippedError); skipped {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				} else if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\n", paths.origin, len(indicators), path)
+			}
+		}
+		return w.Flush()
+	},
+}
+
+var iocRemoveCmd = &cobra.Command{
+	Use:   "remove <name>...",
+	Short: "Remove imported hash lists",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+		for _, name := range args {
+			path, err := ioc.ListPath(cfg.IOC.Dir, name)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(path); err != nil {
+				if os.IsNotExist(err) {
+					return fmt.Errorf("no imported hash list named %s", name)
+				}
+				return fmt.Errorf("failed to remove hash list: %v", err)
+			}
+			fmt.Printf("Removed %s\n", path)
+		}
+		return nil
+	},
+}
+
+// countAlgorithms summarises indicators by algorithm, e.g. "12 sha256, 3 md5"
+func countAlgorithms(indicators []*monitor.Indicator) string {
+	counts := make(map[string]int)
+	for _, indicator := range indicators {
+		counts[indicator.Algorithm]++
+	}
+	var parts []string
+	for _, algorithm := range []string{"sha256", "sha1", "md5"} {
+		if counts[algorithm] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[algorithm], algorithm))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func init() {
+	rootCmd.AddCommand(iocCmd)
+	iocCmd.AddCommand(iocImportCmd, iocListCmd, iocRemoveCmd)
+	iocImportCmd.Flags().StringVar(&iocName, "name", "", "Name of the imported list (default: the file name)")
+	iocImportCmd.Flags().StringVar(&iocFormat, "format", "", "Format of the file (text, csv or stix; default: detected)")
+}
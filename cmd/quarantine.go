@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/quarantine"
+	"github.com/spf13/cobra"
+)
+
+var (
+	quarantineAll   bool
+	quarantineForce bool
+)
+
+var quarantineCmd = &cobra.Command{
+	Use:   "quarantine",
+	Short: "Manage quarantined files",
+	Long: `Manage files moved into quarantine by the [quarantine] responder.
+
+Quarantined files are kept without exec, setuid and setgid bits in a
+directory only the owner can read, together with the original path,
+attributes, hash and the scan that found them.`,
+}
+
+var quarantineListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List quarantined files",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		q, err := openQuarantine()
+		if err != nil {
+			return err
+		}
+		items, err := q.List()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tQUARANTINED\tCHANGE\tSEVERITY\tSIZE\tPATH")
+		shown := 0
+		for _, item := range items {
+			if item.Released() && !quarantineAll {
+				continue
+			}
+			path := item.Path
+			if item.Released() {
+				path += " (released)"
+			}
+			severity := item.Severity.String()
+			if severity == "" {
+				severity = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", item.ID,
+				item.QuarantinedAt.Local().Format(time.RFC3339), item.Change, severity, item.Info.Size, path)
+			shown++
+		}
+		if shown == 0 {
+			fmt.Println("No quarantined files.")
+			return nil
+		}
+		return w.Flush()
+	},
+}
+
+var quarantineReleaseCmd = &cobra.Command{
+	Use:   "release <id>",
+	Short: "Move a quarantined file back to its original location",
+	Long: `Move a quarantined file back to its original location with its original
+mode, owner and modification time. The file is not quarantined again while
+its content is unchanged; run 'fim init' to add it to the baseline.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		q, err := openQuarantine()
+		if err != nil {
+			return err
+		}
+		item, err := q.Release(args[0], quarantineForce)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Released %s to %s\n", item.ID, item.Path)
+		return nil
+	},
+}
+
+var quarantinePurgeCmd = &cobra.Command{
+	Use:   "purge [id...]",
+	Short: "Permanently delete quarantined files",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if quarantineAll {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		q, err := openQuarantine()
+		if err != nil {
+			return err
+		}
+
+		ids := args
+		if quarantineAll {
+			items, err := q.List()
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+		}
+
+		for _, id := range ids {
+			if err := q.Purge(id); err != nil {
+				return err
+			}
+			fmt.Printf("Purged %s\n", id)
+		}
+		return nil
+	},
+}
+
+// openQuarantine opens the configured quarantine directory
+func openQuarantine() (*quarantine.Quarantine, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %v", err)
+	}
+	return quarantine.Open(cfg.Quarantine.Dir)
+}
+
+func init() {
+	rootCmd.AddCommand(quarantineCmd)
+	quarantineCmd.AddCommand(quarantineListCmd, quarantineReleaseCmd, quarantinePurgeCmd)
+	quarantineListCmd.Flags().BoolVar(&quarantineAll, "all", false, "Include released files")
+	quarantineReleaseCmd.Flags().BoolVar(&quarantineForce, "force", false, "Replace a file that now exists at the original location")
+	quarantinePurgeCmd.Flags().BoolVar(&quarantineAll, "all", false, "Purge every item, including records of released files")
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/content"
+	"github.com/rhinocodelab/IntegrityWatchdog/ioc"
+	"github.com/rhinocodelab/IntegrityWatchdog/logging"
+	"github.com/rhinocodelab/IntegrityWatchdog/packages"
+	"github.com/rhinocodelab/IntegrityWatchdog/report"
+	"github.com/rhinocodelab/IntegrityWatchdog/rules"
+	"github.com/rhinocodelab/IntegrityWatchdog/scanner"
+	"github.com/rhinocodelab/IntegrityWatchdog/severity"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportFormat   string
+	reportOutput   string
+	reportBaseline string
+	reportAgainst  string
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Generate a scan report",
+	Long: `Generate a human-readable report of the differences between the baseline
+and the current state of the file system, suitable for archiving.
+
+By default the configured paths are scanned and compared with the baseline
+at ~/.fim/baseline.json. Use --against to compare two baseline files
+instead, for example one taken before and one after a maintenance window.
+
+The HTML report is a single self-contained file without external assets.
+The other formats of 'fim scan' (text, json, csv, sarif, cef, leef) are
+available as well.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		reporter, err := report.NewReporter(reportFormat)
+		if err != nil {
+			return err
+		}
+
+		// Load configuration
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+
+		// Load baseline
+		baselinePath := reportBaseline
+		if baselinePath == "" {
+			baselinePath = storage.GetDefaultBaselinePath()
+		}
+		baseline, err := storage.Load(baselinePath)
+		if err != nil {
+			return &exitError{code: ExitBaselineMissing, err: fmt.Errorf("failed to load baseline: %v", err)}
+		}
+
+		// Load the second baseline, or scan the live file system
+		var current *storage.Baseline
+		currentSource := reportAgainst
+		if reportAgainst != "" {
+			current, err = storage.Load(reportAgainst)
+			if err != nil {
+				return &exitError{code: ExitBaselineMissing, err: fmt.Errorf("failed to load baseline: %v", err)}
+			}
+		} else {
+			current, err = scanner.NewScanner(cfg).ScanPaths()
+			if err != nil {
+				return fmt.Errorf("failed to scan paths: %v", err)
+			}
+			currentSource = "live filesystem"
+		}
+
+		// Compare and classify
+		changes := baseline.Compare(current)
+		classifier, err := severity.NewClassifier(cfg)
+		if err != nil {
+			return err
+		}
+		classifier.Classify(changes.Details)
+
+		// Flag files matching known-bad and known-good hashes and content
+		// rules; these read the files themselves, so only live scans qualify
+		if reportAgainst == "" {
+			known, err := ioc.LoadSet(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to load hash lists: %v", err)
+			}
+			known.Annotate(changes, current)
+
+			if changes, err = applyAllowlist(cfg, changes); err != nil {
+				return err
+			}
+
+			engine, err := rules.Load(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to load rules: %v", err)
+			}
+			engine.Apply(changes)
+		}
+
+		// Show what changed in captured text files
+		if snapshots := content.NewSnapshotter(cfg); snapshots.Enabled() {
+			snapshots.AttachDiffs(changes.Details)
+		}
+
+		// Check changed files against the package databases; a second
+		// baseline may come from another host, so only live scans qualify
+		if reportAgainst == "" {
+			verifier, err := packages.NewVerifier(cfg)
+			if err != nil {
+				return err
+			}
+			if err := verifier.Annotate(changes.Details); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to verify packages: %v\n", err)
+			}
+		}
+
+		// Render the report
+		r := report.New(baseline, baselinePath, current, currentSource, changes)
+		r.ScanID = logging.NewScanID()
+		if err := writeReport(reporter, r, reportOutput); err != nil {
+			return err
+		}
+
+		if reportOutput != "" {
+			fmt.Printf("Report written to %s\n", reportOutput)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.Flags().StringVar(&reportFormat, "format", "html", "Report format ("+strings.Join(report.Formats(), ", ")+")")
+	reportCmd.Flags().StringVarP(&reportOutput, "output", "o", "", "Write the report to a file instead of stdout")
+	reportCmd.Flags().StringVar(&reportBaseline, "baseline", "", "Baseline file to compare from (default ~/.fim/baseline.json)")
+	reportCmd.Flags().StringVar(&reportAgainst, "against", "", "Compare with a second baseline file instead of scanning")
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/content"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreDryRun bool
+	restoreYes    bool
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <path>",
+	Short: "Restore files to their baselined state",
+	Long: `Put back the baselined content, mode and ownership of a file. If the
+path is a directory, every baselined file beneath it is restored; files
+added since the baseline are left alone.
+
+Content can only be restored for files matching the restore globs in the
+[content] section when 'fim init' was run:
+
+  [content]
+  restore = /etc/**, /usr/local/bin/*
+
+Use --dry-run to see what would change without touching anything.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		// Load configuration so that invalid settings are reported
+		if _, err := config.LoadConfig(); err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+
+		baseline, err := storage.Load(storage.GetDefaultBaselinePath())
+		if err != nil {
+			return &exitError{code: ExitBaselineMissing, err: fmt.Errorf("failed to load baseline: %v", err)}
+		}
+
+		// Find the baselined files at or below the path
+		target, err := filepath.Abs(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid path: %v", err)
+		}
+		var plans []*content.Plan
+		for _, info := range baseline.Files {
+			if info.IsDir || info.IsSymlink {
+				continue
+			}
+			if info.Path != target && !strings.HasPrefix(info.Path, target+"/") {
+				continue
+			}
+			plan, err := content.NewPlan(info)
+			if err != nil {
+				return err
+			}
+			if plan.Needed() {
+				plans = append(plans, plan)
+			}
+		}
+		if _, ok := baseline.GetFile(target); !ok && len(plans) == 0 {
+			return fmt.Errorf("%s is not in the baseline", target)
+		}
+		if len(plans) == 0 {
+			fmt.Println("Nothing to restore: files match the baseline.")
+			return nil
+		}
+
+		// Show the plan
+		sortPlans(plans)
+		store := content.NewStore(content.GetDefaultStoreDir())
+		for _, plan := range plans {
+			note := ""
+			if plan.Content && !store.Has(plan.Baseline.Hash) {
+				note = " [content not stored]"
+			}
+			fmt.Printf("%s: %s%s\n", plan.Baseline.Path, plan, note)
+		}
+		if restoreDryRun {
+			return nil
+		}
+
+		// Ask for confirmation
+		if !restoreYes {
+			fmt.Printf("Restore %d file(s)? [y/N] ", len(plans))
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "yes":
+			default:
+				fmt.Println("Aborted.")
+				return nil
+			}
+		}
+
+		// Restore, continuing past failures so that one file does not
+		// block the rest
+		failed := 0
+		for _, plan := range plans {
+			if err := store.Restore(plan); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				failed++
+				continue
+			}
+			fmt.Printf("Restored %s\n", plan.Baseline.Path)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d file(s) could not be restored", failed, len(plans))
+		}
+		return nil
+	},
+}
+
+// sortPlans orders plans by path
+func sortPlans(plans []*content.Plan) {
+	sort.Slice(plans, func(i, j int) bool {
+		return plans[i].Baseline.Path < plans[j].Baseline.Path
+	})
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().BoolVar(&restoreDryRun, "dry-run", false, "Show what would be restored without changing anything")
+	restoreCmd.Flags().BoolVarP(&restoreYes, "yes", "y", false, "Do not ask for confirmation")
+}
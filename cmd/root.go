@@ -1,11 +1,41 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
 )
 
+// Exit codes returned by fim
+const (
+	ExitOK              = 0 // success, no changes found
+	ExitChanges         = 1 // the scan found changes
+	ExitError           = 2 // an error occurred
+	ExitBaselineMissing = 3 // the baseline is missing or invalid
+)
+
+// exitError carries a specific exit code out of a command. A nil err exits
+// with the code without printing anything.
+type exitError struct {
+	code int
+	err  error
+}
+
+// Error implements error
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
 var (
 	daemonMode bool
 )
@@ -15,13 +45,25 @@ var rootCmd = &cobra.Command{
 	Short: "File Integrity Monitoring Tool",
 	Long: `A lightweight file integrity monitoring CLI tool for Linux/Unix systems.
 It helps detect unauthorized or unexpected changes in your file system.`,
+	SilenceErrors: true,
 }
 
 func Execute() {
 	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+	if err == nil {
+		return
 	}
+
+	var exit *exitError
+	if errors.As(err, &exit) {
+		if exit.err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", exit.err)
+		}
+		os.Exit(exit.code)
+	}
+
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	os.Exit(ExitError)
 }
 
 func init() {
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/rhinocodelab/IntegrityWatchdog/rules"
+	"github.com/spf13/cobra"
+)
+
+var rulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "Check and test content rules",
+	Long: `Check and test the content rules that 'fim scan' and the daemon run
+against added and modified files.
+
+Rules are read from the *.yar, *.yara and *.rules files in the [rules]
+directory (~/.fim/rules by default) and use a YARA-like syntax:
+
+  rule php_webshell : webshell {
+      meta:
+          description = "PHP code evaluating request data"
+          severity = "critical"
+      strings:
+          $eval = "eval(" nocase
+          $input = /\$_(GET|POST|REQUEST)\[/
+          $mz = { 4D 5A ?? 00 [0-64] 50 45 }
+      condition:
+          $eval and $input and filesize < 1MB
+  }
+
+A file matching a rule is reported with the rule name and at least the
+rule's severity, or the [rules] severity if the rule has none.`,
+}
+
+var rulesCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Compile the rules and list them",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+		engine, err := rules.Load(cfg)
+		if err != nil {
+			return err
+		}
+		if !engine.Enabled() {
+			fmt.Println("No rules found.")
+			return nil
+		}
+		for _, line := range engine.Describe() {
+			fmt.Println(line)
+		}
+		fmt.Printf("%d rules compiled\n", engine.Len())
+		return nil
+	},
+}
+
+var rulesTestCmd = &cobra.Command{
+	Use:   "test <file>...",
+	Short: "Run the rules against files",
+	Long: `Run the rules against files and print the rules each file matches.
+Exits with status 1 if any file matches, or 2 if a file cannot be read.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+		engine, err := rules.Load(cfg)
+		if err != nil {
+			return err
+		}
+
+		matched, failed := 0, 0
+		for _, path := range args {
+			matches, err := engine.MatchFile(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				failed++
+				continue
+			}
+			for _, match := range matches {
+				fmt.Printf("%s: %s (%s)%s\n", path, match.Rule, match.Severity, describeMatch(match))
+			}
+			if len(matches) > 0 {
+				matched++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d files could not be scanned", failed, len(args))
+		}
+		if matched > 0 {
+			return &exitError{code: ExitChanges}
+		}
+		return nil
+	},
+}
+
+// describeMatch returns the strings found by a rule match, e.g. " [$a $b]"
+func describeMatch(match *monitor.RuleMatch) string {
+	if len(match.Strings) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" %v", match.Strings)
+}
+
+func init() {
+	rootCmd.AddCommand(rulesCmd)
+	rulesCmd.AddCommand(rulesCheckCmd, rulesTestCmd)
+}
@@ -1,31 +1,82 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/rhinocodelab/IntegrityWatchdog/allowlist"
+	"github.com/rhinocodelab/IntegrityWatchdog/archive"
 	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/content"
 	"github.com/rhinocodelab/IntegrityWatchdog/daemon"
+	"github.com/rhinocodelab/IntegrityWatchdog/hooks"
+	"github.com/rhinocodelab/IntegrityWatchdog/ioc"
+	"github.com/rhinocodelab/IntegrityWatchdog/logging"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/rhinocodelab/IntegrityWatchdog/notify"
+	"github.com/rhinocodelab/IntegrityWatchdog/packages"
+	"github.com/rhinocodelab/IntegrityWatchdog/quarantine"
+	"github.com/rhinocodelab/IntegrityWatchdog/report"
+	"github.com/rhinocodelab/IntegrityWatchdog/rules"
 	"github.com/rhinocodelab/IntegrityWatchdog/scanner"
+	"github.com/rhinocodelab/IntegrityWatchdog/severity"
 	"github.com/rhinocodelab/IntegrityWatchdog/storage"
 	"github.com/spf13/cobra"
 )
 
 var (
-	jsonOutput bool
-	interval   string
+	jsonOutput   bool
+	outputFormat string
+	interval     string
+	noHooks      bool
+	noQuarantine bool
+	sendEmail    bool
+	minSeverity  string
+	failOn       string
+	quiet        bool
+	scanOutput   string
+	scanRoot     string
+	scanImage    string
 )
 
+// defaultFailOn selects the change types that fail a scan by default
+const defaultFailOn = "added,modified,deleted"
+
 var scanCmd = &cobra.Command{
 	Use:   "scan",
 	Short: "Scan for changes",
 	Long: `Scan the configured paths for changes since the last baseline.
 This command will compare the current state of files with the baseline
-and report any changes detected.`,
+and report any changes detected.
+
+Exit codes:
+  0  no changes found
+  1  changes found (restricted to the types selected with --fail-on)
+  2  an error occurred
+  3  the baseline is missing or invalid`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		// Arguments are valid; errors from here on are not usage errors
+		cmd.SilenceUsage = true
+
+		// Parse the change types that make the scan fail
+		failTypes, err := parseFailOn(failOn)
+		if err != nil {
+			return err
+		}
+
+		// Select the output renderer
+		format := outputFormat
+		if jsonOutput {
+			format = "json"
+		}
+		reporter, err := report.NewReporter(format)
+		if err != nil {
+			return err
+		}
+
 		// Check if configuration file exists
 		configPath, err := config.GetConfigPath()
 		if err != nil {
@@ -38,14 +89,23 @@ and report any changes detected.`,
 			return fmt.Errorf("configuration file not found")
 		}
 
-		// Load configuration
-		cfg, err := config.LoadConfig()
+		// Load configuration; the monitored paths of an image need not
+		// exist on this host
+		load := config.LoadConfig
+		if scanRoot != "" || scanImage != "" {
+			load = config.LoadOfflineConfig
+		}
+		cfg, err := load()
 		if err != nil {
 			return fmt.Errorf("failed to load configuration: %v", err)
 		}
 
 		// Check if daemon mode is requested
 		if daemonMode {
+			if scanRoot != "" || scanImage != "" {
+				return fmt.Errorf("--root and --image cannot be used with --daemon")
+			}
+
 			// Check if daemon is already running
 			if daemon.IsRunning() {
 				return fmt.Errorf("FIM daemon is already running")
@@ -75,7 +135,9 @@ and report any changes detected.`,
 			}
 
 			fmt.Printf("FIM daemon started with scan interval: %s\n", scanInterval)
-			return nil
+
+			// Run until stopped with 'fim stop' or a termination signal
+			return d.Wait()
 		}
 
 		// Regular scan mode
@@ -88,57 +150,117 @@ and report any changes detected.`,
 
 		baseline, err := storage.Load(baselinePath)
 		if err != nil {
-			return fmt.Errorf("failed to load baseline: %v", err)
+			return &exitError{code: ExitBaselineMissing, err: fmt.Errorf("failed to load baseline: %v", err)}
 		}
 
-		// Create scanner
-		s := scanner.NewScanner(cfg)
+		// Scan the configured paths, or read them from an image
+		verbose := !quiet && format == "text" && scanOutput == ""
+		currentState, source, err := scanCurrent(cfg, scanRoot, scanImage, verbose)
+		if err != nil {
+			return err
+		}
+		offline := scanRoot != "" || scanImage != ""
 
-		// Print what we're scanning
-		fmt.Println("Scanning configured paths...")
-		for _, path := range cfg.Monitor.Paths {
-			fmt.Printf("  - %s\n", path)
-			// Check if it's a symlink
-			if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
-				realPath, err := filepath.EvalSymlinks(path)
-				if err == nil {
-					fmt.Printf("    (symlink to: %s)\n", realPath)
-				}
-			}
+		// Compare with baseline and classify the changes
+		changes := baseline.Compare(currentState)
+		scanID := logging.NewScanID()
+
+		classifier, err := severity.NewClassifier(cfg)
+		if err != nil {
+			return err
 		}
+		classifier.Classify(changes.Details)
 
-		// Scan paths
-		currentState, err := s.ScanPaths()
+		// Flag files matching known-bad hashes as critical
+		known, err := ioc.LoadSet(cfg)
 		if err != nil {
-			return fmt.Errorf("failed to scan paths: %v", err)
+			return fmt.Errorf("failed to load hash lists: %v", err)
 		}
+		known.Annotate(changes, currentState)
 
-		// Compare with baseline
-		changes := baseline.Compare(currentState)
+		// Lower the severity of new files on a known-good allowlist
+		if changes, err = applyAllowlist(cfg, changes); err != nil {
+			return err
+		}
 
-		// Output results
-		if jsonOutput {
-			// JSON output
-			jsonData, err := json.MarshalIndent(changes, "", "  ")
+		// Run content rules against added and modified files
+		engine, err := rules.Load(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to load rules: %v", err)
+		}
+		engine.Apply(changes)
+
+		// Show what changed in captured text files
+		if snapshots := content.NewSnapshotter(cfg); snapshots.Enabled() {
+			snapshots.AttachDiffs(changes.Details)
+		}
+
+		// Check changed files against the package databases
+		verifier, err := packages.NewVerifier(cfg)
+		if err != nil {
+			return err
+		}
+		if err := verifier.Annotate(changes.Details); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to verify packages: %v\n", err)
+		}
+
+		// Drop changes below the requested severity
+		if minSeverity != "" {
+			threshold, err := monitor.ParseSeverity(minSeverity)
 			if err != nil {
-				return fmt.Errorf("failed to marshal changes to JSON: %v", err)
+				return fmt.Errorf("invalid --min-severity: %v", err)
 			}
-			fmt.Println(string(jsonData))
-		} else {
-			// Text output
-			if len(changes.Added) == 0 && len(changes.Modified) == 0 && len(changes.Deleted) == 0 {
-				fmt.Println("No changes detected.")
-			} else {
-				fmt.Println("\nChanges detected:")
-				for _, file := range changes.Added {
-					fmt.Printf("[+] %s\n", file.Path)
-				}
-				for _, file := range changes.Modified {
-					fmt.Printf("[*] %s\n", file.Path)
-				}
-				for _, file := range changes.Deleted {
-					fmt.Printf("[-] %s\n", file.Path)
-				}
+			changes = changes.Filter(func(c *monitor.Change) bool {
+				return c.Severity >= threshold
+			})
+		}
+
+		// Output results; quiet mode prints nothing unless there are findings
+		if !quiet || changes.Count() > 0 {
+			r := report.New(baseline, baselinePath, currentState, source, changes)
+			r.ScanID = scanID
+			if err := writeReport(reporter, r, scanOutput); err != nil {
+				return err
+			}
+		}
+
+		// Run configured hooks and the quarantine, logging their results
+		// to stderr
+		stderrLog := logging.New(os.Stderr, logging.FormatText, logging.LevelInfo)
+		if !noHooks && len(changes.Details) > 0 {
+			runner := hooks.NewRunner(cfg, stderrLog)
+			if runner.Enabled() {
+				runner.Run(scanID, changes.Details)
+			}
+		}
+		// Files under another root are evidence and never moved
+		if !noQuarantine && !offline && len(changes.Details) > 0 {
+			responder := quarantine.NewResponder(cfg, stderrLog)
+			if responder.Enabled() {
+				responder.Run(scanID, changes.Details)
+			}
+		}
+
+		// Mail the results if requested
+		if sendEmail && len(changes.Details) > 0 {
+			email, err := notify.NewEmail(cfg)
+			if err != nil {
+				return err
+			}
+			if !email.Enabled() {
+				return fmt.Errorf("email is not configured: add an [email] section to fim.conf")
+			}
+			hostname, _ := os.Hostname()
+			subject := fmt.Sprintf("[FIM] %s: %d change(s) detected", hostname, len(changes.Details))
+			if err := email.Send(subject, "The scan found the following changes:", changes.Details); err != nil {
+				return fmt.Errorf("failed to send email: %v", err)
+			}
+		}
+
+		// Fail if any change of a selected type was found
+		for _, change := range changes.Details {
+			if failTypes[change.Type] {
+				return &exitError{code: ExitChanges}
 			}
 		}
 
@@ -146,8 +268,146 @@ and report any changes detected.`,
 	},
 }
 
+// scanCurrent scans the configured paths, below root if set, or reads them
+// from a tar archive or OCI image layout. It returns the current state and
+// where it was read from, for reports.
+func scanCurrent(cfg *config.Config, root, image string, verbose bool) (*storage.Baseline, string, error) {
+	if image != "" {
+		if root != "" {
+			return nil, "", fmt.Errorf("--root and --image cannot be combined")
+		}
+		// Package databases describe this host, not the image
+		cfg.Packages.Verify = []string{"off"}
+		if verbose {
+			fmt.Printf("Reading configured paths from image %s...\n", image)
+		}
+		state, err := archive.Load(cfg, image)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read image: %v", err)
+		}
+		return state, "image " + image, nil
+	}
+
+	s, err := newScanner(cfg, root)
+	if err != nil {
+		return nil, "", err
+	}
+	source := "live filesystem"
+	if s.Root() != "" {
+		source = "filesystem at " + s.Root()
+	}
+
+	// Print what we're scanning
+	if verbose {
+		if s.Root() != "" {
+			fmt.Printf("Scanning configured paths under %s...\n", s.Root())
+		} else {
+			fmt.Println("Scanning configured paths...")
+		}
+		for _, path := range cfg.Monitor.Paths {
+			fmt.Printf("  - %s\n", path)
+			// Check if it's a symlink
+			if realPath, err := s.Resolve(path); err == nil && realPath != filepath.Clean(path) {
+				fmt.Printf("    (symlink to: %s)\n", realPath)
+			}
+		}
+	}
+
+	state, err := s.ScanPaths()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to scan paths: %v", err)
+	}
+	return state, source, nil
+}
+
+// newScanner creates a scanner for the configured paths, reading them below
+// root if set. The package databases are then read from the root too, so
+// that changed files are verified against the image's own packages.
+func newScanner(cfg *config.Config, root string) (*scanner.Scanner, error) {
+	s := scanner.NewScanner(cfg)
+	if err := s.SetRoot(root); err != nil {
+		return nil, err
+	}
+	if s.Root() != "" {
+		cfg.Packages.DpkgDir = filepath.Join(s.Root(), cfg.Packages.DpkgDir)
+		cfg.Packages.RpmDir = filepath.Join(s.Root(), cfg.Packages.RpmDir)
+	}
+	return s, nil
+}
+
+// applyAllowlist lowers the severity of, or drops, new files found on the
+// imported allowlists
+func applyAllowlist(cfg *config.Config, changes *storage.Changes) (*storage.Changes, error) {
+	allowed, err := allowlist.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer allowed.Close()
+
+	changes, _, err = allowed.Apply(changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check allowlists: %v", err)
+	}
+	return changes, nil
+}
+
+// parseFailOn parses the --fail-on selector into the set of change types
+// that make the scan exit with ExitChanges. "none" never fails, and an
+// empty selector means the default of every type.
+func parseFailOn(selector string) (map[monitor.ChangeType]bool, error) {
+	if strings.TrimSpace(selector) == "" {
+		selector = defaultFailOn
+	}
+	types := make(map[monitor.ChangeType]bool)
+	for _, name := range strings.Split(selector, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+			// Tolerate trailing and doubled commas
+		case "added":
+			types[monitor.NewFile] = true
+		case "modified":
+			// Permission and ownership changes are modifications too
+			types[monitor.ModifiedFile] = true
+			types[monitor.PermissionChange] = true
+		case "deleted":
+			types[monitor.DeletedFile] = true
+		case "none":
+		default:
+			return nil, fmt.Errorf("invalid --fail-on value %q: expected added, modified, deleted or none", name)
+		}
+	}
+	return types, nil
+}
+
+// writeReport renders a report to the output file, or stdout if none is set
+func writeReport(reporter report.Reporter, r *report.Report, output string) error {
+	if output == "" {
+		return reporter.Write(os.Stdout, r)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	if err := reporter.Write(file, r); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write output file: %v", err)
+	}
+	return file.Close()
+}
+
 func init() {
 	rootCmd.AddCommand(scanCmd)
 	scanCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output results in JSON format")
+	scanCmd.Flags().StringVar(&outputFormat, "format", "text", "Output format ("+strings.Join(report.Formats(), ", ")+")")
+	scanCmd.Flags().StringVarP(&scanOutput, "output", "o", "", "Write the results to a file instead of stdout")
+	scanCmd.Flags().StringVar(&scanImage, "image", "", "Compare a tar archive or OCI image layout with the baseline instead of the file system")
+	scanCmd.Flags().StringVar(&scanRoot, "root", "", "Scan the configured paths below this directory, e.g. a mounted image, as if it were /")
+	scanCmd.Flags().StringVar(&minSeverity, "min-severity", "", "Only report changes at or above this severity (info, low, medium, high, critical)")
+	scanCmd.Flags().StringVar(&failOn, "fail-on", defaultFailOn, "Change types that make the scan exit with status 1 (added, modified, deleted or none)")
+	scanCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Print nothing unless changes are found")
+	scanCmd.Flags().BoolVar(&noHooks, "no-hooks", false, "Do not run configured hooks")
+	scanCmd.Flags().BoolVar(&noQuarantine, "no-quarantine", false, "Do not quarantine matching files")
+	scanCmd.Flags().BoolVar(&sendEmail, "email", false, "Email the scan results to the configured recipients")
 	scanCmd.Flags().StringVar(&interval, "interval", "", "Scan interval in daemon mode (e.g., 5m, 1h)")
 }
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/alert"
+	"github.com/spf13/cobra"
+)
+
+var (
+	silenceReason string
+	silenceList   bool
+	silenceRemove bool
+)
+
+var silenceCmd = &cobra.Command{
+	Use:   "silence <path-glob> <duration>",
+	Short: "Suppress daemon alerts for matching paths",
+	Long: `Suppress daemon alerts for paths matching a glob for a period of time,
+for example during planned maintenance:
+
+  fim silence '/etc/cron.d/*' 2h --reason "crontab rollout"
+
+Quote the glob so that the shell does not expand it. Silences are stored
+in ~/.fim/silences.json and survive daemon restarts. Drift that is still
+present when a silence expires is alerted on at the next scan.
+
+Use --list to show active silences and --remove to delete a silence.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		switch {
+		case silenceList:
+			return cobra.NoArgs(cmd, args)
+		case silenceRemove:
+			return cobra.ExactArgs(1)(cmd, args)
+		default:
+			return cobra.ExactArgs(2)(cmd, args)
+		}
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		silences, err := alert.LoadSilences(alert.GetDefaultSilencesPath())
+		if err != nil {
+			return err
+		}
+
+		// List active silences
+		if silenceList {
+			active := silences.Active()
+			if len(active) == 0 {
+				fmt.Println("No active silences.")
+				return nil
+			}
+			for _, s := range active {
+				fmt.Printf("%s until %s", s.Pattern, s.Until.Format(time.RFC3339))
+				if s.Reason != "" {
+					fmt.Printf(" (%s)", s.Reason)
+				}
+				fmt.Println()
+			}
+			return nil
+		}
+
+		// Remove a silence
+		if silenceRemove {
+			if silences.Remove(args[0]) == 0 {
+				return fmt.Errorf("no silence for %s", args[0])
+			}
+			if err := silences.Save(); err != nil {
+				return fmt.Errorf("failed to save silences: %v", err)
+			}
+			fmt.Printf("Removed silence for %s\n", args[0])
+			return nil
+		}
+
+		// Add a silence
+		duration, err := time.ParseDuration(args[1])
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("invalid duration %q: use a duration such as 30m or 2h", args[1])
+		}
+		s := silences.Add(args[0], duration, silenceReason)
+		if err := silences.Save(); err != nil {
+			return fmt.Errorf("failed to save silences: %v", err)
+		}
+
+		fmt.Printf("Silenced %s until %s\n", s.Pattern, s.Until.Format(time.RFC3339))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(silenceCmd)
+	silenceCmd.Flags().StringVar(&silenceReason, "reason", "", "Reason recorded with the silence")
+	silenceCmd.Flags().BoolVar(&silenceList, "list", false, "List active silences")
+	silenceCmd.Flags().BoolVar(&silenceRemove, "remove", false, "Remove the silence for a path glob")
+}
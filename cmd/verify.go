@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/rhinocodelab/IntegrityWatchdog/packages"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyAll  bool
+	verifyJSON bool
+)
+
+var verifyPackagesCmd = &cobra.Command{
+	Use:   "verify-packages",
+	Short: "Check packaged files in monitored paths against the package databases",
+	Long: `Check every file in the monitored paths that is owned by a dpkg or rpm
+package against the digest recorded by the package manager. Unlike 'fim
+scan', no baseline is needed.
+
+Files that differ from their package or are missing are listed, and the
+command exits with status 1 if there are any. Locally modified
+configuration files are only listed with --all.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %v", err)
+		}
+		verifier, err := packages.NewVerifier(cfg)
+		if err != nil {
+			return err
+		}
+		if !verifier.Enabled() {
+			return fmt.Errorf("no package database found: check the [packages] section of fim.conf")
+		}
+
+		results, err := verifier.VerifyAll(cfg.Monitor.Paths, cfg.IsExcluded)
+		if err != nil {
+			return err
+		}
+
+		// Count the results and keep the ones to show
+		counts := make(map[monitor.PackageStatus]int)
+		var shown []*packages.Result
+		for _, result := range results {
+			counts[result.Status]++
+			switch result.Status {
+			case monitor.PackageDiffers, monitor.PackageMissing:
+				shown = append(shown, result)
+			case monitor.PackageConffile, monitor.PackageUnverified:
+				if verifyAll {
+					shown = append(shown, result)
+				}
+			}
+		}
+
+		if verifyJSON {
+			data, err := json.MarshalIndent(shown, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal results to JSON: %v", err)
+			}
+			fmt.Println(string(data))
+		} else {
+			if len(shown) > 0 {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "STATUS\tPATH\tPACKAGE\tVERSION")
+				for _, result := range shown {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Status, result.Path, result.File.Package, result.File.Version)
+				}
+				w.Flush()
+				fmt.Println()
+			}
+			fmt.Printf("Checked %d packaged files: %d match, %d differ, %d missing, %d modified conffiles\n",
+				len(results), counts[monitor.PackageMatches], counts[monitor.PackageDiffers],
+				counts[monitor.PackageMissing], counts[monitor.PackageConffile])
+		}
+
+		if counts[monitor.PackageDiffers] > 0 || counts[monitor.PackageMissing] > 0 {
+			return &exitError{code: ExitChanges}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyPackagesCmd)
+	verifyPackagesCmd.Flags().BoolVar(&verifyAll, "all", false, "Also list modified conffiles and files that cannot be verified")
+	verifyPackagesCmd.Flags().BoolVar(&verifyJSON, "json", false, "Output results in JSON format")
+}
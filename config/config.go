@@ -5,7 +5,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/rhinocodelab/IntegrityWatchdog/logging"
 	"github.com/spf13/viper"
 )
 
@@ -17,10 +19,119 @@ type Config struct {
 	} `mapstructure:"monitor"`
 	Logging struct {
 		LogFile string `mapstructure:"logfile"`
+		Format  string `mapstructure:"format"`
+		Level   string `mapstructure:"level"`
+		Syslog  string `mapstructure:"syslog"`
+
+		// Rotation of the daemon log
+		MaxSize    int           `mapstructure:"max_size"`    // megabytes
+		MaxAge     time.Duration `mapstructure:"max_age"`     // e.g. 24h
+		MaxBackups int           `mapstructure:"max_backups"` // rotated segments to keep
+		Compress   bool          `mapstructure:"compress"`
 	} `mapstructure:"logging"`
 	Output struct {
 		Verbose bool `mapstructure:"verbose"`
 	} `mapstructure:"output"`
+	Hooks struct {
+		Timeout     time.Duration   `mapstructure:"timeout"`     // default per-hook timeout
+		Concurrency int             `mapstructure:"concurrency"` // hooks running at once
+		Commands    map[string]Hook `mapstructure:",remain"`     // one [hooks.<name>] section per hook
+	} `mapstructure:"hooks"`
+	Email  Email `mapstructure:"email"`
+	Alerts struct {
+		Throttle       int           `mapstructure:"throttle"`        // alerts per window, 0 disables
+		ThrottleWindow time.Duration `mapstructure:"throttle_window"` // e.g. 1m
+	} `mapstructure:"alerts"`
+	Severity struct {
+		Default    string                  `mapstructure:"default"`    // severity when no rule matches
+		Heuristics bool                    `mapstructure:"heuristics"` // built-in setuid/world-writable/executable rules
+		Rules      map[string]SeverityRule `mapstructure:",remain"`    // one [severity.<name>] section per rule
+	} `mapstructure:"severity"`
+	Content struct {
+		Capture []string `mapstructure:"capture"`  // globs of text files whose content is kept for diffs
+		MaxSize int64    `mapstructure:"max_size"` // bytes, larger files are not captured
+
+		Restore        []string `mapstructure:"restore"`          // globs of files kept for fim restore
+		RestoreMaxSize int64    `mapstructure:"restore_max_size"` // bytes, larger files are not kept
+	} `mapstructure:"content"`
+	Quarantine struct {
+		Paths       []string `mapstructure:"paths"`       // quarantine changes to files matching these globs
+		Changes     []string `mapstructure:"changes"`     // change types quarantined: added, modified
+		Executables bool     `mapstructure:"executables"` // only quarantine files with an exec bit
+		Dir         string   `mapstructure:"dir"`         // where quarantined files are kept
+	} `mapstructure:"quarantine"`
+	Packages struct {
+		Verify  []string `mapstructure:"verify"`   // auto, off or package managers: dpkg, rpm
+		DpkgDir string   `mapstructure:"dpkg_dir"` // dpkg database directory
+		RpmDir  string   `mapstructure:"rpm_dir"`  // rpm database directory
+
+		AutoAccept bool     `mapstructure:"auto_accept"` // fold package manager changes into the baseline
+		Logs       []string `mapstructure:"logs"`        // package manager logs read for transactions
+		Locks      []string `mapstructure:"locks"`       // lock files held during transactions
+	} `mapstructure:"packages"`
+	IOC struct {
+		Lists []string `mapstructure:"lists"` // known-bad hash lists: plain text, CSV or STIX JSON
+		Dir   string   `mapstructure:"dir"`   // where 'fim ioc import' keeps lists
+	} `mapstructure:"ioc"`
+	Allowlist struct {
+		Severity string `mapstructure:"severity"` // severity of new files on an allowlist
+		Report   bool   `mapstructure:"report"`   // still report new files on an allowlist
+		Dir      string `mapstructure:"dir"`      // where 'fim allowlist import' keeps indexes
+	} `mapstructure:"allowlist"`
+	Rules struct {
+		Dir      string `mapstructure:"dir"`      // directory of .yar rule files
+		MaxSize  int64  `mapstructure:"max_size"` // bytes, larger files are not scanned
+		Severity string `mapstructure:"severity"` // severity of matches of rules without a severity meta
+	} `mapstructure:"rules"`
+	Audit struct {
+		Enabled bool          `mapstructure:"enabled"` // attribute changes found by the daemon using the audit log
+		Log     string        `mapstructure:"log"`     // auditd log file
+		Window  time.Duration `mapstructure:"window"`  // largest distance between an audit event and a file's mtime
+		Key     string        `mapstructure:"key"`     // only use events of audit rules with this key
+	} `mapstructure:"audit"`
+	IMA struct {
+		Verify bool   `mapstructure:"verify"` // check new IMA measurements against the baseline in the daemon
+		Log    string `mapstructure:"log"`    // measurement list, ASCII or binary (default: from securityfs)
+	} `mapstructure:"ima"`
+	Containers struct {
+		Enabled  bool   `mapstructure:"enabled"`   // check running containers against their image baselines in the daemon
+		Runtime  string `mapstructure:"runtime"`   // docker or containerd
+		StateDir string `mapstructure:"state_dir"` // runtime state directory (default: from the runtime)
+		Proc     string `mapstructure:"proc"`      // procfs mount, for /proc/<pid>/root
+		Images   string `mapstructure:"images"`    // directory of image baselines (default ~/.fim/images)
+	} `mapstructure:"containers"`
+
+	offline bool // the monitored paths are read from an image, not this host
+}
+
+// SeverityRule maps path globs and change kinds to a severity
+type SeverityRule struct {
+	Paths []string `mapstructure:"paths"`
+	Kinds []string `mapstructure:"kinds"` // added, deleted, content, permission, ownership, setuid, world_writable, executable
+	Level string   `mapstructure:"level"` // info, low, medium, high or critical
+}
+
+// Email configures SMTP alerting
+type Email struct {
+	Server    string   `mapstructure:"server"` // host:port
+	From      string   `mapstructure:"from"`
+	To        []string `mapstructure:"to"`
+	Username  string   `mapstructure:"username"`
+	Password  string   `mapstructure:"password"`
+	StartTLS  bool     `mapstructure:"starttls"`
+	Immediate []string `mapstructure:"immediate"` // globs mailed without waiting for the digest
+	Digest    string   `mapstructure:"digest"`    // hourly, daily, off or a duration
+
+	ImmediateSeverity string `mapstructure:"immediate_severity"` // changes at or above this severity are mailed immediately
+}
+
+// Hook configures a command run when changes are detected
+type Hook struct {
+	Command string        `mapstructure:"command"`
+	Mode    string        `mapstructure:"mode"`    // "change" (once per change) or "batch" (once per scan)
+	Paths   []string      `mapstructure:"paths"`   // only run for changes matching these globs
+	Changes []string      `mapstructure:"changes"` // only run for these change types
+	Timeout time.Duration `mapstructure:"timeout"`
 }
 
 // DefaultConfig returns the default configuration
@@ -36,9 +147,74 @@ func DefaultConfig() *Config {
 	// Set default log file
 	cfg.Logging.LogFile = "/var/log/fim.log"
 
+	// Set default event log format and level
+	cfg.Logging.Format = "text"
+	cfg.Logging.Level = "info"
+
+	// Set default log rotation
+	cfg.Logging.MaxSize = 10
+	cfg.Logging.MaxBackups = 5
+	cfg.Logging.Compress = true
+
 	// Set default output settings
 	cfg.Output.Verbose = true
 
+	// Set default hook limits
+	cfg.Hooks.Timeout = 30 * time.Second
+	cfg.Hooks.Concurrency = 4
+
+	// Set default email settings
+	cfg.Email.StartTLS = true
+	cfg.Email.Digest = "hourly"
+
+	// Set default alert throttling
+	cfg.Alerts.Throttle = 100
+	cfg.Alerts.ThrottleWindow = time.Minute
+
+	// Set default severity classification
+	cfg.Severity.Default = "medium"
+	cfg.Severity.Heuristics = true
+
+	// Set default content capture limits
+	cfg.Content.MaxSize = 64 * 1024
+	cfg.Content.RestoreMaxSize = 10 * 1024 * 1024
+
+	// Set default quarantine selection
+	cfg.Quarantine.Changes = []string{"added"}
+	cfg.Quarantine.Executables = true
+
+	// Set default package verification
+	cfg.Packages.Verify = []string{"auto"}
+	cfg.Packages.DpkgDir = "/var/lib/dpkg"
+	cfg.Packages.RpmDir = "/var/lib/rpm"
+	cfg.Packages.Logs = []string{
+		"/var/log/apt/history.log",
+		"/var/log/dpkg.log",
+		"/var/log/dnf.rpm.log",
+		"/var/log/yum.log",
+	}
+	cfg.Packages.Locks = []string{
+		"/var/lib/dpkg/lock-frontend",
+		"/var/lib/dpkg/lock",
+		"/var/lib/rpm/.rpm.lock",
+	}
+
+	// Set default handling of allowlisted files
+	cfg.Allowlist.Severity = "low"
+	cfg.Allowlist.Report = true
+
+	// Set default content rule limits
+	cfg.Rules.MaxSize = 4 * 1024 * 1024
+	cfg.Rules.Severity = "high"
+
+	// Set default audit log correlation
+	cfg.Audit.Log = "/var/log/audit/audit.log"
+	cfg.Audit.Window = 2 * time.Minute
+
+	// Set default container runtime
+	cfg.Containers.Runtime = "docker"
+	cfg.Containers.Proc = "/proc"
+
 	return cfg
 }
 
@@ -62,11 +238,16 @@ func (c *Config) ValidateConfig() error {
 	}
 
 	// Validate and clean paths
+	c.Monitor.Paths = cleanList(c.Monitor.Paths)
+	c.Monitor.Exclude = cleanList(c.Monitor.Exclude)
 	for i, path := range c.Monitor.Paths {
 		// Remove trailing slashes
 		c.Monitor.Paths[i] = strings.TrimRight(path, "/")
 
 		// Check if path exists
+		if c.offline {
+			continue
+		}
 		if _, err := os.Stat(c.Monitor.Paths[i]); os.IsNotExist(err) {
 			return fmt.Errorf("monitor path does not exist: %s", path)
 		}
@@ -81,13 +262,150 @@ func (c *Config) ValidateConfig() error {
 		}
 	}
 
+	// Validate log format and level
+	if _, err := logging.ParseFormat(c.Logging.Format); err != nil {
+		return fmt.Errorf("invalid [logging] format: %v", err)
+	}
+	if c.Logging.MaxSize < 0 || c.Logging.MaxAge < 0 || c.Logging.MaxBackups < 0 {
+		return fmt.Errorf("invalid [logging] rotation settings: values must not be negative")
+	}
+	if c.Logging.Level != "" {
+		if _, err := logging.ParseLevel(c.Logging.Level); err != nil {
+			return fmt.Errorf("invalid [logging] level: %v", err)
+		}
+	}
+
+	// Validate hooks
+	if c.Hooks.Concurrency < 1 || c.Hooks.Timeout <= 0 {
+		return fmt.Errorf("invalid [hooks] settings: concurrency and timeout must be positive")
+	}
+	for name, hook := range c.Hooks.Commands {
+		if strings.TrimSpace(hook.Command) == "" {
+			return fmt.Errorf("hook %s: no command specified", name)
+		}
+		switch hook.Mode {
+		case "":
+			hook.Mode = "change"
+		case "change", "batch":
+		default:
+			return fmt.Errorf("hook %s: invalid mode %q: must be change or batch", name, hook.Mode)
+		}
+		hook.Paths = cleanList(hook.Paths)
+		hook.Changes = cleanList(hook.Changes)
+		for _, change := range hook.Changes {
+			switch change {
+			case "added", "modified", "deleted", "permission":
+			default:
+				return fmt.Errorf("hook %s: invalid change type %q", name, change)
+			}
+		}
+		if hook.Timeout <= 0 {
+			hook.Timeout = c.Hooks.Timeout
+		}
+		c.Hooks.Commands[name] = hook
+	}
+
+	// Validate alert throttling
+	if c.Alerts.Throttle < 0 || c.Alerts.ThrottleWindow < 0 {
+		return fmt.Errorf("invalid [alerts] settings: values must not be negative")
+	}
+	if c.Alerts.Throttle > 0 && c.Alerts.ThrottleWindow == 0 {
+		c.Alerts.ThrottleWindow = time.Minute
+	}
+
+	// Validate severity rules
+	for name, rule := range c.Severity.Rules {
+		rule.Paths = cleanList(rule.Paths)
+		rule.Kinds = cleanList(rule.Kinds)
+		if rule.Level == "" {
+			return fmt.Errorf("severity rule %s: no level specified", name)
+		}
+		c.Severity.Rules[name] = rule
+	}
+
+	// Validate content capture
+	c.Content.Capture = cleanList(c.Content.Capture)
+	c.Content.Restore = cleanList(c.Content.Restore)
+	if c.Content.MaxSize < 0 || c.Content.RestoreMaxSize < 0 {
+		return fmt.Errorf("invalid [content] settings: sizes must not be negative")
+	}
+
+	// Validate quarantine selection
+	c.Quarantine.Paths = cleanList(c.Quarantine.Paths)
+	c.Quarantine.Changes = cleanList(c.Quarantine.Changes)
+	for _, change := range c.Quarantine.Changes {
+		switch change {
+		case "added", "modified":
+		default:
+			return fmt.Errorf("invalid [quarantine] change type %q: must be added or modified", change)
+		}
+	}
+
+	// Validate package verification
+	c.Packages.Verify = cleanList(c.Packages.Verify)
+	c.Packages.Logs = cleanList(c.Packages.Logs)
+	c.Packages.Locks = cleanList(c.Packages.Locks)
+	for _, manager := range c.Packages.Verify {
+		switch manager {
+		case "auto", "off", "dpkg", "rpm":
+		default:
+			return fmt.Errorf("invalid [packages] verify value %q: must be auto, off, dpkg or rpm", manager)
+		}
+	}
+
+	// Validate known-bad hash lists
+	c.IOC.Lists = cleanList(c.IOC.Lists)
+
+	// Validate content rule limits
+	if c.Rules.MaxSize < 0 {
+		return fmt.Errorf("invalid [rules] max_size: must not be negative")
+	}
+
+	// Validate audit log correlation
+	if c.Audit.Enabled && c.Audit.Log == "" {
+		return fmt.Errorf("invalid [audit] section: no log specified")
+	}
+	if c.Audit.Window < 0 {
+		return fmt.Errorf("invalid [audit] window: must not be negative")
+	}
+
+	// Validate container monitoring
+	switch c.Containers.Runtime {
+	case "docker", "containerd":
+	default:
+		return fmt.Errorf("invalid [containers] runtime %q: must be docker or containerd", c.Containers.Runtime)
+	}
+
+	// Validate email settings
+	c.Email.To = cleanList(c.Email.To)
+	c.Email.Immediate = cleanList(c.Email.Immediate)
+	if c.Email.Server != "" {
+		if len(c.Email.To) == 0 {
+			return fmt.Errorf("invalid [email] section: no recipients specified")
+		}
+		if c.Email.From == "" {
+			return fmt.Errorf("invalid [email] section: no sender specified")
+		}
+	}
+
 	return nil
 }
 
 // LoadConfig loads the configuration from fim.conf
 func LoadConfig() (*Config, error) {
+	return loadConfig(DefaultConfig())
+}
+
+// LoadOfflineConfig loads the configuration for scanning a mounted image or
+// an archive, whose monitored paths need not exist on this host
+func LoadOfflineConfig() (*Config, error) {
 	cfg := DefaultConfig()
+	cfg.offline = true
+	return loadConfig(cfg)
+}
 
+// loadConfig reads fim.conf over the defaults in cfg and validates it
+func loadConfig(cfg *Config) (*Config, error) {
 	// Get config file path
 	configPath, err := GetConfigPath()
 	if err != nil {
@@ -103,6 +421,7 @@ func LoadConfig() (*Config, error) {
 	v := viper.New()
 	v.SetConfigFile(configPath)
 	v.SetConfigType("ini")
+	setDefaults(v, cfg)
 
 	// Read the config file
 	if err := v.ReadInConfig(); err != nil {
@@ -122,6 +441,18 @@ func LoadConfig() (*Config, error) {
 	return cfg, nil
 }
 
+// setDefaults registers the defaults of sections that are decoded into
+// named or map-collecting structs. Viper replaces such structs wholesale when
+// the section is present, so their defaults must come from Viper itself.
+func setDefaults(v *viper.Viper, cfg *Config) {
+	v.SetDefault("hooks.timeout", cfg.Hooks.Timeout)
+	v.SetDefault("hooks.concurrency", cfg.Hooks.Concurrency)
+	v.SetDefault("email.starttls", cfg.Email.StartTLS)
+	v.SetDefault("email.digest", cfg.Email.Digest)
+	v.SetDefault("severity.default", cfg.Severity.Default)
+	v.SetDefault("severity.heuristics", cfg.Severity.Heuristics)
+}
+
 // IsExcluded checks if a path should be excluded from monitoring
 func (c *Config) IsExcluded(path string) bool {
 	for _, exclude := range c.Monitor.Exclude {
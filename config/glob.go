@@ -0,0 +1,78 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// MatchPath reports whether path matches a glob pattern. Patterns use the
+// filepath.Match syntax, with "**" additionally matching any number of path
+// components. A pattern that matches a directory also matches everything
+// below it, so "/etc/ssh" and "/etc/*" both match /etc/ssh/sshd_config.
+func MatchPath(pattern, path string) bool {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return false
+	}
+
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/")) {
+			return true
+		}
+		if p == "/" || p == "." || p == filepath.Dir(p) {
+			return false
+		}
+	}
+}
+
+// MatchAny reports whether path matches any of the patterns
+func MatchAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if MatchPath(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path components against pattern components
+func matchSegments(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse repeated ** and try every possible split
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range path {
+				if matchSegments(pattern, path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(path) == 0 {
+			return false
+		}
+		if matched, err := filepath.Match(pattern[0], path[0]); err != nil || !matched {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+// cleanList trims the whitespace that comma-separated config values leave
+// around each entry and drops empty entries
+func cleanList(list []string) []string {
+	cleaned := make([]string, 0, len(list))
+	for _, item := range list {
+		if item = strings.TrimSpace(item); item != "" {
+			cleaned = append(cleaned, item)
+		}
+	}
+	return cleaned
+}
@@ -0,0 +1,200 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// Default state directories of the supported runtimes
+const (
+	DefaultDockerDir     = "/var/lib/docker"
+	DefaultContainerdDir = "/run/containerd/io.containerd.runtime.v2.task"
+)
+
+// Container is a running container found in the runtime state directory
+type Container struct {
+	ID      string
+	Name    string
+	Image   string // image reference the container was created from
+	Runtime string
+	PID     int
+
+	Root      string   // directory holding the merged root filesystem, "" if not reachable
+	UpperDir  string   // overlayfs upper directory holding the container's changes, "" if unknown
+	LowerDirs []string // overlayfs lower directories holding the image, topmost first; nil if unknown
+}
+
+// Info returns the identity of the container for attaching to changes
+func (c *Container) Info() *monitor.Container {
+	return &monitor.Container{ID: c.ID, Name: c.Name, Image: c.Image}
+}
+
+// String describes the container for people
+func (c *Container) String() string {
+	return c.Info().String()
+}
+
+// StateDir returns the configured runtime state directory, or the
+// runtime's default
+func StateDir(cfg *config.Config) string {
+	if cfg.Containers.StateDir != "" {
+		return cfg.Containers.StateDir
+	}
+	if cfg.Containers.Runtime == "containerd" {
+		return DefaultContainerdDir
+	}
+	return DefaultDockerDir
+}
+
+// Discover lists the running containers of the configured runtime,
+// ordered by name
+func Discover(cfg *config.Config) ([]*Container, error) {
+	dir := StateDir(cfg)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to read container runtime state: %v", err)
+	}
+
+	var containers []*Container
+	var err error
+	switch cfg.Containers.Runtime {
+	case "containerd":
+		containers, err = discoverContainerd(dir, cfg.Containers.Proc)
+	default:
+		containers, err = discoverDocker(dir, cfg.Containers.Proc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(containers, func(i, j int) bool {
+		if containers[i].Name != containers[j].Name {
+			return containers[i].Name < containers[j].Name
+		}
+		return containers[i].ID < containers[j].ID
+	})
+	return containers, nil
+}
+
+// Find returns the containers whose name or ID, or the start of it,
+// is one of names
+func Find(containers []*Container, names []string) ([]*Container, error) {
+	var found []*Container
+	for _, name := range names {
+		var match *Container
+		for _, c := range containers {
+			if c.Name == name || c.ID == name {
+				match = c
+				break
+			}
+			if strings.HasPrefix(c.ID, name) {
+				if match != nil {
+					return nil, fmt.Errorf("container ID prefix %s is ambiguous", name)
+				}
+				match = c
+			}
+		}
+		if match == nil {
+			return nil, fmt.Errorf("no running container %s", name)
+		}
+		found = append(found, match)
+	}
+	return found, nil
+}
+
+// processRoot returns /proc/<pid>/root if the process is running and its
+// root filesystem can be reached
+func processRoot(proc string, pid int) string {
+	if pid <= 0 {
+		return ""
+	}
+	root := filepath.Join(proc, strconv.Itoa(pid), "root")
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return ""
+	}
+	return root
+}
+
+// running reports whether a process exists
+func running(proc string, pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(proc, strconv.Itoa(pid)))
+	return err == nil
+}
+
+// mountLayers returns the upper and lower directories of the overlayfs
+// mounted at the root of a process, from its mountinfo
+func mountLayers(proc string, pid int) (string, []string) {
+	if pid <= 0 {
+		return "", nil
+	}
+	file, err := os.Open(filepath.Join(proc, strconv.Itoa(pid), "mountinfo"))
+	if err != nil {
+		return "", nil
+	}
+	defer file.Close()
+
+	// 1400 1300 0:52 / / rw,relatime - overlay overlay rw,lowerdir=...,upperdir=...,workdir=...
+	upper := ""
+	var lower []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[4] != "/" {
+			continue
+		}
+		sep := -1
+		for i, field := range fields {
+			if field == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || sep+3 >= len(fields) || fields[sep+1] != "overlay" {
+			continue
+		}
+		// The last mount on / is the one visible
+		upper, lower = "", nil
+		for _, option := range strings.Split(fields[sep+3], ",") {
+			if dir, ok := strings.CutPrefix(option, "upperdir="); ok {
+				upper = unescapeMount(dir)
+			}
+			if dirs, ok := strings.CutPrefix(option, "lowerdir="); ok {
+				for _, dir := range strings.Split(dirs, ":") {
+					lower = append(lower, unescapeMount(dir))
+				}
+			}
+		}
+	}
+	return upper, lower
+}
+
+// unescapeMount decodes the octal escapes of spaces and other special
+// characters in mountinfo fields
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,117 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+)
+
+// GetDefaultImagesDir returns the default directory of image baselines
+func GetDefaultImagesDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "fim-images"
+	}
+	return filepath.Join(homeDir, ".fim", "images")
+}
+
+// NormalizeImage returns the full form of an image reference, so that
+// "nginx" and "docker.io/library/nginx:latest" name the same image
+func NormalizeImage(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "sha256:") {
+		// Image IDs are used as they are
+		return ref
+	}
+	name, digest, hasDigest := strings.Cut(ref, "@")
+
+	if !hasDigest && !strings.Contains(name[strings.LastIndex(name, "/")+1:], ":") {
+		name += ":latest"
+	}
+	domain, _, found := strings.Cut(name, "/")
+	if !found || (!strings.ContainsAny(domain, ".:") && domain != "localhost") {
+		if !found {
+			name = "library/" + name
+		}
+		name = "docker.io/" + name
+	}
+	if hasDigest {
+		name += "@" + digest
+	}
+	return name
+}
+
+// Images holds the baselines of container images, one file per image,
+// loading them on demand and again when they are replaced
+type Images struct {
+	dir   string
+	cache map[string]*cachedBaseline
+}
+
+// cachedBaseline is a loaded image baseline and the mtime of its file
+type cachedBaseline struct {
+	modTime  time.Time
+	baseline *storage.Baseline
+}
+
+// OpenImages opens the [containers] images directory
+func OpenImages(cfg *config.Config) *Images {
+	dir := cfg.Containers.Images
+	if dir == "" {
+		dir = GetDefaultImagesDir()
+	}
+	return &Images{dir: dir, cache: make(map[string]*cachedBaseline)}
+}
+
+// Dir returns the directory of the image baselines
+func (i *Images) Dir() string {
+	return i.dir
+}
+
+// Path returns the file holding the baseline of an image
+func (i *Images) Path(image string) string {
+	name := strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(NormalizeImage(image))
+	return filepath.Join(i.dir, name+".json")
+}
+
+// Baseline returns the baseline of an image, or nil if there is none
+func (i *Images) Baseline(image string) (*storage.Baseline, error) {
+	if image == "" {
+		return nil, nil
+	}
+	path := i.Path(image)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		delete(i.cache, path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image baseline: %v", err)
+	}
+	if cached, ok := i.cache[path]; ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.baseline, nil
+	}
+
+	baseline, err := storage.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load baseline of image %s: %v", image, err)
+	}
+	i.cache[path] = &cachedBaseline{modTime: info.ModTime(), baseline: baseline}
+	return baseline, nil
+}
+
+// Save stores the baseline of an image
+func (i *Images) Save(image string, baseline *storage.Baseline) error {
+	if err := os.MkdirAll(i.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create images directory: %v", err)
+	}
+	if err := baseline.Save(i.Path(image)); err != nil {
+		return fmt.Errorf("failed to save image baseline: %v", err)
+	}
+	return nil
+}
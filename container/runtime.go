@@ -0,0 +1,203 @@
+package container
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// dockerConfig is the part of a Docker container's config.v2.json read here
+type dockerConfig struct {
+	ID     string `json:"ID"`
+	Name   string `json:"Name"`
+	Driver string `json:"Driver"`
+	Config struct {
+		Image string `json:"Image"`
+	} `json:"Config"`
+	State struct {
+		Running bool `json:"Running"`
+		Pid     int  `json:"Pid"`
+	} `json:"State"`
+}
+
+// discoverDocker lists the running containers of a Docker state
+// directory, such as /var/lib/docker:
+//
+//	containers/<id>/config.v2.json
+//	image/overlay2/layerdb/mounts/<id>/mount-id
+//	overlay2/<mount-id>/diff
+//	overlay2/<mount-id>/lower
+func discoverDocker(dir, proc string) ([]*Container, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, "containers"))
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []*Container
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, "containers", entry.Name(), "config.v2.json"))
+		if err != nil {
+			// Containers being created or removed have no readable config
+			continue
+		}
+		var cfg dockerConfig
+		if err := json.Unmarshal(data, &cfg); err != nil || cfg.ID == "" || !cfg.State.Running {
+			continue
+		}
+
+		c := &Container{
+			ID:      cfg.ID,
+			Name:    strings.TrimPrefix(cfg.Name, "/"),
+			Image:   cfg.Config.Image,
+			Runtime: "docker",
+			PID:     cfg.State.Pid,
+			Root:    processRoot(proc, cfg.State.Pid),
+		}
+		if cfg.Driver != "" {
+			if mountID, err := os.ReadFile(filepath.Join(dir, "image", cfg.Driver, "layerdb", "mounts", cfg.ID, "mount-id")); err == nil {
+				layer := filepath.Join(dir, cfg.Driver, strings.TrimSpace(string(mountID)))
+				if info, err := os.Stat(filepath.Join(layer, "diff")); err == nil && info.IsDir() {
+					c.UpperDir = filepath.Join(layer, "diff")
+					c.LowerDirs = lowerDirs(filepath.Join(dir, cfg.Driver), layer)
+				}
+			}
+		}
+		if c.UpperDir == "" {
+			c.UpperDir, c.LowerDirs = mountLayers(proc, c.PID)
+		}
+		containers = append(containers, c)
+	}
+	return containers, nil
+}
+
+// lowerDirs returns the lower directories of a layer of Docker's overlay2
+// driver, listed in its lower file as short links such as "l/ABC:l/DEF"
+// relative to the driver directory, or nil if they cannot be read
+func lowerDirs(driver, layer string) []string {
+	data, err := os.ReadFile(filepath.Join(layer, "lower"))
+	lower := strings.TrimSpace(string(data))
+	if err != nil || lower == "" {
+		return nil
+	}
+	var dirs []string
+	for _, link := range strings.Split(lower, ":") {
+		dir, err := filepath.EvalSymlinks(filepath.Join(driver, link))
+		if err != nil {
+			return nil
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// bundleConfig is the part of an OCI runtime bundle's config.json read here
+type bundleConfig struct {
+	Hostname    string            `json:"hostname"`
+	Annotations map[string]string `json:"annotations"`
+	Root        struct {
+		Path string `json:"path"`
+	} `json:"root"`
+}
+
+// Annotations set by the CRI plugin of containerd, used by Kubernetes
+const (
+	annotationType      = "io.kubernetes.cri.container-type"
+	annotationName      = "io.kubernetes.cri.container-name"
+	annotationSandbox   = "io.kubernetes.cri.sandbox-name"
+	annotationNamespace = "io.kubernetes.cri.sandbox-namespace"
+	annotationImage     = "io.kubernetes.cri.image-name"
+)
+
+// discoverContainerd lists the running containers of a containerd task
+// state directory, such as /run/containerd/io.containerd.runtime.v2.task,
+// which holds a bundle per namespace and container:
+//
+//	<namespace>/<id>/config.json
+//	<namespace>/<id>/init.pid
+//	<namespace>/<id>/rootfs
+func discoverContainerd(dir, proc string) ([]*Container, error) {
+	namespaces, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []*Container
+	for _, ns := range namespaces {
+		if !ns.IsDir() {
+			continue
+		}
+		bundles, err := os.ReadDir(filepath.Join(dir, ns.Name()))
+		if err != nil {
+			continue
+		}
+		for _, entry := range bundles {
+			if c := readBundle(filepath.Join(dir, ns.Name(), entry.Name()), proc); c != nil {
+				containers = append(containers, c)
+			}
+		}
+	}
+	return containers, nil
+}
+
+// readBundle reads the container of a bundle, or returns nil if it is not
+// a running application container
+func readBundle(bundle, proc string) *Container {
+	data, err := os.ReadFile(filepath.Join(bundle, "init.pid"))
+	if err != nil {
+		return nil
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || !running(proc, pid) {
+		return nil
+	}
+	data, err = os.ReadFile(filepath.Join(bundle, "config.json"))
+	if err != nil {
+		return nil
+	}
+	var cfg bundleConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil
+	}
+	annotations := cfg.Annotations
+	if annotations[annotationType] == "sandbox" {
+		// Pod sandboxes only hold the pause process
+		return nil
+	}
+
+	c := &Container{
+		ID:      filepath.Base(bundle),
+		Name:    annotations[annotationName],
+		Image:   annotations[annotationImage],
+		Runtime: "containerd",
+		PID:     pid,
+		Root:    processRoot(proc, pid),
+	}
+	if sandbox := annotations[annotationSandbox]; sandbox != "" && c.Name != "" {
+		c.Name = sandbox + "/" + c.Name
+		if ns := annotations[annotationNamespace]; ns != "" {
+			c.Name = ns + "/" + c.Name
+		}
+	}
+	if c.Name == "" {
+		c.Name = cfg.Hostname
+	}
+
+	// The bundle's rootfs is the merged mount, reachable without entering
+	// the container's mount namespace
+	if c.Root == "" {
+		rootfs := cfg.Root.Path
+		if rootfs == "" {
+			rootfs = "rootfs"
+		}
+		if !filepath.IsAbs(rootfs) {
+			rootfs = filepath.Join(bundle, rootfs)
+		}
+		if info, err := os.Stat(rootfs); err == nil && info.IsDir() {
+			c.Root = rootfs
+		}
+	}
+	c.UpperDir, c.LowerDirs = mountLayers(proc, pid)
+	return c
+}
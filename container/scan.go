@@ -0,0 +1,355 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/rhinocodelab/IntegrityWatchdog/scanner"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+	"golang.org/x/sys/unix"
+)
+
+// Scan returns the current state of the monitored paths in a container.
+// The merged root filesystem is scanned if it can be reached; otherwise the
+// changes in the overlayfs upper directory are applied to the image
+// baseline.
+func Scan(cfg *config.Config, c *Container, image *storage.Baseline) (*storage.Baseline, error) {
+	if c.Root != "" {
+		s := scanner.NewScanner(cfg)
+		if err := s.SetRoot(c.Root); err != nil {
+			return nil, err
+		}
+		return s.ScanPaths()
+	}
+	if c.UpperDir != "" {
+		return applyUpper(cfg, image, c.UpperDir, c.LowerDirs)
+	}
+	return nil, fmt.Errorf("the root filesystem of container %s cannot be reached", c)
+}
+
+// Annotate marks changes as found in a container
+func Annotate(changes []*monitor.Change, c *Container) {
+	info := c.Info()
+	for _, change := range changes {
+		change.Container = info
+	}
+}
+
+// applyUpper returns the image baseline with the entries of an overlayfs
+// upper directory applied. Deleted files are whiteouts: character devices
+// with device number 0, and directories replacing the image's are opaque.
+// Symlinks are resolved through the layers as the container sees them.
+func applyUpper(cfg *config.Config, image *storage.Baseline, upper string, lower []string) (*storage.Baseline, error) {
+	state := newMerged(image)
+	layers := newOverlay(image, upper, lower)
+
+	err := filepath.Walk(upper, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(upper, path)
+		if err != nil || rel == "." {
+			return nil
+		}
+		logical := "/" + filepath.ToSlash(rel)
+
+		choice := selected(cfg, logical)
+		if choice == skip {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isWhiteout(info) {
+			state.remove(logical, true)
+			return nil
+		}
+		existing := state.get(logical)
+		if info.IsDir() && isOpaque(path) {
+			// An opaque directory hides everything the image holds below it
+			state.remove(logical, true)
+		}
+		if choice == descend {
+			return nil
+		}
+
+		fileInfo, err := monitor.GetFileInfo(path)
+		if err != nil {
+			return err
+		}
+		fileInfo.Path, fileInfo.Source = logical, path
+		if fileInfo.IsSymlink {
+			// Symlinks are recorded with their target, as for live scans
+			if target, err := layers.resolve(logical); err == nil {
+				fileInfo.Path = fmt.Sprintf("%s -> %s", logical, target)
+			}
+		}
+		if existing != nil && existing.IsDir && fileInfo.IsDir {
+			// A directory is copied up to hold a changed entry. Its size and
+			// modification time change with the entries added or removed,
+			// which are reported themselves, so the image's are kept.
+			fileInfo.Size, fileInfo.ModTime = existing.Size, existing.ModTime
+		}
+
+		// A directory copied up keeps the lower entries it holds; anything
+		// else replaces what was at its path
+		state.remove(logical, !fileInfo.IsDir)
+		state.add(fileInfo.Path, fileInfo)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upper directory: %v", err)
+	}
+	return state.baseline, nil
+}
+
+// merged is the baseline of a container as the upper directory is applied
+// to the image, with its entries indexed by directory
+type merged struct {
+	baseline *storage.Baseline
+	keys     map[string]string          // key of the entry of each path
+	children map[string]map[string]bool // entries of each directory
+}
+
+// newMerged creates the state of a container from the image baseline
+func newMerged(image *storage.Baseline) *merged {
+	m := &merged{
+		baseline: storage.NewBaseline(),
+		keys:     make(map[string]string),
+		children: make(map[string]map[string]bool),
+	}
+	for key, info := range image.Files {
+		m.add(key, info)
+	}
+	return m
+}
+
+// add records an entry under its key, symlinks being recorded with their
+// target
+func (m *merged) add(key string, info *monitor.FileInfo) {
+	name, _, _ := strings.Cut(key, " -> ")
+	m.baseline.Files[key] = info
+	m.keys[name] = key
+	for ; name != "/"; name = filepath.Dir(name) {
+		dir := filepath.Dir(name)
+		if m.children[dir][name] {
+			break
+		}
+		if m.children[dir] == nil {
+			m.children[dir] = make(map[string]bool)
+		}
+		m.children[dir][name] = true
+	}
+}
+
+// get returns the entry recorded for a path, or nil
+func (m *merged) get(name string) *monitor.FileInfo {
+	key, ok := m.keys[name]
+	if !ok {
+		return nil
+	}
+	return m.baseline.Files[key]
+}
+
+// remove deletes the entry recorded for a path, and everything below it if
+// all is set
+func (m *merged) remove(name string, all bool) {
+	if all {
+		for child := range m.children[name] {
+			m.remove(child, true)
+		}
+		delete(m.children, name)
+		delete(m.children[filepath.Dir(name)], name)
+	}
+	if key, ok := m.keys[name]; ok {
+		delete(m.baseline.Files, key)
+		delete(m.keys, name)
+	}
+}
+
+// selection is what applyUpper does with an entry
+type selection int
+
+const (
+	skip    selection = iota // outside the monitored paths, or excluded
+	descend                  // a directory above a monitored path
+	record                   // in a monitored path
+)
+
+// selected decides whether an entry of the upper directory is monitored
+func selected(cfg *config.Config, path string) selection {
+	result := skip
+	for _, top := range cfg.Monitor.Paths {
+		switch {
+		case path == top || strings.HasPrefix(path, strings.TrimSuffix(top, "/")+"/"):
+			for p := path; len(p) >= len(top); p = filepath.Dir(p) {
+				if cfg.IsExcluded(p) {
+					return skip
+				}
+				if p == "/" {
+					break
+				}
+			}
+			return record
+		case strings.HasPrefix(top, path+"/"):
+			result = descend
+		}
+	}
+	return result
+}
+
+// isWhiteout reports whether an upper directory entry hides a lower file
+func isWhiteout(info os.FileInfo) bool {
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && stat.Rdev == 0
+}
+
+// opaqueAttrs are the extended attributes marking an overlayfs directory
+// that hides the entries of the layers below it
+var opaqueAttrs = []string{"trusted.overlay.opaque", "user.overlay.opaque"}
+
+// isOpaque reports whether a directory of a layer is opaque
+func isOpaque(path string) bool {
+	value := make([]byte, 1)
+	for _, attr := range opaqueAttrs {
+		if n, err := unix.Lgetxattr(path, attr, value); err == nil && n == 1 && value[0] == 'y' {
+			return true
+		}
+	}
+	return false
+}
+
+// maxLinks bounds the symlinks followed when resolving a path in a
+// container
+const maxLinks = 40
+
+// overlay is the root filesystem of a container as merged from its
+// overlayfs layers. Where the lower directories are unknown, the image
+// baseline stands in for them: its symlinks are recorded with their
+// resolved targets, and paths it does not hold are taken to exist.
+type overlay struct {
+	layers []string          // upper directory, then the lower ones
+	known  bool              // whether the lower directories are known
+	links  map[string]string // symlinks of the image baseline and their targets
+}
+
+// newOverlay creates the merged view of the layers of a container
+func newOverlay(image *storage.Baseline, upper string, lower []string) *overlay {
+	o := &overlay{
+		layers: append([]string{upper}, lower...),
+		known:  lower != nil,
+		links:  make(map[string]string),
+	}
+	if !o.known {
+		for key, info := range image.Files {
+			if link, target, ok := strings.Cut(key, " -> "); ok && info.IsSymlink {
+				o.links[link] = target
+			}
+		}
+	}
+	return o
+}
+
+// resolve returns a path with all symlinks resolved, as seen from inside
+// the container
+func (o *overlay) resolve(name string) (string, error) {
+	resolved := "/"
+	pending := strings.Split(name, "/")
+	for links := 0; len(pending) > 0; {
+		elem := pending[0]
+		pending = pending[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, elem)
+		target, symlink, ok := o.lookup(next)
+		if !ok {
+			return "", fmt.Errorf("%s: no such file or directory", next)
+		}
+		if !symlink {
+			resolved = next
+			continue
+		}
+
+		if links++; links > maxLinks {
+			return "", fmt.Errorf("too many levels of symbolic links: %s", name)
+		}
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		pending = append(strings.Split(target, "/"), pending...)
+	}
+	return resolved, nil
+}
+
+// lookup returns whether a path, whose directory holds no symlinks, exists
+// in the merged filesystem, and its target if it is a symlink
+func (o *overlay) lookup(name string) (target string, symlink, ok bool) {
+	layers, opaque := o.dirs(filepath.Dir(name))
+	for _, layer := range layers {
+		path := filepath.Join(layer, name)
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		if isWhiteout(info) {
+			return "", false, false
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return "", false, true
+		}
+		target, err := os.Readlink(path)
+		return target, err == nil, err == nil
+	}
+	if o.known || opaque {
+		return "", false, false
+	}
+	target, symlink = o.links[name]
+	return target, symlink, true
+}
+
+// dirs returns the layers contributing entries to a directory, topmost
+// first, and whether an opaque directory hides the layers below them. An
+// entry other than a directory hides the layers below it, so that no
+// symlink of a layer is followed on the host.
+func (o *overlay) dirs(dir string) (layers []string, opaque bool) {
+	live := o.layers
+	prefix := "/"
+	for _, elem := range strings.Split(dir, "/") {
+		if elem == "" {
+			continue
+		}
+		prefix = filepath.Join(prefix, elem)
+		var next []string
+		for _, layer := range live {
+			path := filepath.Join(layer, prefix)
+			info, err := os.Lstat(path)
+			if err != nil {
+				continue
+			}
+			if !info.IsDir() {
+				break
+			}
+			next = append(next, layer)
+			if isOpaque(path) {
+				opaque = true
+				break
+			}
+		}
+		live = next
+	}
+	return live, opaque
+}
@@ -0,0 +1,288 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/scanner"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+	"golang.org/x/sys/unix"
+)
+
+const testID = "3f4e5d6c7b8a9f0e1d2c3b4a5f6e7d8c9b0a1f2e3d4c5b6a7f8e9d0c1b2a3f4e"
+
+// layout creates files below dir: names ending in "/" are directories,
+// opaque ones with content of "opaque", content of "->x" makes a symlink
+// to x and content of "whiteout" a whiteout
+func layout(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		content := files[name]
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		switch {
+		case strings.HasSuffix(name, "/"):
+			err = os.MkdirAll(path, 0755)
+			if err == nil && content == "opaque" {
+				if err := unix.Setxattr(path, "user.overlay.opaque", []byte("y"), 0); err != nil {
+					t.Skipf("cannot mark directories opaque: %v", err)
+				}
+			}
+		case strings.HasPrefix(content, "->"):
+			err = os.Symlink(content[2:], path)
+		case content == "whiteout":
+			if err := unix.Mknod(path, unix.S_IFCHR, 0); err != nil {
+				t.Skipf("cannot create whiteouts: %v", err)
+			}
+		default:
+			err = os.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// image is the lower layer of the test containers: /bin is a symlink
+// outside the monitored /etc
+var image = map[string]string{
+	"etc/":           "",
+	"etc/hosts":      "127.0.0.1 localhost",
+	"etc/old":        "old",
+	"etc/app/":       "",
+	"etc/app/a.conf": "a",
+	"etc/conf":       "->app",
+	"etc/alt":        "->conf/a.conf",
+	"bin":            "->usr/bin",
+	"usr/bin/tool":   "tool",
+}
+
+// upper is the upper layer of the test containers. /etc/app is copied up
+// to hold a new file, /etc/alt is copied up unchanged and /etc/tool links
+// through /bin.
+var upper = map[string]string{
+	"etc/app/":          "",
+	"etc/app/new.conf":  "new",
+	"etc/hosts":         "10.0.0.1 evil",
+	"etc/old":           "whiteout",
+	"etc/alt":           "->conf/a.conf",
+	"etc/tool":          "->/bin/tool",
+	"var/log/messages":  "not monitored",
+	"etc/app/.hidden/":  "",
+	"etc/app/.hidden/x": "x",
+}
+
+// setupLayers creates the lower and upper layers and the baseline of the
+// image, and returns the directories of the layers
+func setupLayers(t *testing.T, dir string, upper map[string]string) (string, string, *storage.Baseline, *config.Config) {
+	t.Helper()
+	lower := filepath.Join(dir, "lower")
+	layout(t, lower, image)
+	cfg := config.DefaultConfig()
+	cfg.Monitor.Paths = []string{"/etc"}
+	cfg.Monitor.Exclude = []string{"/etc/app/.hidden"}
+	s := scanner.NewScanner(cfg)
+	if err := s.SetRoot(lower); err != nil {
+		t.Fatal(err)
+	}
+	baseline, err := s.ScanPaths()
+	if err != nil {
+		t.Fatalf("ScanPaths: %v", err)
+	}
+
+	diff := filepath.Join(dir, "layer", "diff")
+	layout(t, diff, upper)
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(diff, "etc", "app"), later, later)
+	return lower, diff, baseline, cfg
+}
+
+// drift returns the changes between the image and a container as
+// "type path" lines
+func drift(t *testing.T, cfg *config.Config, c *Container, image *storage.Baseline) string {
+	t.Helper()
+	current, err := Scan(cfg, c, image)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	var lines []string
+	for _, change := range image.Compare(current).Details {
+		lines = append(lines, change.Type.String()+" "+change.Path)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestDockerUpperDirectory(t *testing.T) {
+	dir := t.TempDir()
+	state := filepath.Join(dir, "docker")
+	proc := filepath.Join(dir, "proc")
+	os.Mkdir(proc, 0755)
+
+	lower, diff, baseline, cfg := setupLayers(t, dir, upper)
+	layout(t, state, map[string]string{
+		"containers/" + testID + "/config.v2.json": fmt.Sprintf(
+			`{"ID":%q,"Name":"/web","Driver":"overlay2","Config":{"Image":"nginx:1.25"},"State":{"Running":true,"Pid":4242}}`, testID),
+		"containers/stopped/config.v2.json":                     `{"ID":"stopped","State":{"Running":false}}`,
+		"image/overlay2/layerdb/mounts/" + testID + "/mount-id": "m1",
+		"overlay2/m1":          "->" + filepath.Dir(diff),
+		"overlay2/l/LOWER":     "->" + lower,
+		"overlay2/other/diff/": "",
+	})
+	layout(t, filepath.Dir(diff), map[string]string{"lower": "l/LOWER", "work/": ""})
+	cfg.Containers.StateDir = state
+	cfg.Containers.Proc = proc
+
+	containers, err := Discover(cfg)
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("found %d containers, want 1", len(containers))
+	}
+	c := containers[0]
+	if c.Name != "web" || c.Image != "nginx:1.25" || c.Root != "" {
+		t.Errorf("container = %+v", c)
+	}
+	if len(c.LowerDirs) != 1 || c.LowerDirs[0] != lower {
+		t.Errorf("lower directories %v, want %s", c.LowerDirs, lower)
+	}
+
+	// The copied-up directories and symlink match the image, and the
+	// new symlink is resolved through the image's /bin
+	want := strings.Join([]string{
+		"added /etc/app/new.conf",
+		"modified /etc/hosts",
+		"added /etc/tool -> /usr/bin/tool",
+		"deleted /etc/old",
+	}, "\n")
+	if got := drift(t, cfg, c, baseline); got != want {
+		t.Errorf("drift:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestContainerdMountinfo(t *testing.T) {
+	dir := t.TempDir()
+	state := filepath.Join(dir, "containerd")
+	proc := filepath.Join(dir, "proc")
+
+	lower, diff, baseline, cfg := setupLayers(t, dir, upper)
+	bundle := "k8s.io/" + testID + "/"
+	layout(t, state, map[string]string{
+		bundle + "init.pid": "4242\n",
+		bundle + "config.json": `{"hostname":"web-0","annotations":{
+			"io.kubernetes.cri.container-type":"container",
+			"io.kubernetes.cri.container-name":"nginx",
+			"io.kubernetes.cri.sandbox-name":"web-0",
+			"io.kubernetes.cri.sandbox-namespace":"prod",
+			"io.kubernetes.cri.image-name":"nginx:1.25"},"root":{"path":"missing"}}`,
+		"k8s.io/sandbox/init.pid":    "4343\n",
+		"k8s.io/sandbox/config.json": `{"annotations":{"io.kubernetes.cri.container-type":"sandbox"}}`,
+	})
+	// The spaces in the layer paths are escaped as in mountinfo
+	escape := strings.NewReplacer(" ", `\040`)
+	layout(t, proc, map[string]string{
+		"4242/mountinfo": fmt.Sprintf("22 1 8:1 / / rw - ext4 /dev/sda1 rw\n"+
+			"1400 1300 0:52 / / rw,relatime - overlay overlay rw,lowerdir=%s,upperdir=%s,workdir=/w\n"+
+			"1401 1400 0:53 / /proc rw - proc proc rw\n", escape.Replace(lower), escape.Replace(diff)),
+		"4343/mountinfo": "",
+	})
+	cfg.Containers.Runtime = "containerd"
+	cfg.Containers.StateDir = state
+	cfg.Containers.Proc = proc
+
+	containers, err := Discover(cfg)
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("found %d containers, want 1", len(containers))
+	}
+	c := containers[0]
+	if c.Name != "prod/web-0/nginx" || c.UpperDir != diff || len(c.LowerDirs) != 1 || c.LowerDirs[0] != lower {
+		t.Errorf("container = %+v", c)
+	}
+	want := strings.Join([]string{
+		"added /etc/app/new.conf",
+		"modified /etc/hosts",
+		"added /etc/tool -> /usr/bin/tool",
+		"deleted /etc/old",
+	}, "\n")
+	if got := drift(t, cfg, c, baseline); got != want {
+		t.Errorf("drift:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnknownLowerDirectories(t *testing.T) {
+	dir := t.TempDir()
+	_, diff, baseline, cfg := setupLayers(t, dir, upper)
+
+	// Without the lower directories, the image baseline stands in for
+	// them. The copied-up symlink resolves as in the image; /bin is not
+	// in the baseline, so the new link is recorded as written.
+	c := &Container{ID: testID, UpperDir: diff}
+	want := strings.Join([]string{
+		"added /etc/app/new.conf",
+		"modified /etc/hosts",
+		"added /etc/tool -> /bin/tool",
+		"deleted /etc/old",
+	}, "\n")
+	if got := drift(t, cfg, c, baseline); got != want {
+		t.Errorf("drift:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestOverlayDoesNotFollowLayerSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(dir, "outside")
+	layout(t, outside, map[string]string{"secret": "x"})
+	upperDir := filepath.Join(dir, "upper")
+	lowerDir := filepath.Join(dir, "lower")
+	// The upper directory replaces the lower symlink to the host with a
+	// directory, which hides the lower entries below it
+	layout(t, upperDir, map[string]string{"data/": "", "data/link": "->secret"})
+	layout(t, lowerDir, map[string]string{"data": "->" + outside})
+
+	o := newOverlay(storage.NewBaseline(), upperDir, []string{lowerDir})
+	if target, err := o.resolve("/data/link"); err == nil {
+		t.Errorf("resolved through a lower symlink to %s", target)
+	}
+}
+
+func TestOpaqueDirectory(t *testing.T) {
+	dir := t.TempDir()
+	// /etc/app is replaced rather than copied up, so that the image's
+	// a.conf is hidden, and links into it no longer resolve
+	lower, diff, baseline, cfg := setupLayers(t, dir, map[string]string{
+		"etc/app/":         "opaque",
+		"etc/app/new.conf": "new",
+		"etc/link":         "->app/a.conf",
+	})
+
+	for _, c := range []*Container{
+		{ID: testID, UpperDir: diff, LowerDirs: []string{lower}},
+		{ID: testID, UpperDir: diff},
+	} {
+		want := strings.Join([]string{
+			"added /etc/app/new.conf",
+			"added /etc/link",
+			"deleted /etc/app/a.conf",
+		}, "\n")
+		if got := drift(t, cfg, c, baseline); got != want {
+			t.Errorf("drift with lower directories %v:\n%s\nwant:\n%s", c.LowerDirs, got, want)
+		}
+	}
+}
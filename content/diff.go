@@ -0,0 +1,229 @@
+package content
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change
+const contextLines = 3
+
+// Limits on the work of a diff. The edit script search takes time in the
+// number of lines times the edit distance and memory in the square of the
+// edit distance; larger diffs are reported as the files differing.
+const (
+	maxDiffLines = 200000
+	maxEdits     = 2000
+)
+
+// op is a single line of an edit script
+type op struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// Unified returns a unified diff between old and new, or an empty string if
+// they are equal. Files too large or too different to diff are only
+// reported as differing.
+func Unified(oldName, newName string, old, new []byte) string {
+	a, b := splitLines(old), splitLines(new)
+	if len(a)+len(b) > maxDiffLines {
+		return differ(oldName, newName)
+	}
+	ops, ok := diffLines(a, b, maxEdits)
+	if !ok {
+		return differ(oldName, newName)
+	}
+
+	var out strings.Builder
+	for _, h := range hunks(ops) {
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		out.WriteString(h)
+	}
+	return out.String()
+}
+
+// differ is the diff of files whose changes are not shown
+func differ(oldName, newName string) string {
+	return fmt.Sprintf("Files %s and %s differ\n", oldName, newName)
+}
+
+// splitLines splits text into lines without their terminators
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	text := string(bytes.TrimSuffix(data, []byte("\n")))
+	return strings.Split(text, "\n")
+}
+
+// diffLines computes a shortest edit script from a to b using Myers'
+// algorithm. It gives up, returning false, if the script needs more than
+// limit insertions and deletions.
+func diffLines(a, b []string, limit int) ([]op, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	trace := make([][]int, 0, 16)
+
+	// Find the length of the shortest edit script, remembering each
+	// frontier so that the path can be reconstructed. Only the diagonals
+	// -d-1..d+1 that step d reads are kept.
+	var d int
+search:
+	for d = 0; d <= max; d++ {
+		if d > limit {
+			return nil, false
+		}
+		snapshot := make([]int, 2*d+3)
+		copy(snapshot, v[offset-d-1:offset+d+2])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk the trace backwards to recover the edit script
+	ops := make([]op, 0, n+m)
+	x, y := n, m
+	for ; d > 0; d-- {
+		snapshot, base := trace[d], d+1
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && snapshot[base+k-1] < snapshot[base+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := snapshot[base+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, op{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, op{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, op{'-', a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, op{' ', a[x]})
+	}
+
+	// Reverse into forward order
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops, true
+}
+
+// hunks groups an edit script into unified diff hunks with context
+func hunks(ops []op) []string {
+	var result []string
+
+	for i := 0; i < len(ops); {
+		// Find the next change
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		// Extend the hunk until there are more than 2*context unchanged
+		// lines in a row or the script ends
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*contextLines {
+				end += contextLines
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = run
+		}
+
+		// Line numbers of the hunk in both files
+		oldStart, newStart := 1, 1
+		for _, o := range ops[:start] {
+			if o.kind != '+' {
+				oldStart++
+			}
+			if o.kind != '-' {
+				newStart++
+			}
+		}
+		oldCount, newCount := 0, 0
+		var body strings.Builder
+		for _, o := range ops[start:end] {
+			if o.kind != '+' {
+				oldCount++
+			}
+			if o.kind != '-' {
+				newCount++
+			}
+			body.WriteByte(o.kind)
+			body.WriteString(o.line)
+			body.WriteByte('\n')
+		}
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+
+		result = append(result, fmt.Sprintf("@@ -%s +%s @@\n%s",
+			hunkRange(oldStart, oldCount), hunkRange(newStart, newCount), body.String()))
+		i = end
+	}
+
+	return result
+}
+
+// hunkRange formats a hunk range, omitting the count when it is one
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
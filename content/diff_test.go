@@ -0,0 +1,132 @@
+package content
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"both empty", "", "", ""},
+		{"changed line", "a\nb\nc\n", "a\nB\nc\n",
+			"--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"added to empty", "", "x\n",
+			"--- a/f\n+++ b/f\n@@ -0,0 +1 @@\n+x\n"},
+		{"all deleted", "x\ny\n", "",
+			"--- a/f\n+++ b/f\n@@ -1,2 +0,0 @@\n-x\n-y\n"},
+		{"context is trimmed", "1\n2\n3\n4\n5\n6\n7\n8\n", "1\n2\n3\n4\n5\n6\n7\nEIGHT\n",
+			"--- a/f\n+++ b/f\n@@ -5,4 +5,4 @@\n 5\n 6\n 7\n-8\n+EIGHT\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified("a/f", "b/f", []byte(tt.old), []byte(tt.new))
+			if got != tt.want {
+				t.Errorf("Unified() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedSeparateHunks(t *testing.T) {
+	var old, cur strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&old, "line %d\n", i)
+		if i == 2 || i == 25 {
+			fmt.Fprintf(&cur, "changed %d\n", i)
+		} else {
+			fmt.Fprintf(&cur, "line %d\n", i)
+		}
+	}
+	diff := Unified("a", "b", []byte(old.String()), []byte(cur.String()))
+	if n := strings.Count(diff, "@@ -"); n != 2 {
+		t.Errorf("got %d hunks, want 2:\n%s", n, diff)
+	}
+}
+
+func TestUnifiedTooManyEdits(t *testing.T) {
+	var old, cur strings.Builder
+	for i := 0; i < maxEdits; i++ {
+		fmt.Fprintf(&old, "old %d\n", i)
+		fmt.Fprintf(&cur, "new %d\n", i)
+	}
+	got := Unified("a/f", "b/f", []byte(old.String()), []byte(cur.String()))
+	if got != "Files a/f and b/f differ\n" {
+		t.Errorf("Unified() = %.200q, want the files reported as differing", got)
+	}
+}
+
+func TestUnifiedTooManyLines(t *testing.T) {
+	old := strings.Repeat("x\n", maxDiffLines)
+	cur := old + "y\n"
+	got := Unified("a/f", "b/f", []byte(old), []byte(cur))
+	if got != "Files a/f and b/f differ\n" {
+		t.Errorf("Unified() = %.200q, want the files reported as differing", got)
+	}
+}
+
+// lcs returns the length of the longest common subsequence of a and b
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestDiffLinesIsShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(), randomLines()
+		ops, ok := diffLines(a, b, len(a)+len(b))
+		if !ok {
+			t.Fatalf("diffLines gave up on %q -> %q", a, b)
+		}
+
+		// The script must turn a into b using the fewest edits
+		var gotA, gotB []string
+		edits := 0
+		for _, o := range ops {
+			if o.kind != '+' {
+				gotA = append(gotA, o.line)
+			}
+			if o.kind != '-' {
+				gotB = append(gotB, o.line)
+			}
+			if o.kind != ' ' {
+				edits++
+			}
+		}
+		if strings.Join(gotA, ",") != strings.Join(a, ",") || strings.Join(gotB, ",") != strings.Join(b, ",") {
+			t.Fatalf("edit script for %q -> %q does not reproduce the inputs", a, b)
+		}
+		if want := len(a) + len(b) - 2*lcs(a, b); edits != want {
+			t.Fatalf("edit script for %q -> %q has %d edits, want %d", a, b, edits, want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package content
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// Plan describes what restoring one file to its baselined state changes
+type Plan struct {
+	Baseline *monitor.FileInfo // the state to restore
+	Current  *monitor.FileInfo // the state on disk, nil if the file is missing
+	Content  bool              // the content differs or the file is missing
+	Mode     bool              // the permissions differ
+	Owner    bool              // the owner or group differs
+}
+
+// NewPlan compares a baselined file with the file on disk
+func NewPlan(info *monitor.FileInfo) (*Plan, error) {
+	plan := &Plan{Baseline: info}
+
+	if _, err := os.Lstat(info.Path); os.IsNotExist(err) {
+		plan.Content, plan.Mode, plan.Owner = true, true, true
+		return plan, nil
+	}
+	current, err := monitor.GetFileInfo(info.Path)
+	if err != nil {
+		return nil, err
+	}
+	plan.Current = current
+
+	plan.Content = current.IsDir || current.IsSymlink || current.Hash != info.Hash
+	plan.Mode = current.Mode != info.Mode
+	plan.Owner = current.UID != info.UID || current.GID != info.GID
+	return plan, nil
+}
+
+// Needed reports whether the file differs from the baseline at all
+func (p *Plan) Needed() bool {
+	return p.Content || p.Mode || p.Owner
+}
+
+// String describes the planned changes
+func (p *Plan) String() string {
+	if p.Current == nil {
+		return fmt.Sprintf("recreate (%d bytes, mode %04o, owner %d:%d)",
+			p.Baseline.Size, p.Baseline.UnixPerm(), p.Baseline.UID, p.Baseline.GID)
+	}
+
+	var parts []string
+	if p.Content {
+		parts = append(parts, fmt.Sprintf("content %.12s -> %.12s", p.Current.Hash, p.Baseline.Hash))
+	}
+	if p.Mode {
+		parts = append(parts, fmt.Sprintf("mode %04o -> %04o", p.Current.UnixPerm(), p.Baseline.UnixPerm()))
+	}
+	if p.Owner {
+		parts = append(parts, fmt.Sprintf("owner %d:%d -> %d:%d", p.Current.UID, p.Current.GID, p.Baseline.UID, p.Baseline.GID))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Restore applies a plan. Content is written to a temporary file next to
+// the target, verified against the baselined hash and renamed over the
+// target, so a failed restore never leaves a partial file behind. Symlinks
+// in the directories above the target are not followed.
+func (s *Store) Restore(plan *Plan) error {
+	info := plan.Baseline
+	mode := os.FileMode(info.Mode) & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+
+	// Only fix the attributes when the content is intact
+	if !plan.Content {
+		return setAttributes(info.Path, info, mode)
+	}
+
+	if !s.Has(info.Hash) {
+		return fmt.Errorf("content of %s was not stored: add it to restore in the [content] section and run 'fim init'", info.Path)
+	}
+
+	dir := filepath.Dir(info.Path)
+	if err := makeParents(dir); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".fim-restore-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := s.WriteTo(tmp, info.Hash); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", info.Path, err)
+	}
+	if err := setAttributes(tmp.Name(), info, mode); err != nil {
+		return err
+	}
+
+	// A directory or symlink in the way must be moved aside first. The
+	// path is checked again, as it may have changed since the plan was made.
+	if current, err := os.Lstat(info.Path); err == nil {
+		switch {
+		case current.IsDir():
+			return fmt.Errorf("%s is now a directory; remove it and restore again", info.Path)
+		case current.Mode()&os.ModeSymlink != 0:
+			return fmt.Errorf("%s is now a symlink; remove it and restore again", info.Path)
+		}
+	}
+	if err := os.Rename(tmp.Name(), info.Path); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", info.Path, err)
+	}
+	return nil
+}
+
+// makeParents creates the directory of a restored file and those above
+// it. A symlink or anything else but a directory in the path is refused,
+// so that a restore cannot be redirected outside the baselined path.
+func makeParents(dir string) error {
+	path := ""
+	if filepath.IsAbs(dir) {
+		path = "/"
+	}
+	for _, elem := range strings.Split(filepath.Clean(dir), "/") {
+		if elem == "" {
+			continue
+		}
+		path = filepath.Join(path, elem)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(path, 0755); err != nil {
+				return fmt.Errorf("failed to create directory: %v", err)
+			}
+			continue
+		}
+		switch {
+		case err != nil:
+			return fmt.Errorf("failed to check directory: %v", err)
+		case info.Mode()&os.ModeSymlink != 0:
+			return fmt.Errorf("%s is a symlink; restore the files below it where it points", path)
+		case !info.IsDir():
+			return fmt.Errorf("%s is not a directory", path)
+		}
+	}
+	return nil
+}
+
+// setAttributes restores the ownership, mode and modification time of a
+// file. Ownership is set first, as chown clears the setuid and setgid bits.
+func setAttributes(path string, info *monitor.FileInfo, mode os.FileMode) error {
+	if info.UID >= 0 && info.GID >= 0 {
+		if err := os.Lchown(path, info.UID, info.GID); err != nil {
+			return fmt.Errorf("failed to restore owner of %s: %v", info.Path, err)
+		}
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("failed to restore mode of %s: %v", info.Path, err)
+	}
+	modTime := time.Unix(info.ModTime, 0)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		return fmt.Errorf("failed to restore modification time of %s: %v", info.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package content
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+)
+
+// Snapshotter keeps the content of baselined files in the content store:
+// small text files matching the capture globs, so that later changes can be
+// shown as diffs, and any file matching the restore globs, so that it can be
+// put back with fim restore
+type Snapshotter struct {
+	store          *Store
+	capture        []string
+	maxSize        int64
+	restore        []string
+	restoreMaxSize int64
+}
+
+// NewSnapshotter creates a snapshotter from the [content] configuration
+func NewSnapshotter(cfg *config.Config) *Snapshotter {
+	return &Snapshotter{
+		store:          NewStore(GetDefaultStoreDir()),
+		capture:        cfg.Content.Capture,
+		maxSize:        cfg.Content.MaxSize,
+		restore:        cfg.Content.Restore,
+		restoreMaxSize: cfg.Content.RestoreMaxSize,
+	}
+}
+
+// Enabled reports whether any capture or restore globs are configured
+func (s *Snapshotter) Enabled() bool {
+	return len(s.capture) > 0 || len(s.restore) > 0
+}
+
+// Store returns the underlying content store
+func (s *Snapshotter) Store() *Store {
+	return s.store
+}
+
+// regular reports whether info describes a regular file with a hash
+func regular(info *monitor.FileInfo) bool {
+	return info != nil && !info.IsDir && !info.IsSymlink && info.Hash != ""
+}
+
+// diffable reports whether a file's content should be captured for diffs
+func (s *Snapshotter) diffable(info *monitor.FileInfo) bool {
+	if !regular(info) || (s.maxSize > 0 && info.Size > s.maxSize) {
+		return false
+	}
+	return config.MatchAny(s.capture, info.Path)
+}
+
+// restorable reports whether a file's content should be kept for restores
+func (s *Snapshotter) restorable(info *monitor.FileInfo) bool {
+	if !regular(info) || (s.restoreMaxSize > 0 && info.Size > s.restoreMaxSize) {
+		return false
+	}
+	return config.MatchAny(s.restore, info.Path)
+}
+
+// Capture stores the content of every selected file in the baseline and
+// prunes content no longer referenced by it. It returns the number of files
+// whose content was stored.
+func (s *Snapshotter) Capture(baseline *storage.Baseline) (int, error) {
+	keep := make(map[string]bool)
+	captured := 0
+
+	for _, info := range baseline.Files {
+		var hash string
+		switch {
+		case s.restorable(info):
+			// Restorable files are kept whatever their content
+			var err error
+			if hash, err = s.store.PutFile(info.SourcePath()); err != nil {
+				continue
+			}
+		case s.diffable(info):
+			data, err := s.read(info.SourcePath())
+			if err != nil || !isText(data) {
+				continue
+			}
+			if hash, err = s.store.Put(data); err != nil {
+				return captured, err
+			}
+		default:
+			continue
+		}
+
+		// The file may have changed since it was hashed; only keep
+		// content that matches the baseline
+		if hash != info.Hash {
+			continue
+		}
+		keep[hash] = true
+		captured++
+	}
+
+	if _, err := s.store.Prune(keep); err != nil {
+		return captured, err
+	}
+	return captured, nil
+}
+
+// AttachDiffs sets Change.Diff on modified files whose baseline content was
+// captured. Files that are no longer text or exceed the size cap are skipped.
+func (s *Snapshotter) AttachDiffs(changes []*monitor.Change) {
+	for _, change := range changes {
+		if change.Type != monitor.ModifiedFile || change.OldInfo == nil || change.NewInfo == nil {
+			continue
+		}
+		if change.OldInfo.Hash == change.NewInfo.Hash || !s.diffable(change.NewInfo) {
+			continue
+		}
+
+		old, err := s.store.Get(change.OldInfo.Hash)
+		if err != nil || !isText(old) {
+			continue
+		}
+
+		// Prefer stored content for the current version, which is what a
+		// second baseline refers to; fall back to the live file
+		current, err := s.store.Get(change.NewInfo.Hash)
+		if err != nil {
+			current, err = s.read(change.NewInfo.SourcePath())
+		}
+		if err != nil || !isText(current) {
+			continue
+		}
+
+		change.Diff = Unified("a"+change.Path, "b"+change.Path, old, current)
+	}
+}
+
+// read reads a file, refusing anything larger than the size cap
+func (s *Snapshotter) read(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if s.maxSize <= 0 {
+		return io.ReadAll(file)
+	}
+	data, err := io.ReadAll(io.LimitReader(file, s.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.maxSize {
+		return nil, fmt.Errorf("%s exceeds the content size limit", path)
+	}
+	return data, nil
+}
+
+// isText reports whether data looks like text: valid UTF-8 without NUL bytes
+func isText(data []byte) bool {
+	return bytes.IndexByte(data, 0) < 0 && utf8.Valid(data)
+}
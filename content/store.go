@@ -0,0 +1,198 @@
+package content
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Store is a content-addressed store of file contents, keyed by the SHA-256
+// already recorded in FileInfo.Hash. Identical contents are stored once, and
+// blobs are gzip-compressed on disk.
+type Store struct {
+	dir string
+}
+
+// GetDefaultStoreDir returns the default directory of the content store
+func GetDefaultStoreDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "fim-content"
+	}
+	return filepath.Join(homeDir, ".fim", "content")
+}
+
+// NewStore creates a store rooted at dir
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// path returns the location of a blob; blobs are fanned out by the first
+// two hex digits of their hash to keep directories small
+func (s *Store) path(hash string) (string, error) {
+	if len(hash) != sha256.Size*2 || strings.Trim(hash, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid content hash: %q", hash)
+	}
+	return filepath.Join(s.dir, hash[:2], hash), nil
+}
+
+// Has reports whether the store holds the content with the given hash
+func (s *Store) Has(hash string) bool {
+	path, err := s.path(hash)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Put stores data and returns its hash
+func (s *Store) Put(data []byte) (string, error) {
+	return s.PutReader(bytes.NewReader(data))
+}
+
+// PutFile stores the content of a file and returns its hash
+func (s *Store) PutFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+	return s.PutReader(file)
+}
+
+// PutReader compresses everything read from r into the store and returns
+// its hash
+func (s *Store) PutReader(r io.Reader) (string, error) {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create content directory: %v", err)
+	}
+
+	// Compress into a temporary file while hashing, as the hash, and so
+	// the final name, is only known at the end
+	tmp, err := os.CreateTemp(s.dir, ".tmp-")
+	if err != nil {
+		return "", fmt.Errorf("failed to store content: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	zw := gzip.NewWriter(tmp)
+	if _, err := io.Copy(io.MultiWriter(zw, hash), r); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to store content: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to store content: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to store content: %v", err)
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if s.Has(sum) {
+		return sum, nil
+	}
+
+	path, _ := s.path(sum)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create content directory: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to store content: %v", err)
+	}
+	return sum, nil
+}
+
+// Open returns a reader of the decompressed content with the given hash.
+// The content is not verified; use Get or WriteTo for that.
+func (s *Store) Open(hash string) (io.ReadCloser, error) {
+	path, err := s.path(hash)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content %s: %v", hash, err)
+	}
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("content %s is corrupt: %v", hash, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, file}, nil
+}
+
+// Get returns the content with the given hash, verifying its integrity
+func (s *Store) Get(hash string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := s.WriteTo(&buf, hash); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo copies the content with the given hash to w and verifies it. On a
+// mismatch w will have received corrupt data, so callers writing to a file
+// should write to a temporary one.
+func (s *Store) WriteTo(w io.Writer, hash string) error {
+	r, err := s.Open(hash)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), r); err != nil {
+		return fmt.Errorf("failed to read content %s: %v", hash, err)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != hash {
+		return fmt.Errorf("content %s is corrupt", hash)
+	}
+	return nil
+}
+
+// tmpMaxAge is how long a temporary file of the store may be in use by
+// another process before Prune removes it as left over
+const tmpMaxAge = time.Hour
+
+// Prune removes every blob whose hash is not in keep and returns how many
+// were removed. Recent temporary files are kept, as another process may
+// still be writing them.
+func (s *Store) Prune(keep map[string]bool) (int, error) {
+	removed := 0
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || keep[info.Name()] {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".tmp-") && time.Since(info.ModTime()) < tmpMaxAge {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to prune content store: %v", err)
+	}
+	return removed, nil
+}
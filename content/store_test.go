@@ -0,0 +1,148 @@
+package content
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+func TestRestoreRefusesSymlink(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(filepath.Join(dir, "store"))
+	hash, err := store.Put([]byte("original\n"))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	target := filepath.Join(dir, "target")
+	outside := filepath.Join(dir, "outside")
+	if err := os.WriteFile(outside, []byte("untouched\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, target); err != nil {
+		t.Fatal(err)
+	}
+
+	info := &monitor.FileInfo{Path: target, Hash: hash, Mode: 0644, UID: -1, GID: -1}
+	plan := &Plan{Baseline: info, Content: true}
+	err = store.Restore(plan)
+	if err == nil || !strings.Contains(err.Error(), "symlink") {
+		t.Fatalf("Restore over a symlink = %v, want it refused", err)
+	}
+	if data, _ := os.ReadFile(outside); string(data) != "untouched\n" {
+		t.Errorf("symlink target was changed to %q", data)
+	}
+	if fi, err := os.Lstat(target); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink was replaced")
+	}
+}
+
+func TestRestoreRefusesSymlinkedParent(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(filepath.Join(dir, "store"))
+	hash, err := store.Put([]byte("original\n"))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	outside := filepath.Join(dir, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		refuse string // part of the error, "" if the restore succeeds
+	}{
+		{"link/conf", "symlink"},
+		{"link/sub/conf", "symlink"},
+		{"file/conf", "not a directory"},
+		{"new/sub/conf", ""},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.path)
+		info := &monitor.FileInfo{Path: path, Hash: hash, Mode: 0644, UID: -1, GID: -1}
+		err := store.Restore(&Plan{Baseline: info, Content: true})
+		if tt.refuse == "" {
+			if data, _ := os.ReadFile(path); err != nil || string(data) != "original\n" {
+				t.Errorf("%s: Restore = %v, content %q", tt.path, err, data)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.refuse) {
+			t.Errorf("%s: Restore = %v, want it refused", tt.path, err)
+		}
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("restored through the symlink into %s", outside)
+	}
+}
+
+func TestOpenRejectsUncompressedBlobs(t *testing.T) {
+	store := NewStore(t.TempDir())
+	hash, err := store.Put([]byte("content"))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if data, err := store.Get(hash); err != nil || string(data) != "content" {
+		t.Fatalf("Get = %q, %v", data, err)
+	}
+
+	path, _ := store.path(hash)
+	if err := os.WriteFile(path, []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(hash); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("Get of an uncompressed blob = %v, want it corrupt", err)
+	}
+}
+
+func TestPruneKeepsRecentTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir)
+	keep, err := store.Put([]byte("keep"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Put([]byte("drop")); err != nil {
+		t.Fatal(err)
+	}
+
+	recent := filepath.Join(dir, ".tmp-recent")
+	stale := filepath.Join(dir, ".tmp-stale")
+	for _, path := range []string{recent, stale} {
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * tmpMaxAge)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := store.Prune(map[string]bool{keep: true})
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("removed %d files, want the unreferenced blob and the stale temporary file", removed)
+	}
+	if !store.Has(keep) {
+		t.Error("referenced blob was removed")
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Error("temporary file still being written was removed")
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("stale temporary file was kept")
+	}
+}
@@ -2,25 +2,62 @@ package daemon
 
 import (
 	"fmt"
-	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/rhinocodelab/IntegrityWatchdog/alert"
+	"github.com/rhinocodelab/IntegrityWatchdog/allowlist"
+	"github.com/rhinocodelab/IntegrityWatchdog/audit"
 	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/container"
+	"github.com/rhinocodelab/IntegrityWatchdog/content"
+	"github.com/rhinocodelab/IntegrityWatchdog/hooks"
+	"github.com/rhinocodelab/IntegrityWatchdog/ima"
+	"github.com/rhinocodelab/IntegrityWatchdog/ioc"
+	"github.com/rhinocodelab/IntegrityWatchdog/logging"
 	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/rhinocodelab/IntegrityWatchdog/notify"
+	"github.com/rhinocodelab/IntegrityWatchdog/packages"
+	"github.com/rhinocodelab/IntegrityWatchdog/quarantine"
+	"github.com/rhinocodelab/IntegrityWatchdog/rules"
+	"github.com/rhinocodelab/IntegrityWatchdog/scanner"
+	"github.com/rhinocodelab/IntegrityWatchdog/severity"
 	"github.com/rhinocodelab/IntegrityWatchdog/storage"
 )
 
 // Daemon represents the FIM daemon
 type Daemon struct {
-	config   *config.Config
-	baseline *storage.Baseline
-	logger   *log.Logger
-	pidFile  string
-	running  bool
-	interval time.Duration
+	config     *config.Config
+	baseline   *storage.Baseline
+	logger     *logging.Logger
+	logFile    *logging.RotatingFile
+	hooks      *hooks.Runner
+	quarantine *quarantine.Responder
+	email      *notify.Email
+	alerts     *alert.Tracker
+	severity   *severity.Classifier
+	content    *content.Snapshotter
+	packages   *packages.Verifier
+	known      *ioc.Loader
+	audit      *audit.Log        // nil unless [audit] is enabled
+	ima        *ima.Watcher      // nil unless [ima] verify is on
+	images     *container.Images // nil unless [containers] is enabled
+	pidFile    string
+	running    bool
+	interval   time.Duration
+	done       chan struct{}
+
+	// packageSince is the time from which package manager transactions
+	// may explain changes
+	packageSince time.Time
+
+	// unbaselined holds the containers already reported as having no
+	// baseline of their image
+	unbaselined map[string]bool
 }
 
 // NewDaemon creates a new daemon instance
@@ -39,22 +76,98 @@ func NewDaemon(cfg *config.Config, interval time.Duration) (*Daemon, error) {
 
 	// Set up log file
 	logFile := filepath.Join(fimDir, "fim.log")
-	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	file, err := logging.OpenRotatingFile(logFile, logging.RotateOptions{
+		MaxSize:    int64(cfg.Logging.MaxSize) * 1024 * 1024,
+		MaxAge:     cfg.Logging.MaxAge,
+		MaxBackups: cfg.Logging.MaxBackups,
+		Compress:   cfg.Logging.Compress,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to open log file: %v", err)
+		return nil, err
 	}
 
-	// Create logger
-	logger := log.New(file, "", log.LstdFlags)
+	// Create event logger
+	format, err := logging.ParseFormat(cfg.Logging.Format)
+	if err != nil {
+		return nil, err
+	}
+	level := logging.LevelInfo
+	if cfg.Logging.Level != "" {
+		if level, err = logging.ParseLevel(cfg.Logging.Level); err != nil {
+			return nil, err
+		}
+	}
+	logger := logging.New(file, format, level)
+
+	// Forward events to syslog if configured
+	if cfg.Logging.Syslog != "" {
+		w, err := logging.DialSyslog(cfg.Logging.Syslog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %v", err)
+		}
+		logger.SetSyslog(w)
+	}
+
+	// Set up email alerts
+	email, err := notify.NewEmail(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up severity classification
+	classifier, err := severity.NewClassifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up package verification
+	verifier, err := packages.NewVerifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up attribution of changes from the audit log
+	var auditLog *audit.Log
+	if cfg.Audit.Enabled {
+		auditLog = audit.NewLog(cfg)
+	}
+
+	// Set up checking of IMA measurements
+	var imaWatcher *ima.Watcher
+	if cfg.IMA.Verify {
+		if imaWatcher, err = ima.NewWatcher(cfg.IMA.Log); err != nil {
+			return nil, err
+		}
+	}
+
+	// Set up checking of running containers against their images
+	var images *container.Images
+	if cfg.Containers.Enabled {
+		images = container.OpenImages(cfg)
+	}
 
 	// Create PID file path
 	pidFile := filepath.Join(fimDir, "fim.pid")
 
 	return &Daemon{
-		config:   cfg,
-		logger:   logger,
-		pidFile:  pidFile,
-		interval: interval,
+		config:     cfg,
+		logger:     logger,
+		logFile:    file,
+		hooks:      hooks.NewRunner(cfg, logger),
+		quarantine: quarantine.NewResponder(cfg, logger),
+		email:      email,
+		severity:   classifier,
+		content:    content.NewSnapshotter(cfg),
+		packages:   verifier,
+		known:      ioc.NewLoader(cfg),
+		audit:      auditLog,
+		ima:        imaWatcher,
+		images:     images,
+		pidFile:    pidFile,
+		interval:   interval,
+		done:       make(chan struct{}),
+
+		unbaselined: make(map[string]bool),
 	}, nil
 }
 
@@ -84,12 +197,28 @@ func (d *Daemon) Start() error {
 
 	baseline, err := storage.Load(baselinePath)
 	if err != nil {
+		os.Remove(d.pidFile)
+		d.logger.Error(logging.EventScanFailed, "", "Failed to load baseline", err)
 		return fmt.Errorf("failed to load baseline: %v", err)
 	}
 	d.baseline = baseline
+	d.packageSince = baseline.UpdatedAt
+
+	// Load alert state so that a restart does not re-alert known drift
+	tracker, err := alert.LoadTracker(alert.GetDefaultStatePath(),
+		d.config.Alerts.Throttle, d.config.Alerts.ThrottleWindow)
+	if err != nil {
+		os.Remove(d.pidFile)
+		return err
+	}
+	d.alerts = tracker
+	d.logger.Print(logging.EventBaselineLoaded, logging.LevelInfo, "",
+		"Loaded baseline %s with %d files", baselinePath, len(baseline.Files))
 
 	// Set running flag
 	d.running = true
+	d.logger.Print(logging.EventDaemonStarted, logging.LevelInfo, "",
+		"FIM daemon started (pid %d, interval %s)", os.Getpid(), d.interval)
 
 	// Start monitoring loop
 	go d.monitorLoop()
@@ -108,12 +237,43 @@ func (d *Daemon) Stop() error {
 		return fmt.Errorf("failed to remove PID file: %v", err)
 	}
 
-	// Set running flag
+	// Set running flag and stop the monitoring loop
 	d.running = false
+	close(d.done)
+
+	// Send whatever is still waiting for the next digest
+	if d.email.Enabled() {
+		d.flushEmail("", true)
+	}
+	d.logger.Print(logging.EventDaemonStopped, logging.LevelInfo, "", "FIM daemon stopped")
 
 	return nil
 }
 
+// Wait blocks until the daemon receives SIGINT or SIGTERM and then stops it.
+// SIGUSR1 reopens the log file so that external log rotation can be used.
+func (d *Daemon) Wait() error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1)
+	defer signal.Stop(signals)
+
+	for sig := range signals {
+		if sig == syscall.SIGUSR1 {
+			if err := d.logFile.Reopen(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to reopen log file: %v\n", err)
+				continue
+			}
+			d.logger.Print(logging.EventLogReopened, logging.LevelInfo, "", "Log file reopened")
+			continue
+		}
+		break
+	}
+
+	err := d.Stop()
+	d.logFile.Close()
+	return err
+}
+
 // IsRunning checks if the daemon is running
 func IsRunning() bool {
 	// Get home directory
@@ -155,63 +315,403 @@ func (d *Daemon) monitorLoop() {
 	ticker := time.NewTicker(d.interval)
 	defer ticker.Stop()
 
-	for d.running {
+	for {
 		select {
 		case <-ticker.C:
-			if err := d.scan(); err != nil {
-				d.logger.Printf("Error during scan: %v", err)
-			}
+			d.scan()
+		case <-d.done:
+			return
 		}
 	}
 }
 
-// scan performs a scan and compares with baseline
-func (d *Daemon) scan() error {
+// scan performs a scan, compares it with the baseline and logs the results
+func (d *Daemon) scan() {
+	scanID := logging.NewScanID()
+	started := time.Now()
+
+	// Half-installed packages would be reported as tampering, so wait for
+	// a running package manager transaction to finish
+	if d.config.Packages.AutoAccept {
+		if lock, held := packages.LockHeld(d.config.Packages.Locks); held {
+			d.logger.Print(logging.EventChangeDeferred, logging.LevelInfo, scanID,
+				"Package manager transaction in progress (%s is locked): scan deferred", lock)
+			return
+		}
+	}
+
+	d.logger.Print(logging.EventScanStarted, logging.LevelInfo, scanID,
+		"Scan started for %d paths", len(d.config.Monitor.Paths))
+
 	// Scan each monitored path
-	for _, path := range d.config.Monitor.Paths {
-		if err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
+	current, err := scanner.NewScanner(d.config).ScanPaths()
+	if err != nil {
+		d.logger.Error(logging.EventScanFailed, scanID, "Error during scan", err)
+		return
+	}
 
-			// Skip excluded paths
-			if d.config.IsExcluded(path) {
-				if info.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
+	// The root digest is logged. The digests of the baseline are prepared
+	// too, so that the comparison lists only the entries below directories
+	// whose digests differ.
+	rootDigest := current.RootDigest()
+	d.baseline.PrepareDigests()
+
+	// Compare with baseline and keep only transitions worth alerting on
+	changes := d.baseline.Compare(current)
+	d.severity.Classify(changes.Details)
+	known := d.loadKnownBad(scanID)
+	if known != nil {
+		known.Annotate(changes, current)
+	}
+	changes = d.applyAllowlist(scanID, changes)
+	d.applyRules(scanID, changes)
+	if d.content.Enabled() {
+		d.content.AttachDiffs(changes.Details)
+	}
+	if err := d.packages.Annotate(changes.Details); err != nil {
+		d.logger.Error(logging.EventScanFailed, scanID, "Package verification failed", err)
+	}
+	if d.audit != nil {
+		d.attributeChanges(scanID, changes)
+	}
+	if d.config.Packages.AutoAccept && d.packages.Enabled() {
+		changes = d.acceptPackageChanges(scanID, changes, started)
+	}
+	containers := 0
+	if d.images != nil {
+		var drift []*monitor.Change
+		containers, drift = d.scanContainers(scanID, known)
+		for _, change := range drift {
+			changes.Add(change)
+		}
+	}
+	alerts := d.filterAlerts(scanID, changes)
+	for _, change := range alerts {
+		d.logger.Log(logging.NewChangeEvent(scanID, change))
+	}
+	if d.ima != nil {
+		d.checkMeasurements(scanID)
+	}
+
+	event := logging.NewEvent(logging.EventScanFinished, logging.LevelInfo,
+		fmt.Sprintf("Scan finished: %d added, %d modified, %d deleted, %d new alerts",
+			len(changes.Added), len(changes.Modified), len(changes.Deleted), len(alerts)))
+	event.ScanID = scanID
+	event.Fields = map[string]interface{}{
+		"files":       len(current.Files),
+		"root_digest": rootDigest,
+		"added":       len(changes.Added),
+		"modified":    len(changes.Modified),
+		"deleted":     len(changes.Deleted),
+		"alerts":      len(alerts),
+		"duration_ms": time.Since(started).Milliseconds(),
+	}
+	if d.images != nil {
+		event.Fields["containers"] = containers
+	}
+	d.logger.Log(event)
+
+	// Run the configured responders
+	if len(alerts) > 0 && d.hooks.Enabled() {
+		d.hooks.Run(scanID, alerts)
+	}
+	if len(alerts) > 0 && d.quarantine.Enabled() {
+		d.quarantine.Run(scanID, alerts)
+	}
 
-			// Get current file info
-			currentInfo, err := monitor.GetFileInfo(path)
-			if err != nil {
-				return err
+	// Send email alerts
+	if d.email.Enabled() {
+		if len(alerts) > 0 {
+			if sent, err := d.email.Notify(alerts); err != nil {
+				d.logger.Error(logging.EventNotifyFailed, scanID, "Failed to send email alert", err)
+			} else if sent > 0 {
+				d.logger.Print(logging.EventNotifySent, logging.LevelInfo, scanID,
+					"Sent email alert for %d changes", sent)
 			}
+		}
+		d.flushEmail(scanID, false)
+	}
+}
+
+// loadKnownBad returns the known-bad hashes to check a scan against, or nil
+// if they cannot be loaded. Hash lists that changed are reloaded every scan
+// so that 'fim ioc import' takes effect without restarting the daemon.
+func (d *Daemon) loadKnownBad(scanID string) *ioc.Set {
+	known, warnings, err := d.known.Load()
+	if err != nil {
+		d.logger.Error(logging.EventScanFailed, scanID, "Failed to load hash lists", err)
+		return nil
+	}
+	for _, warning := range warnings {
+		d.logger.Print(logging.EventScanFailed, logging.LevelWarning, scanID, "Hash list loaded partially: %v", warning)
+	}
+	return known
+}
 
-			// Compare with baseline
-			baselineInfo, exists := d.baseline.GetFile(path)
-			if !exists {
-				// New file
-				d.logger.Printf("[+] New file: %s", path)
-			} else {
-				// Check for changes
-				if !baselineInfo.Equals(currentInfo) {
-					d.logger.Printf("[*] Modified file: %s", path)
-				}
+// applyAllowlist lowers the severity of, or drops, new files found on the
+// imported allowlists. The indexes are reopened every scan so that
+// 'fim allowlist import' takes effect without restarting the daemon.
+func (d *Daemon) applyAllowlist(scanID string, changes *storage.Changes) *storage.Changes {
+	allowed, err := allowlist.Open(d.config)
+	if err != nil {
+		d.logger.Error(logging.EventScanFailed, scanID, "Failed to open allowlists", err)
+		return changes
+	}
+	defer allowed.Close()
+
+	remaining, _, err := allowed.Apply(changes)
+	if err != nil {
+		d.logger.Error(logging.EventScanFailed, scanID, "Failed to check allowlists", err)
+		return changes
+	}
+	return remaining
+}
+
+// applyRules runs content rules against added and modified files. Rules
+// are reloaded every scan so that new rule files take effect without
+// restarting the daemon.
+func (d *Daemon) applyRules(scanID string, changes *storage.Changes) {
+	engine, err := rules.Load(d.config)
+	if err != nil {
+		d.logger.Error(logging.EventScanFailed, scanID, "Failed to load rules", err)
+		return
+	}
+	engine.Apply(changes)
+}
+
+// attributeChanges reads the audit records written since the previous scan
+// and attaches the process that made each change
+func (d *Daemon) attributeChanges(scanID string, changes *storage.Changes) {
+	if err := d.audit.Update(); err != nil {
+		d.logger.Error(logging.EventScanFailed, scanID, "Failed to read audit log", err)
+		return
+	}
+	d.audit.Annotate(changes.Details)
+}
+
+// checkMeasurements logs the files that IMA measured, typically on
+// execution, with content that differs from the baseline
+func (d *Daemon) checkMeasurements(scanID string) {
+	differs, err := d.ima.Check(d.baseline)
+	if err != nil {
+		d.logger.Error(logging.EventScanFailed, scanID, "Failed to check IMA measurements", err)
+		return
+	}
+	for _, result := range differs {
+		event := logging.NewEvent(logging.EventIMAMismatch, logging.LevelError,
+			fmt.Sprintf("[!] IMA measured %s with a hash not in the baseline: %s:%s", result.Path, result.Algorithm, result.Hash))
+		event.ScanID = scanID
+		event.Fields = map[string]interface{}{
+			"path":          result.Path,
+			"algorithm":     result.Algorithm,
+			"hash":          result.Hash,
+			"baseline_hash": result.Baseline,
+			"template":      result.Template,
+			"pcr":           result.PCR,
+		}
+		if result.Content != "" {
+			event.Fields["content"] = string(result.Content)
+		}
+		d.logger.Log(event)
+	}
+}
+
+// scanContainers compares the running containers with the baselines of
+// their images and the known-bad hashes, if loaded. It returns the number
+// of containers checked and the changes found in them.
+func (d *Daemon) scanContainers(scanID string, known *ioc.Set) (int, []*monitor.Change) {
+	containers, err := container.Discover(d.config)
+	if err != nil {
+		d.logger.Error(logging.EventScanFailed, scanID, "Failed to list containers", err)
+		return 0, nil
+	}
+
+	checked := 0
+	var drift []*monitor.Change
+	for _, c := range containers {
+		image, err := d.images.Baseline(c.Image)
+		if err != nil {
+			d.logger.Error(logging.EventScanFailed, scanID, fmt.Sprintf("Failed to check container %s", c), err)
+			continue
+		}
+		if image == nil {
+			if !d.unbaselined[c.ID] {
+				d.unbaselined[c.ID] = true
+				d.logger.Print(logging.EventScanFailed, logging.LevelWarning, scanID,
+					"Container %s not checked: no baseline of image %q (add one with 'fim containers baseline')", c, c.Image)
 			}
+			continue
+		}
+		delete(d.unbaselined, c.ID)
 
-			return nil
-		}); err != nil {
-			return fmt.Errorf("failed to scan path %s: %v", path, err)
+		current, err := container.Scan(d.config, c, image)
+		if err != nil {
+			d.logger.Error(logging.EventScanFailed, scanID, fmt.Sprintf("Failed to scan container %s", c), err)
+			continue
 		}
+		checked++
+
+		// Host package databases and audit records do not describe
+		// containers, so only the content checks apply
+		changes := image.Compare(current)
+		d.severity.Classify(changes.Details)
+		if known != nil {
+			known.Annotate(changes, current)
+		}
+		changes = d.applyAllowlist(scanID, changes)
+		d.applyRules(scanID, changes)
+		container.Annotate(changes.Details, c)
+		drift = append(drift, changes.Details...)
+	}
+	return checked, drift
+}
+
+// filterAlerts passes the changes of a scan through the alert tracker and
+// returns the ones to notify about. Resolved drift, silenced and throttled
+// changes are logged.
+func (d *Daemon) filterAlerts(scanID string, changes *storage.Changes) []*monitor.Change {
+	// Silences are reloaded every scan so that 'fim silence' takes effect
+	// without restarting the daemon
+	silences, err := alert.LoadSilences(alert.GetDefaultSilencesPath())
+	if err != nil {
+		d.logger.Error(logging.EventScanFailed, scanID, "Failed to load silences", err)
+		silences = nil
 	}
 
-	// Check for deleted files
-	for path := range d.baseline.Files {
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			d.logger.Printf("[-] Deleted file: %s", path)
+	result := d.alerts.Update(changes.Details, silences)
+
+	for _, entry := range result.Resolved {
+		message := fmt.Sprintf("[=] Resolved: %s matches the baseline again", entry.Path)
+		if entry.Container != nil {
+			message = fmt.Sprintf("[=] Resolved: %s in container %s matches its image again, or the container stopped", entry.Path, entry.Container)
+		}
+		event := logging.NewEvent(logging.EventChangeResolved, logging.LevelInfo, message)
+		event.ScanID = scanID
+		event.Fields = map[string]interface{}{
+			"path":       entry.Path,
+			"first_seen": entry.FirstSeen.Format(time.RFC3339),
+		}
+		if entry.Container != nil {
+			event.Fields["container_id"] = entry.Container.ID
+			event.Fields["container_name"] = entry.Container.Name
 		}
+		d.logger.Log(event)
+	}
+	for _, change := range result.Silenced {
+		event := logging.NewChangeEvent(scanID, change)
+		event.ID = logging.EventAlertSilenced
+		event.Name = event.ID.Name()
+		event.Level = logging.LevelDebug
+		event.Message = "Silenced: " + event.Message
+		d.logger.Log(event)
+	}
+	if result.Throttled > 0 {
+		d.logger.Print(logging.EventAlertThrottle, logging.LevelWarning, scanID,
+			"Alert throttle reached: %d alerts deferred to the next scan", result.Throttled)
 	}
 
-	return nil
+	if err := d.alerts.Save(); err != nil {
+		d.logger.Error(logging.EventScanFailed, scanID, "Failed to save alert state", err)
+	}
+
+	return result.Alerts
+}
+
+// acceptPackageChanges folds changes explained by a package manager
+// transaction into the baseline and returns the remaining changes. A change
+// is explained if a file was added or modified, its content matches its
+// package, a transaction since the last scan touched that package, and its
+// mode and owner are unchanged or the ones the package records. Critical
+// changes are never accepted.
+func (d *Daemon) acceptPackageChanges(scanID string, changes *storage.Changes, started time.Time) *storage.Changes {
+	txs, err := packages.RecentTransactions(d.config.Packages.Logs, d.packageSince)
+	if err != nil {
+		d.logger.Error(logging.EventScanFailed, scanID, "Failed to read package manager logs", err)
+		return changes
+	}
+	d.packageSince = started
+	if len(txs) == 0 {
+		return changes
+	}
+
+	accepted := 0
+	remaining := changes.Filter(func(change *monitor.Change) bool {
+		if change.Type != monitor.NewFile && change.Type != monitor.ModifiedFile {
+			return true
+		}
+		pkg := change.Package
+		if pkg == nil || pkg.Status != monitor.PackageMatches || change.NewInfo == nil || change.IOC != nil ||
+			change.Severity == monitor.SeverityCritical {
+			return true
+		}
+		if !d.packagedAttributes(change) {
+			return true
+		}
+		tx := findTransaction(txs, pkg.Name)
+		if tx == nil {
+			return true
+		}
+
+		d.baseline.AddFile(change.NewInfo)
+		accepted++
+
+		event := logging.NewChangeEvent(scanID, change)
+		event.ID = logging.EventChangeAccepted
+		event.Name = event.ID.Name()
+		event.Level = logging.LevelInfo
+		event.Message = fmt.Sprintf("Accepted into baseline: %s (%s %s) by %s", change.Path, pkg.Name, pkg.Version, tx)
+		event.Fields = map[string]interface{}{
+			"reason":              tx.String(),
+			"transaction_manager": tx.Manager,
+			"transaction_start":   tx.Start.Format(time.RFC3339),
+		}
+		if tx.Command != "" {
+			event.Fields["transaction_command"] = tx.Command
+		}
+		d.logger.Log(event)
+		return false
+	})
+
+	if accepted > 0 {
+		if err := d.baseline.Save(storage.GetDefaultBaselinePath()); err != nil {
+			d.logger.Error(logging.EventScanFailed, scanID, "Failed to save baseline", err)
+		}
+	}
+	return remaining
+}
+
+// packagedAttributes reports whether a changed file kept its mode and owner,
+// or has the mode and owner its package records
+func (d *Daemon) packagedAttributes(change *monitor.Change) bool {
+	old, cur := change.OldInfo, change.NewInfo
+	if old != nil && old.Mode == cur.Mode && old.UID == cur.UID && old.GID == cur.GID {
+		return true
+	}
+	file, ok, err := d.packages.Lookup(change.Path)
+	return err == nil && ok && file.MatchesAttributes(cur)
+}
+
+// findTransaction returns the transaction that touched a package, preferring
+// front ends such as apt, which log the command line, over dpkg
+func findTransaction(txs []*packages.Transaction, pkg string) *packages.Transaction {
+	var found *packages.Transaction
+	for _, tx := range txs {
+		if !tx.Touches(pkg) {
+			continue
+		}
+		if found == nil || (found.Command == "" && tx.Command != "") {
+			found = tx
+		}
+	}
+	return found
+}
+
+// flushEmail sends the email digest if it is due, or now if force is set
+func (d *Daemon) flushEmail(scanID string, force bool) {
+	if sent, err := d.email.Flush(force); err != nil {
+		d.logger.Error(logging.EventNotifyFailed, scanID, "Failed to send email digest", err)
+	} else if sent > 0 {
+		d.logger.Print(logging.EventNotifySent, logging.LevelInfo, scanID,
+			"Sent email digest of %d changes", sent)
+	}
 }
@@ -0,0 +1,289 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/logging"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// maxOutput is the maximum amount of hook output kept for the log
+const maxOutput = 16 * 1024
+
+// Hook is a configured command run for detected changes
+type Hook struct {
+	Name    string
+	Command string
+	Batch   bool
+	Paths   []string
+	Changes []string
+	Timeout time.Duration
+}
+
+// Batch is the JSON document passed on stdin to hooks in batch mode
+type Batch struct {
+	ScanID string           `json:"scan_id"`
+	Host   string           `json:"host"`
+	Events []*logging.Event `json:"events"`
+}
+
+// Runner runs hooks for detected changes, limiting how many run at once
+type Runner struct {
+	hooks  []*Hook
+	slots  chan struct{}
+	logger *logging.Logger
+	host   string
+}
+
+// NewRunner creates a runner for the hooks configured in cfg. Hook results
+// are written to logger.
+func NewRunner(cfg *config.Config, logger *logging.Logger) *Runner {
+	names := make([]string, 0, len(cfg.Hooks.Commands))
+	for name := range cfg.Hooks.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hooks := make([]*Hook, 0, len(names))
+	for _, name := range names {
+		h := cfg.Hooks.Commands[name]
+		hooks = append(hooks, &Hook{
+			Name:    name,
+			Command: h.Command,
+			Batch:   h.Mode == "batch",
+			Paths:   h.Paths,
+			Changes: h.Changes,
+			Timeout: h.Timeout,
+		})
+	}
+
+	host, _ := os.Hostname()
+	return &Runner{
+		hooks:  hooks,
+		slots:  make(chan struct{}, cfg.Hooks.Concurrency),
+		logger: logger,
+		host:   host,
+	}
+}
+
+// Enabled reports whether any hooks are configured
+func (r *Runner) Enabled() bool {
+	return len(r.hooks) > 0
+}
+
+// Matches reports whether the hook should run for a change
+func (h *Hook) Matches(change *monitor.Change) bool {
+	if len(h.Paths) > 0 && !config.MatchAny(h.Paths, change.Path) {
+		return false
+	}
+	if len(h.Changes) > 0 {
+		for _, t := range h.Changes {
+			if t == change.Type.String() {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Run runs every matching hook for the changes of one scan and waits for
+// them to finish
+func (r *Runner) Run(scanID string, changes []*monitor.Change) {
+	var wg sync.WaitGroup
+	for _, hook := range r.hooks {
+		matched := make([]*logging.Event, 0)
+		for _, change := range changes {
+			if hook.Matches(change) {
+				event := logging.NewChangeEvent(scanID, change)
+				event.Host = r.host
+				matched = append(matched, event)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		if hook.Batch {
+			wg.Add(1)
+			go func(hook *Hook, events []*logging.Event) {
+				defer wg.Done()
+				r.runBatch(hook, scanID, events)
+			}(hook, matched)
+			continue
+		}
+		for _, event := range matched {
+			wg.Add(1)
+			go func(hook *Hook, event *logging.Event) {
+				defer wg.Done()
+				r.runChange(hook, event)
+			}(hook, event)
+		}
+	}
+	wg.Wait()
+}
+
+// runChange runs a hook for a single change
+func (r *Runner) runChange(hook *Hook, event *logging.Event) {
+	input, err := json.Marshal(event)
+	if err != nil {
+		r.logger.Error(logging.EventHookFailed, event.ScanID, fmt.Sprintf("Hook %s: failed to encode event", hook.Name), err)
+		return
+	}
+
+	env := []string{
+		"FIM_HOOK=" + hook.Name,
+		"FIM_MODE=change",
+		"FIM_SCAN_ID=" + event.ScanID,
+		"FIM_HOST=" + r.host,
+		"FIM_EVENT=" + event.Name,
+		"FIM_EVENT_ID=" + strconv.Itoa(int(event.ID)),
+	}
+	path := ""
+	if change := event.Change; change != nil {
+		path = change.Path
+		env = append(env,
+			"FIM_PATH="+change.Path,
+			"FIM_CHANGE_TYPE="+change.Type.String(),
+			"FIM_SEVERITY="+change.Severity.String(),
+		)
+		if change.OldInfo != nil {
+			env = append(env, "FIM_OLD_HASH="+change.OldInfo.Hash)
+		}
+		if change.NewInfo != nil {
+			env = append(env, "FIM_NEW_HASH="+change.NewInfo.Hash)
+		}
+		if c := change.Container; c != nil {
+			// The path is inside the container, not on the host
+			env = append(env,
+				"FIM_CONTAINER_ID="+c.ID,
+				"FIM_CONTAINER_NAME="+c.Name,
+				"FIM_CONTAINER_IMAGE="+c.Image,
+			)
+		}
+	}
+
+	r.exec(hook, event.ScanID, input, env, path)
+}
+
+// runBatch runs a hook once for all matching changes of a scan
+func (r *Runner) runBatch(hook *Hook, scanID string, events []*logging.Event) {
+	input, err := json.Marshal(&Batch{ScanID: scanID, Host: r.host, Events: events})
+	if err != nil {
+		r.logger.Error(logging.EventHookFailed, scanID, fmt.Sprintf("Hook %s: failed to encode events", hook.Name), err)
+		return
+	}
+
+	env := []string{
+		"FIM_HOOK=" + hook.Name,
+		"FIM_MODE=batch",
+		"FIM_SCAN_ID=" + scanID,
+		"FIM_HOST=" + r.host,
+		"FIM_CHANGE_COUNT=" + strconv.Itoa(len(events)),
+	}
+
+	r.exec(hook, scanID, input, env, "")
+}
+
+// exec runs the hook command with the given stdin and extra environment and
+// logs its outcome and output
+func (r *Runner) exec(hook *Hook, scanID string, input []byte, env []string, path string) {
+	// Wait for a free slot
+	r.slots <- struct{}{}
+	defer func() { <-r.slots }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), hook.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", hook.Command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(), env...)
+	output := &limitedBuffer{limit: maxOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	// Run in its own process group so that a timeout also kills children
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+
+	started := time.Now()
+	err := cmd.Run()
+
+	fields := map[string]interface{}{
+		"hook":        hook.Name,
+		"duration_ms": time.Since(started).Milliseconds(),
+		"exit_code":   cmd.ProcessState.ExitCode(),
+	}
+	if path != "" {
+		fields["path"] = path
+	}
+	if out := strings.TrimSpace(output.String()); out != "" {
+		fields["output"] = out
+	}
+
+	var event *logging.Event
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		event = logging.NewEvent(logging.EventHookFailed, logging.LevelError,
+			fmt.Sprintf("Hook %s timed out after %s", hook.Name, hook.Timeout))
+	case err != nil:
+		event = logging.NewEvent(logging.EventHookFailed, logging.LevelError,
+			fmt.Sprintf("Hook %s failed", hook.Name))
+		event.Error = err.Error()
+	default:
+		event = logging.NewEvent(logging.EventHookCompleted, logging.LevelInfo,
+			fmt.Sprintf("Hook %s completed", hook.Name))
+	}
+	event.ScanID = scanID
+	event.Fields = fields
+	r.logger.Log(event)
+}
+
+// limitedBuffer collects output up to a limit and silently drops the rest
+type limitedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write implements io.Writer
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// String returns the collected output
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
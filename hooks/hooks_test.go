@@ -0,0 +1,178 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/logging"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// logged is the part of a logged hook result the tests look at
+type logged struct {
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields"`
+}
+
+// input is the part of an event passed on stdin the tests look at
+type input struct {
+	ScanID string `json:"scan_id"`
+	Change struct {
+		Path string `json:"path"`
+	} `json:"change"`
+}
+
+// run runs one hook for the changes and returns the logged results
+func run(t *testing.T, hook config.Hook, changes ...*monitor.Change) []logged {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Hooks.Concurrency = 2
+	if hook.Timeout == 0 {
+		hook.Timeout = 10 * time.Second
+	}
+	cfg.Hooks.Commands = map[string]config.Hook{"test": hook}
+	var buf bytes.Buffer
+	NewRunner(cfg, logging.New(&buf, logging.FormatJSON, logging.LevelDebug)).Run("scan-1", changes)
+
+	var results []logged
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var result logged
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// readEnv returns the FIM_ variables written by env to a file
+func readEnv(t *testing.T, path string) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok && strings.HasPrefix(key, "FIM_") {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+func TestChangeHookEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	change := &monitor.Change{
+		Path: "/etc/hosts", Type: monitor.ModifiedFile, Severity: monitor.SeverityHigh,
+		OldInfo:   &monitor.FileInfo{Path: "/etc/hosts", Hash: "old"},
+		NewInfo:   &monitor.FileInfo{Path: "/etc/hosts", Hash: "new"},
+		Container: &monitor.Container{ID: "c0ffee", Name: "web", Image: "nginx:1.25"},
+	}
+	results := run(t, config.Hook{Command: "env > " + dir + "/env; cat > " + dir + "/stdin"}, change)
+	if len(results) != 1 || results[0].Message != "Hook test completed" {
+		t.Fatalf("results %+v", results)
+	}
+
+	env := readEnv(t, filepath.Join(dir, "env"))
+	want := map[string]string{
+		"FIM_HOOK":            "test",
+		"FIM_MODE":            "change",
+		"FIM_SCAN_ID":         "scan-1",
+		"FIM_EVENT":           "file.modified",
+		"FIM_EVENT_ID":        "3001",
+		"FIM_PATH":            "/etc/hosts",
+		"FIM_CHANGE_TYPE":     "modified",
+		"FIM_SEVERITY":        "high",
+		"FIM_OLD_HASH":        "old",
+		"FIM_NEW_HASH":        "new",
+		"FIM_CONTAINER_ID":    "c0ffee",
+		"FIM_CONTAINER_NAME":  "web",
+		"FIM_CONTAINER_IMAGE": "nginx:1.25",
+	}
+	for key, value := range want {
+		if env[key] != value {
+			t.Errorf("%s=%q, want %q", key, env[key], value)
+		}
+	}
+	if env["FIM_HOST"] == "" {
+		t.Error("FIM_HOST is not set")
+	}
+
+	var event input
+	data, _ := os.ReadFile(filepath.Join(dir, "stdin"))
+	if err := json.Unmarshal(data, &event); err != nil || event.ScanID != "scan-1" || event.Change.Path != "/etc/hosts" {
+		t.Errorf("stdin %s: %v", data, err)
+	}
+}
+
+func TestBatchHookEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	changes := []*monitor.Change{
+		{Path: "/etc/hosts", Type: monitor.ModifiedFile},
+		{Path: "/etc/passwd", Type: monitor.ModifiedFile},
+		{Path: "/var/log/x", Type: monitor.NewFile},
+	}
+	hook := config.Hook{Command: "env > " + dir + "/env; cat > " + dir + "/stdin", Mode: "batch", Paths: []string{"/etc/*"}}
+	if results := run(t, hook, changes...); len(results) != 1 {
+		t.Fatalf("batch hook ran %d times, want once", len(results))
+	}
+
+	env := readEnv(t, filepath.Join(dir, "env"))
+	if env["FIM_MODE"] != "batch" || env["FIM_CHANGE_COUNT"] != "2" || env["FIM_PATH"] != "" {
+		t.Errorf("environment %v", env)
+	}
+	var batch struct {
+		ScanID string  `json:"scan_id"`
+		Events []input `json:"events"`
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "stdin"))
+	if err := json.Unmarshal(data, &batch); err != nil || batch.ScanID != "scan-1" || len(batch.Events) != 2 ||
+		batch.Events[1].Change.Path != "/etc/passwd" {
+		t.Errorf("stdin %s: %v", data, err)
+	}
+}
+
+func TestTimeoutKillsProcessGroup(t *testing.T) {
+	dir := t.TempDir()
+	// The background child outlives the shell unless the whole process
+	// group is killed
+	survived := filepath.Join(dir, "survived")
+	hook := config.Hook{
+		Command: "(sleep 1; touch " + survived + ") & sleep 10",
+		Timeout: 100 * time.Millisecond,
+	}
+	started := time.Now()
+	results := run(t, hook, &monitor.Change{Path: "/etc/hosts", Type: monitor.ModifiedFile})
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Run returned after %s", elapsed)
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Message, "timed out") {
+		t.Fatalf("results %+v", results)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(survived); err == nil {
+		t.Error("a child of the hook survived the timeout")
+	}
+}
+
+func TestOutputIsCapped(t *testing.T) {
+	hook := config.Hook{Command: "head -c 100000 /dev/zero | tr '\\0' x; echo done >&2"}
+	results := run(t, hook, &monitor.Change{Path: "/etc/hosts", Type: monitor.ModifiedFile})
+	if len(results) != 1 {
+		t.Fatalf("results %+v", results)
+	}
+	output, _ := results[0].Fields["output"].(string)
+	kept := strings.TrimSuffix(output, "\n[output truncated]")
+	if kept == output || len(kept) != maxOutput || strings.Trim(kept, "x") != "" {
+		t.Errorf("output of %d bytes ending in %q, want %d bytes and a truncation note",
+			len(output), output[max(0, len(output)-30):], maxOutput)
+	}
+}
@@ -0,0 +1,275 @@
+package ima
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultLogs are the locations of the runtime measurement list, tried in
+// order
+var DefaultLogs = []string{
+	"/sys/kernel/security/ima/ascii_runtime_measurements",
+	"/sys/kernel/security/integrity/ima/ascii_runtime_measurements",
+}
+
+// Measurement is an entry of the IMA runtime measurement list
+type Measurement struct {
+	PCR       int    `json:"pcr"`
+	Template  string `json:"template"`  // ima, ima-ng, ima-sig, ...
+	Algorithm string `json:"algorithm"` // algorithm of the file hash, e.g. sha256
+	Hash      string `json:"hash"`      // lower-case hex file hash
+	Path      string `json:"path"`
+	Violation bool   `json:"violation,omitempty"` // a file was measured while open for writing, or vice versa
+}
+
+// FindLog returns the first readable default measurement list
+func FindLog() (string, error) {
+	for _, path := range DefaultLogs {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no IMA measurement list found; is IMA enabled and securityfs mounted?")
+}
+
+// ReadFile reads a measurement list in the ASCII or binary format
+func ReadFile(path string) ([]*Measurement, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read measurement list: %v", err)
+	}
+	defer file.Close()
+
+	// The ASCII list starts with a PCR number, the binary one with a
+	// little-endian 32-bit PCR
+	r := bufio.NewReaderSize(file, 64*1024)
+	head, _ := r.Peek(1)
+	var measurements []*Measurement
+	if len(head) > 0 && head[0] >= '0' && head[0] <= '9' {
+		measurements, err = ParseASCII(r)
+	} else {
+		measurements, err = ParseBinary(r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return measurements, nil
+}
+
+// ParseASCII parses the ASCII measurement list, one entry per line:
+//
+//	10 <template hash> ima-ng sha256:<file hash> /usr/bin/ls
+//
+// Entries of templates that do not measure files, such as ima-buf, are
+// skipped.
+func ParseASCII(r io.Reader) ([]*Measurement, error) {
+	var measurements []*Measurement
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.SplitN(text, " ", 5)
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("line %d: expected at least 5 fields", line)
+		}
+		pcr, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid PCR %q", line, fields[0])
+		}
+		templateHash, template, digest, rest := fields[1], fields[2], fields[3], fields[4]
+		if !measuresFiles(template) {
+			continue
+		}
+
+		m := &Measurement{PCR: pcr, Template: template, Violation: strings.Trim(templateHash, "0") == ""}
+		if m.Algorithm, m.Hash, err = parseDigest(template, digest); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		m.Path = rest
+		if template == "ima-sig" || template == "ima-modsig" {
+			// A signature, if any, follows the path
+			if i := strings.LastIndexByte(rest, ' '); i >= 0 && isHex(rest[i+1:]) {
+				m.Path = rest[:i]
+			}
+		}
+		measurements = append(measurements, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return measurements, nil
+}
+
+// parseDigest splits a file hash of the ASCII list. The legacy ima
+// template logs bare sha1 digests, the others "<algorithm>:<hex>", and
+// ima-ngv2 prefixes the digest type, e.g. "ima:sha256:<hex>".
+func parseDigest(template, digest string) (string, string, error) {
+	algorithm, hash := "sha1", digest
+	if i := strings.LastIndexByte(digest, ':'); i >= 0 {
+		prefix := digest[:i]
+		if j := strings.IndexByte(prefix, ':'); j >= 0 {
+			prefix = prefix[j+1:]
+		}
+		algorithm, hash = prefix, digest[i+1:]
+	} else if template != "ima" {
+		return "", "", fmt.Errorf("invalid file hash %q", digest)
+	}
+	if !isHex(hash) {
+		return "", "", fmt.Errorf("invalid file hash %q", digest)
+	}
+	return algorithm, strings.ToLower(hash), nil
+}
+
+// ParseBinary parses the binary measurement list, which holds for each
+// entry the PCR, the template hash, the template name and, except for the
+// legacy ima template, the length-prefixed template fields
+func ParseBinary(r io.Reader) ([]*Measurement, error) {
+	var measurements []*Measurement
+	for entry := 1; ; entry++ {
+		var header struct {
+			PCR          uint32
+			TemplateHash [20]byte
+			NameLen      uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &header); err == io.EOF {
+			return measurements, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("entry %d: truncated header", entry)
+		}
+		if header.NameLen == 0 || header.NameLen > 255 {
+			return nil, fmt.Errorf("entry %d: invalid template name length %d", entry, header.NameLen)
+		}
+		name := make([]byte, header.NameLen)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, fmt.Errorf("entry %d: truncated template name", entry)
+		}
+		template := string(name)
+
+		m := &Measurement{
+			PCR:       int(header.PCR),
+			Template:  template,
+			Violation: header.TemplateHash == [20]byte{},
+		}
+		var err error
+		if template == "ima" {
+			err = readLegacy(r, m)
+		} else {
+			err = readFields(r, m)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %v", entry, err)
+		}
+		if measuresFiles(template) {
+			measurements = append(measurements, m)
+		}
+	}
+}
+
+// readLegacy reads the data of the ima template: a sha1 digest and a
+// length-prefixed file name
+func readLegacy(r io.Reader, m *Measurement) error {
+	var digest [20]byte
+	if _, err := io.ReadFull(r, digest[:]); err != nil {
+		return fmt.Errorf("truncated digest")
+	}
+	name, err := readField(r)
+	if err != nil {
+		return err
+	}
+	m.Algorithm, m.Hash, m.Path = "sha1", hex.EncodeToString(digest[:]), cString(name)
+	return nil
+}
+
+// readFields reads the template data of templates such as ima-ng: its
+// length and the length-prefixed fields, of which the first two are the
+// file hash and the file name
+func readFields(r io.Reader, m *Measurement) error {
+	data, err := readField(r)
+	if err != nil {
+		return err
+	}
+	var fields [][]byte
+	for rest := bytes.NewReader(data); rest.Len() > 0; {
+		field, err := readField(rest)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, field)
+	}
+	if !measuresFiles(m.Template) {
+		return nil
+	}
+	if len(fields) < 2 {
+		return fmt.Errorf("template %s has %d fields", m.Template, len(fields))
+	}
+
+	// d-ng is "<algorithm>:\0<digest>"; d-ngv2 is "<type>:<algorithm>:\0<digest>"
+	prefix, digest, ok := bytes.Cut(fields[0], []byte{0})
+	if !ok || !bytes.HasSuffix(prefix, []byte(":")) {
+		return fmt.Errorf("invalid file hash field")
+	}
+	algorithm := strings.TrimSuffix(string(prefix), ":")
+	if i := strings.LastIndexByte(algorithm, ':'); i >= 0 {
+		algorithm = algorithm[i+1:]
+	}
+	m.Algorithm, m.Hash, m.Path = algorithm, hex.EncodeToString(digest), cString(fields[1])
+	return nil
+}
+
+// maxField bounds the length of a template field
+const maxField = 16 * 1024 * 1024
+
+// readField reads a field prefixed with its little-endian 32-bit length
+func readField(r io.Reader) ([]byte, error) {
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return nil, fmt.Errorf("truncated field length")
+	}
+	if n > maxField {
+		return nil, fmt.Errorf("invalid field length %d", n)
+	}
+	field := make([]byte, n)
+	if _, err := io.ReadFull(r, field); err != nil {
+		return nil, fmt.Errorf("truncated field")
+	}
+	return field, nil
+}
+
+// measuresFiles reports whether entries of a template describe files.
+// ima-buf entries hold buffers such as the kexec command line.
+func measuresFiles(template string) bool {
+	switch template {
+	case "ima", "ima-ng", "ima-ngv2", "ima-sig", "ima-sigv2", "ima-modsig":
+		return true
+	}
+	return false
+}
+
+// cString returns a NUL-terminated string without its terminator
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// isHex reports whether s is a non-empty hex string
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,203 @@
+package ima
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+)
+
+// Status tells how a measured file compares with the baseline
+type Status string
+
+const (
+	// StatusMatches means the measured hash is the baseline hash
+	StatusMatches Status = "matches"
+	// StatusDiffers means the file was measured, typically executed,
+	// with content that differs from the baseline
+	StatusDiffers Status = "differs"
+	// StatusUnmonitored means the file is not in the baseline
+	StatusUnmonitored Status = "unmonitored"
+	// StatusUnverified means the measurement cannot be compared with the
+	// baseline, e.g. because the list holds no sha256 digest and the file
+	// can no longer be read
+	StatusUnverified Status = "unverified"
+	// StatusViolation means IMA could not measure the file reliably
+	// because it was open for writing at the time
+	StatusViolation Status = "violation"
+)
+
+// Content tells what a measurement that differs from the baseline measured
+type Content string
+
+const (
+	// ContentCurrent means IMA measured the file as it is now, e.g. a new
+	// binary that was executed after replacing the baselined one
+	ContentCurrent Content = "current"
+	// ContentOther means IMA measured content that is neither the
+	// baseline's nor on disk now, e.g. a binary that was put back since
+	ContentOther Content = "other"
+)
+
+// Result is the outcome of checking one measurement
+type Result struct {
+	*Measurement
+	Status   Status  `json:"status"`
+	Baseline string  `json:"baseline_hash,omitempty"` // sha256 recorded in the baseline
+	Content  Content `json:"content,omitempty"`       // set for differing measurements if the file could be read
+}
+
+// newHash returns a hash for an IMA algorithm name, or nil if the algorithm
+// is not supported
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha224":
+		return sha256.New224()
+	case "sha256":
+		return sha256.New()
+	case "sha384":
+		return sha512.New384()
+	case "sha512":
+		return sha512.New()
+	}
+	return nil
+}
+
+// Verifier compares measurements with a baseline
+type Verifier struct {
+	baseline *storage.Baseline
+	digests  map[string]digests // "<algorithm>:<path>" to digests of files as they are now
+}
+
+// digests holds the digests of a file with a measurement's algorithm and
+// with sha256
+type digests struct {
+	digest, sha256 string
+}
+
+// NewVerifier creates a verifier for a baseline
+func NewVerifier(baseline *storage.Baseline) *Verifier {
+	return &Verifier{baseline: baseline, digests: make(map[string]digests)}
+}
+
+// Verify compares a measurement with the baseline. The baseline records
+// sha256 digests, so for other algorithms the file is read: a measurement
+// matches if it is the digest of the file and the file still has the
+// baseline sha256. A file whose sha256 is no longer the baseline's differs
+// whatever IMA measured.
+func (v *Verifier) Verify(m *Measurement) *Result {
+	result := &Result{Measurement: m}
+	info, ok := v.baseline.GetFile(m.Path)
+	switch {
+	case m.Violation:
+		result.Status = StatusViolation
+		return result
+	case !ok || info.IsDir || info.IsSymlink:
+		result.Status = StatusUnmonitored
+		return result
+	case info.Hash == "":
+		result.Status = StatusUnverified
+		return result
+	}
+	result.Baseline = info.Hash
+	if m.Algorithm == "sha256" && m.Hash == info.Hash {
+		result.Status = StatusMatches
+		return result
+	}
+
+	current, err := v.current(m.Path, m.Algorithm)
+	switch {
+	case err != nil && m.Algorithm == "sha256":
+		result.Status = StatusDiffers
+	case err != nil:
+		result.Status = StatusUnverified
+	case m.Hash == current.digest && current.sha256 == info.Hash:
+		result.Status = StatusMatches
+	case m.Hash == current.digest:
+		result.Status = StatusDiffers
+		result.Content = ContentCurrent
+	default:
+		result.Status = StatusDiffers
+		result.Content = ContentOther
+	}
+	return result
+}
+
+// current returns the digests of a file as it is now
+func (v *Verifier) current(path, algorithm string) (digests, error) {
+	key := algorithm + ":" + path
+	if d, ok := v.digests[key]; ok {
+		return d, nil
+	}
+
+	h := newHash(algorithm)
+	if h == nil {
+		return digests{}, fmt.Errorf("unsupported algorithm %s", algorithm)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return digests{}, err
+	}
+	defer file.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(h, sum), file); err != nil {
+		return digests{}, err
+	}
+
+	d := digests{digest: hex.EncodeToString(h.Sum(nil)), sha256: hex.EncodeToString(sum.Sum(nil))}
+	v.digests[key] = d
+	return d, nil
+}
+
+// Watcher checks the entries appended to a measurement list. The list only
+// grows until the next boot, so each entry is checked once.
+type Watcher struct {
+	path string
+	seen int
+}
+
+// NewWatcher creates a watcher for a measurement list, or for the list in
+// securityfs if path is empty
+func NewWatcher(path string) (*Watcher, error) {
+	if path == "" {
+		var err error
+		if path, err = FindLog(); err != nil {
+			return nil, err
+		}
+	}
+	return &Watcher{path: path}, nil
+}
+
+// Check returns the measurements added since the previous check that
+// differ from the baseline
+func (w *Watcher) Check(baseline *storage.Baseline) ([]*Result, error) {
+	measurements, err := ReadFile(w.path)
+	if err != nil {
+		return nil, err
+	}
+	if len(measurements) < w.seen {
+		// A list replaced by a shorter one, e.g. a saved list
+		w.seen = 0
+	}
+
+	verifier := NewVerifier(baseline)
+	var differs []*Result
+	for _, m := range measurements[w.seen:] {
+		if result := verifier.Verify(m); result.Status == StatusDiffers {
+			differs = append(differs, result)
+		}
+	}
+	w.seen = len(measurements)
+	return differs, nil
+}
@@ -0,0 +1,72 @@
+package ima
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+)
+
+func sha1Hex(content string) string {
+	sum := sha1.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	unchanged := filepath.Join(dir, "unchanged")
+	replaced := filepath.Join(dir, "replaced")
+	deleted := filepath.Join(dir, "deleted")
+	if err := os.WriteFile(unchanged, []byte("v1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(replaced, []byte("v2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The baseline was taken with v1 everywhere
+	baseline := storage.NewBaseline()
+	for _, path := range []string{unchanged, replaced, deleted} {
+		baseline.AddFile(&monitor.FileInfo{Path: path, Hash: sha256Hex("v1"), Mode: 0755})
+	}
+	baseline.AddFile(&monitor.FileInfo{Path: dir, IsDir: true})
+
+	tests := []struct {
+		name    string
+		m       Measurement
+		status  Status
+		content Content
+	}{
+		{"sha256 of the baseline", Measurement{Algorithm: "sha256", Hash: sha256Hex("v1"), Path: replaced}, StatusMatches, ""},
+		{"sha256 of the new binary", Measurement{Algorithm: "sha256", Hash: sha256Hex("v2"), Path: replaced}, StatusDiffers, ContentCurrent},
+		{"sha256 of something else", Measurement{Algorithm: "sha256", Hash: sha256Hex("v3"), Path: replaced}, StatusDiffers, ContentOther},
+		{"sha256 of a deleted file", Measurement{Algorithm: "sha256", Hash: sha256Hex("v3"), Path: deleted}, StatusDiffers, ""},
+		{"sha1 of an unchanged file", Measurement{Algorithm: "sha1", Hash: sha1Hex("v1"), Path: unchanged}, StatusMatches, ""},
+		{"sha1 of other content", Measurement{Algorithm: "sha1", Hash: sha1Hex("v3"), Path: unchanged}, StatusDiffers, ContentOther},
+		{"sha1 of the new binary", Measurement{Algorithm: "sha1", Hash: sha1Hex("v2"), Path: replaced}, StatusDiffers, ContentCurrent},
+		{"sha1 after a replacement", Measurement{Algorithm: "sha1", Hash: sha1Hex("v1"), Path: replaced}, StatusDiffers, ContentOther},
+		{"sha1 of a deleted file", Measurement{Algorithm: "sha1", Hash: sha1Hex("v1"), Path: deleted}, StatusUnverified, ""},
+		{"unknown algorithm", Measurement{Algorithm: "sm3", Hash: "00", Path: unchanged}, StatusUnverified, ""},
+		{"violation", Measurement{Algorithm: "sha256", Hash: "00", Path: unchanged, Violation: true}, StatusViolation, ""},
+		{"not in the baseline", Measurement{Algorithm: "sha256", Hash: "00", Path: "/usr/bin/true"}, StatusUnmonitored, ""},
+		{"directory", Measurement{Algorithm: "sha256", Hash: "00", Path: dir}, StatusUnmonitored, ""},
+	}
+	v := NewVerifier(baseline)
+	for _, tt := range tests {
+		m := tt.m
+		result := v.Verify(&m)
+		if result.Status != tt.status || result.Content != tt.content {
+			t.Errorf("%s: %s %q, want %s %q", tt.name, result.Status, result.Content, tt.status, tt.content)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package ioc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// listExt is the extension of imported hash lists
+const listExt = ".txt"
+
+// validName matches names of imported lists
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// GetDefaultDir returns the default directory of imported hash lists
+func GetDefaultDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "fim-ioc"
+	}
+	return filepath.Join(homeDir, ".fim", "ioc")
+}
+
+// ImportedLists returns the paths of the lists in the import directory, or
+// the default directory if dir is empty
+func ImportedLists(dir string) ([]string, error) {
+	if dir == "" {
+		dir = GetDefaultDir()
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hash list directory: %v", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && filepath.Ext(entry.Name()) == listExt {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ListPath returns the path of the imported list with the given name
+func ListPath(dir, name string) (string, error) {
+	if dir == "" {
+		dir = GetDefaultDir()
+	}
+	name = strings.TrimSuffix(name, listExt)
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("invalid list name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return filepath.Join(dir, name+listExt), nil
+}
+
+// Import converts the indicators of a hash list to plain text and stores
+// them in the import directory under name, replacing an earlier import of
+// the same name. It returns the path of the stored list.
+func Import(dir, name, source string, indicators []*monitor.Indicator) (string, error) {
+	path, err := ListPath(dir, name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create hash list directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".import-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create hash list: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	fmt.Fprintf(w, "# Imported from %s on %s\n", source, time.Now().UTC().Format(time.RFC3339))
+	seen := make(map[string]bool, len(indicators))
+	for _, indicator := range indicators {
+		if seen[indicator.Hash] {
+			continue
+		}
+		seen[indicator.Hash] = true
+		name := strings.Join(strings.Fields(indicator.Name), " ")
+		fmt.Fprintf(w, "%s %s\n", indicator.Hash, name)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write hash list: %v", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write hash list: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write hash list: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to store hash list: %v", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,347 @@
+package ioc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// Formats of hash lists
+const (
+	FormatText = "text" // one hash per line, optionally followed by a name
+	FormatCSV  = "csv"  // hash columns found by header name or content
+	FormatSTIX = "stix" // STIX 2 bundle with file hash indicators
+)
+
+// SkippedError reports the malformed lines skipped while reading a hash
+// list. The hashes on the other lines were read.
+type SkippedError struct {
+	Path   string // the list, if read from a file
+	Lines  int    // number of lines skipped
+	Line   int    // the first of them
+	Reason string // why it was skipped
+}
+
+// Error describes the skipped lines
+func (e *SkippedError) Error() string {
+	msg := fmt.Sprintf("skipped %d malformed line(s), first at line %d: %s", e.Lines, e.Line, e.Reason)
+	if e.Path != "" {
+		msg = e.Path + ": " + msg
+	}
+	return msg
+}
+
+// LoadFile reads the indicators of a hash list, detecting its format. If
+// malformed lines were skipped, the indicators read are returned with a
+// *SkippedError.
+func LoadFile(path string) ([]*monitor.Indicator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hash list: %v", err)
+	}
+
+	indicators, err := Parse(bytes.NewReader(data), DetectFormat(path, data), filepath.Base(path))
+	if skipped, ok := err.(*SkippedError); ok {
+		skipped.Path = path
+		return indicators, skipped
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return indicators, nil
+}
+
+// DetectFormat guesses the format of a hash list from its file name and
+// content
+func DetectFormat(path string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".stix":
+		return FormatSTIX
+	case ".csv":
+		return FormatCSV
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return FormatSTIX
+	}
+	return FormatText
+}
+
+// Parse reads the indicators of a hash list in the given format. Source
+// names the list in matches. If malformed lines were skipped, the
+// indicators read are returned with a *SkippedError.
+func Parse(r io.Reader, format, source string) ([]*monitor.Indicator, error) {
+	var indicators []*monitor.Indicator
+	err := Read(r, format, func(indicator *monitor.Indicator) error {
+		indicator.Source = source
+		indicators = append(indicators, indicator)
+		return nil
+	})
+	if _, ok := err.(*SkippedError); ok {
+		return indicators, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return indicators, nil
+}
+
+// Read streams the hashes of a list in the given format to fn, so that
+// lists with millions of entries need not be held in memory. Reading stops
+// at the first error returned by fn. Malformed lines of text lists are
+// skipped and reported with a *SkippedError once the list has been read.
+func Read(r io.Reader, format string, fn func(*monitor.Indicator) error) error {
+	switch format {
+	case FormatText:
+		return parseText(r, fn)
+	case FormatCSV:
+		return parseCSV(r, fn)
+	case FormatSTIX:
+		return parseSTIX(r, fn)
+	default:
+		return fmt.Errorf("unknown hash list format %q: expected text, csv or stix", format)
+	}
+}
+
+// parseText reads one hash per line, as written by sha256sum or exported by
+// most feeds. Anything after the hash is taken as its name; blank lines and
+// lines starting with # are skipped, as are lines without a hash.
+func parseText(r io.Reader, fn func(*monitor.Indicator) error) error {
+	var skipped *SkippedError
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		indicator, ok := parseHash(fields[0])
+		if !ok {
+			if skipped == nil {
+				skipped = &SkippedError{Line: line, Reason: fmt.Sprintf("not a md5, sha1 or sha256 hash: %q", fields[0])}
+			}
+			skipped.Lines++
+			continue
+		}
+		name := strings.Join(fields[1:], " ")
+		indicator.Name = strings.TrimSpace(strings.TrimLeft(name, "*#"))
+		if err := fn(indicator); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read hash list: %v", err)
+	}
+	if skipped != nil {
+		return skipped
+	}
+	return nil
+}
+
+// nameColumns lists CSV columns that name an indicator, most specific first
+var nameColumns = []string{
+	"signature", "malware", "family", "threat", "name", "description", "comment", "file_name", "filename",
+}
+
+// parseCSV reads a CSV export. With a header row, every column whose name
+// mentions md5, sha1, sha256 or hash is read and the name is taken from the
+// first known name column. Without one, every cell holding a hash is read.
+func parseCSV(r io.Reader, fn func(*monitor.Indicator) error) error {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+
+	record, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse CSV: %v", err)
+	}
+
+	// Find the hash and name columns from the header, if there is one
+	hashCols, nameCol := []int(nil), -1
+	if !hasHash(record) {
+		header := append([]string(nil), record...)
+		record = nil
+		for i, column := range header {
+			column = strings.ToLower(strings.TrimSpace(column))
+			for _, algo := range []string{"md5", "sha1", "sha-1", "sha256", "sha-256", "hash", "digest"} {
+				if strings.Contains(column, algo) {
+					hashCols = append(hashCols, i)
+					break
+				}
+			}
+		}
+		if len(hashCols) == 0 {
+			return fmt.Errorf("no hash column found in CSV header")
+		}
+	names:
+		for _, name := range nameColumns {
+			for i, column := range header {
+				if strings.ToLower(strings.TrimSpace(column)) == name {
+					nameCol = i
+					break names
+				}
+			}
+		}
+	}
+
+	for {
+		name := ""
+		if nameCol >= 0 && nameCol < len(record) {
+			name = strings.TrimSpace(record[nameCol])
+		}
+		for i, cell := range record {
+			if hashCols != nil && !containsInt(hashCols, i) {
+				continue
+			}
+			if indicator, ok := parseHash(cell); ok {
+				indicator.Name = name
+				if err := fn(indicator); err != nil {
+					return err
+				}
+			}
+		}
+
+		record, err = reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse CSV: %v", err)
+		}
+	}
+}
+
+// hasHash reports whether any cell of a CSV record holds a hash
+func hasHash(record []string) bool {
+	for _, cell := range record {
+		if _, ok := parseHash(cell); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// containsInt reports whether n is one of values
+func containsInt(values []int, n int) bool {
+	for _, v := range values {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+// stixObject holds the fields of STIX 2 objects used for file hashes
+type stixObject struct {
+	Type        string            `json:"type"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Pattern     string            `json:"pattern"`
+	Hashes      map[string]string `json:"hashes"`
+	Objects     []stixObject      `json:"objects"`
+}
+
+// stixHashPattern matches a file hash comparison in a STIX pattern, e.g.
+// [file:hashes.'SHA-256' = '...']
+var stixHashPattern = regexp.MustCompile(`file:hashes\.(?:'[^']*'|"[^"]*"|[A-Za-z0-9-]+)\s*=\s*'([0-9A-Fa-f]+)'`)
+
+// parseSTIX reads file hashes from a STIX 2 bundle, a list of STIX objects
+// or a single object. Hashes are taken from the patterns of indicator
+// objects and from the hashes of file objects; other objects are ignored.
+func parseSTIX(r io.Reader, fn func(*monitor.Indicator) error) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read hash list: %v", err)
+	}
+
+	var objects []stixObject
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &objects)
+	} else {
+		var object stixObject
+		err = json.Unmarshal(data, &object)
+		objects = []stixObject{object}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse STIX JSON: %v", err)
+	}
+
+	var walk func(objects []stixObject) error
+	walk = func(objects []stixObject) error {
+		for _, object := range objects {
+			name := object.Name
+			if name == "" {
+				name = object.Description
+			}
+			var values []string
+			switch object.Type {
+			case "bundle":
+				if err := walk(object.Objects); err != nil {
+					return err
+				}
+			case "indicator":
+				for _, match := range stixHashPattern.FindAllStringSubmatch(object.Pattern, -1) {
+					values = append(values, match[1])
+				}
+			case "file":
+				for _, value := range object.Hashes {
+					values = append(values, value)
+				}
+			}
+			for _, value := range values {
+				if indicator, ok := parseHash(value); ok {
+					indicator.Name = name
+					if err := fn(indicator); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+	return walk(objects)
+}
+
+// parseHash recognises a hex md5, sha1 or sha256 digest by its length. An
+// algorithm prefix such as "sha256:" is accepted.
+func parseHash(s string) (*monitor.Indicator, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		s = s[i+1:]
+	}
+
+	var algorithm string
+	switch len(s) {
+	case 32:
+		algorithm = "md5"
+	case 40:
+		algorithm = "sha1"
+	case 64:
+		algorithm = "sha256"
+	default:
+		return nil, false
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return nil, false
+	}
+	return &monitor.Indicator{Hash: s, Algorithm: algorithm}, true
+}
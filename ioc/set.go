@@ -0,0 +1,311 @@
+package ioc
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+)
+
+// Kind is added to the kinds of a change whose file matches an indicator
+const Kind = "known_bad"
+
+// Set holds known-bad hashes keyed by their binary digest, so that looking
+// up a scanned file costs one map access per algorithm
+type Set struct {
+	sha256 map[[sha256.Size]byte]*monitor.Indicator
+	sha1   map[[sha1.Size]byte]*monitor.Indicator
+	md5    map[[md5.Size]byte]*monitor.Indicator
+
+	// digests keeps the md5 and sha1 digests of files already read
+	digests *digestCache
+}
+
+// NewSet creates an empty set
+func NewSet() *Set {
+	return &Set{
+		sha256:  make(map[[sha256.Size]byte]*monitor.Indicator),
+		sha1:    make(map[[sha1.Size]byte]*monitor.Indicator),
+		md5:     make(map[[md5.Size]byte]*monitor.Indicator),
+		digests: newDigestCache(),
+	}
+}
+
+// LoadSet loads the hash lists configured in [ioc] and the lists added with
+// 'fim ioc import'. Malformed lines are skipped with a warning on stderr.
+func LoadSet(cfg *config.Config) (*Set, error) {
+	set, warnings, err := NewLoader(cfg).Load()
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "fim: %v\n", warning)
+	}
+	return set, err
+}
+
+// Loader loads the hash lists for repeated scans. A list is only parsed
+// again when its size or modification time changes, and the md5 and sha1
+// digests of files are kept from one scan to the next, so that only new
+// and modified files are read again.
+type Loader struct {
+	cfg     *config.Config
+	lists   map[string]*list
+	set     *Set
+	digests *digestCache
+}
+
+// list is a parsed hash list
+type list struct {
+	size       int64
+	modTime    time.Time
+	indicators []*monitor.Indicator
+}
+
+// NewLoader creates a loader for the lists of a configuration
+func NewLoader(cfg *config.Config) *Loader {
+	return &Loader{cfg: cfg, lists: make(map[string]*list), digests: newDigestCache()}
+}
+
+// Load returns the set of the current lists. Lists with malformed lines
+// are loaded without them; the lines are reported as warnings when the
+// list is parsed.
+func (l *Loader) Load() (*Set, []error, error) {
+	imported, err := ImportedLists(l.cfg.IOC.Dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var warnings []error
+	changed := l.set == nil
+	lists := make(map[string]*list)
+	for _, path := range append(append([]string{}, l.cfg.IOC.Lists...), imported...) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read hash list: %v", err)
+		}
+		cached, ok := l.lists[path]
+		if !ok || cached.size != info.Size() || !cached.modTime.Equal(info.ModTime()) {
+			indicators, err := LoadFile(path)
+			if _, skipped := err.(*SkippedError); skipped {
+				warnings = append(warnings, err)
+			} else if err != nil {
+				return nil, nil, err
+			}
+			cached = &list{size: info.Size(), modTime: info.ModTime(), indicators: indicators}
+			changed = true
+		}
+		lists[path] = cached
+	}
+	if len(lists) != len(l.lists) {
+		changed = true
+	}
+	l.lists = lists
+
+	l.digests.rotate()
+	if !changed {
+		return l.set, warnings, nil
+	}
+	set := NewSet()
+	set.digests = l.digests
+	for _, list := range lists {
+		for _, indicator := range list.indicators {
+			set.Add(indicator)
+		}
+	}
+	l.set = set
+	return set, warnings, nil
+}
+
+// Add adds an indicator to the set. Indicators with a malformed hash are
+// ignored; the first indicator for a hash wins.
+func (s *Set) Add(indicator *monitor.Indicator) {
+	digest, err := hex.DecodeString(indicator.Hash)
+	if err != nil {
+		return
+	}
+
+	switch len(digest) {
+	case sha256.Size:
+		key := [sha256.Size]byte(digest)
+		if _, ok := s.sha256[key]; !ok {
+			s.sha256[key] = indicator
+		}
+	case sha1.Size:
+		key := [sha1.Size]byte(digest)
+		if _, ok := s.sha1[key]; !ok {
+			s.sha1[key] = indicator
+		}
+	case md5.Size:
+		key := [md5.Size]byte(digest)
+		if _, ok := s.md5[key]; !ok {
+			s.md5[key] = indicator
+		}
+	}
+}
+
+// Len returns the number of hashes in the set
+func (s *Set) Len() int {
+	return len(s.sha256) + len(s.sha1) + len(s.md5)
+}
+
+// Enabled reports whether the set holds any hashes
+func (s *Set) Enabled() bool {
+	return s.Len() > 0
+}
+
+// Lookup returns the indicator a scanned file matches. The SHA-256 recorded
+// by the scan is used as is; the file is only read again if the set holds
+// md5 or sha1 hashes and its content has not been read before, and those
+// are skipped if it can no longer be read.
+func (s *Set) Lookup(info *monitor.FileInfo) (*monitor.Indicator, bool) {
+	if info == nil || info.IsDir || info.IsSymlink || info.Hash == "" {
+		return nil, false
+	}
+
+	if digest, err := hex.DecodeString(info.Hash); err == nil && len(digest) == sha256.Size {
+		if indicator, ok := s.sha256[[sha256.Size]byte(digest)]; ok {
+			return indicator, true
+		}
+	}
+	if len(s.md5) == 0 && len(s.sha1) == 0 {
+		return nil, false
+	}
+
+	sums, err := s.digests.get(info.Hash, info.SourcePath())
+	if err != nil {
+		return nil, false
+	}
+	if indicator, ok := s.md5[sums.md5]; ok {
+		return indicator, true
+	}
+	if indicator, ok := s.sha1[sums.sha1]; ok {
+		return indicator, true
+	}
+	return nil, false
+}
+
+// Check returns the indicators matched by the files of a scanned state,
+// keyed by path
+func (s *Set) Check(state *storage.Baseline) map[string]*monitor.Indicator {
+	hits := make(map[string]*monitor.Indicator)
+	if !s.Enabled() {
+		return hits
+	}
+	for path, info := range state.Files {
+		if indicator, ok := s.Lookup(info); ok {
+			hits[path] = indicator
+		}
+	}
+	return hits
+}
+
+// Annotate flags every file of the current state that matches an indicator
+// as a critical change. A matching file is never trusted by the baseline:
+// if it is unchanged since the baseline was taken, for example because the
+// indicator was imported later, it is reported as a new file. It returns the
+// number of matching files.
+func (s *Set) Annotate(changes *storage.Changes, current *storage.Baseline) int {
+	hits := s.Check(current)
+	count := len(hits)
+	if count == 0 {
+		return 0
+	}
+
+	for _, change := range changes.Details {
+		if indicator, ok := hits[change.Path]; ok && change.NewInfo != nil {
+			flag(change, indicator)
+			delete(hits, change.Path)
+		}
+	}
+
+	paths := make([]string, 0, len(hits))
+	for path := range hits {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		change := &monitor.Change{
+			Path:      path,
+			Type:      monitor.NewFile,
+			NewInfo:   current.Files[path],
+			Timestamp: time.Now(),
+		}
+		flag(change, hits[path])
+		changes.Add(change)
+	}
+	return count
+}
+
+// flag marks a change as matching an indicator
+func flag(change *monitor.Change, indicator *monitor.Indicator) {
+	change.IOC = indicator
+	change.Severity = monitor.SeverityCritical
+	change.Kinds = append(change.Kinds, Kind)
+}
+
+// legacySums holds the MD5 and SHA-1 digests of a file
+type legacySums struct {
+	md5  [md5.Size]byte
+	sha1 [sha1.Size]byte
+}
+
+// digestCache keeps the legacy digests of file contents by their SHA-256,
+// so that a file is read again only when its content changes and identical
+// files, such as those of containers sharing an image, are read once.
+// Entries not used since the previous rotation are dropped.
+type digestCache struct {
+	cur, prev map[string]legacySums
+}
+
+// newDigestCache creates an empty cache
+func newDigestCache() *digestCache {
+	return &digestCache{cur: make(map[string]legacySums)}
+}
+
+// rotate starts a new scan, dropping the entries unused in the last one
+func (c *digestCache) rotate() {
+	c.prev, c.cur = c.cur, make(map[string]legacySums)
+}
+
+// get returns the legacy digests of a file with the given SHA-256, reading
+// the file if they are not cached
+func (c *digestCache) get(sha256Hex, path string) (legacySums, error) {
+	if sums, ok := c.cur[sha256Hex]; ok {
+		return sums, nil
+	}
+	sums, ok := c.prev[sha256Hex]
+	if !ok {
+		var err error
+		if sums, err = legacyDigests(path); err != nil {
+			return sums, err
+		}
+	}
+	c.cur[sha256Hex] = sums
+	return sums, nil
+}
+
+// legacyDigests returns the MD5 and SHA-1 digests of a file, read once
+func legacyDigests(path string) (legacySums, error) {
+	var sums legacySums
+
+	file, err := os.Open(path)
+	if err != nil {
+		return sums, err
+	}
+	defer file.Close()
+
+	md5Hash, sha1Hash := md5.New(), sha1.New()
+	if _, err := io.Copy(io.MultiWriter(md5Hash, sha1Hash), file); err != nil {
+		return sums, err
+	}
+	copy(sums.md5[:], md5Hash.Sum(nil))
+	copy(sums.sha1[:], sha1Hash.Sum(nil))
+	return sums, nil
+}
@@ -0,0 +1,167 @@
+package ioc
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// writeFile writes a file and returns its scanned state
+func writeFile(t *testing.T, path, content string) *monitor.FileInfo {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	return &monitor.FileInfo{Path: path, Size: int64(len(content)), Hash: hex.EncodeToString(sum[:])}
+}
+
+func md5Hex(content string) string {
+	sum := md5.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseTextSkipsMalformedLines(t *testing.T) {
+	list := strings.Join([]string{
+		"# feed",
+		md5Hex("a") + "  dropper.exe",
+		"not-a-hash",
+		"",
+		"sha256:" + strings.Repeat("ab", 32),
+		"1234 too short",
+	}, "\n")
+
+	indicators, err := Parse(strings.NewReader(list), FormatText, "feed")
+	skipped, ok := err.(*SkippedError)
+	if !ok {
+		t.Fatalf("Parse error = %v, want a *SkippedError", err)
+	}
+	if skipped.Lines != 2 || skipped.Line != 3 {
+		t.Errorf("skipped %d lines from line %d, want 2 from line 3", skipped.Lines, skipped.Line)
+	}
+	if len(indicators) != 2 {
+		t.Fatalf("read %d indicators, want 2", len(indicators))
+	}
+	if indicators[0].Name != "dropper.exe" || indicators[0].Algorithm != "md5" || indicators[0].Source != "feed" {
+		t.Errorf("first indicator = %+v", indicators[0])
+	}
+	if indicators[1].Algorithm != "sha256" {
+		t.Errorf("second indicator = %+v", indicators[1])
+	}
+}
+
+func TestParseFormats(t *testing.T) {
+	hash := strings.Repeat("cd", 32)
+	tests := []struct {
+		name   string
+		format string
+		data   string
+		want   string // name of the single indicator
+	}{
+		{"csv header", FormatCSV, "sha256_hash,signature\n" + hash + ",Mirai\n", "Mirai"},
+		{"csv without header", FormatCSV, "x," + hash + "\n", ""},
+		{"stix indicator", FormatSTIX, `{"type":"bundle","objects":[{"type":"indicator","name":"Emotet","pattern":"[file:hashes.'SHA-256' = '` + hash + `']"}]}`, "Emotet"},
+		{"stix file", FormatSTIX, `[{"type":"file","name":"x.bin","hashes":{"SHA-256":"` + hash + `"}}]`, "x.bin"},
+	}
+	for _, tt := range tests {
+		indicators, err := Parse(strings.NewReader(tt.data), tt.format, "feed")
+		if err != nil {
+			t.Errorf("%s: Parse: %v", tt.name, err)
+			continue
+		}
+		if len(indicators) != 1 || indicators[0].Hash != hash || indicators[0].Name != tt.want {
+			t.Errorf("%s: indicators = %+v", tt.name, indicators)
+		}
+	}
+}
+
+func TestLoaderReparsesChangedLists(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.IOC.Dir = filepath.Join(dir, "imported")
+	cfg.IOC.Lists = []string{filepath.Join(dir, "feed.txt")}
+	files := t.TempDir()
+	bad := writeFile(t, filepath.Join(files, "bad"), "bad")
+	writeFile(t, cfg.IOC.Lists[0], bad.Hash+"\ngarbage\n")
+
+	loader := NewLoader(cfg)
+	set, warnings, err := loader.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("got %d warnings, want one for the malformed line", len(warnings))
+	}
+	if _, ok := set.Lookup(bad); !ok {
+		t.Error("file on the list was not matched")
+	}
+
+	// An unchanged list is neither parsed nor reported again
+	again, warnings, err := loader.Load()
+	if err != nil || len(warnings) != 0 || again != set {
+		t.Errorf("reloading an unchanged list = %p, %v, %v; want the same set without warnings", again, warnings, err)
+	}
+
+	other := writeFile(t, filepath.Join(files, "other"), "other")
+	writeFile(t, cfg.IOC.Lists[0], other.Hash+"\n")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(cfg.IOC.Lists[0], future, future)
+	set, _, err = loader.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if _, ok := set.Lookup(bad); ok {
+		t.Error("hash removed from the list still matches")
+	}
+	if _, ok := set.Lookup(other); !ok {
+		t.Error("hash added to the list does not match")
+	}
+}
+
+func TestLegacyDigestsAreCached(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.IOC.Dir = filepath.Join(dir, "imported")
+	cfg.IOC.Lists = []string{filepath.Join(dir, "feed.txt")}
+	writeFile(t, cfg.IOC.Lists[0], md5Hex("malware")+"\n")
+
+	loader := NewLoader(cfg)
+	set, _, err := loader.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	info := writeFile(t, filepath.Join(dir, "sample"), "malware")
+	if _, ok := set.Lookup(info); !ok {
+		t.Fatal("file matching an md5 was not flagged")
+	}
+
+	// While the SHA-256 is unchanged the file is not read again, so the
+	// cached digest still matches after the content is swapped behind the
+	// scanner's back
+	os.WriteFile(info.Path, []byte("benign"), 0644)
+	set, _, _ = loader.Load()
+	if _, ok := set.Lookup(info); !ok {
+		t.Error("cached md5 was not used for an unchanged file")
+	}
+
+	// A new SHA-256 means new content, which is read
+	changed := writeFile(t, info.Path, "benign")
+	if _, ok := set.Lookup(changed); ok {
+		t.Error("modified file still matches")
+	}
+
+	// Entries unused for a whole scan are dropped
+	loader.Load()
+	loader.Load()
+	if _, ok := set.digests.prev[info.Hash]; ok {
+		t.Error("digest of a file no longer scanned was kept")
+	}
+}
@@ -0,0 +1,321 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// Device identification used in the CEF and LEEF headers
+const (
+	DeviceVendor  = "rhinocodelab"
+	DeviceProduct = "IntegrityWatchdog"
+	DeviceVersion = "1.0"
+)
+
+// CEF extension mapping for change events:
+//
+//	rt                      event time (milliseconds since epoch)
+//	act                     change type (added, modified, deleted, permission)
+//	filePath / fname        path and base name of the file
+//	fileType                file, directory or symlink
+//	fsize / oldFileSize     current and baseline size
+//	fileHash / oldFileHash  current and baseline SHA-256
+//	filePermission          current mode (octal), oldFilePermission for baseline
+//	fileModificationTime    current mtime, oldFileModificationTime for baseline
+//	cn1 (fileUid)           current owner UID
+//	cn2 (fileGid)           current owner GID
+//	cs1 (oldFileOwner)      baseline owner as uid:gid
+//	cs2 (scanId)            scan correlation ID
+//	cs3 (fimSeverity)       severity of the change (info to critical)
+//	suid / spid / sproc     UID, PID and name of the process that made the change
+//	cs4 (loginUid)          audit login UID of that process ("unset" if none)
+//	cs5 (processPath)       executable of that process
+//	cs6 (containerId)       ID of the container holding the file
+//	flexString1 (containerName)  name of that container
+//	dvchost                 host name
+//	msg                     human-readable message
+//
+// Fields of the side that does not exist (old for added files, new for
+// deleted files) are omitted.
+
+// cefSeverity maps an event to the 0-10 CEF severity scale, using the
+// severity of the change for change events and the level otherwise
+func cefSeverity(event *Event) int {
+	if event.Change != nil {
+		switch event.Change.Severity {
+		case monitor.SeverityInfo:
+			return 1
+		case monitor.SeverityLow:
+			return 3
+		case monitor.SeverityMedium:
+			return 5
+		case monitor.SeverityHigh:
+			return 8
+		case monitor.SeverityCritical:
+			return 10
+		}
+	}
+
+	switch event.Level {
+	case LevelDebug:
+		return 1
+	case LevelInfo:
+		return 3
+	case LevelWarning:
+		return 6
+	case LevelError:
+		return 8
+	default:
+		return 10
+	}
+}
+
+// EncodeCEF renders an event in ArcSight Common Event Format
+func EncodeCEF(event *Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%d|%s|%d|",
+		cefHeader(DeviceVendor), cefHeader(DeviceProduct), cefHeader(DeviceVersion),
+		event.ID, cefHeader(event.Name), cefSeverity(event))
+
+	ext := make([]string, 0, 24)
+	add := func(key, value string) {
+		ext = append(ext, key+"="+cefValue(value))
+	}
+
+	add("rt", strconv.FormatInt(event.Time.UnixMilli(), 10))
+	if host := eventHost(event); host != "" {
+		add("dvchost", host)
+	}
+	if change := event.Change; change != nil {
+		add("act", change.Type.String())
+		if change.Severity != monitor.SeverityNone {
+			add("cs3", change.Severity.String())
+			add("cs3Label", "fimSeverity")
+		}
+		add("filePath", change.Path)
+		add("fname", filepath.Base(change.Path))
+		if info := change.NewInfo; info != nil {
+			add("fileType", fileType(info))
+			add("fsize", strconv.FormatInt(info.Size, 10))
+			if info.Hash != "" {
+				add("fileHash", info.Hash)
+			}
+			add("filePermission", fileMode(info))
+			add("fileModificationTime", strconv.FormatInt(info.ModTime*1000, 10))
+			add("cn1", strconv.Itoa(info.UID))
+			add("cn1Label", "fileUid")
+			add("cn2", strconv.Itoa(info.GID))
+			add("cn2Label", "fileGid")
+		}
+		if info := change.OldInfo; info != nil {
+			if change.NewInfo == nil {
+				add("fileType", fileType(info))
+			}
+			add("oldFileSize", strconv.FormatInt(info.Size, 10))
+			if info.Hash != "" {
+				add("oldFileHash", info.Hash)
+			}
+			add("oldFilePermission", fileMode(info))
+			add("oldFileModificationTime", strconv.FormatInt(info.ModTime*1000, 10))
+			add("cs1", fmt.Sprintf("%d:%d", info.UID, info.GID))
+			add("cs1Label", "oldFileOwner")
+		}
+		if actor := change.Actor; actor != nil {
+			add("suid", strconv.FormatUint(uint64(actor.UID), 10))
+			if actor.PID != 0 {
+				add("spid", strconv.Itoa(actor.PID))
+			}
+			if actor.Comm != "" {
+				add("sproc", actor.Comm)
+			}
+			add("cs4", actor.LoginUID())
+			add("cs4Label", "loginUid")
+			if actor.Exe != "" {
+				add("cs5", actor.Exe)
+				add("cs5Label", "processPath")
+			}
+		}
+		if container := change.Container; container != nil {
+			add("cs6", container.ID)
+			add("cs6Label", "containerId")
+			if container.Name != "" {
+				add("flexString1", container.Name)
+				add("flexString1Label", "containerName")
+			}
+		}
+	}
+	if event.ScanID != "" {
+		add("cs2", event.ScanID)
+		add("cs2Label", "scanId")
+	}
+	msg := event.Message
+	if event.Error != "" {
+		msg += ": " + event.Error
+	}
+	add("msg", msg)
+
+	b.WriteString(strings.Join(ext, " "))
+	return b.String()
+}
+
+// LEEF attribute mapping for change events:
+//
+//	devTime / devTimeFormat  event time
+//	sev                      1-10 severity
+//	cat                      event name, e.g. file.modified
+//	identHostName            host name
+//	action                   change type (added, modified, deleted, permission)
+//	resource / fileName      path and base name of the file
+//	fileType                 file, directory or symlink
+//	fileSize / oldFileSize   current and baseline size
+//	fileHash / oldFileHash   current and baseline SHA-256
+//	fileMode / oldFileMode   current and baseline mode (octal)
+//	uid / gid                current owner
+//	oldUid / oldGid          baseline owner
+//	scanId                   scan correlation ID
+//	fimSeverity              severity of the change (info to critical)
+//	processUid / pid         UID and PID of the process that made the change
+//	auid                     audit login UID of that process ("unset" if none)
+//	processName / processPath  name and executable of that process
+//	containerId / containerName  container holding the file
+//	containerImage           image of that container
+//	msg                      human-readable message
+
+// EncodeLEEF renders an event in IBM QRadar Log Event Extended Format 1.0
+func EncodeLEEF(event *Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "LEEF:1.0|%s|%s|%s|%d|",
+		leefHeader(DeviceVendor), leefHeader(DeviceProduct), leefHeader(DeviceVersion), event.ID)
+
+	attrs := make([]string, 0, 24)
+	add := func(key, value string) {
+		attrs = append(attrs, key+"="+leefValue(value))
+	}
+
+	add("devTime", event.Time.Format("Jan 02 2006 15:04:05.000"))
+	add("devTimeFormat", "MMM dd yyyy HH:mm:ss.SSS")
+	add("sev", strconv.Itoa(cefSeverity(event)))
+	add("cat", event.Name)
+	if host := eventHost(event); host != "" {
+		add("identHostName", host)
+	}
+	if change := event.Change; change != nil {
+		add("action", change.Type.String())
+		if change.Severity != monitor.SeverityNone {
+			add("fimSeverity", change.Severity.String())
+		}
+		add("resource", change.Path)
+		add("fileName", filepath.Base(change.Path))
+		if info := change.NewInfo; info != nil {
+			add("fileType", fileType(info))
+			add("fileSize", strconv.FormatInt(info.Size, 10))
+			if info.Hash != "" {
+				add("fileHash", info.Hash)
+			}
+			add("fileMode", fileMode(info))
+			add("uid", strconv.Itoa(info.UID))
+			add("gid", strconv.Itoa(info.GID))
+		}
+		if info := change.OldInfo; info != nil {
+			if change.NewInfo == nil {
+				add("fileType", fileType(info))
+			}
+			add("oldFileSize", strconv.FormatInt(info.Size, 10))
+			if info.Hash != "" {
+				add("oldFileHash", info.Hash)
+			}
+			add("oldFileMode", fileMode(info))
+			add("oldUid", strconv.Itoa(info.UID))
+			add("oldGid", strconv.Itoa(info.GID))
+		}
+		if actor := change.Actor; actor != nil {
+			add("processUid", strconv.FormatUint(uint64(actor.UID), 10))
+			if actor.PID != 0 {
+				add("pid", strconv.Itoa(actor.PID))
+			}
+			add("auid", actor.LoginUID())
+			if actor.Comm != "" {
+				add("processName", actor.Comm)
+			}
+			if actor.Exe != "" {
+				add("processPath", actor.Exe)
+			}
+		}
+		if container := change.Container; container != nil {
+			add("containerId", container.ID)
+			if container.Name != "" {
+				add("containerName", container.Name)
+			}
+			if container.Image != "" {
+				add("containerImage", container.Image)
+			}
+		}
+	}
+	if event.ScanID != "" {
+		add("scanId", event.ScanID)
+	}
+	msg := event.Message
+	if event.Error != "" {
+		msg += ": " + event.Error
+	}
+	add("msg", msg)
+
+	b.WriteString(strings.Join(attrs, "\t"))
+	return b.String()
+}
+
+// eventHost returns the host recorded in the event, or the local host name
+func eventHost(event *Event) string {
+	if event.Host != "" {
+		return event.Host
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+// fileType returns the CEF/LEEF file type of a file
+func fileType(info *monitor.FileInfo) string {
+	switch {
+	case info.IsDir:
+		return "directory"
+	case info.IsSymlink:
+		return "symlink"
+	default:
+		return "file"
+	}
+}
+
+// fileMode returns the permission bits of a file in octal
+func fileMode(info *monitor.FileInfo) string {
+	return fmt.Sprintf("%04o", info.UnixPerm())
+}
+
+// cefHeader escapes a CEF header field
+func cefHeader(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// cefValue escapes a CEF extension value
+func cefValue(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "=", `\=`)
+	return strings.NewReplacer("\r\n", `\n`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+// leefHeader escapes a LEEF header field
+func leefHeader(s string) string {
+	return strings.NewReplacer("|", " ", "\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
+
+// leefValue escapes a LEEF attribute value; tabs separate attributes and
+// must not appear inside values
+func leefValue(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+func TestCEFEscaping(t *testing.T) {
+	// The cases follow the examples of the CEF specification: pipes and
+	// backslashes are escaped in the header, equal signs and backslashes
+	// in extension values, where pipes need no escaping
+	tests := []struct {
+		name   string
+		escape func(string) string
+		in     string
+		want   string
+	}{
+		{"header pipe", cefHeader, "detected a | in message", `detected a \| in message`},
+		{"header backslash", cefHeader, `detected a \ in packet`, `detected a \\ in packet`},
+		{"header backslash before pipe", cefHeader, `a\|b`, `a\\\|b`},
+		{"header equal sign", cefHeader, "a=b", "a=b"},
+		{"header newline", cefHeader, "two\nlines\r\n", "two lines  "},
+		{"extension equal sign", cefValue, "detected a = in message", `detected a \= in message`},
+		{"extension backslash", cefValue, `C:\Windows\cmd.exe`, `C:\\Windows\\cmd.exe`},
+		{"extension pipe", cefValue, "detected a | in message", "detected a | in message"},
+		{"extension newline", cefValue, "Detected a threat.\nNo action needed.", `Detected a threat.\nNo action needed.`},
+		{"extension carriage return", cefValue, "a\r\nb\rc", `a\nb\rc`},
+		{"extension escaped newline", cefValue, `a\nb`, `a\\nb`},
+	}
+	for _, tt := range tests {
+		if got := tt.escape(tt.in); got != tt.want {
+			t.Errorf("%s: %q escaped to %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLEEFEscaping(t *testing.T) {
+	// Pipes delimit the header and tabs the attributes, so neither may
+	// appear inside them
+	tests := []struct {
+		name   string
+		escape func(string) string
+		in     string
+		want   string
+	}{
+		{"header pipe", leefHeader, "a|b", "a b"},
+		{"header tab and newline", leefHeader, "a\tb\nc", "a b c"},
+		{"attribute tab", leefValue, "a\tb", "a b"},
+		{"attribute newline", leefValue, "a\r\nb", "a  b"},
+		{"attribute pipe and equal sign", leefValue, "a|b=c", "a|b=c"},
+	}
+	for _, tt := range tests {
+		if got := tt.escape(tt.in); got != tt.want {
+			t.Errorf("%s: %q escaped to %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeEscapesEvents(t *testing.T) {
+	path := "/srv/a=b|c\nd"
+	event := &Event{
+		Time:    time.UnixMilli(1700000000000).UTC(),
+		ID:      3001,
+		Name:    "file|modified",
+		Level:   LevelWarning,
+		Host:    "web-1",
+		Message: "Modified file: " + path,
+		Change: &monitor.Change{Path: path, Type: monitor.ModifiedFile, Severity: monitor.SeverityHigh,
+			NewInfo: &monitor.FileInfo{Path: path, Mode: 0644}},
+	}
+
+	cef := EncodeCEF(event)
+	if !strings.HasPrefix(cef, `CEF:0|rhinocodelab|IntegrityWatchdog|1.0|3001|file\|modified|8|rt=1700000000000 `) {
+		t.Errorf("CEF header: %s", cef)
+	}
+	if !strings.Contains(cef, ` filePath=/srv/a\=b|c\nd `) || !strings.HasSuffix(cef, ` msg=Modified file: /srv/a\=b|c\nd`) {
+		t.Errorf("CEF extension: %s", cef)
+	}
+	if strings.Contains(cef, "\n") {
+		t.Errorf("CEF event spans lines: %q", cef)
+	}
+
+	leef := EncodeLEEF(event)
+	if !strings.HasPrefix(leef, "LEEF:1.0|rhinocodelab|IntegrityWatchdog|1.0|3001|devTime=") {
+		t.Errorf("LEEF header: %s", leef)
+	}
+	if !strings.Contains(leef, "\tcat=file|modified\t") || !strings.Contains(leef, "\tresource=/srv/a=b|c d\t") {
+		t.Errorf("LEEF attributes: %q", leef)
+	}
+	if strings.Contains(leef, "\n") {
+		t.Errorf("LEEF event spans lines: %q", leef)
+	}
+}
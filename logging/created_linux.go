@@ -0,0 +1,18 @@
+package logging
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileCreated returns the birth time of a file, or its modification time if
+// the filesystem does not record birth times
+func fileCreated(path string, info os.FileInfo) time.Time {
+	var stat unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, path, 0, unix.STATX_BTIME, &stat); err == nil && stat.Mask&unix.STATX_BTIME != 0 {
+		return time.Unix(stat.Btime.Sec, int64(stat.Btime.Nsec))
+	}
+	return info.ModTime()
+}
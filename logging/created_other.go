@@ -0,0 +1,14 @@
+//go:build !linux
+
+package logging
+
+import (
+	"os"
+	"time"
+)
+
+// fileCreated returns the modification time of a file, as birth times are
+// not available portably
+func fileCreated(path string, info os.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -0,0 +1,239 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// SchemaVersion is the version of the JSON event schema. It is bumped
+// whenever a field is renamed or removed, never when one is added.
+const SchemaVersion = 1
+
+// Level represents the severity level of a log event
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+	LevelCritical
+)
+
+var levelNames = map[Level]string{
+	LevelDebug:    "debug",
+	LevelInfo:     "info",
+	LevelWarning:  "warning",
+	LevelError:    "error",
+	LevelCritical: "critical",
+}
+
+// String returns the lower-case name of the level
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// MarshalText encodes the level by name
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// ParseLevel parses a level name such as "info" or "warning"
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "warn" {
+		s = "warning"
+	}
+	for level, name := range levelNames {
+		if name == s {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level: %s", s)
+}
+
+// EventID identifies the kind of an event. IDs are stable across releases
+// so that log shippers can key on them instead of on message text.
+type EventID int
+
+const (
+	// Lifecycle events
+	EventDaemonStarted  EventID = 1000
+	EventDaemonStopped  EventID = 1001
+	EventBaselineLoaded EventID = 1002
+	EventLogReopened    EventID = 1003
+	EventChangeAccepted EventID = 1004
+	EventChangeDeferred EventID = 1005
+
+	// Scan events
+	EventScanStarted  EventID = 2000
+	EventScanFinished EventID = 2001
+
+	// Change events
+	EventFileAdded         EventID = 3000
+	EventFileModified      EventID = 3001
+	EventFileDeleted       EventID = 3002
+	EventPermissionChanged EventID = 3003
+	EventChangeResolved    EventID = 3004
+	EventIMAMismatch       EventID = 3005
+
+	// Error events
+	EventScanFailed EventID = 4000
+
+	// Responder events
+	EventHookCompleted EventID = 5000
+	EventHookFailed    EventID = 5001
+	EventNotifySent    EventID = 5002
+	EventNotifyFailed  EventID = 5003
+	EventAlertThrottle EventID = 5004
+	EventAlertSilenced EventID = 5005
+
+	// Quarantine events
+	EventFileQuarantined  EventID = 5006
+	EventQuarantineFailed EventID = 5007
+)
+
+var eventNames = map[EventID]string{
+	EventDaemonStarted:     "daemon.started",
+	EventDaemonStopped:     "daemon.stopped",
+	EventBaselineLoaded:    "baseline.loaded",
+	EventLogReopened:       "log.reopened",
+	EventChangeAccepted:    "baseline.accepted",
+	EventChangeDeferred:    "baseline.deferred",
+	EventScanStarted:       "scan.started",
+	EventScanFinished:      "scan.finished",
+	EventFileAdded:         "file.added",
+	EventFileModified:      "file.modified",
+	EventFileDeleted:       "file.deleted",
+	EventPermissionChanged: "file.permission_changed",
+	EventChangeResolved:    "file.resolved",
+	EventIMAMismatch:       "file.ima_mismatch",
+	EventScanFailed:        "scan.failed",
+	EventHookCompleted:     "hook.completed",
+	EventHookFailed:        "hook.failed",
+	EventNotifySent:        "notify.sent",
+	EventNotifyFailed:      "notify.failed",
+	EventAlertThrottle:     "alert.throttled",
+	EventAlertSilenced:     "alert.silenced",
+	EventFileQuarantined:   "file.quarantined",
+	EventQuarantineFailed:  "quarantine.failed",
+}
+
+// Name returns the dotted name of the event, e.g. "scan.started"
+func (id EventID) Name() string {
+	if name, ok := eventNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("event.%d", int(id))
+}
+
+// ChangeEventID returns the event ID used to report a change of the given type
+func ChangeEventID(t monitor.ChangeType) EventID {
+	switch t {
+	case monitor.NewFile:
+		return EventFileAdded
+	case monitor.DeletedFile:
+		return EventFileDeleted
+	case monitor.PermissionChange:
+		return EventPermissionChanged
+	default:
+		return EventFileModified
+	}
+}
+
+// Event represents a single entry in the event log
+type Event struct {
+	Schema  int                    `json:"schema"`
+	Time    time.Time              `json:"time"`
+	ID      EventID                `json:"event_id"`
+	Name    string                 `json:"event"`
+	Level   Level                  `json:"level"`
+	Host    string                 `json:"host,omitempty"`
+	ScanID  string                 `json:"scan_id,omitempty"`
+	Message string                 `json:"message"`
+	Change  *monitor.Change        `json:"change,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// NewEvent creates an event with the given ID, level and message
+func NewEvent(id EventID, level Level, message string) *Event {
+	return &Event{
+		Schema:  SchemaVersion,
+		Time:    time.Now(),
+		ID:      id,
+		Name:    id.Name(),
+		Level:   level,
+		Message: message,
+	}
+}
+
+// NewChangeEvent creates an event describing a detected change. The event
+// level follows the severity of the change.
+func NewChangeEvent(scanID string, change *monitor.Change) *Event {
+	event := NewEvent(ChangeEventID(change.Type), SeverityLevel(change.Severity), ChangeMessage(change))
+	event.ScanID = scanID
+	event.Change = change
+	return event
+}
+
+// SeverityLevel maps the severity of a change to a log level, so that the
+// log level filter also filters changes by severity
+func SeverityLevel(severity monitor.Severity) Level {
+	switch severity {
+	case monitor.SeverityCritical:
+		return LevelCritical
+	case monitor.SeverityHigh:
+		return LevelError
+	case monitor.SeverityInfo, monitor.SeverityLow:
+		return LevelInfo
+	default:
+		return LevelWarning
+	}
+}
+
+// ChangeMessage returns the human-readable description of a change
+func ChangeMessage(change *monitor.Change) string {
+	var message string
+	switch change.Type {
+	case monitor.NewFile:
+		message = fmt.Sprintf("[+] New file: %s", change.Path)
+	case monitor.DeletedFile:
+		message = fmt.Sprintf("[-] Deleted file: %s", change.Path)
+	case monitor.PermissionChange:
+		message = fmt.Sprintf("[*] Permissions changed: %s", change.Path)
+	default:
+		message = fmt.Sprintf("[*] Modified file: %s", change.Path)
+	}
+	if change.IOC != nil {
+		message += fmt.Sprintf(" (matches known-bad hash: %s)", change.IOC)
+	}
+	if len(change.Rules) > 0 {
+		message += fmt.Sprintf(" (matches rules: %s)", monitor.RuleNames(change.Rules))
+	}
+	if change.Actor != nil {
+		message += fmt.Sprintf(" (by %s)", change.Actor)
+	}
+	if change.Container != nil {
+		message += fmt.Sprintf(" in container %s", change.Container)
+	}
+	return message
+}
+
+// NewScanID returns a random identifier used to correlate the events of one scan
+func NewScanID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		// Fall back to a time based ID; uniqueness per host is enough here
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
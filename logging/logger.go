@@ -0,0 +1,196 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Format is the output format of the event log
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+	FormatCEF  Format = "cef"
+	FormatLEEF Format = "leef"
+)
+
+// ParseFormat parses a log format name
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatJSON, FormatCEF, FormatLEEF:
+		return f, nil
+	default:
+		return FormatText, fmt.Errorf("unknown log format: %s", s)
+	}
+}
+
+// Logger writes events to an output in the configured format, dropping
+// events below the configured level
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	syslog *syslog.Writer
+	format Format
+	level  Level
+	host   string
+}
+
+// New creates a new event logger
+func New(out io.Writer, format Format, level Level) *Logger {
+	host, _ := os.Hostname()
+	return &Logger{
+		out:    out,
+		format: format,
+		level:  level,
+		host:   host,
+	}
+}
+
+// SetSyslog additionally sends every logged event to the given syslog writer
+func (l *Logger) SetSyslog(w *syslog.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.syslog = w
+}
+
+// DialSyslog connects to a syslog daemon. The address is either "local" for
+// the local syslog socket or a URL such as udp://siem:514 or tcp://siem:601.
+func DialSyslog(address string) (*syslog.Writer, error) {
+	if address == "local" {
+		return syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_INFO, "fim")
+	}
+
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+		return nil, fmt.Errorf("invalid syslog address %q: expected local, udp://host:port or tcp://host:port", address)
+	}
+	return syslog.Dial(u.Scheme, u.Host, syslog.LOG_AUTHPRIV|syslog.LOG_INFO, "fim")
+}
+
+// Enabled reports whether events at the given level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+// Log writes an event
+func (l *Logger) Log(event *Event) {
+	if !l.Enabled(event.Level) {
+		return
+	}
+	if event.Host == "" {
+		event.Host = l.host
+	}
+
+	line := l.Format(event)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(line)
+	if l.syslog != nil {
+		writeSyslog(l.syslog, event.Level, strings.TrimSuffix(string(line), "\n"))
+	}
+}
+
+// Format renders an event as a newline terminated line in the logger's format
+func (l *Logger) Format(event *Event) []byte {
+	var line []byte
+	switch l.format {
+	case FormatJSON:
+		data, err := json.Marshal(event)
+		if err != nil {
+			// Never lose an event because of an unencodable field
+			data = []byte(fmt.Sprintf(`{"schema":%d,"event_id":%d,"event":%q,"level":%q,"message":%q,"error":%q}`,
+				SchemaVersion, event.ID, event.Name, event.Level, event.Message, err.Error()))
+		}
+		line = append(data, '\n')
+	case FormatCEF:
+		line = []byte(EncodeCEF(event) + "\n")
+	case FormatLEEF:
+		line = []byte(EncodeLEEF(event) + "\n")
+	default:
+		line = []byte(formatText(event))
+	}
+	return line
+}
+
+// writeSyslog sends a message to syslog with the priority matching the level
+func writeSyslog(w *syslog.Writer, level Level, msg string) {
+	switch level {
+	case LevelDebug:
+		w.Debug(msg)
+	case LevelInfo:
+		w.Info(msg)
+	case LevelWarning:
+		w.Warning(msg)
+	case LevelError:
+		w.Err(msg)
+	default:
+		w.Crit(msg)
+	}
+}
+
+// formatText renders an event as a single human-readable line
+func formatText(event *Event) string {
+	var b strings.Builder
+	b.WriteString(event.Time.Format("2006/01/02 15:04:05"))
+	b.WriteString(" ")
+	b.WriteString(strings.ToUpper(event.Level.String()))
+	b.WriteString(" ")
+	b.WriteString(event.Message)
+	if event.Error != "" {
+		b.WriteString(": ")
+		b.WriteString(event.Error)
+	}
+	if event.ScanID != "" {
+		b.WriteString(" (scan ")
+		b.WriteString(event.ScanID)
+		b.WriteString(")")
+	}
+
+	// Append extra fields as key=value pairs in a stable order
+	keys := make([]string, 0, len(event.Fields))
+	for key := range event.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := fmt.Sprint(event.Fields[key])
+		if strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(" ")
+		b.WriteString(key)
+		b.WriteString("=")
+		b.WriteString(value)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// Print logs an event with the given ID, level and message
+func (l *Logger) Print(id EventID, level Level, scanID string, format string, args ...interface{}) {
+	event := NewEvent(id, level, fmt.Sprintf(format, args...))
+	event.ScanID = scanID
+	l.Log(event)
+}
+
+// Error logs an error event
+func (l *Logger) Error(id EventID, scanID string, message string, err error) {
+	event := NewEvent(id, LevelError, message)
+	event.ScanID = scanID
+	if err != nil {
+		event.Error = err.Error()
+	}
+	l.Log(event)
+}
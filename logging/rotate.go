@@ -0,0 +1,307 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// segmentTimeFormat is the timestamp appended to rotated segments
+const segmentTimeFormat = "20060102-150405"
+
+// RotateOptions configures when a RotatingFile starts a new segment and how
+// many old segments it keeps
+type RotateOptions struct {
+	MaxSize    int64         // rotate once the file reaches this many bytes, 0 disables
+	MaxAge     time.Duration // rotate once the segment is this old, 0 disables
+	MaxBackups int           // number of old segments to keep, 0 keeps all
+	Compress   bool          // gzip old segments
+}
+
+// RotatingFile is an append-only log file that rotates itself by size and
+// age. It can also be reopened after an external tool such as logrotate has
+// moved it away.
+type RotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	opts    RotateOptions
+	file    *os.File
+	size    int64
+	created time.Time // when the current segment was started
+}
+
+// OpenRotatingFile opens or creates the log file at path
+func OpenRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	r := &RotatingFile{
+		path: path,
+		opts: opts,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the log file for appending; the caller must hold the lock or
+// own the file exclusively
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %v", err)
+	}
+
+	r.file = file
+	r.size = info.Size()
+
+	// A segment carried over from an earlier run keeps its age
+	r.created = time.Now()
+	if r.size > 0 {
+		r.created = fileCreated(r.path, info)
+	}
+	return nil
+}
+
+// Write appends p to the log file, rotating first if the current segment is
+// full or too old
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			// Keep logging to the current segment rather than losing events
+			fmt.Fprintf(os.Stderr, "fim: log rotation failed: %v\n", err)
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// shouldRotate reports whether writing n more bytes requires a new segment
+func (r *RotatingFile) shouldRotate(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.opts.MaxSize > 0 && r.size+n > r.opts.MaxSize {
+		return true
+	}
+	if r.opts.MaxAge > 0 && time.Since(r.created) >= r.opts.MaxAge {
+		return true
+	}
+	return false
+}
+
+// Rotate closes the current segment, moves it aside and starts a new one
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rotate()
+}
+
+// rotate does the work of Rotate; the caller must hold the lock
+func (r *RotatingFile) rotate() error {
+	if r.file != nil {
+		if err := r.file.Close(); err != nil {
+			return fmt.Errorf("failed to close log file: %v", err)
+		}
+		r.file = nil
+	}
+
+	// Name segments after the rotation time so that they sort chronologically
+	backup, err := r.nextBackupName()
+	if err != nil {
+		r.open()
+		return err
+	}
+	if err := os.Rename(r.path, backup); err != nil && !os.IsNotExist(err) {
+		r.open()
+		return fmt.Errorf("failed to rename log file: %v", err)
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	if r.opts.Compress {
+		if err := compressFile(backup); err != nil {
+			return err
+		}
+	}
+	return r.prune()
+}
+
+// nextBackupName returns the name for the segment being rotated out. Segments
+// rotated within the same second get an increasing -N suffix so that they
+// still sort after every existing segment.
+func (r *RotatingFile) nextBackupName() (string, error) {
+	stamp := time.Now().Format(segmentTimeFormat)
+	backup := r.path + "." + stamp
+
+	backups, err := r.Backups()
+	if err != nil {
+		return "", fmt.Errorf("failed to list log segments: %v", err)
+	}
+	seq := -1
+	for _, existing := range backups {
+		if !strings.HasPrefix(existing, backup) {
+			continue
+		}
+		suffix := strings.TrimSuffix(strings.TrimPrefix(existing, backup), ".gz")
+		n := 0
+		if suffix != "" {
+			if _, err := fmt.Sscanf(suffix, "-%d", &n); err != nil {
+				continue
+			}
+		}
+		if n > seq {
+			seq = n
+		}
+	}
+
+	if seq < 0 {
+		return backup, nil
+	}
+	return fmt.Sprintf("%s-%d", backup, seq+1), nil
+}
+
+// Reopen closes and reopens the log file at its configured path. It is used
+// after an external tool has renamed the file.
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+	return r.open()
+}
+
+// Close closes the log file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// Backups returns the rotated segments of the log file, oldest first
+func (r *RotatingFile) Backups() ([]string, error) {
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	type segment struct {
+		path  string
+		stamp string
+		seq   int
+	}
+	segments := make([]segment, 0, len(matches))
+	for _, match := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(match, r.path+"."), ".gz")
+		if len(suffix) < len(segmentTimeFormat) {
+			continue
+		}
+		stamp := suffix[:len(segmentTimeFormat)]
+		if _, err := time.Parse(segmentTimeFormat, stamp); err != nil {
+			continue
+		}
+
+		// Segments rotated within the same second carry a -N sequence suffix
+		seq := 0
+		if rest := suffix[len(stamp):]; rest != "" {
+			if _, err := fmt.Sscanf(rest, "-%d", &seq); err != nil {
+				continue
+			}
+		}
+		segments = append(segments, segment{path: match, stamp: stamp, seq: seq})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].stamp != segments[j].stamp {
+			return segments[i].stamp < segments[j].stamp
+		}
+		return segments[i].seq < segments[j].seq
+	})
+
+	backups := make([]string, len(segments))
+	for i, seg := range segments {
+		backups[i] = seg.path
+	}
+	return backups, nil
+}
+
+// prune removes the oldest segments beyond the retention count
+func (r *RotatingFile) prune() error {
+	if r.opts.MaxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := r.Backups()
+	if err != nil {
+		return fmt.Errorf("failed to list log segments: %v", err)
+	}
+	for len(backups) > r.opts.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove old log segment: %v", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// compressFile gzips path into path.gz and removes the original
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open log segment: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create compressed log segment: %v", err)
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return fmt.Errorf("failed to compress log segment: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return fmt.Errorf("failed to compress log segment: %v", err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("failed to write compressed log segment: %v", err)
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,158 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readSegment returns the content of a log segment, decompressing it if
+// it is gzipped
+func readSegment(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		r = zr
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return string(data)
+}
+
+// writeLines writes each line to the log file
+func writeLines(t *testing.T, r *RotatingFile, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if _, err := r.Write([]byte(line + "\n")); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+}
+
+// segments returns the contents of the rotated segments, oldest first,
+// and of the current file
+func segments(t *testing.T, r *RotatingFile) []string {
+	t.Helper()
+	backups, err := r.Backups()
+	if err != nil {
+		t.Fatalf("Backups: %v", err)
+	}
+	var contents []string
+	for _, backup := range append(backups, r.path) {
+		contents = append(contents, readSegment(t, backup))
+	}
+	return contents
+}
+
+func TestRotateBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fim.log")
+	r, err := OpenRotatingFile(path, RotateOptions{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// A line longer than the limit still goes into an empty segment
+	writeLines(t, r, "a line longer than the limit", "1234", "5678", "abc")
+	got := segments(t, r)
+	want := []string{"a line longer than the limit\n", "1234\n5678\n", "abc\n"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("segments %q, want %q", got, want)
+	}
+}
+
+func TestRotateByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fim.log")
+	r, err := OpenRotatingFile(path, RotateOptions{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	writeLines(t, r, "first", "second")
+	r.created = time.Now().Add(-2 * time.Hour)
+	writeLines(t, r, "third")
+	got := segments(t, r)
+	want := []string{"first\nsecond\n", "third\n"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("segments %q, want %q", got, want)
+	}
+}
+
+func TestCompressAndPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fim.log")
+	r, err := OpenRotatingFile(path, RotateOptions{MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Segments rotated within one second still sort in order
+	for _, line := range []string{"one", "two", "three", "four"} {
+		writeLines(t, r, line)
+		if err := r.Rotate(); err != nil {
+			t.Fatalf("Rotate: %v", err)
+		}
+	}
+	writeLines(t, r, "five")
+
+	backups, err := r.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, backup := range backups {
+		if !strings.HasSuffix(backup, ".gz") {
+			t.Errorf("segment %s is not compressed", backup)
+		}
+		if _, err := os.Stat(strings.TrimSuffix(backup, ".gz")); !os.IsNotExist(err) {
+			t.Errorf("uncompressed copy of %s was kept", backup)
+		}
+	}
+	got := segments(t, r)
+	want := []string{"three\n", "four\n", "five\n"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("segments %q, want %q", got, want)
+	}
+}
+
+func TestReopenAfterExternalRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fim.log")
+	r, err := OpenRotatingFile(path, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	writeLines(t, r, "before")
+	moved := filepath.Join(dir, "fim.log.1")
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reopen(); err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+	writeLines(t, r, "after")
+
+	if got := readSegment(t, moved); got != "before\n" {
+		t.Errorf("moved file holds %q", got)
+	}
+	if got := readSegment(t, path); got != "after\n" {
+		t.Errorf("reopened file holds %q", got)
+	}
+}
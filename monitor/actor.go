@@ -0,0 +1,43 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// AUIDUnset is the audit login UID of processes not started from a login,
+// such as daemons
+const AUIDUnset = 4294967295
+
+// Actor is the process that changed a file, as recorded by the audit log
+type Actor struct {
+	AUID    uint32    `json:"auid"` // login UID, AUIDUnset if not set
+	UID     uint32    `json:"uid"`
+	PID     int       `json:"pid,omitempty"`
+	Exe     string    `json:"exe,omitempty"`
+	Comm    string    `json:"comm,omitempty"`
+	Syscall string    `json:"syscall,omitempty"` // syscall number, as logged
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event,omitempty"` // audit event serial, e.g. "1700000000.123:456"
+}
+
+// LoginUID returns the audit login UID, or "unset"
+func (a *Actor) LoginUID() string {
+	if a.AUID == AUIDUnset {
+		return "unset"
+	}
+	return fmt.Sprint(a.AUID)
+}
+
+// String describes the actor for people, e.g. "auid=1000 uid=0 comm=vim
+// exe=/usr/bin/vim"
+func (a *Actor) String() string {
+	s := fmt.Sprintf("auid=%s uid=%d", a.LoginUID(), a.UID)
+	if a.Comm != "" {
+		s += " comm=" + a.Comm
+	}
+	if a.Exe != "" {
+		s += " exe=" + a.Exe
+	}
+	return s
+}
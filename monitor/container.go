@@ -0,0 +1,25 @@
+package monitor
+
+// Container identifies the container a change was found in
+type Container struct {
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+// ShortID returns the first 12 characters of the container ID, as shown
+// by container runtimes
+func (c *Container) ShortID() string {
+	if len(c.ID) > 12 {
+		return c.ID[:12]
+	}
+	return c.ID
+}
+
+// String describes the container for people, e.g. "web (3f4e5d6c7b8a)"
+func (c *Container) String() string {
+	if c.Name == "" {
+		return c.ShortID()
+	}
+	return c.Name + " (" + c.ShortID() + ")"
+}
@@ -22,6 +22,18 @@ type FileInfo struct {
 	GID       int    `json:"gid"`
 	IsDir     bool   `json:"is_dir"`
 	IsSymlink bool   `json:"is_symlink"`
+
+	// Source is where the file was read if not at Path, as when scanning a
+	// mounted image under another root
+	Source string `json:"-"`
+
+	// Implicit marks directories that an archive holds files in without
+	// an entry of their own, so that their attributes are unknown
+	Implicit bool `json:"implicit,omitempty"`
+
+	// Archived marks files read from a tar archive or image layer, whose
+	// content is not on disk
+	Archived bool `json:"-"`
 }
 
 // ChangeType represents the type of change detected
@@ -35,13 +47,53 @@ const (
 	PermissionChange
 )
 
+var changeTypeNames = map[ChangeType]string{
+	NoChange:         "none",
+	NewFile:          "added",
+	ModifiedFile:     "modified",
+	DeletedFile:      "deleted",
+	PermissionChange: "permission",
+}
+
+// String returns the name of the change type
+func (t ChangeType) String() string {
+	if name, ok := changeTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("change(%d)", int(t))
+}
+
+// MarshalText encodes the change type by name
+func (t ChangeType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a change type from its name
+func (t *ChangeType) UnmarshalText(text []byte) error {
+	for ct, name := range changeTypeNames {
+		if name == string(text) {
+			*t = ct
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown change type: %s", text)
+}
+
 // Change represents a detected change in the file system
 type Change struct {
-	Path      string     `json:"path"`
-	Type      ChangeType `json:"type"`
-	OldInfo   *FileInfo  `json:"old_info,omitempty"`
-	NewInfo   *FileInfo  `json:"new_info,omitempty"`
-	Timestamp time.Time  `json:"timestamp"`
+	Path      string       `json:"path"`
+	Type      ChangeType   `json:"type"`
+	Severity  Severity     `json:"severity,omitempty"`
+	Kinds     []string     `json:"kinds,omitempty"`
+	OldInfo   *FileInfo    `json:"old_info,omitempty"`
+	NewInfo   *FileInfo    `json:"new_info,omitempty"`
+	Diff      string       `json:"diff,omitempty"`      // unified diff of captured text content
+	Package   *PackageInfo `json:"package,omitempty"`   // owning package, if verified
+	IOC       *Indicator   `json:"ioc,omitempty"`       // known-bad hash the file matches
+	Rules     []*RuleMatch `json:"rules,omitempty"`     // content rules the file matches
+	Actor     *Actor       `json:"actor,omitempty"`     // process that made the change, from the audit log
+	Container *Container   `json:"container,omitempty"` // container the file is in; nil for the host
+	Timestamp time.Time    `json:"timestamp"`
 }
 
 // GetFileInfo collects information about a file
@@ -131,15 +183,50 @@ func CompareFiles(oldInfo, newInfo *FileInfo) ChangeType {
 	return NoChange
 }
 
+// SourcePath returns the path the file's content can be read from, or ""
+// for archived files
+func (f *FileInfo) SourcePath() string {
+	if f.Archived {
+		return ""
+	}
+	if f.Source != "" {
+		return f.Source
+	}
+	return f.Path
+}
+
+// UnixPerm returns the permission bits of the file including the setuid,
+// setgid and sticky bits, as they would be shown by chmod
+func (f *FileInfo) UnixPerm() uint32 {
+	mode := os.FileMode(f.Mode)
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 0o1000
+	}
+	return perm
+}
+
 // Equals checks if two FileInfo objects are equal
 func (f *FileInfo) Equals(other *FileInfo) bool {
 	if f == nil || other == nil {
 		return false
 	}
 
-	// Compare basic properties
+	// Only the existence of an implicit directory is known
+	if f.IsDir && other.IsDir && (f.Implicit || other.Implicit) {
+		return f.Path == other.Path
+	}
+
+	// Compare basic properties. The size of a directory depends on the
+	// filesystem holding it, and is 0 in archives, so it is left out.
 	if f.Path != other.Path ||
-		f.Size != other.Size ||
+		(f.Size != other.Size && !f.IsDir) ||
 		f.Mode != other.Mode ||
 		f.ModTime != other.ModTime ||
 		f.UID != other.UID ||
@@ -0,0 +1,21 @@
+package monitor
+
+// Indicator is a known-bad file hash from an IOC feed
+type Indicator struct {
+	Hash      string `json:"hash"`             // lower-case hex digest
+	Algorithm string `json:"algorithm"`        // md5, sha1 or sha256
+	Name      string `json:"name,omitempty"`   // malware family or description from the feed
+	Source    string `json:"source,omitempty"` // hash list the indicator was loaded from
+}
+
+// String describes the indicator for people, e.g. "EICAR test file (feed.csv)"
+func (i *Indicator) String() string {
+	name := i.Name
+	if name == "" {
+		name = i.Algorithm + " " + i.Hash
+	}
+	if i.Source != "" {
+		name += " (" + i.Source + ")"
+	}
+	return name
+}
@@ -0,0 +1,32 @@
+package monitor
+
+// PackageStatus tells how a changed file compares with what its package
+// shipped
+type PackageStatus string
+
+const (
+	// PackageMatches means the file is identical to the packaged file,
+	// as after a legitimate upgrade
+	PackageMatches PackageStatus = "matches"
+	// PackageDiffers means the file differs from the packaged file,
+	// which suggests tampering
+	PackageDiffers PackageStatus = "differs"
+	// PackageConffile means a configuration file differs from its
+	// packaged default, which is normal after local edits
+	PackageConffile PackageStatus = "conffile"
+	// PackageMissing means the file was deleted although its package
+	// is still installed
+	PackageMissing PackageStatus = "missing"
+	// PackageUnverified means the owning package records no digest for
+	// the file, or that the package database could not be read
+	PackageUnverified PackageStatus = "unverified"
+)
+
+// PackageInfo identifies the package owning a changed file and whether the
+// file still matches it
+type PackageInfo struct {
+	Manager string        `json:"manager"` // dpkg or rpm
+	Name    string        `json:"name"`
+	Version string        `json:"version,omitempty"`
+	Status  PackageStatus `json:"status"`
+}
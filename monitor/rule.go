@@ -0,0 +1,21 @@
+package monitor
+
+import "strings"
+
+// RuleMatch is a content rule that matched a changed file
+type RuleMatch struct {
+	Rule        string   `json:"rule"`
+	Tags        []string `json:"tags,omitempty"`
+	Description string   `json:"description,omitempty"` // from the description meta of the rule
+	Severity    Severity `json:"severity,omitempty"`
+	Strings     []string `json:"strings,omitempty"` // identifiers of the strings found
+}
+
+// RuleNames returns the names of matched rules, e.g. "webshell, miner"
+func RuleNames(matches []*RuleMatch) string {
+	names := make([]string, len(matches))
+	for i, match := range matches {
+		names[i] = match.Rule
+	}
+	return strings.Join(names, ", ")
+}
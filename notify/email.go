@@ -0,0 +1,281 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// Email sends change notifications over SMTP. Changes to paths matching the
+// immediate globs are mailed right away; all others are queued and mailed
+// as a periodic digest.
+type Email struct {
+	mu          sync.Mutex
+	cfg         config.Email
+	host        string
+	interval    time.Duration
+	minSeverity monitor.Severity
+	pending     []*monitor.Change
+	lastDigest  time.Time
+}
+
+// NewEmail creates an email notifier from the [email] configuration
+func NewEmail(cfg *config.Config) (*Email, error) {
+	interval, err := ParseDigestInterval(cfg.Email.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	minSeverity := monitor.SeverityNone
+	if cfg.Email.ImmediateSeverity != "" {
+		if minSeverity, err = monitor.ParseSeverity(cfg.Email.ImmediateSeverity); err != nil {
+			return nil, fmt.Errorf("invalid [email] immediate_severity: %v", err)
+		}
+	}
+
+	host, _ := os.Hostname()
+	return &Email{
+		cfg:         cfg.Email,
+		host:        host,
+		interval:    interval,
+		minSeverity: minSeverity,
+		lastDigest:  time.Now(),
+	}, nil
+}
+
+// ParseDigestInterval parses the digest setting: hourly, daily, off or a
+// duration such as 30m. A zero interval disables digests.
+func ParseDigestInterval(s string) (time.Duration, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "off", "none":
+		return 0, nil
+	case "hourly":
+		return time.Hour, nil
+	case "daily":
+		return 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid digest interval %q: expected hourly, daily, off or a duration", s)
+	}
+	return d, nil
+}
+
+// Enabled reports whether email notifications are configured
+func (e *Email) Enabled() bool {
+	return e.cfg.Server != "" && len(e.cfg.To) > 0
+}
+
+// Notify mails changes to immediate paths right away and queues the rest
+// for the next digest. Immediate changes that cannot be mailed are queued
+// too. It returns the number of changes mailed.
+func (e *Email) Notify(changes []*monitor.Change) (int, error) {
+	immediate := make([]*monitor.Change, 0)
+
+	e.mu.Lock()
+	for _, change := range changes {
+		if config.MatchAny(e.cfg.Immediate, change.Path) || e.isUrgent(change) {
+			immediate = append(immediate, change)
+		} else if e.interval > 0 {
+			e.pending = append(e.pending, change)
+		}
+	}
+	e.mu.Unlock()
+
+	if len(immediate) == 0 {
+		return 0, nil
+	}
+	subject := fmt.Sprintf("[FIM] %s: %d change(s) to critical paths", e.host, len(immediate))
+	if err := e.Send(subject, "The following changes to critical paths were detected:", immediate); err != nil {
+		// Requeue so that the changes go out with the next digest
+		e.mu.Lock()
+		e.pending = append(immediate, e.pending...)
+		e.mu.Unlock()
+		return 0, err
+	}
+	return len(immediate), nil
+}
+
+// isUrgent reports whether the severity of a change warrants an immediate mail
+func (e *Email) isUrgent(change *monitor.Change) bool {
+	return e.minSeverity != monitor.SeverityNone && change.Severity >= e.minSeverity
+}
+
+// Flush sends the queued digest if the digest interval has elapsed, or
+// unconditionally if force is set. It returns the number of changes mailed.
+func (e *Email) Flush(force bool) (int, error) {
+	e.mu.Lock()
+	if len(e.pending) == 0 || (!force && time.Since(e.lastDigest) < e.interval) {
+		e.mu.Unlock()
+		return 0, nil
+	}
+	pending := e.pending
+	since := e.lastDigest
+	e.pending = nil
+	e.lastDigest = time.Now()
+	e.mu.Unlock()
+
+	subject := fmt.Sprintf("[FIM] %s: digest of %d change(s)", e.host, len(pending))
+	intro := fmt.Sprintf("Changes detected since %s:", since.Format(time.RFC1123))
+	if err := e.Send(subject, intro, pending); err != nil {
+		// Requeue so that the changes go out with the next digest
+		e.mu.Lock()
+		e.pending = append(pending, e.pending...)
+		e.mu.Unlock()
+		return 0, err
+	}
+	return len(pending), nil
+}
+
+// Send mails a summary of the changes to the configured recipients
+func (e *Email) Send(subject, intro string, changes []*monitor.Change) error {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "Host: %s\r\n\r\n%s\r\n\r\n", e.host, intro)
+	body.WriteString(strings.ReplaceAll(FormatTable(changes), "\n", "\r\n"))
+
+	// Append the content diffs of captured text files
+	for _, change := range changes {
+		if change.Diff != "" {
+			fmt.Fprintf(&body, "\r\n%s\r\n", strings.ReplaceAll(change.Diff, "\n", "\r\n"))
+		}
+	}
+
+	return e.sendMail(subject, body.Bytes())
+}
+
+// FormatTable renders changes as a plain text table. Where changes were
+// found in containers, a column names the container of each.
+func FormatTable(changes []*monitor.Change) string {
+	containers := false
+	for _, change := range changes {
+		containers = containers || change.Container != nil
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	if containers {
+		fmt.Fprint(w, "CONTAINER\t")
+	}
+	fmt.Fprintln(w, "SEVERITY\tCHANGE\tPATH\tSIZE\tMODE\tOWNER\tSHA-256")
+	for _, change := range changes {
+		if containers {
+			name := "-"
+			if change.Container != nil {
+				name = change.Container.String()
+			}
+			fmt.Fprintf(w, "%s\t", name)
+		}
+		size, mode, owner, hash := "-", "-", "-", "-"
+		info := change.NewInfo
+		if info == nil {
+			info = change.OldInfo
+		}
+		if info != nil {
+			size = fmt.Sprintf("%d", info.Size)
+			mode = fmt.Sprintf("%04o", info.UnixPerm())
+			owner = fmt.Sprintf("%d:%d", info.UID, info.GID)
+			if info.Hash != "" {
+				hash = info.Hash[:min(len(info.Hash), 16)]
+			}
+		}
+
+		// Show what changed for modified files
+		if old, cur := change.OldInfo, change.NewInfo; old != nil && cur != nil {
+			if old.Size != cur.Size {
+				size = fmt.Sprintf("%d->%d", old.Size, cur.Size)
+			}
+			if old.UnixPerm() != cur.UnixPerm() {
+				mode = fmt.Sprintf("%04o->%04o", old.UnixPerm(), cur.UnixPerm())
+			}
+			if old.UID != cur.UID || old.GID != cur.GID {
+				owner = fmt.Sprintf("%d:%d->%d:%d", old.UID, old.GID, cur.UID, cur.GID)
+			}
+		}
+		severity := change.Severity.String()
+		if severity == "" {
+			severity = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", severity, change.Type, change.Path, size, mode, owner, hash)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// sendMail delivers a message over SMTP, upgrading the connection with
+// STARTTLS when configured
+func (e *Email) sendMail(subject string, body []byte) error {
+	host, _, err := net.SplitHostPort(e.cfg.Server)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP server address %q: %v", e.cfg.Server, err)
+	}
+
+	conn, err := net.DialTimeout("tcp", e.cfg.Server, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(2 * time.Minute))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Hello(e.host); err != nil {
+		return fmt.Errorf("SMTP HELO failed: %v", err)
+	}
+
+	if e.cfg.StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("STARTTLS failed: %v", err)
+		}
+	}
+
+	if e.cfg.Username != "" {
+		auth := smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %v", err)
+		}
+	}
+
+	if err := client.Mail(e.cfg.From); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %v", err)
+	}
+	for _, to := range e.cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s failed: %v", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %v", err)
+	}
+	fmt.Fprintf(w, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(w, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	fmt.Fprintf(w, "Subject: %s\r\n", subject)
+	fmt.Fprintf(w, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(w, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(w, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(w, "\r\n")
+	w.Write(body)
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %v", err)
+	}
+
+	return client.Quit()
+}
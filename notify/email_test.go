@@ -0,0 +1,308 @@
+package notify
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// message is a mail received by the fake SMTP server
+type message struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer is a minimal SMTP server that records the messages it receives
+type smtpServer struct {
+	listener net.Listener
+	reject   atomic.Bool // answer MAIL FROM with a permanent error
+
+	mu       sync.Mutex
+	messages []message
+}
+
+// startSMTPServer starts a fake SMTP server on a local port
+func startSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &smtpServer{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// serve runs one SMTP session
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP test")
+	var msg message
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case "MAIL":
+			if s.reject.Load() {
+				reply("550 rejected")
+				continue
+			}
+			msg = message{from: address(line)}
+			reply("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, address(line))
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			msg.data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// address returns the address between angle brackets in a command
+func address(line string) string {
+	_, rest, _ := strings.Cut(line, "<")
+	addr, _, _ := strings.Cut(rest, ">")
+	return addr
+}
+
+// received returns the messages received so far
+func (s *smtpServer) received() []message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]message(nil), s.messages...)
+}
+
+// newTestEmail creates a notifier sending to the fake server
+func newTestEmail(t *testing.T, s *smtpServer, digest string, immediate ...string) *Email {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Email.Server = s.listener.Addr().String()
+	cfg.Email.From = "fim@example.com"
+	cfg.Email.To = []string{"ops@example.com", "sec@example.com"}
+	cfg.Email.StartTLS = false
+	cfg.Email.Digest = digest
+	cfg.Email.Immediate = immediate
+	e, err := NewEmail(cfg)
+	if err != nil {
+		t.Fatalf("NewEmail: %v", err)
+	}
+	return e
+}
+
+// change returns a modification of path
+func change(path string) *monitor.Change {
+	info := &monitor.FileInfo{Path: path, Size: 10, Mode: 0644, Hash: strings.Repeat("ab", 32)}
+	return &monitor.Change{Path: path, Type: monitor.ModifiedFile, OldInfo: info, NewInfo: info, Timestamp: time.Now()}
+}
+
+func TestNotifySendsImmediatePaths(t *testing.T) {
+	s := startSMTPServer(t)
+	e := newTestEmail(t, s, "hourly", "/etc/shadow", "/usr/bin/*")
+
+	sent, err := e.Notify([]*monitor.Change{change("/etc/shadow"), change("/usr/bin/ls"), change("/var/lib/x")})
+	if err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if sent != 2 {
+		t.Errorf("sent %d changes immediately, want 2", sent)
+	}
+
+	messages := s.received()
+	if len(messages) != 1 {
+		t.Fatalf("received %d messages, want 1", len(messages))
+	}
+	msg := messages[0]
+	if msg.from != "fim@example.com" {
+		t.Errorf("MAIL FROM %q, want fim@example.com", msg.from)
+	}
+	if len(msg.to) != 2 {
+		t.Errorf("RCPT TO %v, want both recipients", msg.to)
+	}
+	if !strings.Contains(msg.data, "Subject: [FIM] ") || !strings.Contains(msg.data, "2 change(s) to critical paths") {
+		t.Errorf("unexpected subject in:\n%s", msg.data)
+	}
+	if !strings.Contains(msg.data, "/etc/shadow") || strings.Contains(msg.data, "/var/lib/x") {
+		t.Errorf("message lists the wrong changes:\n%s", msg.data)
+	}
+}
+
+func TestFormatTableNamesContainers(t *testing.T) {
+	host := change("/etc/hosts")
+	if table := FormatTable([]*monitor.Change{host}); strings.Contains(table, "CONTAINER") {
+		t.Errorf("table of host changes has a container column:\n%s", table)
+	}
+
+	drift := change("/etc/nginx/nginx.conf")
+	drift.Container = &monitor.Container{ID: strings.Repeat("3f", 32), Name: "web", Image: "nginx:1.25"}
+	lines := strings.Split(FormatTable([]*monitor.Change{host, drift}), "\n")
+	if !strings.HasPrefix(lines[0], "CONTAINER") {
+		t.Errorf("header %q has no container column", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "- ") || !strings.HasPrefix(lines[2], "web (3f3f3f3f3f3f) ") {
+		t.Errorf("containers not named:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestFlushSendsDigest(t *testing.T) {
+	s := startSMTPServer(t)
+	e := newTestEmail(t, s, "hourly")
+
+	if _, err := e.Notify([]*monitor.Change{change("/etc/hosts"), change("/etc/passwd")}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if n := len(s.received()); n != 0 {
+		t.Fatalf("received %d messages before the digest, want 0", n)
+	}
+
+	// The hour has not passed yet
+	if sent, err := e.Flush(false); err != nil || sent != 0 {
+		t.Fatalf("Flush(false) = %d, %v; want 0, nil", sent, err)
+	}
+	sent, err := e.Flush(true)
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if sent != 2 {
+		t.Errorf("digest holds %d changes, want 2", sent)
+	}
+	messages := s.received()
+	if len(messages) != 1 || !strings.Contains(messages[0].data, "digest of 2 change(s)") {
+		t.Fatalf("unexpected messages: %+v", messages)
+	}
+
+	// Nothing is left for the next digest
+	if sent, _ := e.Flush(true); sent != 0 {
+		t.Errorf("second digest holds %d changes, want 0", sent)
+	}
+}
+
+func TestFlushRequeuesOnFailure(t *testing.T) {
+	s := startSMTPServer(t)
+	s.reject.Store(true)
+	e := newTestEmail(t, s, "hourly")
+
+	e.Notify([]*monitor.Change{change("/etc/hosts")})
+	if _, err := e.Flush(true); err == nil {
+		t.Fatal("Flush succeeded although the server rejected the message")
+	}
+
+	s.reject.Store(false)
+	sent, err := e.Flush(true)
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if sent != 1 {
+		t.Errorf("retried digest holds %d changes, want 1", sent)
+	}
+}
+
+func TestNotifyRequeuesOnFailure(t *testing.T) {
+	s := startSMTPServer(t)
+	s.reject.Store(true)
+	e := newTestEmail(t, s, "off", "/etc/shadow")
+
+	if _, err := e.Notify([]*monitor.Change{change("/etc/shadow")}); err == nil {
+		t.Fatal("Notify succeeded although the server rejected the message")
+	}
+
+	// The change goes out with the next digest, even with digests off
+	s.reject.Store(false)
+	sent, err := e.Flush(false)
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if sent != 1 {
+		t.Errorf("digest holds %d changes, want 1", sent)
+	}
+	messages := s.received()
+	if len(messages) != 1 || !strings.Contains(messages[0].data, "/etc/shadow") {
+		t.Errorf("unexpected messages: %+v", messages)
+	}
+}
+
+func TestDigestOffDropsQueue(t *testing.T) {
+	s := startSMTPServer(t)
+	e := newTestEmail(t, s, "off")
+
+	e.Notify([]*monitor.Change{change("/etc/hosts")})
+	if sent, _ := e.Flush(true); sent != 0 {
+		t.Errorf("digest sent %d changes with digests off", sent)
+	}
+}
+
+func TestParseDigestInterval(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		err  bool
+	}{
+		{"hourly", time.Hour, false},
+		{"Daily", 24 * time.Hour, false},
+		{"off", 0, false},
+		{"", 0, false},
+		{"30m", 30 * time.Minute, false},
+		{"-5m", 0, true},
+		{"weekly", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDigestInterval(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseDigestInterval(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestDefaultDigestIsHourly(t *testing.T) {
+	cfg := config.DefaultConfig()
+	if cfg.Email.Digest != "hourly" || !cfg.Email.StartTLS {
+		t.Errorf("default digest %q, starttls %v; want hourly, true", cfg.Email.Digest, cfg.Email.StartTLS)
+	}
+}
@@ -0,0 +1,131 @@
+package packages
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// Berkeley DB constants for reading hash databases such as the Packages
+// file of rpm before version 4.16
+const (
+	bdbHashMagic     = 0x061561
+	bdbPageHeader    = 26
+	bdbPageOverflow  = 7
+	bdbPageHash      = 13
+	bdbPageHashOld   = 2 // unsorted hash page
+	bdbItemKeyData   = 1
+	bdbItemOffPage   = 3
+	bdbMaxChainPages = 1 << 20
+)
+
+// readBDBHash returns the values of every key/value pair in a Berkeley DB
+// hash database. Keys are not needed to read the rpmdb and are dropped.
+func readBDBHash(path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseBDBHash(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return values, nil
+}
+
+// parseBDBHash returns the values of a Berkeley DB hash database from the
+// contents of its file
+func parseBDBHash(data []byte) ([][]byte, error) {
+	if len(data) < 512 {
+		return nil, fmt.Errorf("not a Berkeley DB database")
+	}
+
+	// The metadata page is in the byte order of the host that created it
+	var order binary.ByteOrder = binary.LittleEndian
+	if order.Uint32(data[12:16]) != bdbHashMagic {
+		order = binary.BigEndian
+		if order.Uint32(data[12:16]) != bdbHashMagic {
+			return nil, fmt.Errorf("not a Berkeley DB hash database")
+		}
+	}
+	pageSize := int(order.Uint32(data[20:24]))
+	if pageSize < 512 || pageSize > 65536 || len(data) < pageSize {
+		return nil, fmt.Errorf("invalid page size")
+	}
+
+	page := func(pgno uint32) []byte {
+		start := int64(pgno) * int64(pageSize)
+		if start+int64(pageSize) > int64(len(data)) {
+			return nil
+		}
+		return data[start : start+int64(pageSize)]
+	}
+
+	var values [][]byte
+	for pgno := uint32(1); int64(pgno+1)*int64(pageSize) <= int64(len(data)); pgno++ {
+		p := page(pgno)
+		if typ := p[25]; typ != bdbPageHash && typ != bdbPageHashOld {
+			continue
+		}
+
+		// Items are stored backwards from the end of the page, with their
+		// offsets after the header; they alternate between key and value
+		entries := int(order.Uint16(p[20:22]))
+		if bdbPageHeader+2*entries > pageSize {
+			continue
+		}
+		offsets := make([]int, entries)
+		for i := range offsets {
+			offsets[i] = int(order.Uint16(p[bdbPageHeader+2*i:]))
+		}
+		for i := 1; i < entries; i += 2 {
+			start, end := offsets[i], offsets[i-1]
+			if start >= end || end > pageSize {
+				continue
+			}
+			item := p[start:end]
+
+			switch item[0] {
+			case bdbItemKeyData:
+				values = append(values, item[1:])
+			case bdbItemOffPage:
+				// Large values live in a chain of overflow pages
+				if len(item) < 12 {
+					continue
+				}
+				length := int64(order.Uint32(item[8:12]))
+				if length > int64(len(data)) {
+					return nil, fmt.Errorf("invalid Berkeley DB overflow item on page %d", pgno)
+				}
+				value, err := bdbOverflow(page, order, order.Uint32(item[4:8]), int(length))
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, value)
+			}
+		}
+	}
+	return values, nil
+}
+
+// bdbOverflow reads a value stored in a chain of overflow pages. The
+// length must have been checked against the size of the database.
+func bdbOverflow(page func(uint32) []byte, order binary.ByteOrder, pgno uint32, length int) ([]byte, error) {
+	value := make([]byte, 0, length)
+	for n := 0; pgno != 0 && len(value) < length; n++ {
+		p := page(pgno)
+		if p == nil || p[25] != bdbPageOverflow || n > bdbMaxChainPages {
+			return nil, fmt.Errorf("invalid Berkeley DB overflow page %d", pgno)
+		}
+		used := int(order.Uint16(p[22:24]))
+		if bdbPageHeader+used > len(p) {
+			return nil, fmt.Errorf("invalid Berkeley DB overflow page %d", pgno)
+		}
+		value = append(value, p[bdbPageHeader:bdbPageHeader+used]...)
+		pgno = order.Uint32(p[16:20])
+	}
+	if len(value) != length {
+		return nil, fmt.Errorf("truncated Berkeley DB overflow chain")
+	}
+	return value, nil
+}
@@ -0,0 +1,194 @@
+package packages
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Dpkg reads the Debian package database: the status file for installed
+// packages and their conffiles, and info/*.md5sums for the digests of
+// every other packaged file. The database is indexed on first use and
+// re-read whenever the status file changes.
+type Dpkg struct {
+	dir   string
+	cache cache
+}
+
+// dpkgPackage is an installed package from the status file
+type dpkgPackage struct {
+	name      string
+	arch      string
+	version   string
+	installed bool
+	conffiles map[string]string // path to md5
+}
+
+// OpenDpkg returns the dpkg database in dir, usually /var/lib/dpkg
+func OpenDpkg(dir string) *Dpkg {
+	return &Dpkg{dir: dir}
+}
+
+// Manager implements Database
+func (d *Dpkg) Manager() string {
+	return "dpkg"
+}
+
+// Lookup implements Database
+func (d *Dpkg) Lookup(path string) (*File, bool, error) {
+	files, err := d.Files()
+	if err != nil {
+		return nil, false, err
+	}
+	file, ok := lookup(files, path)
+	return file, ok, nil
+}
+
+// Files implements Database
+func (d *Dpkg) Files() (map[string]*File, error) {
+	statusPath := filepath.Join(d.dir, "status")
+	stamp := func() (time.Time, error) {
+		info, err := os.Stat(statusPath)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to read dpkg status: %v", err)
+		}
+		return info.ModTime(), nil
+	}
+	return d.cache.get(stamp, d.load)
+}
+
+// load indexes the database
+func (d *Dpkg) load() (map[string]*File, error) {
+	pkgs, err := parseDpkgStatus(filepath.Join(d.dir, "status"))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*File)
+	seen := make(map[*dpkgPackage]bool)
+	for _, pkg := range pkgs {
+		// Packages are listed under both name and name:arch; index
+		// each one once
+		if seen[pkg] || !pkg.installed {
+			continue
+		}
+		seen[pkg] = true
+		for path, md5 := range pkg.conffiles {
+			files[path] = &File{Path: path, Manager: "dpkg", Package: pkg.name, Version: pkg.version,
+				Digest: md5, Algorithm: "md5", Conffile: true}
+		}
+	}
+
+	// Multi-arch packages name their info files name:arch
+	sums, err := filepath.Glob(filepath.Join(d.dir, "info", "*.md5sums"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dpkg md5sums: %v", err)
+	}
+	for _, sumsPath := range sums {
+		key := strings.TrimSuffix(filepath.Base(sumsPath), ".md5sums")
+		pkg, ok := pkgs[key]
+		if !ok || !pkg.installed {
+			continue
+		}
+		if err := readMD5Sums(sumsPath, pkg, files); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// parseDpkgStatus parses the dpkg status file into installed packages,
+// keyed by name and by name:arch
+func parseDpkgStatus(path string) (map[string]*dpkgPackage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dpkg status: %v", err)
+	}
+	defer file.Close()
+
+	pkgs := make(map[string]*dpkgPackage)
+	pkg := &dpkgPackage{conffiles: make(map[string]string)}
+	field := ""
+
+	// add records the current stanza
+	add := func() {
+		if pkg.name != "" {
+			pkgs[pkg.name] = pkg
+			if pkg.arch != "" && pkg.arch != "all" {
+				pkgs[pkg.name+":"+pkg.arch] = pkg
+			}
+		}
+		pkg = &dpkgPackage{conffiles: make(map[string]string)}
+		field = ""
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			add()
+		case line[0] == ' ' || line[0] == '\t':
+			// Continuation line; only conffiles are of interest
+			if field != "conffiles" {
+				continue
+			}
+			parts := strings.Fields(line)
+			if len(parts) >= 2 && parts[len(parts)-1] != "obsolete" && parts[len(parts)-1] != "remove-on-upgrade" {
+				pkg.conffiles[parts[0]] = parts[1]
+			}
+		default:
+			name, value, _ := strings.Cut(line, ":")
+			field = strings.ToLower(name)
+			value = strings.TrimSpace(value)
+			switch field {
+			case "package":
+				pkg.name = value
+			case "architecture":
+				pkg.arch = value
+			case "version":
+				pkg.version = value
+			case "status":
+				// "install ok installed"; half-installed packages still
+				// own their files
+				state := strings.Fields(value)
+				pkg.installed = len(state) == 3 && state[2] != "not-installed" && state[2] != "config-files"
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dpkg status: %v", err)
+	}
+	add()
+
+	return pkgs, nil
+}
+
+// readMD5Sums adds the files listed in a package's md5sums file. Paths are
+// relative to the root; conffiles are not listed.
+func readMD5Sums(path string, pkg *dpkgPackage, files map[string]*File) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok || len(sum) != 32 {
+			continue
+		}
+		path := "/" + strings.TrimPrefix(name, "/")
+		files[path] = &File{Path: path, Manager: "dpkg", Package: pkg.name,
+			Version: pkg.version, Digest: sum, Algorithm: "md5"}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package packages
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+func TestDpkgFiles(t *testing.T) {
+	files, err := OpenDpkg(filepath.Join("testdata", "dpkg")).Files()
+	if err != nil {
+		t.Fatalf("Files: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		pkg      string
+		version  string
+		digest   string
+		conffile bool
+	}{
+		{"/etc/ssh/moduli", "openssh-server", "1:9.2p1-2", "6d4c8e5ad4bd8b4f5a5b1e7f1b7f9a31", true},
+		{"/etc/pam.d/sshd", "openssh-server", "1:9.2p1-2", "8b4c59d7a3d3ebbed3b3ed3bd3e4a8d1", true},
+		{"/bin/true", "coreutils", "9.1-1", "d41d8cd98f00b204e9800998ecf8427e", false},
+		{"/usr/bin/sort", "coreutils", "9.1-1", "5d41402abc4b2a76b9719d911017c592", false},
+		// Multi-arch packages name their md5sums name:arch
+		{"/lib/x86_64-linux-gnu/libc.so.6", "libc6", "2.36-9", "0cc175b9c0f1b6a831c399e269772661", false},
+	}
+	for _, tt := range tests {
+		file, ok := files[tt.path]
+		if !ok {
+			t.Errorf("%s is not indexed", tt.path)
+			continue
+		}
+		if file.Package != tt.pkg || file.Version != tt.version || file.Digest != tt.digest ||
+			file.Conffile != tt.conffile || file.Algorithm != "md5" || file.Manager != "dpkg" {
+			t.Errorf("%s = %+v", tt.path, file)
+		}
+	}
+
+	// Obsolete conffiles and packages that are not installed own nothing
+	for _, path := range []string{"/etc/ssh/old_config", "/etc/inetd.d/telnet", "/usr/sbin/in.telnetd", "/usr/bin/removed-tool"} {
+		if file, ok := files[path]; ok {
+			t.Errorf("%s is owned by %s, want it unowned", path, file.Package)
+		}
+	}
+	if len(files) != len(tests) {
+		t.Errorf("indexed %d files, want %d", len(files), len(tests))
+	}
+}
+
+func TestDpkgLookupMergedUsr(t *testing.T) {
+	db := OpenDpkg(filepath.Join("testdata", "dpkg"))
+	for _, path := range []string{"/bin/true", "/usr/bin/true", "/bin/sort", "/usr/lib/x86_64-linux-gnu/libc.so.6"} {
+		if _, ok, err := db.Lookup(path); err != nil || !ok {
+			t.Errorf("Lookup(%s) = %v, %v; want it found through its alias", path, ok, err)
+		}
+	}
+	if _, ok, _ := db.Lookup("/usr/local/bin/tool"); ok {
+		t.Error("unpackaged file was found")
+	}
+}
+
+func TestDpkgMissingStatus(t *testing.T) {
+	if _, err := OpenDpkg(t.TempDir()).Files(); err == nil {
+		t.Error("Files succeeded without a status file")
+	}
+}
+
+func TestVerifyStatus(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	packaged := &File{Digest: "5d41402abc4b2a76b9719d911017c592", Algorithm: "md5"}
+	conffile := &File{Digest: "5d41402abc4b2a76b9719d911017c592", Algorithm: "md5", Conffile: true}
+
+	tests := []struct {
+		name   string
+		file   *File
+		change *monitor.Change
+		want   monitor.PackageStatus
+	}{
+		{"matches", packaged, modified(write("same", "hello")), monitor.PackageMatches},
+		{"differs", packaged, modified(write("other", "tampered")), monitor.PackageDiffers},
+		{"edited conffile", conffile, modified(write("conf", "edited")), monitor.PackageConffile},
+		{"deleted", packaged, &monitor.Change{Type: monitor.DeletedFile}, monitor.PackageMissing},
+		{"no digest", &File{}, modified(write("plain", "x")), monitor.PackageUnverified},
+	}
+	for _, tt := range tests {
+		if got := status(tt.file, tt.change); got != tt.want {
+			t.Errorf("%s: status = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// modified returns a modification of the file at path
+func modified(path string) *monitor.Change {
+	return &monitor.Change{Path: path, Type: monitor.ModifiedFile, NewInfo: &monitor.FileInfo{Path: path}}
+}
@@ -0,0 +1,304 @@
+package packages
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// File is a file shipped by an installed package
+type File struct {
+	Path      string `json:"path"`
+	Manager   string `json:"manager"` // dpkg or rpm
+	Package   string `json:"package"`
+	Version   string `json:"version,omitempty"`
+	Digest    string `json:"digest,omitempty"`    // hex digest of the packaged content, empty if unknown
+	Algorithm string `json:"algorithm,omitempty"` // md5, sha1, sha256, sha384 or sha512
+	Conffile  bool   `json:"conffile,omitempty"`  // a configuration file that may be edited locally
+
+	// Mode, User and Group are the packaged file mode and owner, if the
+	// package manager records them
+	Mode  os.FileMode `json:"mode,omitempty"`
+	User  string      `json:"user,omitempty"`
+	Group string      `json:"group,omitempty"`
+}
+
+// MatchesAttributes reports whether the mode and owner of a file on disk
+// are the ones its package records. Files whose package records no mode or
+// owner never match.
+func (f *File) MatchesAttributes(info *monitor.FileInfo) bool {
+	if f.Mode == 0 || f.User == "" || f.Group == "" {
+		return false
+	}
+	if os.FileMode(info.Mode) != f.Mode {
+		return false
+	}
+	u, err := user.Lookup(f.User)
+	if err != nil || u.Uid != strconv.Itoa(info.UID) {
+		return false
+	}
+	g, err := user.LookupGroup(f.Group)
+	return err == nil && g.Gid == strconv.Itoa(info.GID)
+}
+
+// Database is a package manager database that knows which package owns a
+// file and what the packaged file looked like
+type Database interface {
+	// Manager returns the name of the package manager
+	Manager() string
+	// Lookup returns the packaged file at path
+	Lookup(path string) (*File, bool, error)
+	// Files returns every packaged file, keyed by path
+	Files() (map[string]*File, error)
+}
+
+// cache holds the packaged files of a database until the database changes
+type cache struct {
+	mu    sync.Mutex
+	stamp time.Time // modification time of the database when loaded
+	files map[string]*File
+}
+
+// get returns the cached files, reloading them if stamp reports a newer
+// modification time than the one they were loaded at
+func (c *cache) get(stamp func() (time.Time, error), load func() (map[string]*File, error)) (map[string]*File, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modTime, err := stamp()
+	if err != nil {
+		return nil, err
+	}
+	if c.files != nil && modTime.Equal(c.stamp) {
+		return c.files, nil
+	}
+
+	files, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.files, c.stamp = files, modTime
+	return files, nil
+}
+
+// lookup finds a path, or one of its aliases, in a set of packaged files
+func lookup(files map[string]*File, path string) (*File, bool) {
+	for _, alias := range aliases(path) {
+		if file, ok := files[alias]; ok {
+			return file, true
+		}
+	}
+	return nil, false
+}
+
+// Verifier compares changed files with the package databases found on the
+// system
+type Verifier struct {
+	dbs []Database
+}
+
+// NewVerifier opens the package databases selected in the [packages]
+// configuration. With "auto", every database present on the system in a
+// supported format is used.
+func NewVerifier(cfg *config.Config) (*Verifier, error) {
+	v := &Verifier{}
+	for _, manager := range cfg.Packages.Verify {
+		switch manager {
+		case "off":
+			return &Verifier{}, nil
+		case "auto":
+			if Exists(cfg.Packages.DpkgDir) {
+				v.dbs = append(v.dbs, OpenDpkg(cfg.Packages.DpkgDir))
+			}
+			// An rpm directory may be left without a database, or hold one
+			// in the unsupported ndb format
+			if rpm := OpenRpm(cfg.Packages.RpmDir); Exists(cfg.Packages.RpmDir) && rpm.Available() {
+				v.dbs = append(v.dbs, rpm)
+			}
+		case "dpkg":
+			if !Exists(cfg.Packages.DpkgDir) {
+				return nil, fmt.Errorf("no dpkg database found in %s", cfg.Packages.DpkgDir)
+			}
+			v.dbs = append(v.dbs, OpenDpkg(cfg.Packages.DpkgDir))
+		case "rpm":
+			if !Exists(cfg.Packages.RpmDir) {
+				return nil, fmt.Errorf("no rpm database found in %s", cfg.Packages.RpmDir)
+			}
+			v.dbs = append(v.dbs, OpenRpm(cfg.Packages.RpmDir))
+		default:
+			return nil, fmt.Errorf("unknown package manager %q", manager)
+		}
+	}
+	return v, nil
+}
+
+// Enabled reports whether any package database is in use
+func (v *Verifier) Enabled() bool {
+	return len(v.dbs) > 0
+}
+
+// Annotate sets Change.Package on every change to a packaged file. A
+// database that cannot be read is left out for the remaining changes, and
+// the changes no other database owns are marked unverified, as they may
+// belong to one of its packages. The first error is returned.
+func (v *Verifier) Annotate(changes []*monitor.Change) error {
+	dbs := v.dbs
+	var failed Database
+	var failure error
+	for _, change := range changes {
+		info, i, err := verify(dbs, change)
+		for err != nil {
+			if failure == nil {
+				failure = err
+			}
+			failed = dbs[i]
+			dbs = append(dbs[:i:i], dbs[i+1:]...)
+			info, i, err = verify(dbs, change)
+		}
+		if info == nil && failed != nil {
+			info = &monitor.PackageInfo{Manager: failed.Manager(), Status: monitor.PackageUnverified}
+		}
+		change.Package = info
+	}
+	return failure
+}
+
+// Lookup returns the packaged file at path from the first database that
+// owns it
+func (v *Verifier) Lookup(path string) (*File, bool, error) {
+	for _, db := range v.dbs {
+		file, ok, err := db.Lookup(path)
+		if err != nil || ok {
+			return file, ok, err
+		}
+	}
+	return nil, false, nil
+}
+
+// Verify looks up the package owning a changed file and compares the file
+// on disk with the packaged one. It returns nil for unpackaged files.
+func (v *Verifier) Verify(change *monitor.Change) (*monitor.PackageInfo, error) {
+	info, _, err := verify(v.dbs, change)
+	return info, err
+}
+
+// verify checks a changed file against the first of dbs owning it. On
+// failure it returns the index of the database that could not be read.
+func verify(dbs []Database, change *monitor.Change) (*monitor.PackageInfo, int, error) {
+	for i, db := range dbs {
+		file, ok, err := db.Lookup(change.Path)
+		if err != nil {
+			return nil, i, err
+		}
+		if !ok {
+			continue
+		}
+
+		info := &monitor.PackageInfo{
+			Manager: file.Manager,
+			Name:    file.Package,
+			Version: file.Version,
+		}
+		info.Status = status(file, change)
+		return info, i, nil
+	}
+	return nil, 0, nil
+}
+
+// status compares the current state of a changed file with its package
+func status(file *File, change *monitor.Change) monitor.PackageStatus {
+	current := change.NewInfo
+	if change.Type == monitor.DeletedFile || current == nil {
+		return monitor.PackageMissing
+	}
+	if current.IsDir || current.IsSymlink || file.Digest == "" {
+		return monitor.PackageUnverified
+	}
+
+	return compare(file, current.SourcePath(), current.Hash)
+}
+
+// compare compares the content of a file on disk with a packaged file,
+// reusing its SHA-256 if known
+func compare(file *File, path, knownSHA256 string) monitor.PackageStatus {
+	digest := knownSHA256
+	if file.Algorithm != "sha256" || digest == "" {
+		var err error
+		if digest, err = Digest(path, file.Algorithm); err != nil {
+			return monitor.PackageUnverified
+		}
+	}
+
+	switch {
+	case strings.EqualFold(digest, file.Digest):
+		return monitor.PackageMatches
+	case file.Conffile:
+		return monitor.PackageConffile
+	default:
+		return monitor.PackageDiffers
+	}
+}
+
+// Digest returns the hex digest of a file with the named algorithm
+func Digest(path, algorithm string) (string, error) {
+	var h hash.Hash
+	switch algorithm {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	case "sha384":
+		h = sha512.New384()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm: %s", algorithm)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Exists reports whether a package database directory exists
+func Exists(dir string) bool {
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+// aliases returns the path followed by the paths it may be recorded under
+// on merged-/usr systems, where /bin is a symlink to /usr/bin and so on
+func aliases(path string) []string {
+	paths := []string{path}
+	for _, dir := range []string{"/bin/", "/sbin/", "/lib/", "/lib32/", "/lib64/", "/libx32/"} {
+		switch {
+		case strings.HasPrefix(path, dir):
+			paths = append(paths, "/usr"+path)
+		case strings.HasPrefix(path, "/usr"+dir):
+			paths = append(paths, strings.TrimPrefix(path, "/usr"))
+		}
+	}
+	return paths
+}
@@ -0,0 +1,144 @@
+package packages
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Rpm reads the RPM database directly, without the rpm binary. Both the
+// SQLite backend (rpmdb.sqlite, rpm 4.16 and later) and the Berkeley DB
+// backend (Packages) are supported. The database is indexed on first use
+// and re-read whenever it changes.
+type Rpm struct {
+	dir   string
+	cache cache
+}
+
+// OpenRpm returns the RPM database in dir, usually /var/lib/rpm
+func OpenRpm(dir string) *Rpm {
+	return &Rpm{dir: dir}
+}
+
+// Manager implements Database
+func (r *Rpm) Manager() string {
+	return "rpm"
+}
+
+// Lookup implements Database
+func (r *Rpm) Lookup(path string) (*File, bool, error) {
+	files, err := r.Files()
+	if err != nil {
+		return nil, false, err
+	}
+	file, ok := lookup(files, path)
+	return file, ok, nil
+}
+
+// Files implements Database
+func (r *Rpm) Files() (map[string]*File, error) {
+	return r.cache.get(r.stamp, r.load)
+}
+
+// Available reports whether the directory holds a database in a supported
+// format
+func (r *Rpm) Available() bool {
+	_, _, err := r.backend()
+	return err == nil
+}
+
+// backend returns the path of the database file and whether it is SQLite
+func (r *Rpm) backend() (string, bool, error) {
+	sqlitePath := filepath.Join(r.dir, "rpmdb.sqlite")
+	if _, err := os.Stat(sqlitePath); err == nil {
+		return sqlitePath, true, nil
+	}
+	bdbPath := filepath.Join(r.dir, "Packages")
+	if _, err := os.Stat(bdbPath); err == nil {
+		return bdbPath, false, nil
+	}
+	if _, err := os.Stat(filepath.Join(r.dir, "Packages.db")); err == nil {
+		return "", false, fmt.Errorf("the ndb rpm database in %s is not supported", r.dir)
+	}
+	return "", false, fmt.Errorf("no rpm database found in %s", r.dir)
+}
+
+// stamp returns the latest modification time of the database files
+func (r *Rpm) stamp() (time.Time, error) {
+	path, isSQLite, err := r.backend()
+	if err != nil {
+		return time.Time{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read rpm database: %v", err)
+	}
+	stamp := info.ModTime()
+	if isSQLite {
+		if wal, err := os.Stat(path + "-wal"); err == nil && wal.ModTime().After(stamp) {
+			stamp = wal.ModTime()
+		}
+	}
+	return stamp, nil
+}
+
+// load indexes the database
+func (r *Rpm) load() (map[string]*File, error) {
+	blobs, err := r.headers()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*File)
+	for _, blob := range blobs {
+		h, err := parseRPMHeader(blob)
+		if err != nil {
+			// The Berkeley DB backend keeps a few non-header records
+			continue
+		}
+		for _, file := range h.files() {
+			files[file.Path] = file
+		}
+	}
+	return files, nil
+}
+
+// headers returns the header blobs of all installed packages
+func (r *Rpm) headers() ([][]byte, error) {
+	path, isSQLite, err := r.backend()
+	if err != nil {
+		return nil, err
+	}
+
+	if !isSQLite {
+		blobs, err := readBDBHash(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rpm database: %v", err)
+		}
+		return blobs, nil
+	}
+
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rpm database: %v", err)
+	}
+	root, err := db.tableRoot("Packages")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rpm database: %v", err)
+	}
+	var blobs [][]byte
+	err = db.scan(root, func(rowid int64, values []interface{}) error {
+		// Columns are hnum (the rowid) and blob
+		if len(values) >= 2 {
+			if blob, ok := values[1].([]byte); ok {
+				blobs = append(blobs, blob)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rpm database: %v", err)
+	}
+	return blobs, nil
+}
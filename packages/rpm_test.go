@@ -0,0 +1,454 @@
+package packages
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// headerEntry is a tag of a test RPM header
+type headerEntry struct {
+	tag    uint32
+	typ    uint32
+	values interface{} // string, []string or []int32
+}
+
+// buildHeader encodes an RPM header as stored in the rpmdb
+func buildHeader(entries []headerEntry) []byte {
+	var index, data bytes.Buffer
+	for _, e := range entries {
+		var offset, count int
+		switch v := e.values.(type) {
+		case string:
+			offset, count = data.Len(), 1
+			data.WriteString(v + "\x00")
+		case []string:
+			offset, count = data.Len(), len(v)
+			for _, s := range v {
+				data.WriteString(s + "\x00")
+			}
+		case []int32:
+			size := 4
+			if e.typ == rpmTypeInt16 {
+				size = 2
+			}
+			for data.Len()%size != 0 {
+				data.WriteByte(0)
+			}
+			offset, count = data.Len(), len(v)
+			for _, n := range v {
+				if size == 2 {
+					binary.Write(&data, binary.BigEndian, uint16(n))
+				} else {
+					binary.Write(&data, binary.BigEndian, n)
+				}
+			}
+		}
+		binary.Write(&index, binary.BigEndian, [4]uint32{e.tag, e.typ, uint32(offset), uint32(count)})
+	}
+
+	var blob bytes.Buffer
+	binary.Write(&blob, binary.BigEndian, [2]uint32{uint32(len(entries)), uint32(data.Len())})
+	blob.Write(index.Bytes())
+	blob.Write(data.Bytes())
+	return blob.Bytes()
+}
+
+// testPackage returns the header of a package owning one file per path
+func testPackage(name string, paths ...string) []byte {
+	var basenames, digests []string
+	var indexes, modes []int32
+	for i, path := range paths {
+		basenames = append(basenames, filepath.Base(path))
+		indexes = append(indexes, int32(i))
+		modes = append(modes, 0o100644)
+		digests = append(digests, fmt.Sprintf("%064x", i+1))
+	}
+	dirnames := make([]string, len(paths))
+	for i, path := range paths {
+		dirnames[i] = filepath.Dir(path) + "/"
+	}
+	return buildHeader([]headerEntry{
+		{rpmTagName, rpmTypeString, name},
+		{rpmTagVersion, rpmTypeString, "1.0"},
+		{rpmTagRelease, rpmTypeString, "1"},
+		{rpmTagFileModes, rpmTypeInt16, modes},
+		{rpmTagFileDigests, rpmTypeStringArray, digests},
+		{rpmTagDirIndexes, rpmTypeInt32, indexes},
+		{rpmTagBasenames, rpmTypeStringArray, basenames},
+		{rpmTagDirnames, rpmTypeStringArray, dirnames},
+		{rpmTagFileDigestAlgo, rpmTypeInt32, []int32{8}},
+	})
+}
+
+// TestRpmSQLite reads testdata/rpm-sqlite/rpmdb.sqlite, created with the
+// sqlite3 module of Python with a 1 KiB page size so that the Packages
+// table has interior pages and overflow chains. It holds bash,
+// shadow-utils, 120 one-file filler packages and bigpkg with 40 files.
+func TestRpmSQLite(t *testing.T) {
+	files, err := OpenRpm(filepath.Join("testdata", "rpm-sqlite")).Files()
+	if err != nil {
+		t.Fatalf("Files: %v", err)
+	}
+	if want := 3 + 2 + 120 + 40; len(files) != want {
+		t.Errorf("indexed %d files, want %d", len(files), want)
+	}
+
+	tests := []struct {
+		path     string
+		pkg      string
+		version  string
+		digest   string
+		conffile bool
+	}{
+		{"/usr/bin/bash", "bash", "5.2.15-2.fc38", "37d2b12d5d9abc2a364ef9448767ee03938e383c0284193477dc7618f4b7c6c2", false},
+		{"/etc/bashrc", "bash", "5.2.15-2.fc38", "", true},
+		{"/usr/share/doc/bash", "bash", "5.2.15-2.fc38", "", false},
+		{"/usr/bin/passwd", "shadow-utils", "2:4.13-6.fc38", "0d6be69b264717f2dd33652e212b173104b4a647b7c11ae72e9885f11cd312fb", false},
+		{"/usr/lib/filler/119", "filler119", "1.0-1", "", false},
+		{"/usr/share/big/0039", "bigpkg", "1.0-1", "", false},
+	}
+	for _, tt := range tests {
+		file, ok := files[tt.path]
+		if !ok {
+			t.Errorf("%s is not indexed", tt.path)
+			continue
+		}
+		if file.Package != tt.pkg || file.Version != tt.version || file.Conffile != tt.conffile {
+			t.Errorf("%s = %+v", tt.path, file)
+		}
+		if tt.digest != "" && file.Digest != tt.digest {
+			t.Errorf("%s has digest %s, want %s", tt.path, file.Digest, tt.digest)
+		}
+	}
+	if file := files["/usr/share/doc/bash"]; file != nil && file.Digest != "" {
+		t.Errorf("directory has digest %s", file.Digest)
+	}
+	if file := files["/usr/bin/passwd"]; file != nil {
+		if file.Algorithm != "sha256" {
+			t.Errorf("algorithm %s, want sha256", file.Algorithm)
+		}
+		if file.Mode != os.ModeSetuid|0o755 || file.User != "root" || file.Group != "root" {
+			t.Errorf("/usr/bin/passwd has mode %v and owner %s:%s, want -rwsr-xr-x root:root", file.Mode, file.User, file.Group)
+		}
+	}
+}
+
+// buildBDBHash lays out a Berkeley DB hash database with one hash page of
+// key/value items; values larger than a quarter page go to overflow pages
+func buildBDBHash(order binary.ByteOrder, pageSize int, values [][]byte) []byte {
+	meta := make([]byte, pageSize)
+	order.PutUint32(meta[12:16], bdbHashMagic)
+	order.PutUint32(meta[20:24], uint32(pageSize))
+	pages := [][]byte{meta, nil}
+
+	hash := make([]byte, pageSize)
+	hash[25] = bdbPageHash
+	end := pageSize
+	var offsets []int
+	for i, value := range values {
+		key := []byte{bdbItemKeyData, byte(i), 0, 0, 0}
+
+		item := append([]byte{bdbItemKeyData}, value...)
+		if len(value) > pageSize/4 {
+			// Chain the value through overflow pages
+			first := len(pages)
+			for rest := value; len(rest) > 0; {
+				n := min(len(rest), pageSize-bdbPageHeader)
+				p := make([]byte, pageSize)
+				p[25] = bdbPageOverflow
+				order.PutUint16(p[22:24], uint16(n))
+				copy(p[bdbPageHeader:], rest[:n])
+				rest = rest[n:]
+				if len(rest) > 0 {
+					order.PutUint32(p[16:20], uint32(len(pages)+1))
+				}
+				pages = append(pages, p)
+			}
+			item = make([]byte, 12)
+			item[0] = bdbItemOffPage
+			order.PutUint32(item[4:8], uint32(first))
+			order.PutUint32(item[8:12], uint32(len(value)))
+		}
+
+		end -= len(key)
+		copy(hash[end:], key)
+		offsets = append(offsets, end)
+		end -= len(item)
+		copy(hash[end:], item)
+		offsets = append(offsets, end)
+	}
+	order.PutUint16(hash[20:22], uint16(len(offsets)))
+	for i, off := range offsets {
+		order.PutUint16(hash[bdbPageHeader+2*i:], uint16(off))
+	}
+	pages[1] = hash
+
+	return bytes.Join(pages, nil)
+}
+
+func TestRpmBerkeleyDB(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		bigPaths := make([]string, 60)
+		for i := range bigPaths {
+			bigPaths[i] = fmt.Sprintf("/usr/share/big/file%02d", i)
+		}
+		blobs := [][]byte{
+			testPackage("bash", "/usr/bin/bash", "/etc/bashrc"),
+			testPackage("big", bigPaths...),
+			// The rpmdb keeps a few records that are not headers
+			{0, 0, 0, 1},
+		}
+
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "Packages"), buildBDBHash(order, 4096, blobs), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files, err := OpenRpm(dir).Files()
+		if err != nil {
+			t.Fatalf("%v: Files: %v", order, err)
+		}
+		if len(files) != 62 {
+			t.Errorf("%v: indexed %d files, want 62", order, len(files))
+		}
+		if file := files["/usr/share/big/file59"]; file == nil || file.Package != "big" {
+			t.Errorf("%v: file of the overflowing header = %+v", order, file)
+		}
+		if file := files["/etc/bashrc"]; file == nil || file.Digest != fmt.Sprintf("%064x", 2) {
+			t.Errorf("%v: /etc/bashrc = %+v", order, file)
+		}
+	}
+}
+
+func TestRpmMissingDatabase(t *testing.T) {
+	if _, err := OpenRpm(t.TempDir()).Files(); err == nil {
+		t.Error("Files succeeded without a database")
+	}
+}
+
+func TestAutoSkipsUnusableRpmDirectory(t *testing.T) {
+	ndb := t.TempDir()
+	if err := os.WriteFile(filepath.Join(ndb, "Packages.db"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{t.TempDir(), ndb} {
+		cfg := config.DefaultConfig()
+		cfg.Packages.Verify = []string{"auto"}
+		cfg.Packages.DpkgDir = filepath.Join("testdata", "dpkg")
+		cfg.Packages.RpmDir = dir
+		v, err := NewVerifier(cfg)
+		if err != nil {
+			t.Fatalf("NewVerifier: %v", err)
+		}
+		if len(v.dbs) != 1 || v.dbs[0].Manager() != "dpkg" {
+			t.Errorf("rpm directory %s: using %d databases, want dpkg only", dir, len(v.dbs))
+		}
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Packages.Verify = []string{"auto"}
+	cfg.Packages.DpkgDir = filepath.Join(t.TempDir(), "missing")
+	cfg.Packages.RpmDir = t.TempDir()
+	if v, err := NewVerifier(cfg); err != nil || v.Enabled() {
+		t.Errorf("NewVerifier without databases = %v, %v; want it disabled", v, err)
+	}
+}
+
+func TestAnnotateMarksUnreadableDatabaseUnverified(t *testing.T) {
+	v := &Verifier{dbs: []Database{OpenRpm(t.TempDir()), OpenDpkg(filepath.Join("testdata", "dpkg"))}}
+	owned := modified("/bin/true")
+	unowned := modified("/usr/local/bin/tool")
+	if err := v.Annotate([]*monitor.Change{owned, unowned}); err == nil {
+		t.Error("Annotate did not report the unreadable database")
+	}
+	if p := owned.Package; p == nil || p.Manager != "dpkg" || p.Name != "coreutils" {
+		t.Errorf("file owned by a readable database = %+v", p)
+	}
+	if p := unowned.Package; p == nil || p.Manager != "rpm" || p.Status != monitor.PackageUnverified {
+		t.Errorf("file possibly owned by the unreadable database = %+v", p)
+	}
+}
+
+func TestParseRPMHeaderMalformed(t *testing.T) {
+	good := testPackage("bash", "/usr/bin/bash")
+
+	// A string array claiming 0xffffffff values
+	huge := buildHeader([]headerEntry{{rpmTagBasenames, rpmTypeStringArray, []string{"a"}}})
+	binary.BigEndian.PutUint32(huge[8+12:], 0xffffffff)
+
+	// Indexes pointing past the data
+	outside := buildHeader([]headerEntry{{rpmTagName, rpmTypeString, "x"}})
+	binary.BigEndian.PutUint32(outside[8+8:], 1000)
+
+	tests := []struct {
+		name string
+		blob []byte
+		ok   bool
+	}{
+		{"valid", good, true},
+		{"empty", nil, false},
+		{"short", good[:6], false},
+		{"truncated data", good[:len(good)-1], false},
+		{"index larger than blob", []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}, false},
+		{"huge string count", huge, true},
+		{"offset outside data", outside, true},
+	}
+	for _, tt := range tests {
+		h, err := parseRPMHeader(tt.blob)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: parseRPMHeader error = %v", tt.name, err)
+			continue
+		}
+		if h != nil {
+			// Must not panic or allocate by the claimed counts
+			h.files()
+			h.string(rpmTagName)
+		}
+	}
+
+	if h, _ := parseRPMHeader(huge); h.strings(rpmTagBasenames) != nil {
+		t.Error("strings returned values for an impossible count")
+	}
+}
+
+func TestRpmHeaderFiles(t *testing.T) {
+	h, err := parseRPMHeader(buildHeader([]headerEntry{
+		{rpmTagName, rpmTypeString, "coreutils"},
+		{rpmTagVersion, rpmTypeString, "9.1"},
+		{rpmTagRelease, rpmTypeString, "3"},
+		{rpmTagEpoch, rpmTypeInt32, []int32{1}},
+		{rpmTagFileModes, rpmTypeInt16, []int32{0o100755, 0o120777, 0o100644}},
+		{rpmTagFileDigests, rpmTypeStringArray, []string{"aa", "bb", "cc"}},
+		{rpmTagFileFlags, rpmTypeInt32, []int32{0, 0, rpmFileConfig}},
+		{rpmTagDirIndexes, rpmTypeInt32, []int32{0, 0, 1}},
+		{rpmTagBasenames, rpmTypeStringArray, []string{"ls", "dir", "DIR_COLORS"}},
+		{rpmTagDirnames, rpmTypeStringArray, []string{"/usr/bin/", "/etc/"}},
+		{rpmTagFileUserName, rpmTypeStringArray, []string{"root", "root", "root"}},
+		{rpmTagFileGroupName, rpmTypeStringArray, []string{"root", "root", "root"}},
+		{rpmTagFileDigestAlgo, rpmTypeInt32, []int32{2}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := h.files()
+	if len(files) != 3 {
+		t.Fatalf("got %d files, want 3", len(files))
+	}
+	want := []File{
+		{Path: "/usr/bin/ls", Manager: "rpm", Package: "coreutils", Version: "1:9.1-3", Digest: "aa", Algorithm: "sha1",
+			Mode: 0o755, User: "root", Group: "root"},
+		{Path: "/usr/bin/dir", Manager: "rpm", Package: "coreutils", Version: "1:9.1-3", Algorithm: "sha1",
+			Mode: os.ModeSymlink | 0o777, User: "root", Group: "root"},
+		{Path: "/etc/DIR_COLORS", Manager: "rpm", Package: "coreutils", Version: "1:9.1-3", Digest: "cc", Algorithm: "sha1", Conffile: true,
+			Mode: 0o644, User: "root", Group: "root"},
+	}
+	for i, file := range files {
+		if *file != want[i] {
+			t.Errorf("file %d = %+v, want %+v", i, *file, want[i])
+		}
+	}
+}
+
+func TestMatchesAttributes(t *testing.T) {
+	file := &File{Mode: os.ModeSetuid | 0o755, User: "root", Group: "root"}
+	tests := []struct {
+		name string
+		file *File
+		info monitor.FileInfo
+		want bool
+	}{
+		{"packaged", file, monitor.FileInfo{Mode: uint32(os.ModeSetuid | 0o755)}, true},
+		{"setuid dropped", file, monitor.FileInfo{Mode: 0o755}, false},
+		{"world writable", file, monitor.FileInfo{Mode: uint32(os.ModeSetuid | 0o777)}, false},
+		{"other owner", file, monitor.FileInfo{Mode: uint32(os.ModeSetuid | 0o755), UID: 12345}, false},
+		{"other group", file, monitor.FileInfo{Mode: uint32(os.ModeSetuid | 0o755), GID: 12345}, false},
+		{"not recorded", &File{}, monitor.FileInfo{}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.file.MatchesAttributes(&tt.info); got != tt.want {
+			t.Errorf("%s: MatchesAttributes = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func FuzzParseRPMHeader(f *testing.F) {
+	f.Add(testPackage("bash", "/usr/bin/bash", "/etc/bashrc"))
+	f.Add([]byte{0, 0, 0, 1, 0, 0, 0, 0})
+	f.Fuzz(func(t *testing.T, blob []byte) {
+		h, err := parseRPMHeader(blob)
+		if err != nil {
+			return
+		}
+		h.files()
+		h.version()
+	})
+}
+
+func FuzzSQLite(f *testing.F) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "rpm-sqlite", "rpmdb.sqlite"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(fixture[:4096])
+	f.Add(fixture)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		db, err := parseSQLite(data, nil)
+		if err != nil {
+			return
+		}
+		root, err := db.tableRoot("Packages")
+		if err != nil {
+			return
+		}
+		db.scan(root, func(int64, []interface{}) error { return nil })
+	})
+}
+
+func FuzzSQLiteRecord(f *testing.F) {
+	f.Add([]byte{3, 1, 0x0f, 7, 'a'})
+	f.Add([]byte{0x81, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80})
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		sqliteRecord(payload)
+	})
+}
+
+func FuzzBerkeleyDB(f *testing.F) {
+	f.Add(buildBDBHash(binary.LittleEndian, 512, [][]byte{testPackage("bash", "/usr/bin/bash"), bytes.Repeat([]byte{1}, 300)}))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parseBDBHash(data)
+	})
+}
+
+func TestMalformedDatabasesDoNotPanic(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "rpm-sqlite", "rpmdb.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cell pointers, record headers and payload sizes out of range on
+	// every page, one byte at a time
+	for off := 100; off < len(fixture); off += 7 {
+		data := append([]byte(nil), fixture...)
+		data[off] ^= 0xff
+		db, err := parseSQLite(data, nil)
+		if err != nil {
+			continue
+		}
+		if root, err := db.tableRoot("Packages"); err == nil {
+			db.scan(root, func(int64, []interface{}) error { return nil })
+		}
+	}
+
+	bdb := buildBDBHash(binary.LittleEndian, 512, [][]byte{testPackage("bash", "/usr/bin/bash"), bytes.Repeat([]byte{1}, 1000)})
+	for off := 0; off < len(bdb); off++ {
+		data := append([]byte(nil), bdb...)
+		data[off] ^= 0xff
+		parseBDBHash(data)
+	}
+}
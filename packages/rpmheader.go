@@ -0,0 +1,255 @@
+package packages
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+)
+
+// RPM header tags used for verification
+const (
+	rpmTagName           = 1000
+	rpmTagVersion        = 1001
+	rpmTagRelease        = 1002
+	rpmTagEpoch          = 1003
+	rpmTagFileModes      = 1030
+	rpmTagFileDigests    = 1035
+	rpmTagFileFlags      = 1037
+	rpmTagFileUserName   = 1039
+	rpmTagFileGroupName  = 1040
+	rpmTagOldFilenames   = 1027
+	rpmTagDirIndexes     = 1116
+	rpmTagBasenames      = 1117
+	rpmTagDirnames       = 1118
+	rpmTagFileDigestAlgo = 5011
+)
+
+// RPM header data types
+const (
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// rpmFileConfig marks a file as %config in FILEFLAGS
+const rpmFileConfig = 1 << 0
+
+// rpmDigestAlgos maps FILEDIGESTALGO values to algorithm names
+var rpmDigestAlgos = map[int32]string{
+	1:  "md5",
+	2:  "sha1",
+	8:  "sha256",
+	9:  "sha384",
+	10: "sha512",
+}
+
+// rpmEntry is an entry of the header index
+type rpmEntry struct {
+	typ    uint32
+	offset uint32
+	count  uint32
+}
+
+// rpmHeader is a parsed RPM header as stored in the rpmdb: an index of
+// tags followed by their data, without the lead and magic of a package file
+type rpmHeader struct {
+	entries map[uint32]rpmEntry
+	data    []byte
+}
+
+// parseRPMHeader parses a header blob from the rpmdb
+func parseRPMHeader(blob []byte) (*rpmHeader, error) {
+	if len(blob) < 8 {
+		return nil, fmt.Errorf("rpm header too short")
+	}
+	il := binary.BigEndian.Uint32(blob[0:4])
+	dl := binary.BigEndian.Uint32(blob[4:8])
+	start := 8 + uint64(il)*16
+	if start+uint64(dl) > uint64(len(blob)) {
+		return nil, fmt.Errorf("rpm header truncated")
+	}
+
+	h := &rpmHeader{
+		entries: make(map[uint32]rpmEntry, il),
+		data:    blob[start : start+uint64(dl)],
+	}
+	for i := uint32(0); i < il; i++ {
+		e := blob[8+i*16:]
+		h.entries[binary.BigEndian.Uint32(e[0:4])] = rpmEntry{
+			typ:    binary.BigEndian.Uint32(e[4:8]),
+			offset: binary.BigEndian.Uint32(e[8:12]),
+			count:  binary.BigEndian.Uint32(e[12:16]),
+		}
+	}
+	return h, nil
+}
+
+// strings returns the values of a string, string array or i18n string tag
+func (h *rpmHeader) strings(tag uint32) []string {
+	e, ok := h.entries[tag]
+	if !ok || e.offset > uint32(len(h.data)) {
+		return nil
+	}
+	switch e.typ {
+	case rpmTypeString:
+		e.count = 1
+	case rpmTypeStringArray, rpmTypeI18NString:
+	default:
+		return nil
+	}
+
+	// Every value takes at least its terminator, which bounds the count
+	data := h.data[e.offset:]
+	if uint64(e.count) > uint64(len(data)) {
+		return nil
+	}
+	values := make([]string, 0, e.count)
+	for i := uint32(0); i < e.count; i++ {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			return nil
+		}
+		values = append(values, string(data[:end]))
+		data = data[end+1:]
+	}
+	return values
+}
+
+// string returns the first value of a string tag
+func (h *rpmHeader) string(tag uint32) string {
+	if values := h.strings(tag); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ints returns the values of an int16 or int32 tag
+func (h *rpmHeader) ints(tag uint32) []int32 {
+	e, ok := h.entries[tag]
+	if !ok {
+		return nil
+	}
+	size := uint32(4)
+	if e.typ == rpmTypeInt16 {
+		size = 2
+	} else if e.typ != rpmTypeInt32 {
+		return nil
+	}
+	if uint64(e.offset)+uint64(e.count)*uint64(size) > uint64(len(h.data)) {
+		return nil
+	}
+
+	values := make([]int32, e.count)
+	for i := range values {
+		b := h.data[e.offset+uint32(i)*size:]
+		if size == 2 {
+			values[i] = int32(binary.BigEndian.Uint16(b))
+		} else {
+			values[i] = int32(binary.BigEndian.Uint32(b))
+		}
+	}
+	return values
+}
+
+// fileMode converts a Unix st_mode, as stored in FILEMODES, to the
+// os.FileMode recorded in the baseline
+func fileMode(mode uint32) os.FileMode {
+	m := os.FileMode(mode & 0o777)
+	switch mode & 0o170000 {
+	case 0o040000:
+		m |= os.ModeDir
+	case 0o120000:
+		m |= os.ModeSymlink
+	case 0o020000:
+		m |= os.ModeDevice | os.ModeCharDevice
+	case 0o060000:
+		m |= os.ModeDevice
+	case 0o010000:
+		m |= os.ModeNamedPipe
+	case 0o140000:
+		m |= os.ModeSocket
+	}
+	if mode&0o4000 != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+// version returns the [epoch:]version-release of the package
+func (h *rpmHeader) version() string {
+	v := h.string(rpmTagVersion) + "-" + h.string(rpmTagRelease)
+	if epoch := h.ints(rpmTagEpoch); len(epoch) > 0 {
+		v = strconv.Itoa(int(epoch[0])) + ":" + v
+	}
+	return v
+}
+
+// files returns the packaged files of the header
+func (h *rpmHeader) files() []*File {
+	// Paths are stored as directory and basename, or as full paths in
+	// packages built before rpm 4
+	var paths []string
+	if basenames := h.strings(rpmTagBasenames); len(basenames) > 0 {
+		dirnames := h.strings(rpmTagDirnames)
+		indexes := h.ints(rpmTagDirIndexes)
+		if len(indexes) != len(basenames) {
+			return nil
+		}
+		for i, base := range basenames {
+			if int(indexes[i]) >= len(dirnames) || indexes[i] < 0 {
+				return nil
+			}
+			paths = append(paths, dirnames[indexes[i]]+base)
+		}
+	} else {
+		paths = h.strings(rpmTagOldFilenames)
+	}
+
+	digests := h.strings(rpmTagFileDigests)
+	flags := h.ints(rpmTagFileFlags)
+	modes := h.ints(rpmTagFileModes)
+	users := h.strings(rpmTagFileUserName)
+	groups := h.strings(rpmTagFileGroupName)
+	algorithm := "md5"
+	if algo := h.ints(rpmTagFileDigestAlgo); len(algo) > 0 {
+		algorithm = rpmDigestAlgos[algo[0]]
+	}
+
+	name, version := h.string(rpmTagName), h.version()
+	files := make([]*File, 0, len(paths))
+	for i, p := range paths {
+		file := &File{
+			Manager:   "rpm",
+			Package:   name,
+			Version:   version,
+			Path:      path.Clean(p),
+			Algorithm: algorithm,
+		}
+		// Only regular files have digests
+		if i < len(digests) && algorithm != "" && (i >= len(modes) || modes[i]&0o170000 == 0o100000) {
+			file.Digest = digests[i]
+		}
+		if i < len(flags) && flags[i]&rpmFileConfig != 0 {
+			file.Conffile = true
+		}
+		if i < len(modes) {
+			file.Mode = fileMode(uint32(modes[i]))
+		}
+		if i < len(users) && i < len(groups) {
+			file.User, file.Group = users[i], groups[i]
+		}
+		files = append(files, file)
+	}
+	return files
+}
@@ -0,0 +1,334 @@
+package packages
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sqliteDB is a minimal read-only reader of SQLite database files, just
+// enough to scan the rows of a table. Committed pages still in the
+// write-ahead log are taken into account.
+type sqliteDB struct {
+	data     []byte
+	pageSize int
+	usable   int
+	wal      map[uint32][]byte // latest committed version of pages in the WAL
+}
+
+// sqliteMagic starts every SQLite database file
+const sqliteMagic = "SQLite format 3\x00"
+
+// openSQLite reads a database file and its write-ahead log, if any
+func openSQLite(path string) (*sqliteDB, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	wal, _ := os.ReadFile(path + "-wal")
+	db, err := parseSQLite(data, wal)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return db, nil
+}
+
+// parseSQLite reads a database from the contents of its file and
+// write-ahead log, which may be empty
+func parseSQLite(data, wal []byte) (*sqliteDB, error) {
+	if len(data) < 100 || string(data[:16]) != sqliteMagic {
+		return nil, fmt.Errorf("not an SQLite database")
+	}
+
+	db := &sqliteDB{data: data}
+	db.pageSize = int(binary.BigEndian.Uint16(data[16:18]))
+	if db.pageSize == 1 {
+		db.pageSize = 65536
+	}
+	db.usable = db.pageSize - int(data[20])
+	if db.pageSize < 512 || db.usable < 480 {
+		return nil, fmt.Errorf("invalid page size")
+	}
+
+	if len(wal) > 0 {
+		db.wal = readWAL(wal, db.pageSize)
+	}
+	return db, nil
+}
+
+// readWAL returns the pages of the committed transactions in a WAL file.
+// Frames after the last commit, or left over from an earlier checkpoint
+// (with stale salts), are ignored.
+func readWAL(wal []byte, pageSize int) map[uint32][]byte {
+	if len(wal) < 32 || int(binary.BigEndian.Uint32(wal[8:12])) != pageSize {
+		return nil
+	}
+	salt := wal[16:24]
+
+	pages := make(map[uint32][]byte)
+	pending := make(map[uint32][]byte)
+	for off := 32; off+24+pageSize <= len(wal); off += 24 + pageSize {
+		frame := wal[off : off+24+pageSize]
+		if !bytes.Equal(frame[8:16], salt) {
+			break
+		}
+		pending[binary.BigEndian.Uint32(frame[0:4])] = frame[24:]
+
+		// A non-zero database size marks the commit frame
+		if binary.BigEndian.Uint32(frame[4:8]) != 0 {
+			for pgno, page := range pending {
+				pages[pgno] = page
+			}
+			pending = make(map[uint32][]byte)
+		}
+	}
+	return pages
+}
+
+// page returns a page by its 1-based number
+func (db *sqliteDB) page(pgno uint32) ([]byte, error) {
+	if page, ok := db.wal[pgno]; ok {
+		return page, nil
+	}
+	start := int64(pgno-1) * int64(db.pageSize)
+	if pgno == 0 || start+int64(db.pageSize) > int64(len(db.data)) {
+		return nil, fmt.Errorf("sqlite page %d out of range", pgno)
+	}
+	return db.data[start : start+int64(db.pageSize)], nil
+}
+
+// tableRoot returns the root page of a table from the schema table
+func (db *sqliteDB) tableRoot(name string) (uint32, error) {
+	var root uint32
+	err := db.scan(1, func(rowid int64, values []interface{}) error {
+		if len(values) < 4 || values[0] != "table" || !strings.EqualFold(fmt.Sprint(values[1]), name) {
+			return nil
+		}
+		if n, ok := values[3].(int64); ok {
+			root = uint32(n)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if root == 0 {
+		return 0, fmt.Errorf("sqlite table %s not found", name)
+	}
+	return root, nil
+}
+
+// scan calls fn for every row of the table b-tree rooted at page root
+func (db *sqliteDB) scan(root uint32, fn func(rowid int64, values []interface{}) error) error {
+	return db.scanPage(root, fn, 0, make(map[uint32]bool))
+}
+
+// maxPayload bounds the size of a record, which cannot be larger than the
+// database and its write-ahead log together
+func (db *sqliteDB) maxPayload() int64 {
+	return int64(len(db.data)) + int64(len(db.wal))*int64(db.pageSize)
+}
+
+// scanPage walks one page of a table b-tree. Each page is visited once, as
+// a page linked twice would make the walk loop in a corrupt database.
+func (db *sqliteDB) scanPage(pgno uint32, fn func(int64, []interface{}) error, depth int, seen map[uint32]bool) error {
+	if depth > 64 {
+		return fmt.Errorf("sqlite b-tree too deep")
+	}
+	if seen[pgno] {
+		return fmt.Errorf("sqlite page %d is linked twice", pgno)
+	}
+	seen[pgno] = true
+	page, err := db.page(pgno)
+	if err != nil {
+		return err
+	}
+
+	// Page 1 starts with the database header
+	hdr := 0
+	if pgno == 1 {
+		hdr = 100
+	}
+	typ := page[hdr]
+	ncells := int(binary.BigEndian.Uint16(page[hdr+3:]))
+
+	// The cell pointers follow the page header, 12 bytes on interior
+	// pages and 8 on leaves
+	ptrs := hdr + 8
+	if typ == 0x05 {
+		ptrs = hdr + 12
+	}
+	if ptrs+2*ncells > len(page) {
+		return fmt.Errorf("sqlite page %d: cell pointers out of range", pgno)
+	}
+
+	switch typ {
+	case 0x05: // interior table page
+		for i := 0; i < ncells; i++ {
+			cell := int(binary.BigEndian.Uint16(page[ptrs+2*i:]))
+			if cell+4 > len(page) {
+				return fmt.Errorf("sqlite cell out of range")
+			}
+			if err := db.scanPage(binary.BigEndian.Uint32(page[cell:]), fn, depth+1, seen); err != nil {
+				return err
+			}
+		}
+		return db.scanPage(binary.BigEndian.Uint32(page[hdr+8:]), fn, depth+1, seen)
+
+	case 0x0d: // leaf table page
+		for i := 0; i < ncells; i++ {
+			cell := int(binary.BigEndian.Uint16(page[ptrs+2*i:]))
+			if cell >= len(page) {
+				return fmt.Errorf("sqlite cell out of range")
+			}
+			size, n := sqliteVarint(page[cell:])
+			if n == 0 || size < 0 || size > db.maxPayload() {
+				return fmt.Errorf("sqlite page %d: invalid payload size", pgno)
+			}
+			cell += n
+			rowid, n := sqliteVarint(page[cell:])
+			if n == 0 {
+				return fmt.Errorf("sqlite page %d: invalid rowid", pgno)
+			}
+			cell += n
+
+			payload, err := db.payload(page, cell, int(size))
+			if err != nil {
+				return err
+			}
+			values, err := sqliteRecord(payload)
+			if err != nil {
+				return err
+			}
+			if err := fn(rowid, values); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unexpected sqlite page type %#x", typ)
+	}
+}
+
+// payload assembles the payload of a leaf cell, following overflow pages.
+// The size must have been checked against maxPayload.
+func (db *sqliteDB) payload(page []byte, cell, size int) ([]byte, error) {
+	u := db.usable
+	maxLocal := u - 35
+	local := size
+	if size > maxLocal {
+		minLocal := (u-12)*32/255 - 23
+		local = minLocal + (size-minLocal)%(u-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if cell+local > len(page) {
+		return nil, fmt.Errorf("sqlite payload out of range")
+	}
+
+	payload := make([]byte, 0, size)
+	payload = append(payload, page[cell:cell+local]...)
+	if local == size {
+		return payload, nil
+	}
+
+	// The rest of the payload is chained through overflow pages
+	if cell+local+4 > len(page) {
+		return nil, fmt.Errorf("sqlite payload out of range")
+	}
+	next := binary.BigEndian.Uint32(page[cell+local:])
+	for len(payload) < size {
+		if next == 0 {
+			return nil, fmt.Errorf("sqlite overflow chain truncated")
+		}
+		overflow, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		n := min(size-len(payload), u-4)
+		payload = append(payload, overflow[4:4+n]...)
+		next = binary.BigEndian.Uint32(overflow[0:4])
+	}
+	return payload, nil
+}
+
+// sqliteRecord decodes a record into its column values: int64, float
+// (returned as nil), string, []byte or nil
+func sqliteRecord(payload []byte) ([]interface{}, error) {
+	hdrSize, n := sqliteVarint(payload)
+	if n == 0 || hdrSize < int64(n) || hdrSize > int64(len(payload)) {
+		return nil, fmt.Errorf("invalid sqlite record")
+	}
+
+	var values []interface{}
+	body := payload[hdrSize:]
+	for pos := n; pos < int(hdrSize); {
+		serial, n := sqliteVarint(payload[pos:hdrSize])
+		if n == 0 || serial < 0 || serial > int64(2*len(payload)+13) {
+			return nil, fmt.Errorf("invalid sqlite record")
+		}
+		pos += n
+
+		var size int
+		var value interface{}
+		switch {
+		case serial == 0, serial == 10, serial == 11:
+		case serial <= 6:
+			size = []int{0, 1, 2, 3, 4, 6, 8}[serial]
+		case serial == 7:
+			size = 8
+		case serial == 8:
+			value = int64(0)
+		case serial == 9:
+			value = int64(1)
+		default:
+			size = int(serial-12) / 2
+		}
+		if size > len(body) {
+			return nil, fmt.Errorf("invalid sqlite record")
+		}
+
+		field := body[:size]
+		body = body[size:]
+		switch {
+		case serial >= 1 && serial <= 6:
+			var v int64
+			for _, b := range field {
+				v = v<<8 | int64(b)
+			}
+			// Sign-extend
+			shift := 64 - 8*uint(size)
+			value = v << shift >> shift
+		case serial >= 12 && serial%2 == 0:
+			value = field
+		case serial >= 13:
+			value = string(field)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// sqliteVarint decodes a SQLite varint and returns it with its length, or
+// a length of zero if the buffer is too short
+func sqliteVarint(b []byte) (int64, int) {
+	var v uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		if i == 8 {
+			v = v<<8 | uint64(b[i])
+			return int64(v), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return int64(v), i + 1
+		}
+	}
+	return int64(v), 9
+}
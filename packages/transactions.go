@@ -0,0 +1,350 @@
+package packages
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxLogTail is how much of the end of a package manager log is read
+const maxLogTail = 4 * 1024 * 1024
+
+// transactionGap separates transactions in logs that have no explicit
+// start and end markers
+const transactionGap = time.Minute
+
+// Transaction is a package manager run found in its log
+type Transaction struct {
+	Manager  string // apt, dpkg, dnf or yum
+	Start    time.Time
+	End      time.Time
+	Command  string          // e.g. "apt upgrade", if logged
+	Packages map[string]bool // names of the packages installed, upgraded or removed
+}
+
+// String describes the transaction for approval records
+func (t *Transaction) String() string {
+	desc := t.Manager
+	if t.Command != "" {
+		desc += " '" + t.Command + "'"
+	}
+	return fmt.Sprintf("%s at %s", desc, t.Start.Format(time.RFC3339))
+}
+
+// Touches reports whether the transaction installed, upgraded or removed a
+// package
+func (t *Transaction) Touches(pkg string) bool {
+	return t.Packages[pkg]
+}
+
+// RecentTransactions returns the transactions in the given logs that ended
+// at or after since. The log format is chosen by file name: apt's
+// history.log, dpkg.log, dnf.rpm.log and yum.log are understood.
+func RecentTransactions(logs []string, since time.Time) ([]*Transaction, error) {
+	var result []*Transaction
+	for _, path := range logs {
+		// Skip logs that were not written to since
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		if info.ModTime().Before(since) {
+			continue
+		}
+
+		data, err := readTail(path, maxLogTail)
+		if err != nil {
+			return nil, err
+		}
+
+		var txs []*Transaction
+		switch base := filepath.Base(path); {
+		case base == "history.log":
+			txs = parseAptHistory(data)
+		case base == "dpkg.log":
+			txs = parseDpkgLog(data)
+		case strings.HasPrefix(base, "dnf"):
+			txs = parseDnfLog(data)
+		case base == "yum.log":
+			txs = parseYumLog(data, info.ModTime())
+		default:
+			return nil, fmt.Errorf("unknown package manager log: %s", path)
+		}
+
+		for _, tx := range txs {
+			if !tx.End.Before(since) {
+				result = append(result, tx)
+			}
+		}
+	}
+	return result, nil
+}
+
+// readTail reads up to max bytes from the end of a file, dropping the first
+// partial line
+func readTail(path string, max int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	offset := info.Size() - max
+	if offset < 0 {
+		offset = 0
+	}
+	data, err := io.ReadAll(io.NewSectionReader(file, offset, info.Size()-offset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if offset > 0 {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	return data, nil
+}
+
+// lines returns a scanner over log lines
+func lines(data []byte) *bufio.Scanner {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return scanner
+}
+
+// packageName strips the architecture from a dpkg package name
+func packageName(name string) string {
+	name, _, _ = strings.Cut(name, ":")
+	return name
+}
+
+// parseAptHistory parses apt's history.log, whose stanzas run from a
+// Start-Date to an End-Date line and list packages like
+// "Upgrade: bash:amd64 (5.1-2, 5.2-1), libc6:amd64 (...)"
+func parseAptHistory(data []byte) []*Transaction {
+	var txs []*Transaction
+	var tx *Transaction
+
+	scanner := lines(data)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ": ")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Start-Date":
+			start, err := time.ParseInLocation("2006-01-02  15:04:05", value, time.Local)
+			if err != nil {
+				tx = nil
+				continue
+			}
+			tx = &Transaction{Manager: "apt", Start: start, End: start, Packages: make(map[string]bool)}
+		case "Commandline":
+			if tx != nil {
+				tx.Command = value
+			}
+		case "Install", "Upgrade", "Downgrade", "Reinstall", "Remove", "Purge":
+			if tx == nil {
+				continue
+			}
+			// Drop the parenthesised versions, which contain commas
+			depth := 0
+			name := strings.Builder{}
+			for _, r := range value + "," {
+				switch {
+				case r == '(':
+					depth++
+				case r == ')':
+					depth--
+				case r == ',' && depth == 0:
+					if n := strings.TrimSpace(name.String()); n != "" {
+						tx.Packages[packageName(n)] = true
+					}
+					name.Reset()
+				case depth == 0:
+					name.WriteRune(r)
+				}
+			}
+		case "End-Date":
+			if tx == nil {
+				continue
+			}
+			if end, err := time.ParseInLocation("2006-01-02  15:04:05", value, time.Local); err == nil {
+				tx.End = end
+			}
+			txs = append(txs, tx)
+			tx = nil
+		}
+	}
+
+	// A stanza without an End-Date is still running
+	if tx != nil {
+		tx.End = time.Now()
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+// parseDpkgLog parses dpkg.log, where each dpkg run starts with a
+// "startup" line followed by actions such as
+// "2024-01-15 10:23:45 upgrade bash:amd64 5.1-2 5.2-1"
+func parseDpkgLog(data []byte) []*Transaction {
+	var txs []*Transaction
+	var tx *Transaction
+
+	scanner := lines(data)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		when, err := time.ParseInLocation("2006-01-02 15:04:05", fields[0]+" "+fields[1], time.Local)
+		if err != nil {
+			continue
+		}
+
+		if fields[2] == "startup" || tx == nil {
+			tx = &Transaction{Manager: "dpkg", Start: when, Packages: make(map[string]bool)}
+			txs = append(txs, tx)
+		}
+		tx.End = when
+		switch fields[2] {
+		case "install", "upgrade", "remove", "purge":
+			if len(fields) >= 4 {
+				tx.Packages[packageName(fields[3])] = true
+			}
+		}
+	}
+	return txs
+}
+
+// parseDnfLog parses dnf.rpm.log, whose lines look like
+// "2024-01-15T10:23:45+0000 SUBDEBUG Upgrade: bash-5.1.8-6.el9.x86_64".
+// Lines closer together than transactionGap form one transaction.
+func parseDnfLog(data []byte) []*Transaction {
+	var txs []*Transaction
+	var tx *Transaction
+
+	scanner := lines(data)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		when, err := time.Parse("2006-01-02T15:04:05-0700", fields[0])
+		if err != nil {
+			if when, err = time.Parse(time.RFC3339, fields[0]); err != nil {
+				continue
+			}
+		}
+		action := strings.TrimSuffix(fields[2], ":")
+		switch action {
+		case "Install", "Installed", "Upgrade", "Upgraded", "Downgrade", "Downgraded",
+			"Reinstall", "Reinstalled", "Erase", "Obsolete", "Obsoleted", "Cleanup":
+		default:
+			continue
+		}
+
+		if tx == nil || when.Sub(tx.End) > transactionGap {
+			tx = &Transaction{Manager: "dnf", Start: when, Packages: make(map[string]bool)}
+			txs = append(txs, tx)
+		}
+		tx.End = when
+		tx.Packages[nevraName(fields[3])] = true
+	}
+	return txs
+}
+
+// parseYumLog parses yum.log, whose lines look like
+// "Jan 15 10:23:45 Updated: bash-4.2.46-34.el7.x86_64" and carry no year.
+// The year is taken from the log's modification time.
+func parseYumLog(data []byte, modTime time.Time) []*Transaction {
+	var txs []*Transaction
+	var tx *Transaction
+
+	scanner := lines(data)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < 16 {
+			continue
+		}
+		when, err := time.ParseInLocation("2006 Jan _2 15:04:05",
+			fmt.Sprintf("%d %s", modTime.Year(), line[:15]), time.Local)
+		if err != nil {
+			continue
+		}
+		// Entries after the modification time are from the year before
+		if when.After(modTime.Add(time.Hour)) {
+			when = when.AddDate(-1, 0, 0)
+		}
+
+		fields := strings.Fields(line[15:])
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "Installed:", "Updated:", "Erased:":
+		default:
+			continue
+		}
+
+		if tx == nil || when.Sub(tx.End) > transactionGap {
+			tx = &Transaction{Manager: "yum", Start: when, Packages: make(map[string]bool)}
+			txs = append(txs, tx)
+		}
+		tx.End = when
+		tx.Packages[nevraName(fields[1])] = true
+	}
+	return txs
+}
+
+// nevraName returns the package name of a name-[epoch:]version-release.arch
+// string
+func nevraName(nevra string) string {
+	// Drop the architecture, then the release and the version
+	if i := strings.LastIndexByte(nevra, '.'); i > 0 {
+		nevra = nevra[:i]
+	}
+	for n := 0; n < 2; n++ {
+		if i := strings.LastIndexByte(nevra, '-'); i > 0 {
+			nevra = nevra[:i]
+		}
+	}
+	// An epoch may precede the name in yum.log
+	if i := strings.IndexByte(nevra, ':'); i >= 0 {
+		nevra = nevra[i+1:]
+	}
+	return nevra
+}
+
+// LockHeld returns the first of the given lock files that a process holds a
+// lock on, meaning a package manager transaction is in progress
+func LockHeld(locks []string) (string, bool) {
+	for _, path := range locks {
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		lock := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: 0, Start: 0, Len: 0}
+		err = syscall.FcntlFlock(file.Fd(), syscall.F_GETLK, &lock)
+		file.Close()
+		if err == nil && lock.Type != syscall.F_UNLCK {
+			return path, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,80 @@
+package packages
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// Result is the verification result of one packaged file
+type Result struct {
+	Path   string                `json:"path"` // location on disk
+	Status monitor.PackageStatus `json:"status"`
+	File   *File                 `json:"packaged"`
+}
+
+// VerifyAll checks every packaged file with a digest below one of roots
+// against the file on disk. Paths for which exclude returns true are
+// skipped. Results are sorted by path.
+func (v *Verifier) VerifyAll(roots []string, exclude func(string) bool) ([]*Result, error) {
+	seen := make(map[string]bool)
+	var results []*Result
+
+	for _, db := range v.dbs {
+		files, err := db.Files()
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.Digest == "" {
+				continue
+			}
+
+			// On merged-/usr systems the file may be monitored under
+			// an alias of its packaged path
+			path := ""
+			for _, alias := range aliases(file.Path) {
+				if under(alias, roots) {
+					path = alias
+					break
+				}
+			}
+			if path == "" || seen[path] || (exclude != nil && exclude(path)) {
+				continue
+			}
+			seen[path] = true
+
+			results = append(results, &Result{Path: path, File: file, Status: verifyFile(file, path)})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Path < results[j].Path
+	})
+	return results, nil
+}
+
+// verifyFile compares a packaged file with the file on disk
+func verifyFile(file *File, path string) monitor.PackageStatus {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return monitor.PackageMissing
+	}
+	if err != nil || !info.Mode().IsRegular() {
+		return monitor.PackageUnverified
+	}
+	return compare(file, path, "")
+}
+
+// under reports whether path is one of roots or below one of them
+func under(path string, roots []string) bool {
+	for _, root := range roots {
+		root = strings.TrimRight(root, "/")
+		if path == root || strings.HasPrefix(path, root+"/") || root == "" {
+			return true
+		}
+	}
+	return false
+}
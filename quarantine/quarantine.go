@@ -0,0 +1,309 @@
+package quarantine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// Item records a quarantined file and where it came from
+type Item struct {
+	ID            string             `json:"id"`
+	Path          string             `json:"path"` // original location
+	QuarantinedAt time.Time          `json:"quarantined_at"`
+	ReleasedAt    *time.Time         `json:"released_at,omitempty"`
+	Host          string             `json:"host"`
+	ScanID        string             `json:"scan_id,omitempty"`
+	Change        monitor.ChangeType `json:"change"`
+	Severity      monitor.Severity   `json:"severity,omitempty"`
+	Info          *monitor.FileInfo  `json:"info"` // attributes before quarantine
+}
+
+// Released reports whether the item has been released
+func (i *Item) Released() bool {
+	return i.ReleasedAt != nil
+}
+
+// Quarantine is a locked-down directory holding quarantined files. Each
+// item is kept in its own subdirectory with the file and its metadata.
+type Quarantine struct {
+	dir string
+}
+
+// GetDefaultDir returns the default quarantine directory
+func GetDefaultDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "fim-quarantine"
+	}
+	return filepath.Join(homeDir, ".fim", "quarantine")
+}
+
+// Open opens the quarantine directory, creating it if necessary
+func Open(dir string) (*Quarantine, error) {
+	if dir == "" {
+		dir = GetDefaultDir()
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create quarantine directory: %v", err)
+	}
+	// Tighten permissions in case the directory already existed
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to lock quarantine directory: %v", err)
+	}
+	return &Quarantine{dir: dir}, nil
+}
+
+// Dir returns the quarantine directory
+func (q *Quarantine) Dir() string {
+	return q.dir
+}
+
+// filePath returns where the content of an item is kept
+func (q *Quarantine) filePath(id string) string {
+	return filepath.Join(q.dir, id, "file")
+}
+
+// Add moves a file into quarantine, strips its exec, setuid and setgid bits
+// and records its provenance
+func (q *Quarantine) Add(scanID, host string, change *monitor.Change) (*Item, error) {
+	// Record the file as it is now, which may differ from what the scan saw
+	info, err := monitor.GetFileInfo(change.Path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir || info.IsSymlink {
+		return nil, fmt.Errorf("%s is not a regular file", change.Path)
+	}
+
+	item := &Item{
+		Path:          change.Path,
+		QuarantinedAt: time.Now().UTC(),
+		Host:          host,
+		ScanID:        scanID,
+		Change:        change.Type,
+		Severity:      change.Severity,
+		Info:          info,
+	}
+
+	// Allocate a unique item directory
+	base := item.QuarantinedAt.Format("20060102-150405") + "-" + info.Hash[:8]
+	item.ID = base
+	for n := 2; ; n++ {
+		err := os.Mkdir(filepath.Join(q.dir, item.ID), 0700)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create quarantine item: %v", err)
+		}
+		item.ID = fmt.Sprintf("%s-%d", base, n)
+	}
+
+	// Record the item before moving the file, so that no item directory is
+	// left without metadata; any later failure undoes the move
+	itemDir := filepath.Join(q.dir, item.ID)
+	if err := q.save(item); err != nil {
+		os.RemoveAll(itemDir)
+		return nil, err
+	}
+
+	// Move the file and make sure it cannot be executed from quarantine
+	dest := q.filePath(item.ID)
+	if err := move(change.Path, dest); err != nil {
+		os.RemoveAll(itemDir)
+		return nil, err
+	}
+	if err := os.Chmod(dest, 0400); err != nil {
+		if moveErr := move(dest, change.Path); moveErr != nil {
+			return nil, fmt.Errorf("failed to strip permissions of quarantined file: %v; it was left in %s", err, dest)
+		}
+		os.RemoveAll(itemDir)
+		return nil, fmt.Errorf("failed to strip permissions of quarantined file: %v", err)
+	}
+	return item, nil
+}
+
+// save writes the metadata of an item
+func (q *Quarantine) save(item *Item) error {
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal quarantine item: %v", err)
+	}
+	path := filepath.Join(q.dir, item.ID, "item.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write quarantine item: %v", err)
+	}
+	return nil
+}
+
+// Get loads the item with the given ID
+func (q *Quarantine) Get(id string) (*Item, error) {
+	if id == "" || id != filepath.Base(id) || id[0] == '.' {
+		return nil, fmt.Errorf("invalid quarantine ID: %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(q.dir, id, "item.json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no quarantined file with ID %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quarantine item: %v", err)
+	}
+
+	var item Item
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, fmt.Errorf("failed to parse quarantine item %s: %v", id, err)
+	}
+	return &item, nil
+}
+
+// List returns all items, oldest first, including released ones. Items
+// that cannot be read are skipped with a warning on stderr.
+func (q *Quarantine) List() ([]*Item, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quarantine directory: %v", err)
+	}
+
+	var items []*Item
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		item, err := q.Get(entry.Name())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fim: skipping quarantine item: %v\n", err)
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].QuarantinedAt.Before(items[j].QuarantinedAt)
+	})
+	return items, nil
+}
+
+// Released reports whether a file with this path and hash was released
+// from quarantine, so that it is not quarantined again
+func (q *Quarantine) Released(path, hash string) bool {
+	items, err := q.List()
+	if err != nil {
+		return false
+	}
+	for _, item := range items {
+		if item.Released() && item.Path == path && item.Info.Hash == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// Release moves a quarantined file back to its original location with its
+// original mode, owner and modification time. An existing file at that
+// location is only replaced if force is set. The item is kept as a record
+// of the release.
+func (q *Quarantine) Release(id string, force bool) (*Item, error) {
+	item, err := q.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if item.Released() {
+		return nil, fmt.Errorf("%s was already released", id)
+	}
+	if _, err := os.Lstat(item.Path); err == nil && !force {
+		return nil, fmt.Errorf("%s already exists; use --force to replace it", item.Path)
+	}
+
+	// Prepare the file with its original attributes before moving it
+	// into place. Ownership first, as chown clears the setuid bit.
+	src := q.filePath(id)
+	info := item.Info
+	if info.UID >= 0 && info.GID >= 0 {
+		if err := os.Lchown(src, info.UID, info.GID); err != nil {
+			return nil, fmt.Errorf("failed to restore owner: %v", err)
+		}
+	}
+	mode := os.FileMode(info.Mode) & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	if err := os.Chmod(src, mode); err != nil {
+		return nil, fmt.Errorf("failed to restore mode: %v", err)
+	}
+	modTime := time.Unix(info.ModTime, 0)
+	if err := os.Chtimes(src, modTime, modTime); err != nil {
+		return nil, fmt.Errorf("failed to restore modification time: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(item.Path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %v", err)
+	}
+	if err := move(src, item.Path); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	item.ReleasedAt = &now
+	if err := q.save(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Purge permanently deletes an item and its quarantined file
+func (q *Quarantine) Purge(id string) error {
+	if _, err := q.Get(id); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(q.dir, id)); err != nil {
+		return fmt.Errorf("failed to purge %s: %v", id, err)
+	}
+	return nil
+}
+
+// move renames a file, copying it when source and destination are on
+// different file systems
+func move(src, dest string) error {
+	err := os.Rename(src, dest)
+	if err == nil {
+		return nil
+	}
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) || linkErr.Err != syscall.EXDEV {
+		return fmt.Errorf("failed to move %s: %v", src, err)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to move %s: %v", src, err)
+	}
+	defer in.Close()
+	stat, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to move %s: %v", src, err)
+	}
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, stat.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to move %s: %v", src, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return fmt.Errorf("failed to move %s: %v", src, err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dest)
+		return fmt.Errorf("failed to move %s: %v", src, err)
+	}
+	if err := os.Remove(src); err != nil {
+		os.Remove(dest)
+		return fmt.Errorf("failed to move %s: %v", src, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package quarantine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+func TestAddAndRelease(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(filepath.Join(dir, "quarantine"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	path := filepath.Join(dir, "dropper")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := q.Add("scan-1", "host", &monitor.Change{Path: path, Type: monitor.NewFile})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("file is still at its original location")
+	}
+	info, err := os.Stat(q.filePath(item.ID))
+	if err != nil {
+		t.Fatalf("quarantined file is missing: %v", err)
+	}
+	if info.Mode().Perm() != 0400 {
+		t.Errorf("quarantined file has mode %04o, want 0400", info.Mode().Perm())
+	}
+
+	if _, err := q.Release(item.ID, false); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	info, err = os.Stat(path)
+	if err != nil {
+		t.Fatalf("released file is missing: %v", err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("released file has mode %04o, want 0755", info.Mode().Perm())
+	}
+	if !q.Released(path, item.Info.Hash) {
+		t.Error("release was not recorded")
+	}
+}
+
+func TestListSkipsUnreadableItems(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(path, []byte("x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Add("scan-1", "host", &monitor.Change{Path: path, Type: monitor.NewFile}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	// An item left without metadata, and one with corrupt metadata
+	if err := os.Mkdir(filepath.Join(dir, "20240101-000000-deadbeef"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := filepath.Join(dir, "20240101-000000-cafebabe")
+	if err := os.Mkdir(corrupt, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(corrupt, "item.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := q.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(items) != 1 || items[0].Path != path {
+		t.Errorf("List returned %d items, want only the readable one", len(items))
+	}
+}
+
+func TestAddRefusesDirectories(t *testing.T) {
+	q, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := q.Add("scan-1", "host", &monitor.Change{Path: t.TempDir(), Type: monitor.NewFile}); err == nil {
+		t.Error("Add quarantined a directory")
+	}
+	items, _ := q.List()
+	if len(items) != 0 {
+		t.Errorf("a refused file left %d items", len(items))
+	}
+}
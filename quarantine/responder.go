@@ -0,0 +1,114 @@
+package quarantine
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/logging"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// Responder quarantines files matching the [quarantine] configuration as
+// changes are detected
+type Responder struct {
+	dir         string
+	paths       []string
+	changes     []string
+	executables bool
+	logger      *logging.Logger
+	host        string
+}
+
+// NewResponder creates a responder from cfg. Results are written to logger.
+func NewResponder(cfg *config.Config, logger *logging.Logger) *Responder {
+	host, _ := os.Hostname()
+	return &Responder{
+		dir:         cfg.Quarantine.Dir,
+		paths:       cfg.Quarantine.Paths,
+		changes:     cfg.Quarantine.Changes,
+		executables: cfg.Quarantine.Executables,
+		logger:      logger,
+		host:        host,
+	}
+}
+
+// Enabled reports whether any quarantine paths are configured
+func (r *Responder) Enabled() bool {
+	return len(r.paths) > 0
+}
+
+// Matches reports whether a change should be quarantined
+func (r *Responder) Matches(change *monitor.Change) bool {
+	info := change.NewInfo
+	if info == nil || info.IsDir || info.IsSymlink {
+		return false
+	}
+	// Files read elsewhere than at their path, such as in a container,
+	// are not the file at that path on this host
+	if info.Source != "" || info.Archived {
+		return false
+	}
+	if !config.MatchAny(r.paths, change.Path) {
+		return false
+	}
+	if r.executables && info.UnixPerm()&0o111 == 0 {
+		return false
+	}
+	for _, t := range r.changes {
+		if t == change.Type.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// Run quarantines every matching change and returns the new items. Files
+// that were released from quarantine before are left alone.
+func (r *Responder) Run(scanID string, changes []*monitor.Change) []*Item {
+	var matched []*monitor.Change
+	for _, change := range changes {
+		if r.Matches(change) {
+			matched = append(matched, change)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	q, err := Open(r.dir)
+	if err != nil {
+		r.logger.Error(logging.EventQuarantineFailed, scanID, "Failed to open quarantine", err)
+		return nil
+	}
+
+	var items []*Item
+	for _, change := range matched {
+		if q.Released(change.Path, change.NewInfo.Hash) {
+			continue
+		}
+
+		item, err := q.Add(scanID, r.host, change)
+		if err != nil {
+			event := logging.NewEvent(logging.EventQuarantineFailed, logging.LevelError,
+				fmt.Sprintf("Failed to quarantine %s", change.Path))
+			event.ScanID = scanID
+			event.Change = change
+			event.Error = err.Error()
+			r.logger.Log(event)
+			continue
+		}
+
+		event := logging.NewEvent(logging.EventFileQuarantined, logging.LevelWarning,
+			fmt.Sprintf("Quarantined %s as %s", change.Path, item.ID))
+		event.ScanID = scanID
+		event.Change = change
+		event.Fields = map[string]interface{}{
+			"quarantine_id": item.ID,
+			"location":      q.filePath(item.ID),
+		}
+		r.logger.Log(event)
+		items = append(items, item)
+	}
+	return items
+}
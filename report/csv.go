@@ -0,0 +1,68 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// csvHeader lists the CSV columns; old_* columns describe the baseline and
+// new_* columns the current state
+var csvHeader = []string{
+	"scan_id", "change", "severity", "kinds", "path",
+	"old_size", "new_size", "old_mode", "new_mode",
+	"old_uid", "new_uid", "old_gid", "new_gid",
+	"old_mtime", "new_mtime", "old_sha256", "new_sha256",
+}
+
+// CSVReporter renders one row per change for spreadsheets
+type CSVReporter struct{}
+
+// Write implements Reporter
+func (CSVReporter) Write(w io.Writer, r *Report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, change := range r.Changes.Details {
+		row := []string{
+			r.ScanID,
+			change.Type.String(),
+			change.Severity.String(),
+			strings.Join(change.Kinds, ";"),
+			change.Path,
+		}
+		old, cur := csvFields(change.OldInfo), csvFields(change.NewInfo)
+		for i := range old {
+			row = append(row, old[i], cur[i])
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvFields returns size, mode, uid, gid, mtime and hash of a file, or
+// empty values if the file does not exist on that side
+func csvFields(info *monitor.FileInfo) []string {
+	if info == nil {
+		return make([]string, 6)
+	}
+	return []string{
+		strconv.FormatInt(info.Size, 10),
+		fmt.Sprintf("%04o", info.UnixPerm()),
+		strconv.Itoa(info.UID),
+		strconv.Itoa(info.GID),
+		time.Unix(info.ModTime, 0).UTC().Format(time.RFC3339),
+		info.Hash,
+	}
+}
@@ -0,0 +1,23 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCSVReporter(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (CSVReporter{}).Write(&buf, sampleReport()); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	// Paths with commas and quotes are quoted, and absent sides are empty
+	want := `scan_id,change,severity,kinds,path,old_size,new_size,old_mode,new_mode,old_uid,new_uid,old_gid,new_gid,old_mtime,new_mtime,old_sha256,new_sha256
+scan-1,added,high,added;executable,"/etc/<script>alert(""x"")</script>&amp;.conf",,3,,0755,,0,,0,,2023-11-14T22:13:20Z,,cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc
+scan-1,modified,medium,content;permission,/etc/hosts,9,12,0644,0600,0,0,0,0,2023-11-14T22:13:20Z,2023-11-14T22:14:20Z,aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa,bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb
+scan-1,deleted,low,deleted,"/etc/old, ""quoted""",1,,0644,,0,,0,,2023-11-14T22:13:20Z,,dddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddd,
+`
+	if got := buf.String(); got != want {
+		t.Errorf("CSV output:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,194 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// htmlFuncs are the helpers available to the HTML template
+var htmlFuncs = template.FuncMap{
+	"diffs": Diffs,
+	"rules": monitor.RuleNames,
+	"mode": func(info *monitor.FileInfo) string {
+		if info == nil {
+			return ""
+		}
+		return fmt.Sprintf("%04o", info.UnixPerm())
+	},
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format("2006-01-02 15:04:05 MST")
+	},
+	"mtime": func(info *monitor.FileInfo) string {
+		if info == nil {
+			return ""
+		}
+		return time.Unix(info.ModTime, 0).UTC().Format(time.RFC3339)
+	},
+	"ofType": func(changes []*monitor.Change, types ...monitor.ChangeType) []*monitor.Change {
+		matched := make([]*monitor.Change, 0)
+		for _, c := range changes {
+			for _, t := range types {
+				if c.Type == t {
+					matched = append(matched, c)
+					break
+				}
+			}
+		}
+		return matched
+	},
+	"rank":     func(s monitor.Severity) int { return int(s) },
+	"added":    func() monitor.ChangeType { return monitor.NewFile },
+	"modified": func() monitor.ChangeType { return monitor.ModifiedFile },
+	"perm":     func() monitor.ChangeType { return monitor.PermissionChange },
+	"deleted":  func() monitor.ChangeType { return monitor.DeletedFile },
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(htmlFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - {{.Host.Hostname}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { margin-bottom: 0.2em; }
+h2 { margin-top: 1.8em; border-bottom: 1px solid #ddd; padding-bottom: 0.2em; }
+.meta { color: #666; }
+.summary { display: flex; gap: 1em; margin: 1.5em 0; }
+.card { border: 1px solid #ddd; border-radius: 6px; padding: 0.8em 1.4em; min-width: 7em; }
+.card .n { font-size: 2em; font-weight: bold; }
+.added .n { color: #1a7f37; } .modified .n { color: #9a6700; } .deleted .n { color: #cf222e; }
+table { border-collapse: collapse; width: 100%; font-size: 0.9em; }
+th, td { border: 1px solid #ddd; padding: 0.35em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; cursor: pointer; user-select: none; }
+th.asc::after { content: " \25B2"; } th.desc::after { content: " \25BC"; }
+td.path, td.hash { font-family: ui-monospace, Menlo, Consolas, monospace; word-break: break-all; }
+.sev-critical { color: #fff; background: #a40e26; } .sev-high { color: #fff; background: #cf222e; }
+.sev-medium { background: #fff8c5; } .sev-low, .sev-info { color: #666; }
+.diff { margin: 0; padding: 0; list-style: none; }
+.old { color: #cf222e; text-decoration: line-through; } .new { color: #1a7f37; }
+.ioc { color: #a40e26; font-weight: bold; } .rules { color: #cf222e; }
+.udiff { margin: 0.5em 0 0; padding: 0.5em; background: #f6f8fa; font-size: 0.9em; overflow-x: auto; }
+dl { display: grid; grid-template-columns: max-content auto; gap: 0.2em 1.2em; }
+dt { font-weight: bold; } dd { margin: 0; }
+.none { color: #666; font-style: italic; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="meta">Generated {{time .GeneratedAt}} on {{.Host.Hostname}}</div>
+
+<div class="summary">
+<div class="card added"><div class="n">{{len .Changes.Added}}</div>added</div>
+<div class="card modified"><div class="n">{{len .Changes.Modified}}</div>modified</div>
+<div class="card deleted"><div class="n">{{len .Changes.Deleted}}</div>deleted</div>
+<div class="card"><div class="n">{{.Current.Files}}</div>files scanned</div>
+</div>
+
+<h2>Added files</h2>
+{{with ofType .Changes.Details added}}
+<table class="sortable">
+<thead><tr><th>Severity</th><th>Path</th><th>Size</th><th>Mode</th><th>Owner</th><th>Modified</th><th>SHA-256</th></tr></thead>
+<tbody>
+{{range .}}<tr>
+<td class="sev-{{.Severity}}" data-sort="{{rank .Severity}}">{{.Severity}}</td>
+<td class="path">{{.Path}}{{with .IOC}}<div class="ioc">known-bad: {{.}}</div>{{end}}{{with .Rules}}<div class="rules">rules: {{rules .}}</div>{{end}}</td>
+<td>{{.NewInfo.Size}}</td>
+<td>{{mode .NewInfo}}</td>
+<td>{{.NewInfo.UID}}:{{.NewInfo.GID}}</td>
+<td>{{mtime .NewInfo}}</td>
+<td class="hash">{{.NewInfo.Hash}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+{{else}}<p class="none">No files were added.</p>{{end}}
+
+<h2>Modified files</h2>
+{{with ofType .Changes.Details modified perm}}
+<table class="sortable">
+<thead><tr><th>Severity</th><th>Path</th><th>Change</th><th>Attribute differences</th></tr></thead>
+<tbody>
+{{range .}}<tr>
+<td class="sev-{{.Severity}}" data-sort="{{rank .Severity}}">{{.Severity}}</td>
+<td class="path">{{.Path}}{{with .IOC}}<div class="ioc">known-bad: {{.}}</div>{{end}}{{with .Rules}}<div class="rules">rules: {{rules .}}</div>{{end}}</td>
+<td>{{.Type}}</td>
+<td><ul class="diff">{{range diffs .}}<li><b>{{.Name}}</b>: <span class="old">{{.Old}}</span> &rarr; <span class="new">{{.New}}</span></li>{{end}}</ul>{{with .Diff}}<pre class="udiff">{{.}}</pre>{{end}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+{{else}}<p class="none">No files were modified.</p>{{end}}
+
+<h2>Deleted files</h2>
+{{with ofType .Changes.Details deleted}}
+<table class="sortable">
+<thead><tr><th>Severity</th><th>Path</th><th>Size</th><th>Mode</th><th>Owner</th><th>Modified</th><th>SHA-256</th></tr></thead>
+<tbody>
+{{range .}}<tr>
+<td class="sev-{{.Severity}}" data-sort="{{rank .Severity}}">{{.Severity}}</td>
+<td class="path">{{.Path}}</td>
+<td>{{.OldInfo.Size}}</td>
+<td>{{mode .OldInfo}}</td>
+<td>{{.OldInfo.UID}}:{{.OldInfo.GID}}</td>
+<td>{{mtime .OldInfo}}</td>
+<td class="hash">{{.OldInfo.Hash}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+{{else}}<p class="none">No files were deleted.</p>{{end}}
+
+<h2>Baseline</h2>
+<dl>
+<dt>Baseline</dt><dd>{{.Baseline.Source}}</dd>
+<dt>Created</dt><dd>{{time .Baseline.CreatedAt}}</dd>
+<dt>Updated</dt><dd>{{time .Baseline.UpdatedAt}}</dd>
+<dt>Files</dt><dd>{{.Baseline.Files}}</dd>
+<dt>Root digest</dt><dd>{{.Baseline.Digest}}</dd>
+<dt>Compared with</dt><dd>{{.Current.Source}}</dd>
+<dt>Captured</dt><dd>{{time .Current.CreatedAt}}</dd>
+<dt>Files</dt><dd>{{.Current.Files}}</dd>
+<dt>Root digest</dt><dd>{{.Current.Digest}}</dd>
+</dl>
+
+<h2>Host</h2>
+<dl>
+<dt>Hostname</dt><dd>{{.Host.Hostname}}</dd>
+<dt>Operating system</dt><dd>{{.Host.OS}}/{{.Host.Arch}}</dd>
+{{with .Host.Kernel}}<dt>Kernel</dt><dd>{{.}}</dd>{{end}}
+{{with .Host.User}}<dt>User</dt><dd>{{.}}</dd>{{end}}
+</dl>
+
+<script>
+document.querySelectorAll("table.sortable").forEach(function (table) {
+  table.querySelectorAll("th").forEach(function (th, col) {
+    th.addEventListener("click", function () {
+      var asc = !th.classList.contains("asc");
+      table.querySelectorAll("th").forEach(function (h) { h.classList.remove("asc", "desc"); });
+      th.classList.add(asc ? "asc" : "desc");
+      var body = table.tBodies[0];
+      var rows = Array.prototype.slice.call(body.rows);
+      rows.sort(function (a, b) {
+        var x = a.cells[col].dataset.sort || a.cells[col].textContent.trim();
+        var y = b.cells[col].dataset.sort || b.cells[col].textContent.trim();
+        var nx = parseFloat(x), ny = parseFloat(y);
+        var cmp = (!isNaN(nx) && !isNaN(ny) && String(nx) === x && String(ny) === y) ? nx - ny : x.localeCompare(y);
+        return asc ? cmp : -cmp;
+      });
+      rows.forEach(function (r) { body.appendChild(r); });
+    });
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// WriteHTML renders the report as a self-contained HTML document
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, r)
+}
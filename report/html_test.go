@@ -0,0 +1,91 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+)
+
+// hostile is a path that breaks out of the markup unless it is escaped
+const hostile = `/etc/<script>alert("x")</script>&amp;.conf`
+
+// sampleReport returns a report of an added, a modified and a deleted file
+func sampleReport() *Report {
+	old := &monitor.FileInfo{Path: "/etc/hosts", Size: 9, Mode: 0644, Hash: strings.Repeat("a", 64), ModTime: 1700000000}
+	cur := &monitor.FileInfo{Path: "/etc/hosts", Size: 12, Mode: 0600, Hash: strings.Repeat("b", 64), ModTime: 1700000060}
+	added := &monitor.FileInfo{Path: hostile, Size: 3, Mode: 0755, Hash: strings.Repeat("c", 64), ModTime: 1700000000}
+	gone := &monitor.FileInfo{Path: "/etc/old, \"quoted\"", Size: 1, Mode: 0644, Hash: strings.Repeat("d", 64), ModTime: 1700000000}
+
+	changes := &storage.Changes{}
+	changes.Add(&monitor.Change{Path: hostile, Type: monitor.NewFile, NewInfo: added,
+		Severity: monitor.SeverityHigh, Kinds: []string{"added", "executable"}})
+	changes.Add(&monitor.Change{Path: "/etc/hosts", Type: monitor.ModifiedFile, OldInfo: old, NewInfo: cur,
+		Severity: monitor.SeverityMedium, Kinds: []string{"content", "permission"}})
+	changes.Add(&monitor.Change{Path: gone.Path, Type: monitor.DeletedFile, OldInfo: gone, Severity: monitor.SeverityLow,
+		Kinds: []string{"deleted"}})
+	return &Report{
+		Title:       "File Integrity Report",
+		ScanID:      "scan-1",
+		GeneratedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Host:        HostInfo{Hostname: "web-1", OS: "linux", Arch: "amd64"},
+		Baseline:    BaselineInfo{Source: "/var/lib/fim/baseline.json", Files: 3},
+		Current:     BaselineInfo{Source: "live filesystem", Files: 3},
+		Changes:     changes,
+	}
+}
+
+func TestWriteHTMLEscapesPaths(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sampleReport().WriteHTML(&buf); err != nil {
+		t.Fatalf("WriteHTML: %v", err)
+	}
+	if strings.Contains(buf.String(), "<script>alert") {
+		t.Fatal("path written unescaped")
+	}
+
+	// The document parses, and the cells hold the paths as they are
+	d := xml.NewDecoder(&buf)
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	var paths []string
+	var inPath bool
+	var text strings.Builder
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("report does not parse: %v", err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			for _, attr := range token.Attr {
+				if token.Name.Local == "td" && attr.Name.Local == "class" && attr.Value == "path" {
+					inPath = true
+					text.Reset()
+				}
+			}
+		case xml.CharData:
+			if inPath {
+				text.Write(token)
+			}
+		case xml.EndElement:
+			if inPath && token.Name.Local == "td" {
+				paths = append(paths, text.String())
+				inPath = false
+			}
+		}
+	}
+	want := []string{hostile, "/etc/hosts", "/etc/old, \"quoted\""}
+	if strings.Join(paths, "\n") != strings.Join(want, "\n") {
+		t.Errorf("path cells %q, want %q", paths, want)
+	}
+}
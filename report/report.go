@@ -0,0 +1,118 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+)
+
+// Report holds everything rendered into a scan report
+type Report struct {
+	Title       string
+	ScanID      string
+	GeneratedAt time.Time
+	Host        HostInfo
+	Baseline    BaselineInfo
+	Current     BaselineInfo
+	Changes     *storage.Changes
+}
+
+// HostInfo describes the host the report was generated on
+type HostInfo struct {
+	Hostname string
+	OS       string
+	Arch     string
+	Kernel   string
+	User     string
+}
+
+// BaselineInfo describes one side of the comparison
+type BaselineInfo struct {
+	Source    string // file path, or "live filesystem"
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Files     int
+	Digest    string // root digest of all entries
+}
+
+// AttributeDiff is a single attribute that differs between the baseline
+// and the current state of a file
+type AttributeDiff struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// New creates a report comparing baseline with current
+func New(baseline *storage.Baseline, baselineSource string, current *storage.Baseline, currentSource string, changes *storage.Changes) *Report {
+	return &Report{
+		Title:       "File Integrity Report",
+		GeneratedAt: time.Now(),
+		Host:        CollectHostInfo(),
+		Baseline:    describe(baseline, baselineSource),
+		Current:     describe(current, currentSource),
+		Changes:     changes,
+	}
+}
+
+// describe summarises a baseline
+func describe(b *storage.Baseline, source string) BaselineInfo {
+	return BaselineInfo{
+		Source:    source,
+		CreatedAt: b.CreatedAt,
+		UpdatedAt: b.UpdatedAt,
+		Files:     len(b.Files),
+		Digest:    b.RootDigest(),
+	}
+}
+
+// CollectHostInfo gathers information about the local host
+func CollectHostInfo() HostInfo {
+	info := HostInfo{
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+	}
+	info.Hostname, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		info.User = u.Username
+	}
+	if release, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		info.Kernel = strings.TrimSpace(string(release))
+	}
+	return info
+}
+
+// Diffs returns the attributes that differ between the old and new state
+// of a modified file
+func Diffs(change *monitor.Change) []AttributeDiff {
+	old, cur := change.OldInfo, change.NewInfo
+	if old == nil || cur == nil {
+		return nil
+	}
+
+	diffs := make([]AttributeDiff, 0, 5)
+	if old.Hash != cur.Hash {
+		diffs = append(diffs, AttributeDiff{"sha256", old.Hash, cur.Hash})
+	}
+	if old.Size != cur.Size {
+		diffs = append(diffs, AttributeDiff{"size", fmt.Sprint(old.Size), fmt.Sprint(cur.Size)})
+	}
+	if old.Mode != cur.Mode {
+		diffs = append(diffs, AttributeDiff{"mode", fmt.Sprintf("%04o", old.UnixPerm()), fmt.Sprintf("%04o", cur.UnixPerm())})
+	}
+	if old.UID != cur.UID || old.GID != cur.GID {
+		diffs = append(diffs, AttributeDiff{"owner",
+			fmt.Sprintf("%d:%d", old.UID, old.GID), fmt.Sprintf("%d:%d", cur.UID, cur.GID)})
+	}
+	if old.ModTime != cur.ModTime {
+		diffs = append(diffs, AttributeDiff{"mtime",
+			time.Unix(old.ModTime, 0).UTC().Format(time.RFC3339), time.Unix(cur.ModTime, 0).UTC().Format(time.RFC3339)})
+	}
+	return diffs
+}
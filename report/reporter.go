@@ -0,0 +1,175 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/logging"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// Reporter renders a report in one output format
+type Reporter interface {
+	Write(w io.Writer, r *Report) error
+}
+
+// reporters maps format names to their reporters
+var reporters = map[string]Reporter{
+	"text":  TextReporter{},
+	"json":  JSONReporter{},
+	"cef":   SIEMReporter{Encode: logging.EncodeCEF},
+	"leef":  SIEMReporter{Encode: logging.EncodeLEEF},
+	"csv":   CSVReporter{},
+	"sarif": SARIFReporter{},
+	"html":  HTMLReporter{},
+}
+
+// NewReporter returns the reporter for a format name
+func NewReporter(format string) (Reporter, error) {
+	reporter, ok := reporters[strings.ToLower(format)]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q: expected one of %s", format, strings.Join(Formats(), ", "))
+	}
+	return reporter, nil
+}
+
+// Formats returns the names of all supported formats
+func Formats() []string {
+	formats := make([]string, 0, len(reporters))
+	for format := range reporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// TextReporter renders changes as a human-readable list
+type TextReporter struct{}
+
+// Write implements Reporter
+func (TextReporter) Write(w io.Writer, r *Report) error {
+	if r.Changes.Count() == 0 {
+		fmt.Fprintln(w, "No changes detected.")
+		return writeDigest(w, r)
+	}
+
+	fmt.Fprintln(w, "\nChanges detected:")
+	groups := []struct {
+		types  []monitor.ChangeType
+		marker string
+	}{
+		{[]monitor.ChangeType{monitor.NewFile}, "[+]"},
+		{[]monitor.ChangeType{monitor.ModifiedFile, monitor.PermissionChange}, "[*]"},
+		{[]monitor.ChangeType{monitor.DeletedFile}, "[-]"},
+	}
+	for _, group := range groups {
+		for _, change := range r.Changes.Details {
+			if !hasType(group.types, change.Type) {
+				continue
+			}
+			line := group.marker + " " + change.Path
+			if change.Severity != monitor.SeverityNone {
+				line += fmt.Sprintf(" (%s)", change.Severity)
+			}
+			if change.IOC != nil {
+				line += fmt.Sprintf(" [KNOWN-BAD: %s]", change.IOC)
+			}
+			if len(change.Rules) > 0 {
+				line += fmt.Sprintf(" [rules: %s]", monitor.RuleNames(change.Rules))
+			}
+			if p := change.Package; p != nil {
+				owner := strings.Join(strings.Fields(p.Manager+" "+p.Name+" "+p.Version), " ")
+				line += fmt.Sprintf(" [%s: %s]", owner, packageVerdict(p.Status))
+			}
+			fmt.Fprintln(w, line)
+			if change.Diff != "" {
+				writeIndented(w, change.Diff, "    ")
+			}
+		}
+	}
+	return writeDigest(w, r)
+}
+
+// writeDigest prints the root digest of the current state, which is the
+// same on any host holding identical files
+func writeDigest(w io.Writer, r *Report) error {
+	if r.Current.Digest == "" {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "\nRoot digest: %s\n", r.Current.Digest)
+	return err
+}
+
+// JSONReporter renders the changes as an indented JSON document
+type JSONReporter struct{}
+
+// Write implements Reporter
+func (JSONReporter) Write(w io.Writer, r *Report) error {
+	data, err := json.MarshalIndent(r.Changes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal changes to JSON: %v", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// SIEMReporter renders one SIEM event per change, correlated by scan ID
+type SIEMReporter struct {
+	Encode func(*logging.Event) string
+}
+
+// Write implements Reporter
+func (s SIEMReporter) Write(w io.Writer, r *Report) error {
+	for _, change := range r.Changes.Details {
+		event := logging.NewChangeEvent(r.ScanID, change)
+		event.Host = r.Host.Hostname
+		if _, err := fmt.Fprintln(w, s.Encode(event)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HTMLReporter renders a self-contained HTML document
+type HTMLReporter struct{}
+
+// Write implements Reporter
+func (HTMLReporter) Write(w io.Writer, r *Report) error {
+	return r.WriteHTML(w)
+}
+
+// packageVerdict describes a package status for people
+func packageVerdict(status monitor.PackageStatus) string {
+	switch status {
+	case monitor.PackageMatches:
+		return "matches package"
+	case monitor.PackageDiffers:
+		return "DIFFERS FROM PACKAGE"
+	case monitor.PackageConffile:
+		return "locally modified conffile"
+	case monitor.PackageMissing:
+		return "packaged file missing"
+	default:
+		return "not verifiable"
+	}
+}
+
+// writeIndented writes each line of text with a prefix
+func writeIndented(w io.Writer, text, prefix string) {
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		fmt.Fprintf(w, "%s%s\n", prefix, line)
+	}
+}
+
+// hasType reports whether t is one of types
+func hasType(types []monitor.ChangeType, t monitor.ChangeType) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
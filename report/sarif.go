@@ -0,0 +1,197 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/logging"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// SARIF 2.1.0 document structure, limited to the parts we emit
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations,omitempty"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string              `json:"id"`
+	Name                 string              `json:"name"`
+	ShortDescription     sarifMessage        `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration  `json:"defaultConfiguration"`
+	Properties           map[string][]string `json:"properties,omitempty"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful bool                   `json:"executionSuccessful"`
+	EndTimeUTC          string                 `json:"endTimeUtc"`
+	Properties          map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID              string                 `json:"ruleId"`
+	RuleIndex           int                    `json:"ruleIndex"`
+	Level               string                 `json:"level"`
+	Message             sarifMessage           `json:"message"`
+	Locations           []sarifLocation        `json:"locations"`
+	PartialFingerprints map[string]string      `json:"partialFingerprints,omitempty"`
+	Properties          map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// sarifRules describes one rule per change type; results reference them by ID
+var sarifRules = []struct {
+	changeType  monitor.ChangeType
+	name        string
+	description string
+}{
+	{monitor.NewFile, "FileAdded", "A file was added that is not in the baseline"},
+	{monitor.ModifiedFile, "FileModified", "The content or attributes of a baselined file changed"},
+	{monitor.DeletedFile, "FileDeleted", "A baselined file was deleted"},
+	{monitor.PermissionChange, "PermissionChanged", "The permissions or ownership of a baselined file changed"},
+}
+
+// SARIFReporter renders changes as a SARIF 2.1.0 log for code scanning
+// dashboards
+type SARIFReporter struct{}
+
+// Write implements Reporter
+func (SARIFReporter) Write(w io.Writer, r *Report) error {
+	driver := sarifDriver{
+		Name:           logging.DeviceProduct,
+		Version:        logging.DeviceVersion,
+		InformationURI: "https://github.com/rhinocodelab/IntegrityWatchdog",
+	}
+	ruleIndex := make(map[monitor.ChangeType]int)
+	for i, rule := range sarifRules {
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   sarifRuleID(rule.changeType),
+			Name:                 rule.name,
+			ShortDescription:     sarifMessage{Text: rule.description},
+			DefaultConfiguration: sarifConfiguration{Level: "warning"},
+			Properties:           map[string][]string{"tags": {"security", "file-integrity"}},
+		})
+		ruleIndex[rule.changeType] = i
+	}
+
+	results := make([]sarifResult, 0, len(r.Changes.Details))
+	for _, change := range r.Changes.Details {
+		result := sarifResult{
+			RuleID:    sarifRuleID(change.Type),
+			RuleIndex: ruleIndex[change.Type],
+			Level:     sarifLevel(change.Severity),
+			Message:   sarifMessage{Text: logging.ChangeMessage(change)},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: fileURI(change.Path)},
+				},
+			}},
+			Properties: map[string]interface{}{
+				"changeType": change.Type.String(),
+			},
+		}
+		if change.Severity != monitor.SeverityNone {
+			result.Properties["severity"] = change.Severity.String()
+		}
+		if len(change.Kinds) > 0 {
+			result.Properties["kinds"] = change.Kinds
+		}
+		if change.OldInfo != nil && change.OldInfo.Hash != "" {
+			result.Properties["oldSha256"] = change.OldInfo.Hash
+		}
+		if change.NewInfo != nil && change.NewInfo.Hash != "" {
+			result.Properties["newSha256"] = change.NewInfo.Hash
+			// Lets dashboards recognise the same finding across runs
+			result.PartialFingerprints = map[string]string{
+				"fileState/v1": fmt.Sprintf("%s:%s", change.Path, change.NewInfo.Hash),
+			}
+		}
+		results = append(results, result)
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: driver},
+			Invocations: []sarifInvocation{{
+				ExecutionSuccessful: true,
+				EndTimeUTC:          r.GeneratedAt.UTC().Format("2006-01-02T15:04:05Z"),
+				Properties: map[string]interface{}{
+					"scanId":   r.ScanID,
+					"hostname": r.Host.Hostname,
+					"baseline": r.Baseline.Source,
+				},
+			}},
+			Results: results,
+		}},
+	}
+
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal SARIF log: %v", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// sarifRuleID returns the rule ID of a change type, derived from its event ID
+func sarifRuleID(t monitor.ChangeType) string {
+	return fmt.Sprintf("FIM%d", logging.ChangeEventID(t))
+}
+
+// sarifLevel maps a change severity to a SARIF result level
+func sarifLevel(severity monitor.Severity) string {
+	switch severity {
+	case monitor.SeverityCritical, monitor.SeverityHigh:
+		return "error"
+	case monitor.SeverityInfo, monitor.SeverityLow:
+		return "note"
+	default:
+		return "warning"
+	}
+}
+
+// fileURI converts an absolute path to a file:// URI
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
@@ -0,0 +1,77 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSARIFReporter(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (SARIFReporter{}).Write(&buf, sampleReport()); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	var log struct {
+		Schema  string `json:"$schema"`
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string `json:"name"`
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				RuleIndex int    `json:"ruleIndex"`
+				Level     string `json:"level"`
+				Message   struct {
+					Text string `json:"text"`
+				} `json:"message"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("invalid SARIF JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || log.Schema != "https://json.schemastore.org/sarif-2.1.0.json" {
+		t.Errorf("version %q, schema %q", log.Version, log.Schema)
+	}
+	if len(log.Runs) != 1 {
+		t.Fatalf("%d runs, want 1", len(log.Runs))
+	}
+	run := log.Runs[0]
+
+	// Every result names a rule of the driver at its index and the file
+	// it is about
+	var got []string
+	for _, result := range run.Results {
+		if result.RuleIndex >= len(run.Tool.Driver.Rules) || run.Tool.Driver.Rules[result.RuleIndex].ID != result.RuleID {
+			t.Errorf("result %s refers to rule %d", result.RuleID, result.RuleIndex)
+		}
+		for _, location := range result.Locations {
+			got = append(got, fmt.Sprintf("%s %s %s | %s", result.RuleID, result.Level,
+				location.PhysicalLocation.ArtifactLocation.URI, result.Message.Text))
+		}
+	}
+	want := []string{
+		`FIM3000 error file:///etc/%3Cscript%3Ealert%28%22x%22%29%3C/script%3E&amp;.conf | [+] New file: /etc/<script>alert("x")</script>&amp;.conf`,
+		`FIM3001 warning file:///etc/hosts | [*] Modified file: /etc/hosts`,
+		`FIM3002 note file:///etc/old,%20%22quoted%22 | [-] Deleted file: /etc/old, "quoted"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("results:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,164 @@
+package rules
+
+// scanContext holds what conditions are evaluated against
+type scanContext struct {
+	size    int64
+	matches map[string][]int // offsets of each string of the rule
+	rules   map[string]bool  // results of the rules evaluated so far
+}
+
+// expr is a boolean condition
+type expr interface {
+	eval(ctx *scanContext) bool
+}
+
+// numExpr is a numeric operand of a comparison
+type numExpr interface {
+	value(ctx *scanContext) int64
+}
+
+// andExpr is true if both operands are
+type andExpr struct{ left, right expr }
+
+// eval implements expr
+func (e *andExpr) eval(ctx *scanContext) bool {
+	return e.left.eval(ctx) && e.right.eval(ctx)
+}
+
+// orExpr is true if either operand is
+type orExpr struct{ left, right expr }
+
+// eval implements expr
+func (e *orExpr) eval(ctx *scanContext) bool {
+	return e.left.eval(ctx) || e.right.eval(ctx)
+}
+
+// notExpr negates its operand
+type notExpr struct{ operand expr }
+
+// eval implements expr
+func (e *notExpr) eval(ctx *scanContext) bool {
+	return !e.operand.eval(ctx)
+}
+
+// boolExpr is a constant
+type boolExpr bool
+
+// eval implements expr
+func (e boolExpr) eval(ctx *scanContext) bool {
+	return bool(e)
+}
+
+// ruleRef is true if an earlier rule matched
+type ruleRef string
+
+// eval implements expr
+func (e ruleRef) eval(ctx *scanContext) bool {
+	return ctx.rules[string(e)]
+}
+
+// stringExpr is true if a string occurs, optionally at an offset or within
+// a range of offsets
+type stringExpr struct {
+	id     string
+	at     numExpr // nil if any offset will do
+	from   numExpr // with to, the inclusive range of an "in" condition
+	to     numExpr
+	ranged bool
+}
+
+// eval implements expr
+func (e *stringExpr) eval(ctx *scanContext) bool {
+	offsets := ctx.matches[e.id]
+	switch {
+	case e.at != nil:
+		at := e.at.value(ctx)
+		for _, offset := range offsets {
+			if int64(offset) == at {
+				return true
+			}
+		}
+		return false
+	case e.ranged:
+		from, to := e.from.value(ctx), e.to.value(ctx)
+		for _, offset := range offsets {
+			if int64(offset) >= from && int64(offset) <= to {
+				return true
+			}
+		}
+		return false
+	default:
+		return len(offsets) > 0
+	}
+}
+
+// ofExpr is true if enough strings of a set occur: "any of", "all of",
+// "none of" or "n of"
+type ofExpr struct {
+	ids  []string
+	min  int  // strings that must occur
+	none bool // no string may occur
+}
+
+// eval implements expr
+func (e *ofExpr) eval(ctx *scanContext) bool {
+	found := 0
+	for _, id := range e.ids {
+		if len(ctx.matches[id]) > 0 {
+			found++
+		}
+	}
+	if e.none {
+		return found == 0
+	}
+	return found >= e.min
+}
+
+// compareExpr compares two numbers
+type compareExpr struct {
+	op          string
+	left, right numExpr
+}
+
+// eval implements expr
+func (e *compareExpr) eval(ctx *scanContext) bool {
+	l, r := e.left.value(ctx), e.right.value(ctx)
+	switch e.op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	case "==":
+		return l == r
+	default:
+		return l != r
+	}
+}
+
+// numberExpr is a constant
+type numberExpr int64
+
+// value implements numExpr
+func (e numberExpr) value(ctx *scanContext) int64 {
+	return int64(e)
+}
+
+// filesizeExpr is the size of the scanned file
+type filesizeExpr struct{}
+
+// value implements numExpr
+func (filesizeExpr) value(ctx *scanContext) int64 {
+	return ctx.size
+}
+
+// countExpr is the number of occurrences of a string
+type countExpr string
+
+// value implements numExpr
+func (e countExpr) value(ctx *scanContext) int64 {
+	return int64(len(ctx.matches[string(e)]))
+}
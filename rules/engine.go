@@ -0,0 +1,233 @@
+package rules
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+	"github.com/rhinocodelab/IntegrityWatchdog/storage"
+)
+
+// Kind is added to the kinds of a change whose file matches a rule
+const Kind = "rule_match"
+
+// ruleExts are the extensions of rule files
+var ruleExts = map[string]bool{".yar": true, ".yara": true, ".rules": true}
+
+// Engine runs content rules against changed files
+type Engine struct {
+	rules    []*Rule
+	maxSize  int64
+	severity monitor.Severity
+}
+
+// GetDefaultDir returns the default directory of rule files
+func GetDefaultDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "fim-rules"
+	}
+	return filepath.Join(homeDir, ".fim", "rules")
+}
+
+// Load compiles the rule files in the [rules] directory. A missing
+// directory leaves the engine without rules.
+func Load(cfg *config.Config) (*Engine, error) {
+	severity, err := monitor.ParseSeverity(cfg.Rules.Severity)
+	if err != nil {
+		return nil, fmt.Errorf("invalid [rules] severity: %v", err)
+	}
+	rules, err := LoadDir(cfg.Rules.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{rules: rules, maxSize: cfg.Rules.MaxSize, severity: severity}, nil
+}
+
+// Files returns the rule files in a directory in the order they are
+// compiled, or those in the default directory if dir is empty
+func Files(dir string) ([]string, error) {
+	if dir == "" {
+		dir = GetDefaultDir()
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules directory: %v", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && ruleExts[filepath.Ext(entry.Name())] {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// LoadDir compiles the rule files in a directory. Files are compiled in
+// name order, so rules may refer to rules in files sorting before theirs.
+func LoadDir(dir string) ([]*Rule, error) {
+	paths, err := Files(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool)
+	var rules []*Rule
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rule file: %v", err)
+		}
+		parsed, err := parse(string(src), known)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		rules = append(rules, parsed...)
+	}
+	return rules, nil
+}
+
+// NewEngine creates an engine for compiled rules
+func NewEngine(rules []*Rule, maxSize int64, severity monitor.Severity) *Engine {
+	return &Engine{rules: rules, maxSize: maxSize, severity: severity}
+}
+
+// Enabled reports whether any rule is loaded
+func (e *Engine) Enabled() bool {
+	return len(e.rules) > 0
+}
+
+// Len returns the number of loaded rules
+func (e *Engine) Len() int {
+	return len(e.rules)
+}
+
+// Match runs the rules against content and returns the public rules that
+// matched, in rule order
+func (e *Engine) Match(data []byte) []*monitor.RuleMatch {
+	f := &file{data: data}
+	ctx := &scanContext{size: int64(len(data)), rules: make(map[string]bool)}
+
+	var matches []*monitor.RuleMatch
+	for _, rule := range e.rules {
+		ctx.matches = make(map[string][]int, len(rule.strings))
+		var found []string
+		for _, s := range rule.strings {
+			if offsets := s.pattern.find(f); len(offsets) > 0 {
+				ctx.matches[s.id] = offsets
+				found = append(found, s.id)
+			}
+		}
+
+		matched := rule.condition.eval(ctx)
+		ctx.rules[rule.Name] = matched
+		if !matched || rule.Private {
+			continue
+		}
+
+		severity := rule.Severity
+		if severity == monitor.SeverityNone {
+			severity = e.severity
+		}
+		matches = append(matches, &monitor.RuleMatch{
+			Rule:        rule.Name,
+			Tags:        rule.Tags,
+			Description: rule.Meta["description"],
+			Severity:    severity,
+			Strings:     found,
+		})
+	}
+	return matches
+}
+
+// MatchFile runs the rules against a file. Files larger than [rules]
+// max_size are skipped, including files that grow past it while read.
+func (e *Engine) MatchFile(path string) ([]*monitor.RuleMatch, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s: not a regular file", path)
+	}
+	if e.maxSize > 0 && info.Size() > e.maxSize {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if e.maxSize > 0 {
+		r = io.LimitReader(file, e.maxSize+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if e.maxSize > 0 && int64(len(data)) > e.maxSize {
+		return nil, nil
+	}
+	return e.Match(data), nil
+}
+
+// Apply runs the rules against added and modified regular files, attaches
+// the matches to their changes and raises their severity to that of the
+// most severe matching rule. It returns the number of files that matched.
+func (e *Engine) Apply(changes *storage.Changes) int {
+	if !e.Enabled() {
+		return 0
+	}
+
+	count := 0
+	for _, change := range changes.Details {
+		if change.Type != monitor.NewFile && change.Type != monitor.ModifiedFile {
+			continue
+		}
+		info := change.NewInfo
+		if info == nil || info.IsDir || info.IsSymlink {
+			continue
+		}
+
+		// A file that vanished or cannot be read since the scan is skipped
+		matches, err := e.MatchFile(info.SourcePath())
+		if err != nil || len(matches) == 0 {
+			continue
+		}
+		count++
+		change.Rules = matches
+		change.Kinds = append(change.Kinds, Kind)
+		for _, match := range matches {
+			if match.Severity > change.Severity {
+				change.Severity = match.Severity
+			}
+		}
+	}
+	return count
+}
+
+// Describe summarises the rules for listings, one line per rule
+func (e *Engine) Describe() []string {
+	lines := make([]string, len(e.rules))
+	for i, rule := range e.rules {
+		line := rule.Name + ": " + rule.describe()
+		if rule.Private {
+			line += ", private"
+		}
+		lines[i] = strings.TrimSpace(line)
+	}
+	return lines
+}
@@ -0,0 +1,167 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// loadSample compiles testdata/sample.yar
+func loadSample(t *testing.T, maxSize int64) *Engine {
+	t.Helper()
+	rules, err := LoadDir("testdata")
+	if err != nil {
+		t.Fatalf("LoadDir: %v", err)
+	}
+	return NewEngine(rules, maxSize, monitor.SeverityHigh)
+}
+
+// matched returns the names of matching rules
+func matched(matches []*monitor.RuleMatch) string {
+	var names []string
+	for _, match := range matches {
+		names = append(names, match.Rule)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestSampleRules(t *testing.T) {
+	e := loadSample(t, 0)
+	if e.Len() != 4 {
+		t.Fatalf("compiled %d rules, want 4", e.Len())
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"webshell", `<?php EVAL($_POST['c']); ?>`, "php_webshell,not_elf"},
+		{"webshell with base64", `<?php eval(base64_decode("...")); ?>`, "php_webshell,not_elf"},
+		{"base64 not a full word", `<?php eval(my_base64_decoder("...")); ?>`, "not_elf"},
+		{"elf with pe header", "\x7fELF\x00MZ\x90\x00__PE", "elf_dropper"},
+		{"elf with wide urls", "\x7fELF" + strings.Repeat("h\x00t\x00t\x00p\x00:\x00/\x00/\x00", 3), "elf_dropper"},
+		{"elf alone", "\x7fELF\x00\x00", "not_elf"},
+		{"pe header not in elf", "MZ\x90\x00__PE", "not_elf"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		if got := matched(e.Match([]byte(tt.data))); got != tt.want {
+			t.Errorf("%s: matched %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// The webshell is too large for the private rule it depends on
+	large := `<?php eval($_GET[1]); ?>` + strings.Repeat(" ", 2048)
+	if got := matched(e.Match([]byte(large))); got != "not_elf" {
+		t.Errorf("large webshell matched %q", got)
+	}
+}
+
+func TestMatchSeverity(t *testing.T) {
+	e := loadSample(t, 0)
+	for _, match := range e.Match([]byte(`eval($_REQUEST[0])`)) {
+		want := monitor.SeverityHigh
+		if match.Rule == "php_webshell" {
+			want = monitor.SeverityCritical
+		}
+		if match.Severity != want {
+			t.Errorf("%s has severity %v, want %v", match.Rule, match.Severity, want)
+		}
+	}
+}
+
+func TestMatchFileSkipsLargeFiles(t *testing.T) {
+	e := loadSample(t, 64)
+	dir := t.TempDir()
+
+	small := filepath.Join(dir, "small.php")
+	if err := os.WriteFile(small, []byte(`eval($_GET[0])`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	matches, err := e.MatchFile(small)
+	if err != nil || matched(matches) != "php_webshell,not_elf" {
+		t.Errorf("MatchFile(small) = %q, %v", matched(matches), err)
+	}
+
+	large := filepath.Join(dir, "large.php")
+	if err := os.WriteFile(large, []byte(`eval($_GET[0])`+strings.Repeat(" ", 64)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if matches, err := e.MatchFile(large); err != nil || len(matches) != 0 {
+		t.Errorf("MatchFile(large) = %q, %v; want it skipped", matched(matches), err)
+	}
+
+	if _, err := e.MatchFile(dir); err == nil {
+		t.Error("MatchFile accepted a directory")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"missing condition", `rule a { strings: $a = "x" }`, "missing condition"},
+		{"undefined string", `rule a { condition: $b }`, "undefined string $b"},
+		{"duplicate rule", `rule a { condition: true } rule a { condition: true }`, "duplicate rule a"},
+		{"unknown rule", `rule a { condition: b }`, ""},
+		{"bad hex", `rule a { strings: $h = { 4D [x] } condition: $h }`, "invalid jump"},
+		{"hex modifier", `rule a { strings: $h = { 4D } wide condition: $h }`, "no modifiers"},
+		{"bad regex", `rule a { strings: $r = /(/ condition: $r }`, "invalid regular expression"},
+		{"bad severity", `rule a { meta: severity = "dire" condition: true }`, "unknown severity"},
+		{"keyword name", `rule them { condition: true }`, "expected a rule name"},
+		{"unterminated comment", `/* rule a { condition: true }`, "unterminated comment"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		if err == nil {
+			t.Errorf("%s: compiled", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %q, want it to mention %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestConditions(t *testing.T) {
+	data := []byte("abc abc xyz")
+	tests := []struct {
+		condition string
+		want      bool
+	}{
+		{"$a", true},
+		{"$a at 0", true},
+		{"$a at 1", false},
+		{"$a in (1..4)", true},
+		{"$a in (1..3)", false},
+		{"#a == 2", true},
+		{"#a > 2", false},
+		{"#z == 0", true},
+		{"any of them", true},
+		{"all of them", false},
+		{"none of ($z)", true},
+		{"2 of them", true},
+		{"all of ($a, $x*)", true},
+		{"filesize == 11", true},
+		{"filesize < 1KB and not $z", true},
+		{"$z or ($a and $x1)", true},
+	}
+	for _, tt := range tests {
+		src := `rule r { strings: $a = "abc" $x1 = "xyz" $z = "nope" condition: ` + tt.condition + ` }`
+		rules, err := Parse(src)
+		if err != nil {
+			t.Errorf("%s: %v", tt.condition, err)
+			continue
+		}
+		got := len(NewEngine(rules, 0, monitor.SeverityHigh).Match(data)) == 1
+		if got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.condition, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tokenKind is the kind of a lexical token
+type tokenKind int
+
+const (
+	tokEOF      tokenKind = iota
+	tokIdent              // rule names, keywords, tags
+	tokStringID           // $name, $name*
+	tokCount              // #name
+	tokText               // "text"
+	tokRegex              // /regex/flags
+	tokHex                // { 4D 5A ?? }
+	tokNumber             // 123, 0x7f, 10KB
+	tokPunct              // { } ( ) : = , .. and comparison operators
+)
+
+// token is a lexical token with its position for error messages
+type token struct {
+	kind  tokenKind
+	text  string // identifier, punctuation, decoded text, regex or hex body
+	flags string // regex flags
+	num   int64
+	line  int
+}
+
+// String describes a token in error messages
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of file"
+	case tokText:
+		return strconv.Quote(t.text)
+	case tokRegex:
+		return "/" + t.text + "/"
+	case tokHex:
+		return "{" + t.text + "}"
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// lexer splits rule source into tokens. Regular expressions and hex
+// strings are only recognised after '=', where a string value is expected.
+type lexer struct {
+	src  string
+	pos  int
+	line int
+	prev token
+}
+
+// newLexer creates a lexer for rule source
+func newLexer(src string) *lexer {
+	return &lexer{src: src, line: 1}
+}
+
+// errorf returns an error at the current line
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", l.line, fmt.Sprintf(format, args...))
+}
+
+// next returns the next token
+func (l *lexer) next() (token, error) {
+	tok, err := l.scan()
+	if err == nil {
+		l.prev = tok
+	}
+	return tok, err
+}
+
+// skipSpace skips white space and comments
+func (l *lexer) skipSpace() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return l.errorf("unterminated comment")
+			}
+			l.line += strings.Count(l.src[l.pos:l.pos+2+end], "\n")
+			l.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// scan reads one token
+func (l *lexer) scan() (token, error) {
+	if err := l.skipSpace(); err != nil {
+		return token{}, err
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, line: l.line}, nil
+	}
+
+	start, c := l.pos, l.src[l.pos]
+	afterAssign := l.prev.kind == tokPunct && l.prev.text == "="
+	switch {
+	case c == '"':
+		return l.scanText()
+	case c == '/' && afterAssign:
+		return l.scanRegex()
+	case c == '{' && afterAssign:
+		end := strings.IndexByte(l.src[l.pos:], '}')
+		if end < 0 {
+			return token{}, l.errorf("unterminated hex string")
+		}
+		body := l.src[l.pos+1 : l.pos+end]
+		tok := token{kind: tokHex, text: body, line: l.line}
+		l.line += strings.Count(body, "\n")
+		l.pos += end + 1
+		return tok, nil
+	case c == '$' || c == '#':
+		l.pos++
+		for l.pos < len(l.src) && isIdentChar(l.src[l.pos]) {
+			l.pos++
+		}
+		kind := tokCount
+		if c == '$' {
+			kind = tokStringID
+			if l.pos < len(l.src) && l.src[l.pos] == '*' {
+				l.pos++
+			}
+		}
+		return token{kind: kind, text: l.src[start:l.pos], line: l.line}, nil
+	case isDigit(c):
+		return l.scanNumber()
+	case isIdentChar(c):
+		for l.pos < len(l.src) && isIdentChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], line: l.line}, nil
+	}
+
+	for _, op := range []string{"..", "<=", ">=", "==", "!=", "{", "}", "(", ")", ":", "=", ",", "<", ">"} {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokPunct, text: op, line: l.line}, nil
+		}
+	}
+	return token{}, l.errorf("unexpected character %q", c)
+}
+
+// scanText reads a double-quoted string with C-style escapes
+func (l *lexer) scanText() (token, error) {
+	var b strings.Builder
+	l.pos++
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return token{kind: tokText, text: b.String(), line: l.line}, nil
+		case '\n':
+			return token{}, l.errorf("unterminated string")
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return token{}, l.errorf("unterminated string")
+			}
+			l.pos++
+			switch e := l.src[l.pos]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(e)
+			case 'x':
+				if l.pos+2 >= len(l.src) {
+					return token{}, l.errorf("invalid \\x escape")
+				}
+				v, err := strconv.ParseUint(l.src[l.pos+1:l.pos+3], 16, 8)
+				if err != nil {
+					return token{}, l.errorf("invalid \\x escape")
+				}
+				b.WriteByte(byte(v))
+				l.pos += 2
+			default:
+				return token{}, l.errorf("unknown escape \\%c", e)
+			}
+			l.pos++
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{}, l.errorf("unterminated string")
+}
+
+// scanRegex reads /regex/ followed by optional i and s flags
+func (l *lexer) scanRegex() (token, error) {
+	var b strings.Builder
+	l.pos++
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			return token{}, l.errorf("unterminated regular expression")
+		case c == '\\' && l.pos+1 < len(l.src) && l.src[l.pos+1] == '/':
+			b.WriteByte('/')
+			l.pos += 2
+		case c == '\\' && l.pos+1 < len(l.src):
+			b.WriteString(l.src[l.pos : l.pos+2])
+			l.pos += 2
+		case c == '/':
+			l.pos++
+			start := l.pos
+			for l.pos < len(l.src) && (l.src[l.pos] == 'i' || l.src[l.pos] == 's') {
+				l.pos++
+			}
+			return token{kind: tokRegex, text: b.String(), flags: l.src[start:l.pos], line: l.line}, nil
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{}, l.errorf("unterminated regular expression")
+}
+
+// scanNumber reads a decimal or hexadecimal number with an optional KB or
+// MB suffix
+func (l *lexer) scanNumber() (token, error) {
+	start := l.pos
+	for l.pos < len(l.src) && (isIdentChar(l.src[l.pos])) {
+		l.pos++
+	}
+	text := l.src[start:l.pos]
+
+	digits, multiplier := text, int64(1)
+	switch {
+	case strings.HasSuffix(text, "KB"):
+		digits, multiplier = strings.TrimSuffix(text, "KB"), 1024
+	case strings.HasSuffix(text, "MB"):
+		digits, multiplier = strings.TrimSuffix(text, "MB"), 1024*1024
+	}
+	n, err := strconv.ParseInt(digits, 0, 64)
+	if err != nil {
+		return token{}, l.errorf("invalid number %q", text)
+	}
+	return token{kind: tokNumber, text: text, num: n * multiplier, line: l.line}, nil
+}
+
+// isIdentChar reports whether c may appear in an identifier
+func isIdentChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// isDigit reports whether c is a decimal digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
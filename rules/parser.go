@@ -0,0 +1,598 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// Rule is a compiled content rule
+type Rule struct {
+	Name     string
+	Tags     []string
+	Meta     map[string]string
+	Private  bool             // only used by other rules, never reported
+	Severity monitor.Severity // from the severity meta, SeverityNone if unset
+
+	strings   []*ruleString
+	condition expr
+}
+
+// ruleString is a named pattern of a rule
+type ruleString struct {
+	id      string
+	pattern pattern
+}
+
+// keywords cannot be used as rule names
+var keywords = map[string]bool{
+	"rule": true, "private": true, "meta": true, "strings": true, "condition": true,
+	"and": true, "or": true, "not": true, "any": true, "all": true, "none": true, "of": true,
+	"them": true, "at": true, "in": true, "filesize": true, "true": true, "false": true,
+}
+
+// textModifiers are the modifiers allowed after text and regex strings
+var textModifiers = map[string]bool{"nocase": true, "wide": true, "ascii": true, "fullword": true}
+
+// parser builds rules from tokens
+type parser struct {
+	lex   *lexer
+	tok   token
+	ahead *token
+	known map[string]bool // names of the rules defined so far
+	rule  *Rule           // rule being parsed
+}
+
+// Parse compiles rule source. Rules may refer to rules defined before them.
+func Parse(src string) ([]*Rule, error) {
+	return parse(src, make(map[string]bool))
+}
+
+// parse compiles rule source, given the names of rules already defined
+func parse(src string, known map[string]bool) ([]*Rule, error) {
+	p := &parser{lex: newLexer(src), known: known}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	var rules []*Rule
+	for p.tok.kind != tokEOF {
+		rule, err := p.parseRule()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// advance moves to the next token
+func (p *parser) advance() error {
+	if p.ahead != nil {
+		p.tok, p.ahead = *p.ahead, nil
+		return nil
+	}
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+// peek returns the token after the current one
+func (p *parser) peek() (token, error) {
+	if p.ahead == nil {
+		tok, err := p.lex.next()
+		if err != nil {
+			return token{}, err
+		}
+		p.ahead = &tok
+	}
+	return *p.ahead, nil
+}
+
+// errorf returns an error at the current token
+func (p *parser) errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if p.rule != nil {
+		msg = fmt.Sprintf("rule %s: %s", p.rule.Name, msg)
+	}
+	return fmt.Errorf("line %d: %s", p.tok.line, msg)
+}
+
+// is reports whether the current token is the given identifier or
+// punctuation
+func (p *parser) is(text string) bool {
+	return (p.tok.kind == tokIdent || p.tok.kind == tokPunct) && p.tok.text == text
+}
+
+// expect consumes the given identifier or punctuation
+func (p *parser) expect(text string) error {
+	if !p.is(text) {
+		return p.errorf("expected %q, found %s", text, p.tok)
+	}
+	return p.advance()
+}
+
+// parseRule parses one rule
+func (p *parser) parseRule() (*Rule, error) {
+	p.rule = nil
+	rule := &Rule{Meta: make(map[string]string)}
+	if p.is("private") {
+		rule.Private = true
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect("rule"); err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != tokIdent || keywords[p.tok.text] {
+		return nil, p.errorf("expected a rule name, found %s", p.tok)
+	}
+	rule.Name = p.tok.text
+	if p.known[rule.Name] {
+		return nil, p.errorf("duplicate rule %s", rule.Name)
+	}
+	p.rule = rule
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	// Tags
+	if p.is(":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for p.tok.kind == tokIdent {
+			rule.Tags = append(rule.Tags, p.tok.text)
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for !p.is("}") {
+		if p.tok.kind != tokIdent {
+			return nil, p.errorf("expected meta, strings or condition, found %s", p.tok)
+		}
+		section := p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+
+		var err error
+		switch section {
+		case "meta":
+			err = p.parseMeta()
+		case "strings":
+			err = p.parseStrings()
+		case "condition":
+			if rule.condition != nil {
+				return nil, p.errorf("duplicate condition")
+			}
+			rule.condition, err = p.parseOr()
+		default:
+			return nil, p.errorf("unknown section %q", section)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rule.condition == nil {
+		return nil, p.errorf("missing condition")
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if level, ok := rule.Meta["severity"]; ok {
+		severity, err := monitor.ParseSeverity(level)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %v", rule.Name, err)
+		}
+		rule.Severity = severity
+	}
+	p.known[rule.Name] = true
+	return rule, nil
+}
+
+// parseMeta parses key = value pairs
+func (p *parser) parseMeta() error {
+	for p.tok.kind == tokIdent {
+		next, err := p.peek()
+		if err != nil {
+			return err
+		}
+		if next.kind != tokPunct || next.text != "=" {
+			return nil
+		}
+
+		key := p.tok.text
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+		switch p.tok.kind {
+		case tokText, tokNumber, tokIdent:
+			p.rule.Meta[key] = p.tok.text
+		default:
+			return p.errorf("invalid value for meta %s: %s", key, p.tok)
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseStrings parses $id = value definitions
+func (p *parser) parseStrings() error {
+	for p.tok.kind == tokStringID {
+		id := p.tok.text
+		if id == "$" || strings.HasSuffix(id, "*") {
+			return p.errorf("invalid string identifier %s", id)
+		}
+		for _, s := range p.rule.strings {
+			if s.id == id {
+				return p.errorf("duplicate string %s", id)
+			}
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.expect("="); err != nil {
+			return err
+		}
+
+		value := p.tok
+		if err := p.advance(); err != nil {
+			return err
+		}
+		var modifiers []string
+		for p.tok.kind == tokIdent && textModifiers[p.tok.text] {
+			modifiers = append(modifiers, p.tok.text)
+			if err := p.advance(); err != nil {
+				return err
+			}
+		}
+
+		var pat pattern
+		var err error
+		switch value.kind {
+		case tokText:
+			pat, err = newTextPattern(value.text, modifiers)
+		case tokRegex:
+			flags := value.flags
+			for _, modifier := range modifiers {
+				if modifier != "nocase" {
+					err = fmt.Errorf("modifier %s is not supported for regular expressions", modifier)
+				} else if !strings.Contains(flags, "i") {
+					flags += "i"
+				}
+			}
+			if err == nil {
+				pat, err = newRegexPattern(value.text, flags)
+			}
+		case tokHex:
+			if len(modifiers) > 0 {
+				err = fmt.Errorf("hex strings take no modifiers")
+			} else {
+				pat, err = newHexPattern(value.text)
+			}
+		default:
+			return p.errorf("expected a text, regex or hex string for %s, found %s", id, value)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: rule %s: string %s: %v", value.line, p.rule.Name, id, err)
+		}
+		p.rule.strings = append(p.rule.strings, &ruleString{id: id, pattern: pat})
+	}
+	return nil
+}
+
+// parseOr parses a disjunction, the loosest binding expression
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("or") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpr{left, right}
+	}
+	return left, nil
+}
+
+// parseAnd parses a conjunction
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("and") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpr{left, right}
+	}
+	return left, nil
+}
+
+// parseNot parses an optionally negated primary expression
+func (p *parser) parseNot() (expr, error) {
+	if !p.is("not") {
+		return p.parsePrimary()
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return &notExpr{operand}, nil
+}
+
+// parsePrimary parses a parenthesised expression, a constant, a string
+// test, a quantifier, a comparison or a reference to another rule
+func (p *parser) parsePrimary() (expr, error) {
+	switch {
+	case p.is("("):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+
+	case p.is("true"), p.is("false"):
+		value := p.is("true")
+		return boolExpr(value), p.advance()
+
+	case p.is("any"), p.is("all"), p.is("none"):
+		quantifier := p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return p.parseOf(quantifier, 0)
+
+	case p.tok.kind == tokNumber:
+		next, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if next.kind == tokIdent && next.text == "of" {
+			n := int(p.tok.num)
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			return p.parseOf("", n)
+		}
+		return p.parseComparison()
+
+	case p.tok.kind == tokCount, p.is("filesize"):
+		return p.parseComparison()
+
+	case p.tok.kind == tokStringID:
+		return p.parseStringTest()
+
+	case p.tok.kind == tokIdent && !keywords[p.tok.text]:
+		name := p.tok.text
+		if !p.known[name] {
+			return nil, p.errorf("unknown rule %s", name)
+		}
+		return ruleRef(name), p.advance()
+	}
+	return nil, p.errorf("unexpected %s in condition", p.tok)
+}
+
+// parseStringTest parses $id, $id at n or $id in (a..b)
+func (p *parser) parseStringTest() (expr, error) {
+	id := p.tok.text
+	if err := p.checkString(id); err != nil {
+		return nil, err
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	e := &stringExpr{id: id}
+	switch {
+	case p.is("at"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		at, err := p.parseNumeric()
+		if err != nil {
+			return nil, err
+		}
+		e.at = at
+	case p.is("in"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		from, err := p.parseNumeric()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(".."); err != nil {
+			return nil, err
+		}
+		to, err := p.parseNumeric()
+		if err != nil {
+			return nil, err
+		}
+		e.from, e.to, e.ranged = from, to, true
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// parseOf parses "of them" or "of ($a, $b*)" after a quantifier; n is the
+// count of an "n of" quantifier
+func (p *parser) parseOf(quantifier string, n int) (expr, error) {
+	if err := p.expect("of"); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	if p.is("them") {
+		for _, s := range p.rule.strings {
+			ids = append(ids, s.id)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		for {
+			if p.tok.kind != tokStringID {
+				return nil, p.errorf("expected a string identifier, found %s", p.tok)
+			}
+			matched, err := p.expandStrings(p.tok.text)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, matched...)
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if !p.is(",") {
+				break
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if len(ids) == 0 {
+		return nil, p.errorf("the rule has no strings")
+	}
+
+	e := &ofExpr{ids: ids, min: n}
+	switch quantifier {
+	case "any":
+		e.min = 1
+	case "all":
+		e.min = len(ids)
+	case "none":
+		e.none = true
+	}
+	return e, nil
+}
+
+// expandStrings returns the strings an identifier refers to; $a* matches
+// every string starting with $a
+func (p *parser) expandStrings(id string) ([]string, error) {
+	if !strings.HasSuffix(id, "*") {
+		return []string{id}, p.checkString(id)
+	}
+	var ids []string
+	for _, s := range p.rule.strings {
+		if strings.HasPrefix(s.id, strings.TrimSuffix(id, "*")) {
+			ids = append(ids, s.id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, p.errorf("no strings match %s", id)
+	}
+	return ids, nil
+}
+
+// checkString verifies that the rule defines a string
+func (p *parser) checkString(id string) error {
+	for _, s := range p.rule.strings {
+		if s.id == id {
+			return nil
+		}
+	}
+	return p.errorf("undefined string %s", id)
+}
+
+// parseComparison parses numeric op numeric
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseNumeric()
+	if err != nil {
+		return nil, err
+	}
+	op := p.tok.text
+	switch {
+	case p.tok.kind != tokPunct:
+		return nil, p.errorf("expected a comparison, found %s", p.tok)
+	case op == "<", op == "<=", op == ">", op == ">=", op == "==", op == "!=":
+	default:
+		return nil, p.errorf("expected a comparison, found %s", p.tok)
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	right, err := p.parseNumeric()
+	if err != nil {
+		return nil, err
+	}
+	return &compareExpr{op: op, left: left, right: right}, nil
+}
+
+// parseNumeric parses a number, filesize or #id
+func (p *parser) parseNumeric() (numExpr, error) {
+	var e numExpr
+	switch {
+	case p.tok.kind == tokNumber:
+		e = numberExpr(p.tok.num)
+	case p.is("filesize"):
+		e = filesizeExpr{}
+	case p.tok.kind == tokCount:
+		id := "$" + strings.TrimPrefix(p.tok.text, "#")
+		if err := p.checkString(id); err != nil {
+			return nil, err
+		}
+		e = countExpr(id)
+	default:
+		return nil, p.errorf("expected a number, filesize or string count, found %s", p.tok)
+	}
+	return e, p.advance()
+}
+
+// describe summarises a rule for listings, e.g. "3 strings, tags: php"
+func (r *Rule) describe() string {
+	parts := []string{strconv.Itoa(len(r.strings)) + " strings"}
+	if len(r.Tags) > 0 {
+		parts = append(parts, "tags: "+strings.Join(r.Tags, " "))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,350 @@
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxMatches limits the offsets recorded per string and file
+const maxMatches = 1000
+
+// pattern finds the offsets at which a string of a rule occurs in a file
+type pattern interface {
+	find(f *file) []int
+}
+
+// file is the content of a scanned file with lazily computed views
+type file struct {
+	data  []byte
+	lower []byte // ASCII lower-cased copy, for nocase strings
+}
+
+// lowered returns the ASCII lower-cased content
+func (f *file) lowered() []byte {
+	if f.lower == nil {
+		f.lower = asciiLower(f.data)
+	}
+	return f.lower
+}
+
+// textPattern matches literal text with the nocase, wide, ascii and
+// fullword modifiers
+type textPattern struct {
+	variants [][]byte // ascii and/or wide encodings of the text
+	nocase   bool
+	fullword bool
+}
+
+// newTextPattern compiles a text string with its modifiers
+func newTextPattern(text string, modifiers []string) (*textPattern, error) {
+	if text == "" {
+		return nil, fmt.Errorf("empty text string")
+	}
+
+	p := &textPattern{}
+	ascii, wide := false, false
+	for _, modifier := range modifiers {
+		switch modifier {
+		case "nocase":
+			p.nocase = true
+		case "wide":
+			wide = true
+		case "ascii":
+			ascii = true
+		case "fullword":
+			p.fullword = true
+		default:
+			return nil, fmt.Errorf("unknown text string modifier %q", modifier)
+		}
+	}
+	if !wide {
+		ascii = true
+	}
+
+	literal := []byte(text)
+	if p.nocase {
+		literal = asciiLower(literal)
+	}
+	if ascii {
+		p.variants = append(p.variants, literal)
+	}
+	if wide {
+		encoded := make([]byte, 0, 2*len(literal))
+		for _, c := range literal {
+			encoded = append(encoded, c, 0)
+		}
+		p.variants = append(p.variants, encoded)
+	}
+	return p, nil
+}
+
+// find implements pattern
+func (p *textPattern) find(f *file) []int {
+	data := f.data
+	if p.nocase {
+		data = f.lowered()
+	}
+
+	var offsets []int
+	for _, literal := range p.variants {
+		for start := 0; start <= len(data)-len(literal) && len(offsets) < maxMatches; {
+			i := bytes.Index(data[start:], literal)
+			if i < 0 {
+				break
+			}
+			at := start + i
+			if !p.fullword || isFullword(data, at, len(literal)) {
+				offsets = append(offsets, at)
+			}
+			start = at + 1
+		}
+	}
+	return offsets
+}
+
+// isFullword reports whether the match at data[at:at+n] is delimited by
+// non-alphanumeric characters
+func isFullword(data []byte, at, n int) bool {
+	if at > 0 && isAlnum(data[at-1]) {
+		return false
+	}
+	if end := at + n; end < len(data) && isAlnum(data[end]) {
+		return false
+	}
+	return true
+}
+
+// regexPattern matches a regular expression. Go regular expressions work
+// on UTF-8 text, so bytes that are not valid UTF-8 only match '.' and
+// negated classes.
+type regexPattern struct {
+	re *regexp.Regexp
+}
+
+// newRegexPattern compiles /expr/flags; i ignores case and s lets '.'
+// match newlines
+func newRegexPattern(expr, flags string) (*regexPattern, error) {
+	if flags != "" {
+		expr = "(?" + flags + ")" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %v", err)
+	}
+	return &regexPattern{re: re}, nil
+}
+
+// find implements pattern
+func (p *regexPattern) find(f *file) []int {
+	var offsets []int
+	for _, loc := range p.re.FindAllIndex(f.data, maxMatches) {
+		offsets = append(offsets, loc[0])
+	}
+	return offsets
+}
+
+// hexToken is a byte with a mask of the bits that must match, or a jump
+// over a range of arbitrary bytes
+type hexToken struct {
+	value, mask      byte
+	jump             bool
+	jumpMin, jumpMax int
+}
+
+// hexPattern matches a hex string such as { 4D 5A ?? ?0 [2-8] 50 45 }.
+// Jumps split it into segments of fixed length.
+type hexPattern struct {
+	segments []*hexSegment
+	jumps    []hexToken // jumps[i] lies between segments[i] and segments[i+1]
+}
+
+// hexSegment is a run of bytes without jumps
+type hexSegment struct {
+	tokens []hexToken
+	prefix []byte // leading bytes without wildcards, used to find candidates
+}
+
+// newHexPattern compiles the body of a hex string
+func newHexPattern(body string) (*hexPattern, error) {
+	var tokens []hexToken
+	fields := strings.Fields(strings.NewReplacer("[", " [", "]", "] ").Replace(body))
+	for _, field := range fields {
+		if strings.HasPrefix(field, "[") {
+			jump, err := parseJump(strings.Trim(field, "[]"))
+			if err != nil {
+				return nil, err
+			}
+			if len(tokens) == 0 {
+				return nil, fmt.Errorf("hex string cannot start with a jump")
+			}
+			tokens = append(tokens, jump)
+			continue
+		}
+
+		// Bytes may be written apart (4D 5A) or together (4D5A)
+		if len(field)%2 != 0 {
+			return nil, fmt.Errorf("invalid hex byte %q", field)
+		}
+		for i := 0; i < len(field); i += 2 {
+			token, err := parseHexByte(field[i : i+2])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty hex string")
+	}
+	if tokens[len(tokens)-1].jump {
+		return nil, fmt.Errorf("hex string cannot end with a jump")
+	}
+
+	p := &hexPattern{segments: []*hexSegment{{}}}
+	for i, token := range tokens {
+		seg := p.segments[len(p.segments)-1]
+		switch {
+		case !token.jump:
+			seg.tokens = append(seg.tokens, token)
+		case tokens[i-1].jump:
+			// Adjacent jumps add up
+			last := &p.jumps[len(p.jumps)-1]
+			last.jumpMin += token.jumpMin
+			if last.jumpMax < 0 || token.jumpMax < 0 {
+				last.jumpMax = -1
+			} else {
+				last.jumpMax += token.jumpMax
+			}
+		default:
+			p.jumps = append(p.jumps, token)
+			p.segments = append(p.segments, &hexSegment{})
+		}
+	}
+	for _, seg := range p.segments {
+		for _, token := range seg.tokens {
+			if token.mask != 0xff {
+				break
+			}
+			seg.prefix = append(seg.prefix, token.value)
+		}
+	}
+	return p, nil
+}
+
+// parseHexByte parses a byte with optional nibble wildcards, e.g. 4D, ?D or ??
+func parseHexByte(s string) (hexToken, error) {
+	var token hexToken
+	for i, c := range []byte(strings.ToUpper(s)) {
+		shift := uint(4 * (1 - i))
+		if c == '?' {
+			continue
+		}
+		v, err := strconv.ParseUint(string(c), 16, 8)
+		if err != nil {
+			return token, fmt.Errorf("invalid hex byte %q", s)
+		}
+		token.value |= byte(v) << shift
+		token.mask |= 0xf << shift
+	}
+	return token, nil
+}
+
+// parseJump parses the body of a jump: n, n-m, or n- for an unbounded jump
+func parseJump(s string) (hexToken, error) {
+	token := hexToken{jump: true}
+	lo, hi, ranged := strings.Cut(s, "-")
+	var err error
+	if token.jumpMin, err = strconv.Atoi(strings.TrimSpace(lo)); err != nil || token.jumpMin < 0 {
+		return token, fmt.Errorf("invalid jump [%s]", s)
+	}
+	token.jumpMax = token.jumpMin
+	if ranged {
+		if strings.TrimSpace(hi) == "" {
+			token.jumpMax = -1
+		} else if token.jumpMax, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil || token.jumpMax < token.jumpMin {
+			return token, fmt.Errorf("invalid jump [%s]", s)
+		}
+	}
+	return token, nil
+}
+
+// find implements pattern. Instead of backtracking over the lengths of
+// jumps, which takes exponential time with several wide jumps, it works
+// back from the last segment: reach holds the offsets at which the
+// segments from the current one to the last match, so each segment is
+// searched for once and each jump is checked with one binary search.
+func (p *hexPattern) find(f *file) []int {
+	last := len(p.segments) - 1
+	var reach []int
+	p.segments[last].each(f.data, func(at int) bool {
+		reach = append(reach, at)
+		return last > 0 || len(reach) < maxMatches
+	})
+
+	for i := last - 1; i >= 0 && len(reach) > 0; i-- {
+		seg, jump := p.segments[i], p.jumps[i]
+		next := reach
+		reach = nil
+		seg.each(f.data, func(at int) bool {
+			end := at + len(seg.tokens)
+			j := sort.SearchInts(next, end+jump.jumpMin)
+			if j < len(next) && (jump.jumpMax < 0 || next[j] <= end+jump.jumpMax) {
+				reach = append(reach, at)
+			}
+			return i > 0 || len(reach) < maxMatches
+		})
+	}
+	return reach
+}
+
+// each calls fn with every offset at which the segment matches data, in
+// increasing order, until fn returns false
+func (s *hexSegment) each(data []byte, fn func(at int) bool) {
+	for at := 0; at+len(s.tokens) <= len(data); at++ {
+		if len(s.prefix) > 0 {
+			i := bytes.Index(data[at:], s.prefix)
+			if i < 0 {
+				return
+			}
+			at += i
+		}
+		if s.matchAt(data, at) && !fn(at) {
+			return
+		}
+	}
+}
+
+// matchAt reports whether the segment matches data at pos
+func (s *hexSegment) matchAt(data []byte, pos int) bool {
+	if pos+len(s.tokens) > len(data) {
+		return false
+	}
+	for i, token := range s.tokens {
+		if data[pos+i]&token.mask != token.value {
+			return false
+		}
+	}
+	return true
+}
+
+// asciiLower returns a copy of data with ASCII letters lower-cased. Unlike
+// bytes.ToLower it never changes the length of binary content.
+func asciiLower(data []byte) []byte {
+	lower := make([]byte, len(data))
+	for i, c := range data {
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	return lower
+}
+
+// isAlnum reports whether c is an ASCII letter or digit
+func isAlnum(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
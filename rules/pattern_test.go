@@ -0,0 +1,102 @@
+package rules
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHexPattern(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+		data string
+		want []int
+	}{
+		{"literal", "41 42", "xABxAB", []int{1, 4}},
+		{"packed bytes", "4142", "AB", []int{0}},
+		{"wildcard byte", "41 ?? 43", "AxC AC ABC", []int{0, 7}},
+		{"nibble wildcards", "4? ?2", "AB@2", []int{0, 2}},
+		{"fixed jump", "41 [2] 44", "AxxD AxD", []int{0}},
+		{"ranged jump", "41 [1-2] 44", "AxD AxxD AxxxD", []int{0, 4}},
+		{"empty jump", "41 [0-1] 44", "AD", []int{0}},
+		{"open jump", "41 [2-] 44", "AD AxD A___D", []int{0, 3, 7}},
+		{"adjacent jumps add up", "41 [1] [1-2] 44", "AxD AxxD AxxxD", []int{4, 9}},
+		{"several jumps", "41 [0-3] 42 [1-] 43", "A_B_C AB_C ABC", []int{0, 6}},
+		{"jump past the end", "41 [3] 44", "AxD", nil},
+		{"overlapping matches", "41 41", "AAAA", []int{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		p, err := newHexPattern(tt.hex)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := p.find(&file{data: []byte(tt.data)}); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: { %s } in %q = %v, want %v", tt.name, tt.hex, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestHexPatternErrors(t *testing.T) {
+	for _, hex := range []string{"", "[2] 41", "41 [2]", "4", "4G", "41 [x]", "41 [3-1] 42", "41 [-1] 42"} {
+		if _, err := newHexPattern(hex); err == nil {
+			t.Errorf("{ %s } compiled", hex)
+		}
+	}
+}
+
+func TestHexPatternJumpsAreLinear(t *testing.T) {
+	// Backtracking over the jumps would try about n^3 paths here
+	data := bytes.Repeat([]byte("A"), 1<<20)
+	for _, hex := range []string{"41 [0-] 41 [0-] 41 [0-] 42", "41 [0-4096] 41 [0-4096] 41 [0-4096] 42"} {
+		p, err := newHexPattern(hex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		if got := p.find(&file{data: data}); len(got) != 0 {
+			t.Errorf("{ %s } matched at %v", hex, got[:1])
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("{ %s } took %v", hex, elapsed)
+		}
+	}
+}
+
+func TestHexPatternLimitsMatches(t *testing.T) {
+	p, err := newHexPattern("41 [0-] 41")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.find(&file{data: bytes.Repeat([]byte("A"), 5000)}); len(got) != maxMatches {
+		t.Errorf("recorded %d matches, want %d", len(got), maxMatches)
+	}
+}
+
+func TestTextPattern(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		modifiers []string
+		data      string
+		want      []int
+	}{
+		{"plain", "eval", nil, "eval EVAL", []int{0}},
+		{"nocase", "eval", []string{"nocase"}, "eval EVAL", []int{0, 5}},
+		{"wide", "ab", []string{"wide"}, "ab a\x00b\x00", []int{3}},
+		{"wide ascii", "ab", []string{"wide", "ascii"}, "ab a\x00b\x00", []int{0, 3}},
+		{"fullword", "exec", []string{"fullword"}, "exec execve (exec)", []int{0, 13}},
+	}
+	for _, tt := range tests {
+		p, err := newTextPattern(tt.text, tt.modifiers)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := p.find(&file{data: []byte(tt.data)}); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %q in %q = %v, want %v", tt.name, tt.text, tt.data, got, tt.want)
+		}
+	}
+}
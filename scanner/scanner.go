@@ -4,15 +4,20 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/rhinocodelab/IntegrityWatchdog/config"
 	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
 	"github.com/rhinocodelab/IntegrityWatchdog/storage"
 )
 
+// maxLinks bounds the symlinks followed when resolving a path under a root
+const maxLinks = 40
+
 // Scanner represents a file system scanner
 type Scanner struct {
 	config *config.Config
+	root   string // directory the monitored paths are read below; "" for /
 }
 
 // NewScanner creates a new scanner with the given configuration
@@ -22,6 +27,37 @@ func NewScanner(cfg *config.Config) *Scanner {
 	}
 }
 
+// SetRoot makes the scanner read the monitored paths below root, such as a
+// mounted disk image or a chroot, while recording them as if root were /.
+// Symlinks are resolved within root.
+func (s *Scanner) SetRoot(root string) error {
+	if root == "" {
+		s.root = ""
+		return nil
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("invalid root %s: %v", root, err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return fmt.Errorf("invalid root: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("invalid root %s: not a directory", root)
+	}
+	if abs == "/" {
+		abs = ""
+	}
+	s.root = abs
+	return nil
+}
+
+// Root returns the directory the monitored paths are read below, or "" for /
+func (s *Scanner) Root() string {
+	return s.root
+}
+
 // ScanPaths scans all configured paths and returns a baseline
 func (s *Scanner) ScanPaths() (*storage.Baseline, error) {
 	baseline := storage.NewBaseline()
@@ -30,22 +66,39 @@ func (s *Scanner) ScanPaths() (*storage.Baseline, error) {
 	for _, path := range s.config.Monitor.Paths {
 		// Check if the path is a symlink
 		realPath := path
-		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if s.root != "" {
+			// Symlinks in the parent directories must not be followed
+			// out of the root. Paths an image lacks are skipped, as when
+			// reading archives.
+			dir, err := s.Resolve(filepath.Dir(path))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s: %v", path, err)
+			}
+			realPath = filepath.Join(dir, filepath.Base(path))
+			if _, err := os.Lstat(s.physical(realPath)); os.IsNotExist(err) {
+				continue
+			}
+		}
+		if info, err := os.Lstat(s.physical(realPath)); err == nil && info.Mode()&os.ModeSymlink != 0 {
 			// Resolve the symlink
 			var err error
-			realPath, err = filepath.EvalSymlinks(path)
+			realPath, err = s.Resolve(realPath)
 			if err != nil {
 				return nil, fmt.Errorf("failed to resolve symlink %s: %v", path, err)
 			}
 		}
 
-		if err := filepath.Walk(realPath, func(path string, info os.FileInfo, err error) error {
+		if err := filepath.Walk(s.physical(realPath), func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
 
 			// Skip excluded paths
-			if s.config.IsExcluded(path) {
+			logical := s.logical(path)
+			if s.config.IsExcluded(logical) {
 				if info.IsDir() {
 					return filepath.SkipDir
 				}
@@ -57,6 +110,9 @@ func (s *Scanner) ScanPaths() (*storage.Baseline, error) {
 			if err != nil {
 				return err
 			}
+			if s.root != "" {
+				s.relocate(fileInfo, logical)
+			}
 
 			baseline.AddFile(fileInfo)
 			return nil
@@ -67,3 +123,84 @@ func (s *Scanner) ScanPaths() (*storage.Baseline, error) {
 
 	return baseline, nil
 }
+
+// Resolve returns a monitored path with all symlinks resolved. Under a
+// root, absolute link targets are taken relative to the root and the
+// result is a path as seen from inside it.
+func (s *Scanner) Resolve(path string) (string, error) {
+	if s.root == "" {
+		return filepath.EvalSymlinks(path)
+	}
+
+	resolved := "/"
+	pending := strings.Split(path, "/")
+	for links := 0; len(pending) > 0; {
+		name := pending[0]
+		pending = pending[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			// ".." of the root is the root itself, so links cannot
+			// escape it
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, name)
+		info, err := os.Lstat(s.physical(next))
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		if links++; links > maxLinks {
+			return "", fmt.Errorf("too many levels of symbolic links: %s", path)
+		}
+		target, err := os.Readlink(s.physical(next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		pending = append(strings.Split(target, "/"), pending...)
+	}
+	return resolved, nil
+}
+
+// relocate records a file read below the root under its path inside the
+// root
+func (s *Scanner) relocate(info *monitor.FileInfo, logical string) {
+	info.Source = s.physical(logical)
+	info.Path = logical
+	if info.IsSymlink {
+		// Symlinks are recorded with their target, as for live scans
+		if target, err := s.Resolve(logical); err == nil {
+			info.Path = fmt.Sprintf("%s -> %s", logical, target)
+		}
+	}
+}
+
+// physical returns where a path inside the root is found on this system
+func (s *Scanner) physical(path string) string {
+	if s.root == "" {
+		return path
+	}
+	return filepath.Join(s.root, filepath.Clean("/"+path))
+}
+
+// logical returns the path inside the root of a path found below it
+func (s *Scanner) logical(path string) string {
+	if s.root == "" {
+		return path
+	}
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil || rel == "." {
+		return "/"
+	}
+	return "/" + filepath.ToSlash(rel)
+}
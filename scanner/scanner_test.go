@@ -0,0 +1,125 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+)
+
+// setupRoot creates an image below dir/root whose symlinks point at
+// dir/outside in every way they could, and returns the root
+func setupRoot(t *testing.T, dir string) string {
+	t.Helper()
+	root := filepath.Join(dir, "root")
+	for _, name := range []string{"root/etc", "root/usr/lib", "outside/conf"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"root/etc/hosts":      "127.0.0.1 localhost",
+		"root/usr/lib/mod.so": "mod",
+		"outside/secret":      "secret",
+		"outside/conf/x":      "x",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"root/etc/abs":    "/etc/hosts",
+		"root/etc/up":     "../../../../etc/hosts",
+		"root/etc/secret": filepath.Join(dir, "outside", "secret"),
+		"root/etc/out":    "../../outside/secret",
+		"root/etc/loop":   "loop",
+		"root/lib":        "/usr/lib",
+		"root/conf":       "../outside/conf",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestResolveStaysInRoot(t *testing.T) {
+	s := NewScanner(config.DefaultConfig())
+	if err := s.SetRoot(setupRoot(t, t.TempDir())); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string // "" if the path cannot be resolved
+	}{
+		{"/etc/hosts", "/etc/hosts"},
+		{"/etc/abs", "/etc/hosts"},
+		{"/etc/up", "/etc/hosts"},
+		{"/../../etc/hosts", "/etc/hosts"},
+		{"/lib/mod.so", "/usr/lib/mod.so"},
+		{"/etc/secret", ""},
+		{"/etc/out", ""},
+		{"/conf/x", ""},
+		{"/etc/loop", ""},
+	}
+	for _, tt := range tests {
+		got, err := s.Resolve(tt.path)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("Resolve(%s) = %s, want an error", tt.path, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Resolve(%s) = %s, %v; want %s", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestScanPathsBelowRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := setupRoot(t, dir)
+	cfg := config.DefaultConfig()
+	cfg.Monitor.Paths = []string{"/etc", "/lib", "/conf/x", "/opt/missing"}
+	s := NewScanner(cfg)
+	if err := s.SetRoot(root); err != nil {
+		t.Fatal(err)
+	}
+
+	baseline, err := s.ScanPaths()
+	if err != nil {
+		t.Fatalf("ScanPaths: %v", err)
+	}
+
+	// Paths are recorded as seen from inside the root, links that would
+	// leave it without a target, and paths the image lacks not at all
+	var keys []string
+	for key, info := range baseline.Files {
+		keys = append(keys, key)
+		if !strings.HasPrefix(info.SourcePath(), root+"/") {
+			t.Errorf("%s read from %s, outside the root", key, info.SourcePath())
+		}
+	}
+	sort.Strings(keys)
+	want := []string{
+		"/etc",
+		"/etc/abs -> /etc/hosts",
+		"/etc/hosts",
+		"/etc/loop",
+		"/etc/out",
+		"/etc/secret",
+		"/etc/up -> /etc/hosts",
+		"/usr/lib",
+		"/usr/lib/mod.so",
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("recorded\n%s\nwant\n%s", strings.Join(keys, "\n"), strings.Join(want, "\n"))
+	}
+}
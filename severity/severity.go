@@ -0,0 +1,204 @@
+package severity
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// Kinds of change that rules can match on
+const (
+	KindAdded         = "added"
+	KindDeleted       = "deleted"
+	KindContent       = "content"
+	KindPermission    = "permission"
+	KindOwnership     = "ownership"
+	KindSetuid        = "setuid"         // setuid or setgid bit gained
+	KindWorldWritable = "world_writable" // write permission for others gained
+	KindExecutable    = "executable"     // new executable file
+)
+
+// ValidKinds lists every kind a rule may name
+var ValidKinds = []string{
+	KindAdded, KindDeleted, KindContent, KindPermission, KindOwnership,
+	KindSetuid, KindWorldWritable, KindExecutable,
+}
+
+// Rule assigns a severity to changes matching path globs and kinds
+type Rule struct {
+	Name     string
+	Paths    []string
+	Kinds    []string
+	Severity monitor.Severity
+}
+
+// Classifier assigns a severity to each change. The most severe matching
+// rule or heuristic wins; changes nothing matches get the default.
+type Classifier struct {
+	rules      []*Rule
+	fallback   monitor.Severity
+	heuristics bool
+}
+
+// NewClassifier creates a classifier from the [severity] configuration
+func NewClassifier(cfg *config.Config) (*Classifier, error) {
+	fallback, err := monitor.ParseSeverity(cfg.Severity.Default)
+	if err != nil {
+		return nil, fmt.Errorf("invalid [severity] default: %v", err)
+	}
+
+	names := make([]string, 0, len(cfg.Severity.Rules))
+	for name := range cfg.Severity.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rules := make([]*Rule, 0, len(names))
+	for _, name := range names {
+		r := cfg.Severity.Rules[name]
+		level, err := monitor.ParseSeverity(r.Level)
+		if err != nil {
+			return nil, fmt.Errorf("severity rule %s: %v", name, err)
+		}
+		for _, kind := range r.Kinds {
+			if !validKind(kind) {
+				return nil, fmt.Errorf("severity rule %s: unknown change kind %q", name, kind)
+			}
+		}
+		rules = append(rules, &Rule{
+			Name:     name,
+			Paths:    r.Paths,
+			Kinds:    r.Kinds,
+			Severity: level,
+		})
+	}
+
+	return &Classifier{
+		rules:      rules,
+		fallback:   fallback,
+		heuristics: cfg.Severity.Heuristics,
+	}, nil
+}
+
+// Classify sets the kinds and severity of every change
+func (c *Classifier) Classify(changes []*monitor.Change) {
+	for _, change := range changes {
+		change.Kinds = Kinds(change)
+		change.Severity = c.Severity(change)
+	}
+}
+
+// Severity returns the severity of a single change
+func (c *Classifier) Severity(change *monitor.Change) monitor.Severity {
+	kinds := change.Kinds
+	if kinds == nil {
+		kinds = Kinds(change)
+	}
+
+	severity := monitor.SeverityNone
+	for _, rule := range c.rules {
+		if rule.Severity > severity && rule.matches(change.Path, kinds) {
+			severity = rule.Severity
+		}
+	}
+
+	if c.heuristics {
+		for _, kind := range kinds {
+			if h := heuristic(kind); h > severity {
+				severity = h
+			}
+		}
+	}
+
+	if severity == monitor.SeverityNone {
+		severity = c.fallback
+	}
+	return severity
+}
+
+// matches reports whether the rule applies to a change of the given kinds
+func (r *Rule) matches(path string, kinds []string) bool {
+	if len(r.Paths) > 0 && !config.MatchAny(r.Paths, path) {
+		return false
+	}
+	if len(r.Kinds) == 0 {
+		return true
+	}
+	for _, want := range r.Kinds {
+		for _, kind := range kinds {
+			if want == kind {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// heuristic returns the built-in severity of a kind of change
+func heuristic(kind string) monitor.Severity {
+	switch kind {
+	case KindSetuid:
+		return monitor.SeverityCritical
+	case KindWorldWritable:
+		return monitor.SeverityHigh
+	case KindExecutable:
+		return monitor.SeverityMedium
+	default:
+		return monitor.SeverityNone
+	}
+}
+
+// Kinds describes what changed about a file
+func Kinds(change *monitor.Change) []string {
+	old, cur := change.OldInfo, change.NewInfo
+	kinds := make([]string, 0, 4)
+
+	switch {
+	case old == nil && cur != nil:
+		kinds = append(kinds, KindAdded)
+		if !cur.IsDir && !cur.IsSymlink && cur.UnixPerm()&0o111 != 0 {
+			kinds = append(kinds, KindExecutable)
+		}
+	case old != nil && cur == nil:
+		return append(kinds, KindDeleted)
+	case old == nil && cur == nil:
+		return kinds
+	default:
+		if old.Hash != cur.Hash || old.Size != cur.Size {
+			kinds = append(kinds, KindContent)
+		}
+		if old.Mode != cur.Mode {
+			kinds = append(kinds, KindPermission)
+		}
+		if old.UID != cur.UID || old.GID != cur.GID {
+			kinds = append(kinds, KindOwnership)
+		}
+	}
+
+	// Dangerous permission bits gained, either by a new file or a chmod
+	var oldPerm uint32
+	if old != nil {
+		oldPerm = old.UnixPerm()
+	}
+	newPerm := cur.UnixPerm()
+	if newPerm&0o6000 != 0 && newPerm&0o6000&^oldPerm != 0 {
+		kinds = append(kinds, KindSetuid)
+	}
+	if !cur.IsSymlink && newPerm&0o002 != 0 && oldPerm&0o002 == 0 {
+		kinds = append(kinds, KindWorldWritable)
+	}
+
+	return kinds
+}
+
+// validKind reports whether kind is a known change kind
+func validKind(kind string) bool {
+	for _, k := range ValidKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package severity
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/config"
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// file returns the state of a regular file with the given mode
+func file(mode os.FileMode) *monitor.FileInfo {
+	return &monitor.FileInfo{Path: "f", Mode: uint32(mode), Hash: "a", Size: 1}
+}
+
+// chmod returns a change of the mode of a file
+func chmod(path string, from, to os.FileMode) *monitor.Change {
+	return &monitor.Change{Path: path, OldInfo: file(from), NewInfo: file(to)}
+}
+
+// edit returns a change of the content of a file
+func edit(path string) *monitor.Change {
+	cur := file(0644)
+	cur.Hash = "b"
+	return &monitor.Change{Path: path, OldInfo: file(0644), NewInfo: cur}
+}
+
+// add returns the addition of a file
+func add(path string, info *monitor.FileInfo) *monitor.Change {
+	return &monitor.Change{Path: path, NewInfo: info}
+}
+
+func TestKinds(t *testing.T) {
+	dir := &monitor.FileInfo{IsDir: true, Mode: uint32(os.ModeDir | 0777)}
+	link := &monitor.FileInfo{IsSymlink: true, Mode: uint32(os.ModeSymlink | 0777)}
+	owned := file(0644)
+	owned.UID = 1000
+
+	tests := []struct {
+		name   string
+		change *monitor.Change
+		want   []string
+	}{
+		{"new file", add("f", file(0644)), []string{KindAdded}},
+		{"new executable", add("f", file(0755)), []string{KindAdded, KindExecutable}},
+		{"new setuid executable", add("f", file(os.ModeSetuid|0755)), []string{KindAdded, KindExecutable, KindSetuid}},
+		{"new world-writable directory", add("d", dir), []string{KindAdded, KindWorldWritable}},
+		{"new symlink", add("l", link), []string{KindAdded}},
+		{"deleted", &monitor.Change{Path: "f", OldInfo: file(0644)}, []string{KindDeleted}},
+		{"content", edit("f"), []string{KindContent}},
+		{"chmod", chmod("f", 0644, 0600), []string{KindPermission}},
+		{"setgid gained", chmod("f", 0755, os.ModeSetgid|0755), []string{KindPermission, KindSetuid}},
+		{"setuid kept", chmod("f", os.ModeSetuid|0755, os.ModeSetuid|0750), []string{KindPermission}},
+		{"world-writable gained", chmod("f", 0644, 0666), []string{KindPermission, KindWorldWritable}},
+		{"world-writable kept", chmod("f", 0666, 0667), []string{KindPermission}},
+		{"chown", &monitor.Change{Path: "f", OldInfo: file(0644), NewInfo: owned}, []string{KindOwnership}},
+	}
+	for _, tt := range tests {
+		if got := Kinds(tt.change); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: kinds %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Severity.Default = "info"
+	cfg.Severity.Rules = map[string]config.SeverityRule{
+		"etc":    {Paths: []string{"/etc/**"}, Level: "low"},
+		"shadow": {Paths: []string{"/etc/shadow"}, Level: "critical"},
+		"perms":  {Paths: []string{"/etc/**"}, Kinds: []string{KindPermission, KindOwnership}, Level: "high"},
+		"bin":    {Paths: []string{"/usr/bin/*"}, Kinds: []string{KindAdded}, Level: "high"},
+	}
+
+	tests := []struct {
+		name       string
+		change     *monitor.Change
+		heuristics monitor.Severity // with the heuristics on
+		rules      monitor.Severity // with rules only
+	}{
+		{"rule by path", edit("/etc/hosts"), monitor.SeverityLow, monitor.SeverityLow},
+		{"most severe path rule", edit("/etc/shadow"), monitor.SeverityCritical, monitor.SeverityCritical},
+		{"most severe kind rule", chmod("/etc/hosts", 0644, 0640), monitor.SeverityHigh, monitor.SeverityHigh},
+		{"rule above heuristic", add("/usr/bin/tool", file(0755)), monitor.SeverityHigh, monitor.SeverityHigh},
+		{"no match", edit("/opt/app/conf"), monitor.SeverityInfo, monitor.SeverityInfo},
+		{"new executable", add("/opt/app/tool", file(0755)), monitor.SeverityMedium, monitor.SeverityInfo},
+		{"setuid gained", chmod("/opt/app/tool", 0755, os.ModeSetuid|0755), monitor.SeverityCritical, monitor.SeverityInfo},
+		{"heuristic above rule", chmod("/etc/hosts", 0644, os.ModeSetuid|0644), monitor.SeverityCritical, monitor.SeverityHigh},
+		{"world-writable gained", chmod("/opt/app/conf", 0644, 0666), monitor.SeverityHigh, monitor.SeverityInfo},
+		{"world-writable under a permission rule", chmod("/etc/hosts", 0644, 0666), monitor.SeverityHigh, monitor.SeverityHigh},
+	}
+	for _, heuristics := range []bool{true, false} {
+		cfg.Severity.Heuristics = heuristics
+		c, err := NewClassifier(cfg)
+		if err != nil {
+			t.Fatalf("NewClassifier: %v", err)
+		}
+		for _, tt := range tests {
+			want := tt.rules
+			if heuristics {
+				want = tt.heuristics
+			}
+			c.Classify([]*monitor.Change{tt.change})
+			if tt.change.Severity != want {
+				t.Errorf("%s with heuristics %v: %s, want %s", tt.name, heuristics, tt.change.Severity, want)
+			}
+		}
+	}
+}
+
+func TestNewClassifierRejectsUnknownKinds(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Severity.Rules = map[string]config.SeverityRule{
+		"typo": {Kinds: []string{"setuid", "world-writable"}, Level: "high"},
+	}
+	if _, err := NewClassifier(cfg); err == nil {
+		t.Error("rule with an unknown kind accepted")
+	}
+}
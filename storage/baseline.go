@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
@@ -15,7 +16,14 @@ type Baseline struct {
 	Files     map[string]*monitor.FileInfo `json:"files"`
 	CreatedAt time.Time                    `json:"created_at"`
 	UpdatedAt time.Time                    `json:"updated_at"`
-	mu        sync.RWMutex
+
+	// Root is the digest of all entries, from the Merkle digests of the
+	// directories. It is recomputed by RootDigest and when the baseline is
+	// saved.
+	Root string `json:"root_digest,omitempty"`
+
+	tree *tree
+	mu   sync.RWMutex
 }
 
 // Changes represents the differences between two baselines
@@ -23,6 +31,41 @@ type Changes struct {
 	Added    []*monitor.FileInfo `json:"added"`
 	Modified []*monitor.FileInfo `json:"modified"`
 	Deleted  []*monitor.FileInfo `json:"deleted"`
+	Details  []*monitor.Change   `json:"details,omitempty"`
+}
+
+// Filter returns the changes for which keep returns true
+func (c *Changes) Filter(keep func(*monitor.Change) bool) *Changes {
+	filtered := &Changes{
+		Added:    make([]*monitor.FileInfo, 0),
+		Modified: make([]*monitor.FileInfo, 0),
+		Deleted:  make([]*monitor.FileInfo, 0),
+		Details:  make([]*monitor.Change, 0),
+	}
+	for _, change := range c.Details {
+		if keep(change) {
+			filtered.Add(change)
+		}
+	}
+	return filtered
+}
+
+// Add appends a change to the details and to the list of its type
+func (c *Changes) Add(change *monitor.Change) {
+	c.Details = append(c.Details, change)
+	switch change.Type {
+	case monitor.NewFile:
+		c.Added = append(c.Added, change.NewInfo)
+	case monitor.DeletedFile:
+		c.Deleted = append(c.Deleted, change.OldInfo)
+	default:
+		c.Modified = append(c.Modified, change.NewInfo)
+	}
+}
+
+// Count returns the total number of changes
+func (c *Changes) Count() int {
+	return len(c.Added) + len(c.Modified) + len(c.Deleted)
 }
 
 // NewBaseline creates a new baseline
@@ -41,6 +84,7 @@ func (b *Baseline) AddFile(info *monitor.FileInfo) {
 
 	b.Files[info.Path] = info
 	b.UpdatedAt = time.Now()
+	b.invalidate()
 }
 
 // GetFile retrieves file information from the baseline
@@ -59,13 +103,15 @@ func (b *Baseline) RemoveFile(path string) {
 
 	delete(b.Files, path)
 	b.UpdatedAt = time.Now()
+	b.invalidate()
 }
 
 // Save saves the baseline to a JSON file
 func (b *Baseline) Save(filepath string) error {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
+	b.updateDigests()
 	data, err := json.MarshalIndent(b, "", "  ")
 	if err != nil {
 		return err
@@ -98,35 +144,90 @@ func GetDefaultBaselinePath() string {
 	return filepath.Join(homeDir, ".fim", "baseline.json")
 }
 
-// Compare compares this baseline with another baseline and returns the changes
+// Compare compares this baseline with another baseline and returns the
+// changes. Where the digests of both have been prepared, by PrepareDigests
+// or RootDigest, subtrees whose directory digests match are skipped.
 func (b *Baseline) Compare(other *Baseline) *Changes {
 	changes := &Changes{
 		Added:    make([]*monitor.FileInfo, 0),
 		Modified: make([]*monitor.FileInfo, 0),
 		Deleted:  make([]*monitor.FileInfo, 0),
+		Details:  make([]*monitor.Change, 0),
+	}
+	now := time.Now()
+
+	// Added and modified files are among the entries of the other
+	// baseline, deleted ones among those of this one
+	added, deleted := sortedPaths(other.Files), sortedPaths(b.Files)
+	if paths, ok := b.candidates(other); ok {
+		added, deleted = paths, paths
 	}
 
 	// Check for added and modified files
-	for path, otherFile := range other.Files {
+	for _, path := range added {
+		otherFile, exists := other.Files[path]
+		if !exists {
+			continue
+		}
 		baselineFile, exists := b.Files[path]
 		if !exists {
 			// File is new
 			changes.Added = append(changes.Added, otherFile)
+			changes.Details = append(changes.Details, &monitor.Change{
+				Path:      path,
+				Type:      monitor.NewFile,
+				NewInfo:   otherFile,
+				Timestamp: now,
+			})
 		} else {
 			// Check if file is modified
 			if !baselineFile.Equals(otherFile) {
 				changes.Modified = append(changes.Modified, otherFile)
+
+				changeType := monitor.CompareFiles(baselineFile, otherFile)
+				if changeType == monitor.NoChange {
+					// Only size or modification time differ
+					changeType = monitor.ModifiedFile
+				}
+				changes.Details = append(changes.Details, &monitor.Change{
+					Path:      path,
+					Type:      changeType,
+					OldInfo:   baselineFile,
+					NewInfo:   otherFile,
+					Timestamp: now,
+				})
 			}
 		}
 	}
 
 	// Check for deleted files
-	for path, baselineFile := range b.Files {
+	for _, path := range deleted {
+		baselineFile, exists := b.Files[path]
+		if !exists {
+			continue
+		}
 		if _, exists := other.Files[path]; !exists {
 			// File is deleted
 			changes.Deleted = append(changes.Deleted, baselineFile)
+			changes.Details = append(changes.Details, &monitor.Change{
+				Path:      path,
+				Type:      monitor.DeletedFile,
+				OldInfo:   baselineFile,
+				Timestamp: now,
+			})
 		}
 	}
 
 	return changes
 }
+
+// sortedPaths returns the keys of a file map in lexical order so that
+// comparisons report changes in a stable order
+func sortedPaths(files map[string]*monitor.FileInfo) []string {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
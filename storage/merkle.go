@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// tree links the entries of a baseline to the directories holding them.
+// Entries whose parent directory is not in the baseline, such as the
+// monitored paths themselves, are roots.
+type tree struct {
+	roots    []string
+	children map[string][]string
+	digests  map[string]string // Merkle digests of the directories
+}
+
+// RootDigest returns the digest summarising every entry of the baseline,
+// computing the directory digests if they are not current
+func (b *Baseline) RootDigest() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.updateDigests()
+	return b.Root
+}
+
+// PrepareDigests computes the directory digests if they are not current.
+// Comparing two baselines whose digests have been prepared only lists the
+// entries below directories whose digests differ.
+func (b *Baseline) PrepareDigests() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.updateDigests()
+}
+
+// updateDigests computes the Merkle digest of every directory from the
+// attributes of its own entry and the digests of its children, and the
+// root digest from those of the roots. The caller holds the write lock.
+func (b *Baseline) updateDigests() {
+	if b.tree != nil {
+		return
+	}
+	t := buildTree(b.Files)
+
+	var digest func(key string) []byte
+	digest = func(key string) []byte {
+		info := b.Files[key]
+		h := sha256.New()
+		size := info.Size
+		if info.IsDir {
+			// As in Equals, the size of a directory is not compared
+			size = 0
+		}
+		fmt.Fprintf(h, "%s\x00%t\x00%t\x00%d\x00%d\x00%d\x00%d\x00%d\x00%s\x00",
+			key, info.IsDir, info.IsSymlink, info.Mode, info.UID, info.GID, info.ModTime, size, info.Hash)
+		for _, child := range t.children[key] {
+			h.Write(digest(child))
+		}
+		sum := h.Sum(nil)
+		if info.IsDir {
+			t.digests[key] = hex.EncodeToString(sum)
+		}
+		return sum
+	}
+
+	h := sha256.New()
+	for _, root := range t.roots {
+		h.Write(digest(root))
+	}
+	b.Root = hex.EncodeToString(h.Sum(nil))
+	b.tree = t
+}
+
+// invalidate marks the digests as out of date after an entry changed.
+// The caller holds the write lock.
+func (b *Baseline) invalidate() {
+	b.tree = nil
+	b.Root = ""
+}
+
+// buildTree finds the parent directory of every entry, listing the
+// children of each directory in lexical order
+func buildTree(files map[string]*monitor.FileInfo) *tree {
+	t := &tree{children: make(map[string][]string), digests: make(map[string]string)}
+	for _, key := range sortedPaths(files) {
+		if parent, ok := parentKey(files, key); ok {
+			t.children[parent] = append(t.children[parent], key)
+		} else {
+			t.roots = append(t.roots, key)
+		}
+	}
+	return t
+}
+
+// parentKey returns the key of the directory holding an entry, if it is
+// in the baseline. Symlinks are keyed as "path -> target".
+func parentKey(files map[string]*monitor.FileInfo, key string) (string, bool) {
+	path := key
+	if files[key].IsSymlink {
+		path, _, _ = strings.Cut(key, " -> ")
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return "", false
+	}
+	info, ok := files[parent]
+	if !ok || !info.IsDir {
+		return "", false
+	}
+	return parent, true
+}
+
+// candidates returns the keys of either baseline that may differ between
+// them, in lexical order. Directories with the same digest on both sides
+// are identical down to the last entry, so neither they nor anything
+// below them is listed. Computing the digests takes as long as comparing
+// every entry, so false is returned unless both baselines already have
+// them.
+func (b *Baseline) candidates(other *Baseline) ([]string, bool) {
+	old, cur := b.tree, other.tree
+	if old == nil || cur == nil {
+		return nil, false
+	}
+	if b.Root == other.Root {
+		return nil, true
+	}
+
+	seen := make(map[string]bool)
+	var keys []string
+	var visit func(key string)
+	visit = func(key string) {
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		digest, ok := old.digests[key]
+		if ok && digest == cur.digests[key] {
+			return
+		}
+		keys = append(keys, key)
+		for _, child := range old.children[key] {
+			visit(child)
+		}
+		for _, child := range cur.children[key] {
+			visit(child)
+		}
+	}
+	for _, root := range old.roots {
+		visit(root)
+	}
+	for _, root := range cur.roots {
+		visit(root)
+	}
+
+	sort.Strings(keys)
+	return keys, true
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rhinocodelab/IntegrityWatchdog/monitor"
+)
+
+// sample returns a baseline of two directories, with the content of
+// /etc/hosts given
+func sample(hosts string) *Baseline {
+	b := NewBaseline()
+	for _, info := range []*monitor.FileInfo{
+		{Path: "/etc", IsDir: true, Mode: uint32(os.ModeDir | 0755)},
+		{Path: "/etc/hosts", Size: 9, Mode: 0644, Hash: hosts},
+		{Path: "/etc/ssl", IsDir: true, Mode: uint32(os.ModeDir | 0755)},
+		{Path: "/etc/ssl/cert.pem", Size: 4, Mode: 0644, Hash: "cert"},
+		{Path: "/etc/ssl/link -> /etc/ssl/cert.pem", IsSymlink: true},
+	} {
+		b.AddFile(info)
+	}
+	return b
+}
+
+// paths returns the changed paths as "type path" lines
+func paths(changes *Changes) string {
+	var lines []string
+	for _, change := range changes.Details {
+		lines = append(lines, change.Type.String()+" "+change.Path)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestCompareWithAndWithoutDigests(t *testing.T) {
+	old := sample("a")
+	cur := sample("b")
+	cur.RemoveFile("/etc/ssl/cert.pem")
+	cur.AddFile(&monitor.FileInfo{Path: "/etc/ssl/new.pem", Hash: "new"})
+	want := "modified /etc/hosts\nadded /etc/ssl/new.pem\ndeleted /etc/ssl/cert.pem"
+
+	// Without cached digests every entry is compared
+	if got := paths(old.Compare(cur)); got != want {
+		t.Errorf("without digests:\n%s\nwant:\n%s", got, want)
+	}
+	if old.tree != nil || cur.tree != nil {
+		t.Error("Compare computed the digests")
+	}
+
+	old.PrepareDigests()
+	cur.PrepareDigests()
+	if got := paths(old.Compare(cur)); got != want {
+		t.Errorf("with digests:\n%s\nwant:\n%s", got, want)
+	}
+	if keys, ok := old.candidates(sample("a")); ok || keys != nil {
+		t.Error("digests of only one side were used")
+	}
+}
+
+func TestCandidatesSkipUnchangedDirectories(t *testing.T) {
+	old, cur := sample("a"), sample("b")
+	old.RootDigest()
+	cur.RootDigest()
+	keys, ok := old.candidates(cur)
+	if !ok || !reflect.DeepEqual(keys, []string{"/etc", "/etc/hosts"}) {
+		t.Errorf("candidates = %v, %v; want /etc and /etc/hosts", keys, ok)
+	}
+
+	same := sample("a")
+	same.RootDigest()
+	if keys, ok := old.candidates(same); !ok || len(keys) != 0 {
+		t.Errorf("identical baselines have candidates %v", keys)
+	}
+	if old.Root != same.Root || old.Root == cur.Root {
+		t.Error("root digests do not follow the content")
+	}
+}
+
+func TestDigestsAreNotSavedWithEntries(t *testing.T) {
+	b := sample("a")
+	path := t.TempDir() + "/baseline.json"
+	if err := b.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	var saved struct {
+		Files map[string]map[string]interface{} `json:"files"`
+		Root  string                            `json:"root_digest"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := saved.Files["/etc"]["digest"]; ok {
+		t.Error("directory digest saved in the entry")
+	}
+	if saved.Root == "" || saved.Root != b.RootDigest() {
+		t.Errorf("root digest %q, want %q", saved.Root, b.RootDigest())
+	}
+
+	// Changes are reported without digests
+	change, _ := json.Marshal(&monitor.Change{Path: "/etc", NewInfo: b.Files["/etc"]})
+	if strings.Contains(string(change), "digest") {
+		t.Errorf("change report holds a digest: %s", change)
+	}
+}